@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"database/sql"
+	"flag"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
@@ -12,12 +14,18 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	_ "github.com/mattn/go-sqlite3"
-	"github.com/juthrbog/adversarytracker/internal/app"
+	appdb "github.com/juthrbog/adversarytracker/db"
+	"github.com/juthrbog/adversarytracker/internal/srd"
 	"github.com/juthrbog/adversarytracker/web/handlers"
+	_ "github.com/mattn/go-sqlite3"
 )
 
 func main() {
+	// Command-line flags
+	migrateDryRun := flag.Bool("migrate-dry-run", false, "print pending schema migrations and exit without applying them")
+	seedSRD := flag.Bool("seed-srd", false, "seed the bestiary with the SRD adversary library and exit")
+	flag.Parse()
+
 	// Setup logger
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	slog.SetDefault(logger)
@@ -30,8 +38,37 @@ func main() {
 	}
 	defer db.Close()
 
-	// Store DB in app context
-	app.DB = db
+	if *migrateDryRun {
+		if err := printPendingMigrations(db); err != nil {
+			logger.Error("Failed to check schema migrations", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Bring the schema up to date
+	if err := initSchema(db); err != nil {
+		logger.Error("Failed to migrate database", "error", err)
+		os.Exit(1)
+	}
+
+	if *seedSRD {
+		if err := seedLibrary(db); err != nil {
+			logger.Error("Failed to seed SRD library", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Adversaries and encounters are reached through the stores; combat
+	// handlers still query the database directly
+	store := appdb.NewSQLiteStore(db)
+	srv := &handlers.Server{
+		Adversaries: store,
+		Encounters:  store,
+		DB:          db,
+		Events:      handlers.NewCombatEvents(),
+	}
 
 	// Setup router
 	r := chi.NewRouter()
@@ -48,11 +85,22 @@ func main() {
 	r.Handle("/static/*", http.StripPrefix("/static", fileServer))
 
 	// Routes
-	r.Get("/", handlers.Home)
-	
+	r.Get("/", srv.Home)
+
 	// Mount other routes
-	r.Mount("/adversaries", handlers.AdversaryRoutes())
-	r.Mount("/encounters", handlers.EncounterRoutes())
+	r.Mount("/adversaries", srv.AdversaryRoutes())
+	r.Mount("/encounters", srv.EncounterRoutes())
+	r.Mount("/library", srv.LibraryRoutes())
+	r.Mount("/play", srv.PlayerRoutes())
+
+	// JSON API and its OpenAPI document
+	api, err := srv.APIRoutes()
+	if err != nil {
+		logger.Error("Failed to build API routes", "error", err)
+		os.Exit(1)
+	}
+	r.Mount("/api/v1", api)
+	r.Get("/api/openapi.json", handlers.OpenAPIDocument(api))
 
 	// Start server
 	server := &http.Server{
@@ -60,6 +108,9 @@ func main() {
 		Handler: r,
 	}
 
+	// Shutdown waits for open requests, so end the combat event streams
+	server.RegisterOnShutdown(srv.Events.Close)
+
 	// Server run context
 	serverCtx, serverStopCtx := context.WithCancel(context.Background())
 
@@ -70,7 +121,8 @@ func main() {
 		<-sig
 
 		// Shutdown signal with grace period of 30 seconds
-		shutdownCtx, _ := context.WithTimeout(serverCtx, 30*time.Second)
+		shutdownCtx, shutdownCancel := context.WithTimeout(serverCtx, 30*time.Second)
+		defer shutdownCancel()
 
 		go func() {
 			<-shutdownCtx.Done()
@@ -108,7 +160,12 @@ func initDB() (*sql.DB, error) {
 	}
 
 	// Open SQLite database
-	db, err := sql.Open("sqlite3", "./data/app.db")
+	// Foreign keys are off by default in SQLite; the schema relies on
+	// ON DELETE CASCADE to clean up features and encounter memberships.
+	// Transactions take the write lock as they begin, so that those that
+	// read a combatant before changing it wait their turn rather than fail
+	// when two requests change it at once.
+	db, err := sql.Open("sqlite3", "./data/app.db?_foreign_keys=on&_txlock=immediate")
 	if err != nil {
 		return nil, err
 	}
@@ -118,22 +175,55 @@ func initDB() (*sql.DB, error) {
 		return nil, err
 	}
 
-	// Initialize schema
-	if err := initSchema(db); err != nil {
-		return nil, err
-	}
-
 	return db, nil
 }
 
 func initSchema(db *sql.DB) error {
-	// Read schema SQL from file
-	schemaSQL, err := os.ReadFile("./db/schema.sql")
+	// Apply pending migrations; this refuses to run against a database
+	// written by a newer release
+	applied, err := appdb.Migrate(context.Background(), db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range applied {
+		slog.Info("Applied schema migration", "version", m.Version, "name", m.Name)
+	}
+
+	// The search index needs FTS5, so it lives outside the migrations
+	return appdb.EnsureSearchIndex(context.Background(), db)
+}
+
+func seedLibrary(db *sql.DB) error {
+	library, err := srd.Adversaries()
 	if err != nil {
 		return err
 	}
 
-	// Execute schema SQL
-	_, err = db.Exec(string(schemaSQL))
-	return err
+	created, updated, err := appdb.SeedLibrary(context.Background(), db, library.DBAdversaries())
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Seeded SRD library", "created", created, "updated", updated)
+	return nil
+}
+
+func printPendingMigrations(db *sql.DB) error {
+	pending, err := appdb.PendingMigrations(context.Background(), db)
+	if err != nil {
+		return err
+	}
+
+	if len(pending) == 0 {
+		fmt.Println("Database schema is up to date")
+		return nil
+	}
+
+	fmt.Printf("%d pending schema migration(s):\n", len(pending))
+	for _, m := range pending {
+		fmt.Printf("  %04d_%s\n", m.Version, m.Name)
+	}
+
+	return nil
 }
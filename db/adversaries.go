@@ -3,90 +3,210 @@ package db
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"strings"
 	"time"
 )
 
+// Adversary roles as printed on Daggerheart statblocks
+const (
+	RoleBruiser  = "Bruiser"
+	RoleHorde    = "Horde"
+	RoleLeader   = "Leader"
+	RoleMinion   = "Minion"
+	RoleRanged   = "Ranged"
+	RoleSkulk    = "Skulk"
+	RoleSocial   = "Social"
+	RoleSolo     = "Solo"
+	RoleStandard = "Standard"
+	RoleSupport  = "Support"
+)
+
+// Adversary sources. Homebrew adversaries are created in this install; SRD
+// adversaries are seeded from the bundled library and are read-only.
+const (
+	SourceHomebrew = "homebrew"
+	SourceSRD      = "srd"
+)
+
+// AdversaryRoles lists every valid adversary role in display order
+var AdversaryRoles = []string{
+	RoleBruiser, RoleHorde, RoleLeader, RoleMinion, RoleRanged,
+	RoleSkulk, RoleSocial, RoleSolo, RoleStandard, RoleSupport,
+}
+
 // Adversary represents a Daggerheart adversary entity
 type Adversary struct {
-	ID              int64
-	Name            string
-	Type            string
-	ChallengeRating string
-	Size            string
-	ArmorClass      int
-	HitPoints       int
-	Speed           string
-	Strength        int
-	Dexterity       int
-	Constitution    int
-	Intelligence    int
-	Wisdom          int
-	Charisma        int
-	Abilities       string
-	Actions         string
-	Reactions       string
-	Description     string
-	CreatedAt       time.Time
-	UpdatedAt       time.Time
-}
-
-// GetAllAdversaries retrieves all adversaries from the database
-func GetAllAdversaries(ctx context.Context, db *sql.DB) ([]*Adversary, error) {
+	ID              int64               `json:"id"`
+	Name            string              `json:"name"`
+	Type            string              `json:"type"`
+	Tier            int                 `json:"tier"`
+	Role            string              `json:"role"`
+	Difficulty      int                 `json:"difficulty"`
+	MajorThreshold  int                 `json:"major_threshold"`
+	SevereThreshold int                 `json:"severe_threshold"`
+	HitPoints       int                 `json:"hit_points"`
+	Stress          int                 `json:"stress"`
+	AttackModifier  int                 `json:"attack_modifier"`
+	AttackName      string              `json:"attack_name"`
+	AttackRange     string              `json:"attack_range"`
+	AttackDamage    string              `json:"attack_damage"`
+	DamageType      string              `json:"damage_type"`
+	Experiences     string              `json:"experiences"`
+	MotivesTactics  string              `json:"motives_tactics"`
+	Description     string              `json:"description"`
+	Source          string              `json:"source"`
+	Tags            string              `json:"tags"` // lowercase, comma-separated
+	CreatedAt       time.Time           `json:"created_at"`
+	UpdatedAt       time.Time           `json:"updated_at"`
+	Features        []*AdversaryFeature `json:"features,omitempty"`
+}
+
+// FormattedAttackModifier returns the attack modifier with an explicit sign, e.g. "+2"
+func (a *Adversary) FormattedAttackModifier() string {
+	return fmt.Sprintf("%+d", a.AttackModifier)
+}
+
+// Thresholds returns the damage thresholds as printed on a statblock, e.g. "8/15".
+// Adversaries without thresholds (such as Minions) return "None".
+func (a *Adversary) Thresholds() string {
+	if a.MajorThreshold == 0 && a.SevereThreshold == 0 {
+		return "None"
+	}
+	return fmt.Sprintf("%d/%d", a.MajorThreshold, a.SevereThreshold)
+}
+
+// ReadOnly reports whether the adversary comes from the SRD library and
+// cannot be edited or deleted
+func (a *Adversary) ReadOnly() bool {
+	return a.Source == SourceSRD
+}
+
+// TagList returns the adversary's tags
+func (a *Adversary) TagList() []string {
+	if a.Tags == "" {
+		return nil
+	}
+	return strings.Split(a.Tags, ",")
+}
+
+// HasTag reports whether the adversary has a tag, ignoring case
+func (a *Adversary) HasTag(tag string) bool {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	for _, t := range a.TagList() {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeTags cleans up a comma-separated tag list as typed by a user:
+// tags are trimmed and lowercased, and empty or repeated tags dropped, e.g.
+// " Undead, forest,undead" becomes "undead,forest"
+func NormalizeTags(tags string) string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, t := range strings.Split(tags, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	return strings.Join(out, ",")
+}
+
+// IsValidRole reports whether role is one of the Daggerheart adversary roles
+func IsValidRole(role string) bool {
+	for _, r := range AdversaryRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// adversaryColumns is the column list shared by every adversary query.
+// Queries must alias the adversaries table as "a".
+const adversaryColumns = `
+	a.id, a.name, a.type, a.tier, a.role, a.difficulty, a.major_threshold,
+	a.severe_threshold, a.hit_points, a.stress, a.attack_modifier, a.attack_name,
+	a.attack_range, a.attack_damage, a.damage_type, a.experiences, a.motives_tactics,
+	a.description, a.source, a.tags, a.created_at, a.updated_at`
+
+// adversaryScanDest returns the scan destinations matching adversaryColumns
+func adversaryScanDest(adv *Adversary) []interface{} {
+	return []interface{}{
+		&adv.ID, &adv.Name, &adv.Type, &adv.Tier, &adv.Role, &adv.Difficulty,
+		&adv.MajorThreshold, &adv.SevereThreshold, &adv.HitPoints, &adv.Stress,
+		&adv.AttackModifier, &adv.AttackName, &adv.AttackRange, &adv.AttackDamage,
+		&adv.DamageType, &adv.Experiences, &adv.MotivesTactics, &adv.Description,
+		&adv.Source, &adv.Tags, &adv.CreatedAt, &adv.UpdatedAt,
+	}
+}
+
+// GetAllAdversaries retrieves the adversaries matching opts, homebrew and
+// seeded SRD adversaries alike; Source tells them apart. When opts has a
+// limit, it also returns the cursor of the next page, or "" on the last.
+func GetAllAdversaries(ctx context.Context, db *sql.DB, opts ListOptions) ([]*Adversary, string, error) {
+	list, err := newListQuery(opts, adversarySorts, "a.id")
+	if err != nil {
+		return nil, "", err
+	}
+
+	where, args := adversaryFilters(opts)
+	if list.where != "" {
+		where = append(where, list.where)
+		args = append(args, list.args...)
+	}
+
 	query := `
-		SELECT id, name, type, challenge_rating, size, armor_class, hit_points, 
-		       speed, strength, dexterity, constitution, intelligence, wisdom, 
-		       charisma, abilities, actions, reactions, description, created_at, updated_at
-		FROM adversaries
-		ORDER BY name ASC
-	`
+		SELECT ` + adversaryColumns + `, ` + list.keyColumn() + `
+		FROM adversaries a` + whereClause(where) + list.suffix()
 
-	rows, err := db.QueryContext(ctx, query)
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer rows.Close()
 
 	var adversaries []*Adversary
+	var keys []string
 	for rows.Next() {
 		adv := &Adversary{}
-		err := rows.Scan(
-			&adv.ID, &adv.Name, &adv.Type, &adv.ChallengeRating, &adv.Size,
-			&adv.ArmorClass, &adv.HitPoints, &adv.Speed, &adv.Strength,
-			&adv.Dexterity, &adv.Constitution, &adv.Intelligence, &adv.Wisdom,
-			&adv.Charisma, &adv.Abilities, &adv.Actions, &adv.Reactions,
-			&adv.Description, &adv.CreatedAt, &adv.UpdatedAt,
-		)
-		if err != nil {
-			return nil, err
+		var key string
+		if err := rows.Scan(append(adversaryScanDest(adv), &key)...); err != nil {
+			return nil, "", err
 		}
 		adversaries = append(adversaries, adv)
+		keys = append(keys, key)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, "", err
+	}
+
+	// Drop the extra row fetched to detect a next page
+	if list.hasMore(len(adversaries)) {
+		last := list.limit - 1
+		return adversaries[:list.limit], list.cursorAfter(keys[last], adversaries[last].ID), nil
 	}
 
-	return adversaries, nil
+	return adversaries, "", nil
 }
 
-// GetAdversaryByID retrieves a single adversary by ID
+// GetAdversaryByID retrieves a single adversary by ID, including its features
 func GetAdversaryByID(ctx context.Context, db *sql.DB, id int64) (*Adversary, error) {
 	query := `
-		SELECT id, name, type, challenge_rating, size, armor_class, hit_points, 
-		       speed, strength, dexterity, constitution, intelligence, wisdom, 
-		       charisma, abilities, actions, reactions, description, created_at, updated_at
-		FROM adversaries
-		WHERE id = ?
+		SELECT ` + adversaryColumns + `
+		FROM adversaries a
+		WHERE a.id = ?
 	`
 
 	adv := &Adversary{}
-	err := db.QueryRowContext(ctx, query, id).Scan(
-		&adv.ID, &adv.Name, &adv.Type, &adv.ChallengeRating, &adv.Size,
-		&adv.ArmorClass, &adv.HitPoints, &adv.Speed, &adv.Strength,
-		&adv.Dexterity, &adv.Constitution, &adv.Intelligence, &adv.Wisdom,
-		&adv.Charisma, &adv.Abilities, &adv.Actions, &adv.Reactions,
-		&adv.Description, &adv.CreatedAt, &adv.UpdatedAt,
-	)
+	err := db.QueryRowContext(ctx, query, id).Scan(adversaryScanDest(adv)...)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -94,26 +214,51 @@ func GetAdversaryByID(ctx context.Context, db *sql.DB, id int64) (*Adversary, er
 		return nil, err
 	}
 
+	// Load features for the adversary
+	features, err := GetAdversaryFeatures(ctx, db, adv.ID)
+	if err != nil {
+		return nil, err
+	}
+	adv.Features = features
+
 	return adv, nil
 }
 
+// execer is implemented by both *sql.DB and *sql.Tx, for writes that run
+// on their own or as part of a larger transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
 // CreateAdversary inserts a new adversary into the database
 func CreateAdversary(ctx context.Context, db *sql.DB, adv *Adversary) (int64, error) {
+	return insertAdversary(ctx, db, adv)
+}
+
+// insertAdversary inserts an adversary's statblock, without its features.
+// Adversaries without a source are homebrew.
+func insertAdversary(ctx context.Context, db execer, adv *Adversary) (int64, error) {
 	query := `
 		INSERT INTO adversaries (
-			name, type, challenge_rating, size, armor_class, hit_points, 
-			speed, strength, dexterity, constitution, intelligence, wisdom, 
-			charisma, abilities, actions, reactions, description
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			name, type, tier, role, difficulty, major_threshold, severe_threshold,
+			hit_points, stress, attack_modifier, attack_name, attack_range,
+			attack_damage, damage_type, experiences, motives_tactics, description,
+			source, tags
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
+	source := adv.Source
+	if source == "" {
+		source = SourceHomebrew
+	}
+
 	result, err := db.ExecContext(
 		ctx, query,
-		adv.Name, adv.Type, adv.ChallengeRating, adv.Size,
-		adv.ArmorClass, adv.HitPoints, adv.Speed, adv.Strength,
-		adv.Dexterity, adv.Constitution, adv.Intelligence, adv.Wisdom,
-		adv.Charisma, adv.Abilities, adv.Actions, adv.Reactions,
-		adv.Description,
+		adv.Name, adv.Type, adv.Tier, adv.Role, adv.Difficulty,
+		adv.MajorThreshold, adv.SevereThreshold, adv.HitPoints, adv.Stress,
+		adv.AttackModifier, adv.AttackName, adv.AttackRange, adv.AttackDamage,
+		adv.DamageType, adv.Experiences, adv.MotivesTactics, adv.Description,
+		source, NormalizeTags(adv.Tags),
 	)
 	if err != nil {
 		return 0, err
@@ -124,23 +269,28 @@ func CreateAdversary(ctx context.Context, db *sql.DB, adv *Adversary) (int64, er
 
 // UpdateAdversary updates an existing adversary in the database
 func UpdateAdversary(ctx context.Context, db *sql.DB, adv *Adversary) error {
+	return updateAdversary(ctx, db, adv)
+}
+
+// updateAdversary updates an adversary's statblock, without its features
+func updateAdversary(ctx context.Context, db execer, adv *Adversary) error {
 	query := `
 		UPDATE adversaries
-		SET name = ?, type = ?, challenge_rating = ?, size = ?, 
-		    armor_class = ?, hit_points = ?, speed = ?, strength = ?, 
-		    dexterity = ?, constitution = ?, intelligence = ?, wisdom = ?, 
-		    charisma = ?, abilities = ?, actions = ?, reactions = ?, 
-		    description = ?, updated_at = CURRENT_TIMESTAMP
+		SET name = ?, type = ?, tier = ?, role = ?, difficulty = ?,
+		    major_threshold = ?, severe_threshold = ?, hit_points = ?, stress = ?,
+		    attack_modifier = ?, attack_name = ?, attack_range = ?, attack_damage = ?,
+		    damage_type = ?, experiences = ?, motives_tactics = ?,
+		    description = ?, tags = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
 
 	_, err := db.ExecContext(
 		ctx, query,
-		adv.Name, adv.Type, adv.ChallengeRating, adv.Size,
-		adv.ArmorClass, adv.HitPoints, adv.Speed, adv.Strength,
-		adv.Dexterity, adv.Constitution, adv.Intelligence, adv.Wisdom,
-		adv.Charisma, adv.Abilities, adv.Actions, adv.Reactions,
-		adv.Description, adv.ID,
+		adv.Name, adv.Type, adv.Tier, adv.Role, adv.Difficulty,
+		adv.MajorThreshold, adv.SevereThreshold, adv.HitPoints, adv.Stress,
+		adv.AttackModifier, adv.AttackName, adv.AttackRange, adv.AttackDamage,
+		adv.DamageType, adv.Experiences, adv.MotivesTactics,
+		adv.Description, NormalizeTags(adv.Tags), adv.ID,
 	)
 
 	return err
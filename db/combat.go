@@ -0,0 +1,659 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Combat session statuses
+const (
+	CombatActive = "active"
+	CombatEnded  = "ended"
+)
+
+// Spotlight holders
+const (
+	SpotlightPlayers = "players"
+	SpotlightGM      = "gm"
+)
+
+// Tracker modes. Narrative is the standard spotlight flow; the action
+// tracker is the optional variant where activations cost action tokens.
+const (
+	TrackerNarrative     = "narrative"
+	TrackerActionTracker = "action_tracker"
+)
+
+// TrackerModes lists the valid tracker modes
+var TrackerModes = []string{TrackerNarrative, TrackerActionTracker}
+
+// ErrNotGMTurn is returned when activating an adversary while the players
+// hold the spotlight
+var ErrNotGMTurn = errors.New("the players hold the spotlight")
+
+// ErrAlreadyActed is returned when activating an adversary twice in one GM turn
+var ErrAlreadyActed = errors.New("combatant has already acted this GM turn")
+
+// ErrDefeated is returned when activating an adversary that has been defeated
+var ErrDefeated = errors.New("combatant is defeated")
+
+// ErrNoActionTokens is returned when an activation costs more action tokens
+// than the session holds
+var ErrNoActionTokens = errors.New("not enough action tokens")
+
+// ErrNotEnoughStress is returned when a feature costs more Stress than the
+// combatant has left to mark
+var ErrNotEnoughStress = errors.New("not enough Stress left")
+
+// Conn is a database, or a transaction already under way. The combat
+// functions take one so that several changes to a fight, and the log entry
+// describing them, can be made in the same transaction (see ChangeCombat).
+type Conn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// inTx runs fn in db if it is a transaction already, and otherwise in a new
+// transaction that is committed if fn succeeds
+func inTx(ctx context.Context, db Conn, fn func(tx *sql.Tx) error) error {
+	if tx, ok := db.(*sql.Tx); ok {
+		return fn(tx)
+	}
+
+	conn, ok := db.(*sql.DB)
+	if !ok {
+		return fmt.Errorf("cannot begin a transaction on %T", db)
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CombatSession is a persisted run of an encounter's combat tracker
+type CombatSession struct {
+	ID           int64        `json:"id"`
+	EncounterID  int64        `json:"encounter_id"`
+	Status       string       `json:"status"`
+	Fear         int          `json:"fear"`
+	FearMax      int          `json:"fear_max"`
+	Spotlight    string       `json:"spotlight"`
+	GMTurn       int          `json:"gm_turn"` // number of GM turns taken so far
+	TrackerMode  string       `json:"tracker_mode"`
+	ActionTokens int          `json:"action_tokens"`
+	PlayerToken  string       `json:"player_token"` // names the session in its player view URL
+	StartedAt    time.Time    `json:"started_at"`
+	EndedAt      *time.Time   `json:"ended_at,omitempty"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+	Combatants   []*Combatant `json:"combatants,omitempty"`
+	Countdowns   []*Countdown `json:"countdowns,omitempty"` // countdowns not attached to a combatant
+}
+
+// FearSlots returns one entry per point of the Fear cap, true for each point
+// of Fear held, for rendering the Fear track
+func (s *CombatSession) FearSlots() []bool {
+	slots := make([]bool, s.FearMax)
+	for i := range slots {
+		slots[i] = i < s.Fear
+	}
+	return slots
+}
+
+// IsGMTurn reports whether the GM holds the spotlight
+func (s *CombatSession) IsGMTurn() bool {
+	return s.Spotlight == SpotlightGM
+}
+
+// ActedCount returns the number of combatants activated this GM turn
+func (s *CombatSession) ActedCount() int {
+	n := 0
+	for _, c := range s.Combatants {
+		if c.Acted {
+			n++
+		}
+	}
+	return n
+}
+
+// Combatant is a single adversary taking part in a combat session. Its stats
+// are copied from the adversary when the session starts.
+type Combatant struct {
+	ID              int64                 `json:"id"`
+	SessionID       int64                 `json:"session_id"`
+	AdversaryID     *int64                `json:"adversary_id"` // nil once the source adversary has been deleted
+	Position        int                   `json:"position"`
+	Name            string                `json:"name"`
+	Role            string                `json:"role"`
+	Difficulty      int                   `json:"difficulty"`
+	MajorThreshold  int                   `json:"major_threshold"`
+	SevereThreshold int                   `json:"severe_threshold"`
+	HPMax           int                   `json:"hp_max"`
+	HPMarked        int                   `json:"hp_marked"`
+	StressMax       int                   `json:"stress_max"`
+	StressMarked    int                   `json:"stress_marked"`
+	Acted           bool                  `json:"acted"` // whether the combatant has acted this GM turn
+	Conditions      []*CombatantCondition `json:"conditions,omitempty"`
+	Countdowns      []*Countdown          `json:"countdowns,omitempty"`
+}
+
+// Defeated reports whether the combatant has marked all of its HP
+func (c *Combatant) Defeated() bool {
+	return c.HPMarked >= c.HPMax
+}
+
+// HPSlots returns one entry per HP slot, true for each marked slot, for
+// rendering the HP track
+func (c *Combatant) HPSlots() []bool {
+	slots := make([]bool, c.HPMax)
+	for i := range slots {
+		slots[i] = i < c.HPMarked
+	}
+	return slots
+}
+
+// StressSlots returns one entry per Stress slot, true for each marked slot,
+// for rendering the Stress track
+func (c *Combatant) StressSlots() []bool {
+	slots := make([]bool, c.StressMax)
+	for i := range slots {
+		slots[i] = i < c.StressMarked
+	}
+	return slots
+}
+
+// StressLeft returns the Stress slots the combatant has not marked
+func (c *Combatant) StressLeft() int {
+	if c.StressMarked >= c.StressMax {
+		return 0
+	}
+	return c.StressMax - c.StressMarked
+}
+
+// combatantColumns is the column list shared by every combatant query
+const combatantColumns = `
+	id, session_id, adversary_id, position, name, role, difficulty,
+	major_threshold, severe_threshold, hp_max, hp_marked, stress_max,
+	stress_marked, acted`
+
+// combatantScanDest returns the scan destinations matching combatantColumns
+func combatantScanDest(c *Combatant) []interface{} {
+	return []interface{}{
+		&c.ID, &c.SessionID, &c.AdversaryID, &c.Position, &c.Name, &c.Role,
+		&c.Difficulty, &c.MajorThreshold, &c.SevereThreshold, &c.HPMax,
+		&c.HPMarked, &c.StressMax, &c.StressMarked, &c.Acted,
+	}
+}
+
+// StartCombatSession creates an active combat session for an encounter,
+// expanding each encounter adversary's count into individual combatants.
+// The encounter must have its adversaries loaded.
+func StartCombatSession(ctx context.Context, db Conn, enc *Encounter) (int64, error) {
+	token, err := newPlayerToken()
+	if err != nil {
+		return 0, err
+	}
+
+	var sessionID int64
+	err = inTx(ctx, db, func(tx *sql.Tx) error {
+		// Insert session
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO combat_sessions (encounter_id, status, fear_max, player_token)
+			VALUES (?, ?, ?, ?)
+		`, enc.ID, CombatActive, DefaultFearMax, token)
+		if err != nil {
+			return err
+		}
+
+		sessionID, err = result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		// Insert one combatant per adversary copy
+		query := `
+			INSERT INTO combatants (
+				session_id, adversary_id, position, name, role, difficulty,
+				major_threshold, severe_threshold, hp_max, stress_max
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`
+
+		position := 0
+		for _, ea := range enc.Adversaries {
+			adv := ea.Adversary
+			for i := 0; i < ea.Count; i++ {
+				name := adv.Name
+				if ea.Count > 1 {
+					name = fmt.Sprintf("%s %d", adv.Name, i+1)
+				}
+
+				_, err := tx.ExecContext(
+					ctx, query,
+					sessionID, adv.ID, position, name, adv.Role, adv.Difficulty,
+					adv.MajorThreshold, adv.SevereThreshold, adv.HitPoints, adv.Stress,
+				)
+				if err != nil {
+					return err
+				}
+				position++
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return sessionID, nil
+}
+
+// GetCombatSessionByID retrieves a combat session and its combatants
+func GetCombatSessionByID(ctx context.Context, db Conn, id int64) (*CombatSession, error) {
+	query := `
+		SELECT id, encounter_id, status, fear, fear_max, spotlight, gm_turn,
+		       tracker_mode, action_tokens, player_token, started_at, ended_at,
+		       updated_at
+		FROM combat_sessions
+		WHERE id = ?
+	`
+
+	return getCombatSession(ctx, db, query, id)
+}
+
+// GetCombatSessionByPlayerToken retrieves the combat session a player view
+// URL names, or nil if there is none
+func GetCombatSessionByPlayerToken(ctx context.Context, db Conn, token string) (*CombatSession, error) {
+	query := `
+		SELECT id, encounter_id, status, fear, fear_max, spotlight, gm_turn,
+		       tracker_mode, action_tokens, player_token, started_at, ended_at,
+		       updated_at
+		FROM combat_sessions
+		WHERE player_token = ?
+	`
+
+	return getCombatSession(ctx, db, query, token)
+}
+
+// newPlayerToken returns a random token for a session's player view URL.
+// It is long enough that the URL cannot be guessed.
+func newPlayerToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GetActiveCombatSession retrieves the running combat session of an
+// encounter, or nil if combat has not been started
+func GetActiveCombatSession(ctx context.Context, db Conn, encounterID int64) (*CombatSession, error) {
+	query := `
+		SELECT id, encounter_id, status, fear, fear_max, spotlight, gm_turn,
+		       tracker_mode, action_tokens, player_token, started_at, ended_at,
+		       updated_at
+		FROM combat_sessions
+		WHERE encounter_id = ? AND status = 'active'
+	`
+
+	return getCombatSession(ctx, db, query, encounterID)
+}
+
+// getCombatSession runs a single-session query and loads its combatants
+func getCombatSession(ctx context.Context, db Conn, query string, args ...interface{}) (*CombatSession, error) {
+	s := &CombatSession{}
+	err := db.QueryRowContext(ctx, query, args...).Scan(
+		&s.ID, &s.EncounterID, &s.Status, &s.Fear, &s.FearMax, &s.Spotlight, &s.GMTurn,
+		&s.TrackerMode, &s.ActionTokens, &s.PlayerToken, &s.StartedAt, &s.EndedAt,
+		&s.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Load combatants for the session
+	combatants, err := GetCombatants(ctx, db, s.ID)
+	if err != nil {
+		return nil, err
+	}
+	s.Combatants = combatants
+
+	// Attach each combatant's conditions
+	conditions, err := getSessionConditions(ctx, db, s.ID)
+	if err != nil {
+		return nil, err
+	}
+	byCombatant := make(map[int64]*Combatant, len(combatants))
+	for _, c := range combatants {
+		byCombatant[c.ID] = c
+	}
+	for _, cond := range conditions {
+		if c, ok := byCombatant[cond.CombatantID]; ok {
+			c.Conditions = append(c.Conditions, cond)
+		}
+	}
+
+	// Attach countdowns to their combatant, or to the session
+	countdowns, err := GetCountdowns(ctx, db, s.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, cd := range countdowns {
+		if cd.CombatantID == nil {
+			s.Countdowns = append(s.Countdowns, cd)
+		} else if c, ok := byCombatant[*cd.CombatantID]; ok {
+			c.Countdowns = append(c.Countdowns, cd)
+		}
+	}
+
+	return s, nil
+}
+
+// GetCombatants retrieves the combatants of a session in tracker order
+func GetCombatants(ctx context.Context, db Conn, sessionID int64) ([]*Combatant, error) {
+	query := `
+		SELECT ` + combatantColumns + `
+		FROM combatants
+		WHERE session_id = ?
+		ORDER BY position ASC, id ASC
+	`
+
+	rows, err := db.QueryContext(ctx, query, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var combatants []*Combatant
+	for rows.Next() {
+		c := &Combatant{}
+		if err := rows.Scan(combatantScanDest(c)...); err != nil {
+			return nil, err
+		}
+		combatants = append(combatants, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return combatants, nil
+}
+
+// GetCombatantByID retrieves a single combatant by ID
+func GetCombatantByID(ctx context.Context, db Conn, id int64) (*Combatant, error) {
+	query := `
+		SELECT ` + combatantColumns + `
+		FROM combatants
+		WHERE id = ?
+	`
+
+	c := &Combatant{}
+	err := db.QueryRowContext(ctx, query, id).Scan(combatantScanDest(c)...)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// ChangeCombatant reads a combatant afresh, lets change work out the HP and
+// Stress it has marked, and stores them, all in one transaction. Changes to
+// the same combatant made at the same time are then applied one after the
+// other instead of overwriting each other. c is left as stored; nothing is
+// written if change leaves its HP and Stress as they were.
+func ChangeCombatant(ctx context.Context, db Conn, c *Combatant, change func(c *Combatant)) error {
+	return inTx(ctx, db, func(tx *sql.Tx) error {
+		query := `
+			SELECT ` + combatantColumns + `
+			FROM combatants
+			WHERE id = ?
+		`
+		if err := tx.QueryRowContext(ctx, query, c.ID).Scan(combatantScanDest(c)...); err != nil {
+			return err
+		}
+
+		hpMarked, stressMarked := c.HPMarked, c.StressMarked
+		change(c)
+		if c.HPMarked == hpMarked && c.StressMarked == stressMarked {
+			return nil
+		}
+
+		_, err := tx.ExecContext(ctx, `
+			UPDATE combatants
+			SET hp_marked = ?, stress_marked = ?
+			WHERE id = ?
+		`, c.HPMarked, c.StressMarked, c.ID)
+		if err != nil {
+			return err
+		}
+
+		return touchCombatSession(ctx, tx, c.SessionID)
+	})
+}
+
+// DeleteCombatant removes a combatant from its session
+func DeleteCombatant(ctx context.Context, db Conn, c *Combatant) error {
+	return inTx(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM combatants WHERE id = ?`, c.ID); err != nil {
+			return err
+		}
+
+		return touchCombatSession(ctx, tx, c.SessionID)
+	})
+}
+
+// EndCombatSession marks a session as ended and clears the conditions that
+// last until the end of the scene. Ended sessions are kept so that past
+// fights can be reviewed.
+func EndCombatSession(ctx context.Context, db Conn, id int64) error {
+	return inTx(ctx, db, func(tx *sql.Tx) error {
+		query := `
+			UPDATE combat_sessions
+			SET status = ?, ended_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+			WHERE id = ? AND status = ?
+		`
+
+		if _, err := tx.ExecContext(ctx, query, CombatEnded, id, CombatActive); err != nil {
+			return err
+		}
+
+		return expireSessionConditions(ctx, tx, id, ExpiresEndOfScene)
+	})
+}
+
+// touchCombatSession bumps a session's updated_at after one of its
+// combatants changed
+func touchCombatSession(ctx context.Context, tx *sql.Tx, sessionID int64) error {
+	_, err := tx.ExecContext(ctx, `UPDATE combat_sessions SET updated_at = CURRENT_TIMESTAMP WHERE id = ?`, sessionID)
+	return err
+}
+
+// IsValidTrackerMode reports whether mode is one of the tracker modes
+func IsValidTrackerMode(mode string) bool {
+	for _, m := range TrackerModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// PassSpotlight hands the spotlight to the GM or back to the players. Either
+// way every combatant's acted marker is cleared; giving the spotlight to the
+// GM starts a new GM turn.
+func PassSpotlight(ctx context.Context, db Conn, sessionID int64, spotlight string) error {
+	gmTurns := 0
+	if spotlight == SpotlightGM {
+		gmTurns = 1
+	}
+
+	return inTx(ctx, db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE combat_sessions
+			SET spotlight = ?, gm_turn = gm_turn + ?, updated_at = CURRENT_TIMESTAMP
+			WHERE id = ?
+		`, spotlight, gmTurns, sessionID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE combatants SET acted = 0 WHERE session_id = ?`, sessionID)
+		return err
+	})
+}
+
+// SetTrackerMode switches a session between the narrative spotlight flow and
+// the action tracker
+func SetTrackerMode(ctx context.Context, db Conn, sessionID int64, mode string) error {
+	query := `
+		UPDATE combat_sessions
+		SET tracker_mode = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+
+	_, err := db.ExecContext(ctx, query, mode, sessionID)
+	return err
+}
+
+// ChangeActionTokens adds (positive delta) or removes (negative delta)
+// action tokens, never going below zero
+func ChangeActionTokens(ctx context.Context, db Conn, sessionID int64, delta int) error {
+	query := `
+		UPDATE combat_sessions
+		SET action_tokens = MAX(action_tokens + ?, 0), updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+
+	_, err := db.ExecContext(ctx, query, delta, sessionID)
+	return err
+}
+
+// ActivationCost works out the Fear and action tokens that activating one
+// more adversary costs in a combat session as it stands
+type ActivationCost func(s *CombatSession) (fear, tokens int)
+
+// ActivateCombatant marks a combatant as having acted this GM turn, paying
+// what cost asks for the session as stored, and clears its conditions that
+// last until its next spotlight. Fear spent is logged against the
+// combatant's activation. It returns the cost, also when the session cannot
+// pay it (ErrNotEnoughFear or ErrNoActionTokens). c is left as stored before
+// the activation.
+func ActivateCombatant(ctx context.Context, db Conn, c *Combatant, cost ActivationCost) (fear, tokens int, err error) {
+	err = inTx(ctx, db, func(tx *sql.Tx) error {
+		session, err := GetCombatSessionByID(ctx, tx, c.SessionID)
+		if err != nil {
+			return err
+		}
+
+		var stored *Combatant
+		if session != nil {
+			for _, sc := range session.Combatants {
+				if sc.ID == c.ID {
+					stored = sc
+					break
+				}
+			}
+		}
+		if stored == nil {
+			return sql.ErrNoRows
+		}
+		*c = *stored
+
+		if c.Defeated() {
+			return ErrDefeated
+		}
+		if session.Spotlight != SpotlightGM {
+			return ErrNotGMTurn
+		}
+		if c.Acted {
+			return ErrAlreadyActed
+		}
+
+		fear, tokens = cost(session)
+		if session.ActionTokens < tokens {
+			return ErrNoActionTokens
+		}
+
+		if fear > 0 {
+			if _, err := changeFear(ctx, tx, c.SessionID, -fear, "Spotlight "+c.Name, nil); err != nil {
+				return err
+			}
+		}
+
+		if tokens > 0 {
+			_, err := tx.ExecContext(ctx, `UPDATE combat_sessions SET action_tokens = action_tokens - ? WHERE id = ?`, tokens, c.SessionID)
+			if err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE combatants SET acted = 1 WHERE id = ?`, c.ID); err != nil {
+			return err
+		}
+
+		// Conditions lasting until the combatant's next spotlight end now
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM combatant_conditions WHERE combatant_id = ? AND expires = ?
+		`, c.ID, ExpiresNextSpotlight)
+		if err != nil {
+			return err
+		}
+
+		return touchCombatSession(ctx, tx, c.SessionID)
+	})
+	return fear, tokens, err
+}
+
+// UseFeature has a combatant use one of its adversary's features, marking
+// the feature's Stress cost on the combatant and spending its Fear cost.
+// Fear spent is logged against the feature. A combatant cannot pay with
+// Stress it has no slots left for, so this fails with ErrNotEnoughStress
+// rather than marking HP.
+func UseFeature(ctx context.Context, db Conn, c *Combatant, f *AdversaryFeature) error {
+	return inTx(ctx, db, func(tx *sql.Tx) error {
+		var stressMarked, stressMax int
+		err := tx.QueryRowContext(ctx, `
+			SELECT stress_marked, stress_max FROM combatants WHERE id = ?
+		`, c.ID).Scan(&stressMarked, &stressMax)
+		if err != nil {
+			return err
+		}
+
+		if stressMarked+f.StressCost > stressMax {
+			return ErrNotEnoughStress
+		}
+
+		if f.FearCost > 0 {
+			if _, err := changeFear(ctx, tx, c.SessionID, -f.FearCost, c.Name, &f.ID); err != nil {
+				return err
+			}
+		}
+
+		if f.StressCost > 0 {
+			_, err := tx.ExecContext(ctx, `UPDATE combatants SET stress_marked = stress_marked + ? WHERE id = ?`, f.StressCost, c.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		return touchCombatSession(ctx, tx, c.SessionID)
+	})
+}
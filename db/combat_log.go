@@ -0,0 +1,494 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Combat log actors: where a change came from
+const (
+	ActorTracker = "tracker" // the combat tracker on the encounter page
+	ActorAPI     = "api"     // the JSON API
+)
+
+// Combat log entry kinds for undoing and redoing. Every other entry has the
+// kind of the combat event its change was streamed as.
+const (
+	CombatLogUndo = "undo"
+	CombatLogRedo = "redo"
+)
+
+// ErrNothingToUndo is returned when undoing with no change left to undo
+var ErrNothingToUndo = errors.New("nothing to undo")
+
+// ErrNothingToRedo is returned when redoing with no undone change to redo
+var ErrNothingToRedo = errors.New("nothing to redo")
+
+// CombatState is a combat session as it stood at one point of the fight,
+// with everything that undoing a change puts back
+type CombatState struct {
+	Session *CombatSession `json:"session"`
+	FearLog []*FearEntry   `json:"fear_log"`
+}
+
+// CombatLogEntry is one change to a combat session. Entries are never
+// changed once logged: undoing a change logs an undo entry pointing at it.
+type CombatLogEntry struct {
+	ID        int64        `json:"id"`
+	SessionID int64        `json:"session_id"`
+	Kind      string       `json:"kind"`
+	Actor     string       `json:"actor"`
+	Target    string       `json:"target"` // combatant or countdown the change was about, if any
+	Summary   string       `json:"summary"`
+	EntryID   *int64       `json:"entry_id"` // entry an undo or redo entry undoes or redoes
+	Undoable  bool         `json:"undoable"` // starting and ending combat cannot be undone
+	Before    *CombatState `json:"before,omitempty"`
+	After     *CombatState `json:"after,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+
+	// Worked out from the rest of the log when it is loaded
+	Undone    bool `json:"undone"`     // undone and not redone
+	UndoSteps int  `json:"undo_steps"` // undo steps that revert this change and every later one, 0 if it cannot be undone
+	RedoSteps int  `json:"redo_steps"` // redo steps that bring this change back, 0 if it is not undone
+}
+
+// DescribeChange names the target of a change to a combat session and
+// summarizes it, from the fight before and after. before is nil when combat
+// has just started.
+type DescribeChange func(before, after *CombatState) (target, summary string)
+
+// ChangeCombat makes a change to a combat session and logs it, described by
+// describe, in one transaction, and returns the new entry. Changes made at
+// the same time are then logged one after the other, each against the
+// state the one before left. Nothing is logged, and nil is returned, if
+// change leaves the session as it was; if change fails, nothing is made.
+func ChangeCombat(ctx context.Context, db *sql.DB, sessionID int64, kind, actor string, describe DescribeChange, change func(tx *sql.Tx) error) (*CombatLogEntry, error) {
+	var entry *CombatLogEntry
+	err := inTx(ctx, db, func(tx *sql.Tx) error {
+		if err := change(tx); err != nil {
+			return err
+		}
+
+		var err error
+		entry, err = RecordCombatChange(ctx, tx, sessionID, kind, actor, describe)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// RecordCombatChange logs the latest change to a combat session, made
+// earlier in tx, described by describe, and returns the new entry. The
+// state before the change is taken from the previous entry. Nothing is
+// logged, and nil is returned, if the session has not changed since.
+func RecordCombatChange(ctx context.Context, tx *sql.Tx, sessionID int64, kind, actor string, describe DescribeChange) (*CombatLogEntry, error) {
+	after, err := GetCombatState(ctx, tx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var before *CombatState
+	var beforeJSON []byte
+	err = tx.QueryRowContext(ctx, `
+		SELECT after_state FROM combat_log WHERE session_id = ? ORDER BY id DESC LIMIT 1
+	`, sessionID).Scan(&beforeJSON)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if beforeJSON != nil {
+		if err := json.Unmarshal(beforeJSON, &before); err != nil {
+			return nil, err
+		}
+	}
+
+	afterJSON, err := json.Marshal(after)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(beforeJSON, afterJSON) {
+		return nil, nil
+	}
+
+	entry := &CombatLogEntry{
+		SessionID: sessionID,
+		Kind:      kind,
+		Actor:     actor,
+		Before:    before,
+		After:     after,
+		Undoable:  before != nil && before.Session.Status == CombatActive && after.Session.Status == CombatActive,
+	}
+	entry.Target, entry.Summary = describe(before, after)
+
+	if err := appendCombatLog(ctx, tx, entry); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// UndoCombat undoes up to steps of the latest changes to a combat session
+// that have not been undone, newest first, logging an undo entry for each.
+// It returns the number of changes undone, or fails with ErrNothingToUndo.
+func UndoCombat(ctx context.Context, db *sql.DB, sessionID int64, actor string, steps int) (int, error) {
+	return travelCombat(ctx, db, sessionID, actor, steps, CombatLogUndo)
+}
+
+// RedoCombat redoes up to steps of the changes to a combat session undone
+// since its last new change, latest undone first, logging a redo entry for
+// each. It returns the number of changes redone, or fails with
+// ErrNothingToRedo.
+func RedoCombat(ctx context.Context, db *sql.DB, sessionID int64, actor string, steps int) (int, error) {
+	return travelCombat(ctx, db, sessionID, actor, steps, CombatLogRedo)
+}
+
+// travelCombat undoes or redoes changes to a combat session, depending on
+// kind, and puts the session back as it stood after the last step. The log
+// and the session are read in the same transaction, so that changes made
+// meanwhile are undone or redone in turn rather than lost.
+func travelCombat(ctx context.Context, db *sql.DB, sessionID int64, actor string, steps int, kind string) (int, error) {
+	err := inTx(ctx, db, func(tx *sql.Tx) error {
+		entries, err := getCombatLog(ctx, tx, sessionID)
+		if err != nil {
+			return err
+		}
+		applied, undone := combatLogStacks(entries)
+
+		stack, nothing := applied, ErrNothingToUndo
+		if kind == CombatLogRedo {
+			stack, nothing = undone, ErrNothingToRedo
+		}
+		if len(stack) == 0 {
+			return nothing
+		}
+		if steps > len(stack) {
+			steps = len(stack)
+		}
+
+		current, err := GetCombatState(ctx, tx, sessionID)
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i < steps; i++ {
+			target := stack[len(stack)-1-i]
+			if err := loadCombatLogStates(ctx, tx, target); err != nil {
+				return err
+			}
+
+			step := &CombatLogEntry{
+				SessionID: sessionID,
+				Kind:      kind,
+				Actor:     actor,
+				Target:    target.Target,
+				EntryID:   &target.ID,
+				Before:    current,
+			}
+			if kind == CombatLogUndo {
+				step.Summary = "Undid: " + target.Summary
+				step.After = target.Before
+			} else {
+				step.Summary = "Redid: " + target.Summary
+				step.After = target.After
+			}
+
+			if err := appendCombatLog(ctx, tx, step); err != nil {
+				return err
+			}
+			current = step.After
+		}
+
+		return restoreCombatState(ctx, tx, current)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return steps, nil
+}
+
+// GetCombatLog retrieves the log of a combat session, newest first, without
+// the states before and after each change
+func GetCombatLog(ctx context.Context, db *sql.DB, sessionID int64) ([]*CombatLogEntry, error) {
+	entries, err := getCombatLog(ctx, db, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Work out what undoing and redoing would do to each entry
+	applied, undone := combatLogStacks(entries)
+	for i, e := range applied {
+		e.UndoSteps = len(applied) - i
+	}
+	for i, e := range undone {
+		e.Undone = true
+		e.RedoSteps = len(undone) - i
+	}
+
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// GetCombatHistory retrieves the changes that stand in a combat session's
+// log, oldest first, with the states before and after each: every change
+// that has not been undone, in the order it was made or redone, from the
+// start of combat on
+func GetCombatHistory(ctx context.Context, db Conn, sessionID int64) ([]*CombatLogEntry, error) {
+	entries, err := getCombatLog(ctx, db, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Undoing and redoing only ever take back or bring back the latest
+	// change, so the history is a stack
+	var history, undone []*CombatLogEntry
+	for _, e := range entries {
+		switch {
+		case e.Kind == CombatLogUndo && len(history) > 0:
+			undone = append(undone, history[len(history)-1])
+			history = history[:len(history)-1]
+		case e.Kind == CombatLogRedo && len(undone) > 0:
+			history = append(history, undone[len(undone)-1])
+			undone = undone[:len(undone)-1]
+		default:
+			history = append(history, e)
+			undone = nil
+		}
+	}
+
+	err = inTx(ctx, db, func(tx *sql.Tx) error {
+		for _, e := range history {
+			if err := loadCombatLogStates(ctx, tx, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// getCombatLog retrieves the log of a combat session, oldest first, without
+// the states before and after each change
+func getCombatLog(ctx context.Context, db Conn, sessionID int64) ([]*CombatLogEntry, error) {
+	query := `
+		SELECT id, session_id, kind, actor, target, summary, entry_id, undoable,
+		       created_at
+		FROM combat_log
+		WHERE session_id = ?
+		ORDER BY id ASC
+	`
+
+	rows, err := db.QueryContext(ctx, query, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*CombatLogEntry
+	for rows.Next() {
+		e := &CombatLogEntry{}
+		err := rows.Scan(
+			&e.ID, &e.SessionID, &e.Kind, &e.Actor, &e.Target, &e.Summary,
+			&e.EntryID, &e.Undoable, &e.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// combatLogStacks replays a combat log, oldest first, into the changes that
+// can be undone and the undone changes that can be redone, each with the
+// next one to take last. A new change drops the changes waiting to be
+// redone, and starting or ending combat cannot be undone past.
+func combatLogStacks(entries []*CombatLogEntry) (applied, undone []*CombatLogEntry) {
+	for _, e := range entries {
+		switch {
+		case e.Kind == CombatLogUndo && len(applied) > 0:
+			undone = append(undone, applied[len(applied)-1])
+			applied = applied[:len(applied)-1]
+		case e.Kind == CombatLogRedo && len(undone) > 0:
+			applied = append(applied, undone[len(undone)-1])
+			undone = undone[:len(undone)-1]
+		case e.Undoable:
+			applied = append(applied, e)
+			undone = nil
+		default:
+			applied, undone = nil, nil
+		}
+	}
+	return applied, undone
+}
+
+// loadCombatLogStates fills in the states before and after an entry's change
+func loadCombatLogStates(ctx context.Context, tx *sql.Tx, e *CombatLogEntry) error {
+	var before, after []byte
+	err := tx.QueryRowContext(ctx, `
+		SELECT before_state, after_state FROM combat_log WHERE id = ?
+	`, e.ID).Scan(&before, &after)
+	if err != nil {
+		return err
+	}
+
+	if before != nil {
+		if err := json.Unmarshal(before, &e.Before); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(after, &e.After)
+}
+
+// appendCombatLog stores a new entry at the end of a session's combat log
+func appendCombatLog(ctx context.Context, tx *sql.Tx, e *CombatLogEntry) error {
+	var before []byte
+	if e.Before != nil {
+		var err error
+		if before, err = json.Marshal(e.Before); err != nil {
+			return err
+		}
+	}
+	after, err := json.Marshal(e.After)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO combat_log (
+			session_id, kind, actor, target, summary, entry_id, undoable,
+			before_state, after_state
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, e.SessionID, e.Kind, e.Actor, e.Target, e.Summary, e.EntryID, e.Undoable, before, after)
+	if err != nil {
+		return err
+	}
+
+	e.ID, err = result.LastInsertId()
+	return err
+}
+
+// GetCombatState takes the current state of a combat session. Update times
+// are left out, so that states only differ when the fight does. It fails
+// with sql.ErrNoRows if there is no such session.
+func GetCombatState(ctx context.Context, db Conn, sessionID int64) (*CombatState, error) {
+	session, err := GetCombatSessionByID(ctx, db, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	fearLog, err := GetFearLog(ctx, db, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	session.UpdatedAt = time.Time{}
+	for _, cd := range session.Countdowns {
+		cd.UpdatedAt = time.Time{}
+	}
+	for _, c := range session.Combatants {
+		for _, cd := range c.Countdowns {
+			cd.UpdatedAt = time.Time{}
+		}
+	}
+
+	return &CombatState{Session: session, FearLog: fearLog}, nil
+}
+
+// restoreCombatState puts a combat session back as it stood in a state:
+// its Fear and spotlight, and its combatants, conditions, countdowns and
+// Fear log, with their original IDs. References to adversaries and features
+// deleted since are dropped.
+func restoreCombatState(ctx context.Context, tx *sql.Tx, state *CombatState) error {
+	s := state.Session
+
+	_, err := tx.ExecContext(ctx, `
+		UPDATE combat_sessions
+		SET fear = ?, fear_max = ?, spotlight = ?, gm_turn = ?, tracker_mode = ?,
+		    action_tokens = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, s.Fear, s.FearMax, s.Spotlight, s.GMTurn, s.TrackerMode, s.ActionTokens, s.ID)
+	if err != nil {
+		return err
+	}
+
+	// Conditions and combatant countdowns go with their combatants
+	for _, table := range []string{"countdowns", "combatants", "fear_log"} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE session_id = ?`, s.ID); err != nil {
+			return err
+		}
+	}
+
+	countdowns := s.Countdowns
+	for _, c := range s.Combatants {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO combatants (
+				id, session_id, adversary_id, position, name, role, difficulty,
+				major_threshold, severe_threshold, hp_max, hp_marked, stress_max,
+				stress_marked, acted
+			) VALUES (?, ?, (SELECT id FROM adversaries WHERE id = ?), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, c.ID, s.ID, c.AdversaryID, c.Position, c.Name, c.Role, c.Difficulty,
+			c.MajorThreshold, c.SevereThreshold, c.HPMax, c.HPMarked, c.StressMax,
+			c.StressMarked, c.Acted)
+		if err != nil {
+			return err
+		}
+
+		for _, cond := range c.Conditions {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO combatant_conditions (id, combatant_id, name, expires, public, created_at)
+				VALUES (?, ?, ?, ?, ?, ?)
+			`, cond.ID, c.ID, cond.Name, cond.Expires, cond.Public, cond.CreatedAt)
+			if err != nil {
+				return err
+			}
+		}
+
+		countdowns = append(countdowns, c.Countdowns...)
+	}
+
+	for _, cd := range countdowns {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO countdowns (
+				id, session_id, combatant_id, feature_id, name, kind, purpose,
+				tick_on, looping, start_value, value, loops, public, created_at
+			) VALUES (?, ?, ?, (SELECT id FROM adversary_features WHERE id = ?), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, cd.ID, s.ID, cd.CombatantID, cd.FeatureID, cd.Name, cd.Kind, cd.Purpose,
+			cd.TickOn, cd.Looping, cd.StartValue, cd.Value, cd.Loops, cd.Public, cd.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, e := range state.FearLog {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO fear_log (id, session_id, delta, reason, feature_id, created_at)
+			VALUES (?, ?, ?, ?, (SELECT id FROM adversary_features WHERE id = ?), ?)
+		`, e.ID, s.ID, e.Delta, e.Reason, e.FeatureID, e.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
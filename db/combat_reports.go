@@ -0,0 +1,184 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// CombatReport summarizes a fight once it has ended
+type CombatReport struct {
+	ID          int64              `json:"id"`
+	EncounterID int64              `json:"encounter_id"`
+	SessionID   int64              `json:"session_id"`
+	StartedAt   time.Time          `json:"started_at"`
+	EndedAt     time.Time          `json:"ended_at"`
+	GMTurns     int                `json:"gm_turns"` // GM turns taken over the fight
+	Changes     int                `json:"changes"`  // changes made over the fight, leaving out those undone
+	FearGained  int                `json:"fear_gained"`
+	FearSpent   int                `json:"fear_spent"`
+	FearSpends  []*FearEntry       `json:"fear_spends"` // what the Fear was spent on, oldest first
+	Combatants  []*CombatantReport `json:"combatants"`
+	Countdowns  []*CountdownReport `json:"countdowns"`
+	CreatedAt   time.Time          `json:"created_at"`
+}
+
+// CombatantReport is how one combatant fared over a fight
+type CombatantReport struct {
+	Name         string     `json:"name"`
+	Role         string     `json:"role"`
+	HPMax        int        `json:"hp_max"`
+	HPMarked     int        `json:"hp_marked"` // HP marked when the fight ended
+	Damage       int        `json:"damage"`    // HP marked over the fight, before any was cleared
+	StressMax    int        `json:"stress_max"`
+	StressMarked int        `json:"stress_marked"` // Stress marked over the fight, before any was cleared
+	Defeated     bool       `json:"defeated"`
+	DefeatedAt   *time.Time `json:"defeated_at"` // when it was last defeated, if known
+	Removed      bool       `json:"removed"`     // removed from the fight before it ended
+}
+
+// CountdownReport is what became of one countdown over a fight
+type CountdownReport struct {
+	Name       string     `json:"name"`
+	Kind       string     `json:"kind"`
+	StartValue int        `json:"start_value"`
+	Value      int        `json:"value"` // value when the fight ended, or when it was removed
+	Loops      int        `json:"loops"`
+	Resolved   bool       `json:"resolved"`    // ran down to zero at least once
+	ResolvedAt *time.Time `json:"resolved_at"` // when it first ran down, if known
+	Removed    bool       `json:"removed"`     // removed before the fight ended
+}
+
+// Duration returns how long the fight lasted
+func (r *CombatReport) Duration() time.Duration {
+	return r.EndedAt.Sub(r.StartedAt)
+}
+
+// DurationLabel describes how long the fight lasted, to the minute, or the
+// second for fights under a minute
+func (r *CombatReport) DurationLabel() string {
+	d := r.Duration().Round(time.Second)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Round(time.Minute).Minutes()))
+	default:
+		d = d.Round(time.Minute)
+		return fmt.Sprintf("%dh %dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+}
+
+// DefeatedCount returns the number of combatants defeated by the end of the
+// fight
+func (r *CombatReport) DefeatedCount() int {
+	n := 0
+	for _, c := range r.Combatants {
+		if c.Defeated {
+			n++
+		}
+	}
+	return n
+}
+
+// ResolvedCount returns the number of countdowns that ran down over the
+// fight
+func (r *CombatReport) ResolvedCount() int {
+	n := 0
+	for _, cd := range r.Countdowns {
+		if cd.Resolved {
+			n++
+		}
+	}
+	return n
+}
+
+// CreateCombatReport stores the report of an ended fight and returns its ID.
+// A fight has at most one report; reporting it again replaces it.
+func CreateCombatReport(ctx context.Context, db Conn, r *CombatReport) (int64, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+		INSERT INTO combat_reports (encounter_id, session_id, report)
+		VALUES (?, ?, ?)
+		ON CONFLICT (session_id) DO UPDATE SET report = excluded.report
+	`
+
+	if _, err := db.ExecContext(ctx, query, r.EncounterID, r.SessionID, data); err != nil {
+		return 0, err
+	}
+
+	// LastInsertId is not reliable for an upsert that updated
+	var id int64
+	err = db.QueryRowContext(ctx, `SELECT id FROM combat_reports WHERE session_id = ?`, r.SessionID).Scan(&id)
+	return id, err
+}
+
+// GetCombatReports retrieves the reports of an encounter's fights, newest
+// first
+func GetCombatReports(ctx context.Context, db *sql.DB, encounterID int64) ([]*CombatReport, error) {
+	query := `
+		SELECT id, encounter_id, session_id, report, created_at
+		FROM combat_reports
+		WHERE encounter_id = ?
+		ORDER BY id DESC
+	`
+
+	rows, err := db.QueryContext(ctx, query, encounterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []*CombatReport
+	for rows.Next() {
+		r, err := scanCombatReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reports, nil
+}
+
+// GetCombatReport retrieves a fight's report by ID, or nil if there is none
+func GetCombatReport(ctx context.Context, db *sql.DB, id int64) (*CombatReport, error) {
+	query := `
+		SELECT id, encounter_id, session_id, report, created_at
+		FROM combat_reports
+		WHERE id = ?
+	`
+
+	r, err := scanCombatReport(db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return r, err
+}
+
+// scanCombatReport reads a report row, as selected by GetCombatReport
+func scanCombatReport(row interface{ Scan(...interface{}) error }) (*CombatReport, error) {
+	var id, encounterID, sessionID int64
+	var data []byte
+	var createdAt time.Time
+	if err := row.Scan(&id, &encounterID, &sessionID, &data, &createdAt); err != nil {
+		return nil, err
+	}
+
+	r := &CombatReport{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, err
+	}
+	r.ID, r.EncounterID, r.SessionID, r.CreatedAt = id, encounterID, sessionID, createdAt
+	return r, nil
+}
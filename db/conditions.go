@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Standard Daggerheart conditions. Combatants can also carry custom named
+// effects.
+const (
+	ConditionHidden     = "Hidden"
+	ConditionRestrained = "Restrained"
+	ConditionVulnerable = "Vulnerable"
+)
+
+// StandardConditions lists the standard conditions
+var StandardConditions = []string{ConditionHidden, ConditionRestrained, ConditionVulnerable}
+
+// Condition expiry triggers
+const (
+	ExpiresUntilCleared  = "until_cleared"
+	ExpiresEndOfScene    = "end_of_scene"
+	ExpiresNextSpotlight = "next_spotlight"
+)
+
+// ConditionExpiries lists the valid expiry triggers
+var ConditionExpiries = []string{ExpiresUntilCleared, ExpiresEndOfScene, ExpiresNextSpotlight}
+
+// MaxConditionNameLength is the longest name a custom effect can have
+const MaxConditionNameLength = 60
+
+// CombatantCondition is a condition or effect on a combatant
+type CombatantCondition struct {
+	ID          int64     `json:"id"`
+	CombatantID int64     `json:"combatant_id"`
+	Name        string    `json:"name"`
+	Expires     string    `json:"expires"`
+	Public      bool      `json:"public"` // shown on the player view
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// UnmarshalJSON reads a condition, as shown to players unless it says
+// otherwise: conditions in combat log states from before they could be
+// hidden were all shown
+func (c *CombatantCondition) UnmarshalJSON(data []byte) error {
+	type condition CombatantCondition
+	cond := condition{Public: true}
+	if err := json.Unmarshal(data, &cond); err != nil {
+		return err
+	}
+	*c = CombatantCondition(cond)
+	return nil
+}
+
+// ExpiryLabel describes when the condition ends
+func (c *CombatantCondition) ExpiryLabel() string {
+	switch c.Expires {
+	case ExpiresEndOfScene:
+		return "until end of scene"
+	case ExpiresNextSpotlight:
+		return "until its next spotlight"
+	default:
+		return "until cleared"
+	}
+}
+
+// IsValidConditionExpiry reports whether expires is one of the expiry triggers
+func IsValidConditionExpiry(expires string) bool {
+	for _, e := range ConditionExpiries {
+		if e == expires {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeConditionName trims a condition name and gives standard
+// conditions their canonical spelling
+func NormalizeConditionName(name string) string {
+	name = strings.TrimSpace(name)
+	for _, c := range StandardConditions {
+		if strings.EqualFold(c, name) {
+			return c
+		}
+	}
+	return name
+}
+
+// AddCombatantCondition puts a condition on a combatant. Adding a condition
+// the combatant already has replaces its expiry trigger and visibility.
+func AddCombatantCondition(ctx context.Context, db Conn, cond *CombatantCondition) error {
+	query := `
+		INSERT INTO combatant_conditions (combatant_id, name, expires, public)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (combatant_id, name) DO UPDATE SET expires = excluded.expires, public = excluded.public
+	`
+
+	_, err := db.ExecContext(ctx, query, cond.CombatantID, cond.Name, cond.Expires, cond.Public)
+	return err
+}
+
+// GetCombatantConditionByID retrieves a single condition by ID
+func GetCombatantConditionByID(ctx context.Context, db Conn, id int64) (*CombatantCondition, error) {
+	query := `
+		SELECT id, combatant_id, name, expires, public, created_at
+		FROM combatant_conditions
+		WHERE id = ?
+	`
+
+	cond := &CombatantCondition{}
+	err := db.QueryRowContext(ctx, query, id).Scan(
+		&cond.ID, &cond.CombatantID, &cond.Name, &cond.Expires, &cond.Public, &cond.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return cond, nil
+}
+
+// SetCombatantConditionPublic shows a condition on the player view, or
+// hides it
+func SetCombatantConditionPublic(ctx context.Context, db Conn, id int64, public bool) error {
+	_, err := db.ExecContext(ctx, `UPDATE combatant_conditions SET public = ? WHERE id = ?`, public, id)
+	return err
+}
+
+// DeleteCombatantCondition clears a condition from a combatant
+func DeleteCombatantCondition(ctx context.Context, db Conn, id int64) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM combatant_conditions WHERE id = ?`, id)
+	return err
+}
+
+// getSessionConditions retrieves the conditions of every combatant in a
+// combat session
+func getSessionConditions(ctx context.Context, db Conn, sessionID int64) ([]*CombatantCondition, error) {
+	query := `
+		SELECT cc.id, cc.combatant_id, cc.name, cc.expires, cc.public, cc.created_at
+		FROM combatant_conditions cc
+		JOIN combatants c ON c.id = cc.combatant_id
+		WHERE c.session_id = ?
+		ORDER BY cc.id ASC
+	`
+
+	rows, err := db.QueryContext(ctx, query, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conditions []*CombatantCondition
+	for rows.Next() {
+		cond := &CombatantCondition{}
+		if err := rows.Scan(&cond.ID, &cond.CombatantID, &cond.Name, &cond.Expires, &cond.Public, &cond.CreatedAt); err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, cond)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return conditions, nil
+}
+
+// expireSessionConditions clears the conditions with the given expiry
+// trigger from every combatant in a session
+func expireSessionConditions(ctx context.Context, tx *sql.Tx, sessionID int64, expires string) error {
+	_, err := tx.ExecContext(ctx, `
+		DELETE FROM combatant_conditions
+		WHERE expires = ? AND combatant_id IN (
+			SELECT id FROM combatants WHERE session_id = ?
+		)
+	`, expires, sessionID)
+	return err
+}
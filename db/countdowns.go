@@ -0,0 +1,241 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+)
+
+// Countdown kinds. Standard countdowns tick by one per trigger; dynamic
+// countdowns tick by an amount that depends on the roll result.
+const (
+	CountdownStandard = "standard"
+	CountdownDynamic  = "dynamic"
+)
+
+// Countdown purposes. Progress countdowns track something the PCs are
+// working towards, consequence countdowns something bad that will happen.
+const (
+	CountdownProgress    = "progress"
+	CountdownConsequence = "consequence"
+)
+
+// Countdown triggers. Roll countdowns tick when the players report an action
+// roll, action countdowns when an adversary takes the spotlight.
+const (
+	TickOnRoll   = "roll"
+	TickOnAction = "action"
+)
+
+// Countdown is a Daggerheart countdown attached to a combat session, or to a
+// single combatant when CombatantID is set
+type Countdown struct {
+	ID          int64     `json:"id"`
+	SessionID   int64     `json:"session_id"`
+	CombatantID *int64    `json:"combatant_id"`
+	FeatureID   *int64    `json:"feature_id"`
+	Name        string    `json:"name"`
+	Kind        string    `json:"kind"`
+	Purpose     string    `json:"purpose"`
+	TickOn      string    `json:"tick_on"`
+	Looping     bool      `json:"looping"`
+	StartValue  int       `json:"start_value"`
+	Value       int       `json:"value"`
+	Loops       int       `json:"loops"`  // number of times a looping countdown has fired
+	Public      bool      `json:"public"` // shown on the player view
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Done reports whether a non-looping countdown has run out
+func (c *Countdown) Done() bool {
+	return !c.Looping && c.Value == 0
+}
+
+// IsValidCountdown reports whether the kind, purpose and trigger of a
+// countdown are all known values
+func IsValidCountdown(c *Countdown) bool {
+	validKind := c.Kind == CountdownStandard || c.Kind == CountdownDynamic
+	validPurpose := c.Purpose == CountdownProgress || c.Purpose == CountdownConsequence
+	validTickOn := c.TickOn == TickOnRoll || c.TickOn == TickOnAction
+	return validKind && validPurpose && validTickOn
+}
+
+// countdownColumns is the column list shared by every countdown query
+const countdownColumns = `
+	id, session_id, combatant_id, feature_id, name, kind, purpose, tick_on,
+	looping, start_value, value, loops, public, created_at, updated_at`
+
+// countdownScanDest returns the scan destinations matching countdownColumns
+func countdownScanDest(c *Countdown) []interface{} {
+	return []interface{}{
+		&c.ID, &c.SessionID, &c.CombatantID, &c.FeatureID, &c.Name, &c.Kind,
+		&c.Purpose, &c.TickOn, &c.Looping, &c.StartValue, &c.Value, &c.Loops,
+		&c.Public, &c.CreatedAt, &c.UpdatedAt,
+	}
+}
+
+// CreateCountdown starts a new countdown at its start value
+func CreateCountdown(ctx context.Context, db Conn, c *Countdown) (int64, error) {
+	query := `
+		INSERT INTO countdowns (
+			session_id, combatant_id, feature_id, name, kind, purpose, tick_on,
+			looping, start_value, value, public
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := db.ExecContext(
+		ctx, query,
+		c.SessionID, c.CombatantID, c.FeatureID, c.Name, c.Kind, c.Purpose, c.TickOn,
+		c.Looping, c.StartValue, c.StartValue, c.Public,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+// GetCountdowns retrieves the countdowns of a combat session, including
+// those attached to its combatants
+func GetCountdowns(ctx context.Context, db Conn, sessionID int64) ([]*Countdown, error) {
+	query := `
+		SELECT ` + countdownColumns + `
+		FROM countdowns
+		WHERE session_id = ?
+		ORDER BY id ASC
+	`
+
+	rows, err := db.QueryContext(ctx, query, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var countdowns []*Countdown
+	for rows.Next() {
+		c := &Countdown{}
+		if err := rows.Scan(countdownScanDest(c)...); err != nil {
+			return nil, err
+		}
+		countdowns = append(countdowns, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return countdowns, nil
+}
+
+// GetCountdownByID retrieves a single countdown by ID
+func GetCountdownByID(ctx context.Context, db Conn, id int64) (*Countdown, error) {
+	query := `
+		SELECT ` + countdownColumns + `
+		FROM countdowns
+		WHERE id = ?
+	`
+
+	c := &Countdown{}
+	err := db.QueryRowContext(ctx, query, id).Scan(countdownScanDest(c)...)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// TickCountdowns advances countdowns by the number of ticks given for each
+// countdown ID, and returns the countdowns that reached zero. A looping
+// countdown that reaches zero fires and starts again from its start value;
+// any other countdown stays at zero.
+func TickCountdowns(ctx context.Context, db Conn, ticks map[int64]int) ([]*Countdown, error) {
+	// Tick in creation order so fired countdowns are reported consistently
+	ids := make([]int64, 0, len(ticks))
+	for id := range ticks {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var fired []*Countdown
+	err := inTx(ctx, db, func(tx *sql.Tx) error {
+		for _, id := range ids {
+			n := ticks[id]
+			if n <= 0 {
+				continue
+			}
+
+			c := &Countdown{}
+			err := tx.QueryRowContext(ctx, `SELECT `+countdownColumns+` FROM countdowns WHERE id = ?`, id).Scan(countdownScanDest(c)...)
+			if err == sql.ErrNoRows {
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			// A spent countdown no longer ticks
+			if c.Done() {
+				continue
+			}
+
+			c.Value -= n
+			if c.Value <= 0 {
+				c.Value = 0
+				if c.Looping {
+					c.Value = c.StartValue
+					c.Loops++
+				}
+				fired = append(fired, c)
+			}
+
+			_, err = tx.ExecContext(ctx, `
+				UPDATE countdowns
+				SET value = ?, loops = ?, updated_at = CURRENT_TIMESTAMP
+				WHERE id = ?
+			`, c.Value, c.Loops, c.ID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return fired, nil
+}
+
+// ResetCountdown puts a countdown back to its start value
+func ResetCountdown(ctx context.Context, db Conn, id int64) error {
+	query := `
+		UPDATE countdowns
+		SET value = start_value, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+
+	_, err := db.ExecContext(ctx, query, id)
+	return err
+}
+
+// SetCountdownPublic shows a countdown on the player view, or hides it
+func SetCountdownPublic(ctx context.Context, db Conn, id int64, public bool) error {
+	query := `
+		UPDATE countdowns
+		SET public = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+
+	_, err := db.ExecContext(ctx, query, public, id)
+	return err
+}
+
+// DeleteCountdown removes a countdown
+func DeleteCountdown(ctx context.Context, db Conn, id int64) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM countdowns WHERE id = ?`, id)
+	return err
+}
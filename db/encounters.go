@@ -3,81 +3,139 @@ package db
 import (
 	"context"
 	"database/sql"
+	"sort"
+	"strings"
 	"time"
 )
 
+// Encounter challenge levels, the GM's call on how hard or long a fight
+// should be. Easier and harder fights adjust the battle point budget.
+const (
+	ChallengeEasier   = "easier"
+	ChallengeStandard = "standard"
+	ChallengeHarder   = "harder"
+)
+
+// DefaultPartySize is the party size of a new encounter
+const DefaultPartySize = 4
+
+// Challenges lists the valid challenge levels from easiest to hardest
+var Challenges = []string{ChallengeEasier, ChallengeStandard, ChallengeHarder}
+
 // Encounter represents a combat encounter with adversaries
 type Encounter struct {
-	ID          int64
-	Name        string
-	Description string
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Adversaries []*EncounterAdversary
+	ID          int64                 `json:"id"`
+	Name        string                `json:"name"`
+	Description string                `json:"description"`
+	PartySize   int                   `json:"party_size"`
+	PartyTier   int                   `json:"party_tier"`
+	Challenge   string                `json:"challenge"`
+	DamageBoost bool                  `json:"damage_boost"` // adversaries deal extra damage
+	CreatedAt   time.Time             `json:"created_at"`
+	UpdatedAt   time.Time             `json:"updated_at"`
+	Adversaries []*EncounterAdversary `json:"adversaries,omitempty"`
 }
 
 // EncounterAdversary represents an adversary in an encounter with a count
 type EncounterAdversary struct {
-	ID          int64
-	EncounterID int64
-	AdversaryID int64
-	Count       int
-	Adversary   *Adversary
+	ID          int64      `json:"id"`
+	EncounterID int64      `json:"encounter_id"`
+	AdversaryID int64      `json:"adversary_id"`
+	Count       int        `json:"count"`
+	Adversary   *Adversary `json:"adversary,omitempty"`
 }
 
-// GetAllEncounters retrieves all encounters from the database
-func GetAllEncounters(ctx context.Context, db *sql.DB) ([]*Encounter, error) {
+// GetAllEncounters retrieves the encounters matching opts, with their
+// adversaries. When opts has a limit, it also returns the cursor of the next
+// page, or "" on the last.
+func GetAllEncounters(ctx context.Context, db *sql.DB, opts ListOptions) ([]*Encounter, string, error) {
+	list, err := newListQuery(opts, encounterSorts, "e.id")
+	if err != nil {
+		return nil, "", err
+	}
+
+	var where []string
+	var args []interface{}
+	if opts.Tier != 0 {
+		where = append(where, "e.party_tier = ?")
+		args = append(args, opts.Tier)
+	}
+
+	// The adversary filters match encounters with any such adversary
+	adversaryWhere, adversaryArgs := adversaryFilters(ListOptions{Type: opts.Type, Role: opts.Role, Tag: opts.Tag})
+	if len(adversaryWhere) > 0 {
+		where = append(where, `EXISTS (
+			SELECT 1 FROM encounter_adversaries ea
+			JOIN adversaries a ON a.id = ea.adversary_id
+			WHERE ea.encounter_id = e.id AND `+strings.Join(adversaryWhere, " AND ")+`
+		)`)
+		args = append(args, adversaryArgs...)
+	}
+
+	if list.where != "" {
+		where = append(where, list.where)
+		args = append(args, list.args...)
+	}
+
 	query := `
-		SELECT id, name, description, created_at, updated_at
-		FROM encounters
-		ORDER BY name ASC
-	`
+		SELECT e.id, e.name, e.description, e.party_size, e.party_tier, e.challenge,
+		       e.damage_boost, e.created_at, e.updated_at, ` + list.keyColumn() + `
+		FROM encounters e` + whereClause(where) + list.suffix()
 
-	rows, err := db.QueryContext(ctx, query)
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer rows.Close()
 
 	var encounters []*Encounter
+	var keys []string
 	for rows.Next() {
 		enc := &Encounter{}
+		var key string
 		err := rows.Scan(
-			&enc.ID, &enc.Name, &enc.Description, &enc.CreatedAt, &enc.UpdatedAt,
+			&enc.ID, &enc.Name, &enc.Description, &enc.PartySize, &enc.PartyTier,
+			&enc.Challenge, &enc.DamageBoost, &enc.CreatedAt, &enc.UpdatedAt, &key,
 		)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 		encounters = append(encounters, enc)
+		keys = append(keys, key)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	// Load adversaries for each encounter
-	for _, encounter := range encounters {
-		adversaries, err := GetEncounterAdversaries(ctx, db, encounter.ID)
-		if err != nil {
-			return nil, err
-		}
-		encounter.Adversaries = adversaries
+	// Drop the extra row fetched to detect a next page
+	next := ""
+	if list.hasMore(len(encounters)) {
+		last := list.limit - 1
+		next = list.cursorAfter(keys[last], encounters[last].ID)
+		encounters = encounters[:list.limit]
 	}
 
-	return encounters, nil
+	if err := loadEncounterAdversaries(ctx, db, encounters); err != nil {
+		return nil, "", err
+	}
+
+	return encounters, next, nil
 }
 
 // GetEncounterByID retrieves a single encounter by ID
 func GetEncounterByID(ctx context.Context, db *sql.DB, id int64) (*Encounter, error) {
 	query := `
-		SELECT id, name, description, created_at, updated_at
+		SELECT id, name, description, party_size, party_tier, challenge,
+		       damage_boost, created_at, updated_at
 		FROM encounters
 		WHERE id = ?
 	`
 
 	enc := &Encounter{}
 	err := db.QueryRowContext(ctx, query, id).Scan(
-		&enc.ID, &enc.Name, &enc.Description, &enc.CreatedAt, &enc.UpdatedAt,
+		&enc.ID, &enc.Name, &enc.Description, &enc.PartySize, &enc.PartyTier,
+		&enc.Challenge, &enc.DamageBoost, &enc.CreatedAt, &enc.UpdatedAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -98,18 +156,110 @@ func GetEncounterByID(ctx context.Context, db *sql.DB, id int64) (*Encounter, er
 
 // GetEncounterAdversaries retrieves all adversaries for an encounter
 func GetEncounterAdversaries(ctx context.Context, db *sql.DB, encounterID int64) ([]*EncounterAdversary, error) {
+	return queryEncounterAdversaries(ctx, db, "ea.encounter_id = ?", encounterID)
+}
+
+// membershipBatchSize is how many encounters' adversaries are loaded per
+// query, keeping well under SQLite's limit on query parameters
+const membershipBatchSize = 500
+
+// loadEncounterAdversaries fills in the adversaries of every encounter with
+// two queries per batch of encounters, rather than one per encounter: one for
+// the memberships and one for the statblocks they share. Encounters with the
+// same adversary share its *Adversary.
+func loadEncounterAdversaries(ctx context.Context, db *sql.DB, encounters []*Encounter) error {
+	byID := make(map[int64]*Encounter, len(encounters))
+	for _, enc := range encounters {
+		enc.Adversaries = nil
+		byID[enc.ID] = enc
+	}
+	adversaries := make(map[int64]*Adversary)
+
+	for start := 0; start < len(encounters); start += membershipBatchSize {
+		batch := encounters[start:min(start+membershipBatchSize, len(encounters))]
+
+		placeholders := make([]string, len(batch))
+		args := make([]interface{}, len(batch))
+		for i, enc := range batch {
+			placeholders[i] = "?"
+			args[i] = enc.ID
+		}
+		in := "(" + strings.Join(placeholders, ", ") + ")"
+
+		// The statblocks of every adversary in the batch
+		rows, err := db.QueryContext(ctx, `
+			SELECT `+adversaryColumns+`
+			FROM adversaries a
+			WHERE a.id IN (SELECT adversary_id FROM encounter_adversaries WHERE encounter_id IN `+in+`)
+		`, args...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			adv := &Adversary{}
+			if err := rows.Scan(adversaryScanDest(adv)...); err != nil {
+				rows.Close()
+				return err
+			}
+			if _, ok := adversaries[adv.ID]; !ok {
+				adversaries[adv.ID] = adv
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// The memberships, linked to the statblocks
+		rows, err = db.QueryContext(ctx, `
+			SELECT id, encounter_id, adversary_id, count
+			FROM encounter_adversaries
+			WHERE encounter_id IN `+in, args...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			ea := &EncounterAdversary{}
+			if err := rows.Scan(&ea.ID, &ea.EncounterID, &ea.AdversaryID, &ea.Count); err != nil {
+				rows.Close()
+				return err
+			}
+			ea.Adversary = adversaries[ea.AdversaryID]
+			enc := byID[ea.EncounterID]
+			enc.Adversaries = append(enc.Adversaries, ea)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	// Match the order of GetEncounterAdversaries
+	for _, enc := range encounters {
+		sort.Slice(enc.Adversaries, func(i, j int) bool {
+			a, b := enc.Adversaries[i], enc.Adversaries[j]
+			if a.Adversary.Name != b.Adversary.Name {
+				return a.Adversary.Name < b.Adversary.Name
+			}
+			return a.ID < b.ID
+		})
+	}
+
+	return nil
+}
+
+// queryEncounterAdversaries retrieves the encounter adversaries matching a
+// condition, with their statblocks, ordered by adversary name
+func queryEncounterAdversaries(ctx context.Context, db *sql.DB, where string, args ...interface{}) ([]*EncounterAdversary, error) {
 	query := `
-		SELECT ea.id, ea.encounter_id, ea.adversary_id, ea.count,
-		       a.id, a.name, a.type, a.challenge_rating, a.size, a.armor_class, a.hit_points, 
-		       a.speed, a.strength, a.dexterity, a.constitution, a.intelligence, a.wisdom, 
-		       a.charisma, a.abilities, a.actions, a.reactions, a.description, a.created_at, a.updated_at
+		SELECT ea.id, ea.encounter_id, ea.adversary_id, ea.count,` + adversaryColumns + `
 		FROM encounter_adversaries ea
 		JOIN adversaries a ON ea.adversary_id = a.id
-		WHERE ea.encounter_id = ?
-		ORDER BY a.name ASC
+		WHERE ` + where + `
+		ORDER BY a.name ASC, ea.id ASC
 	`
 
-	rows, err := db.QueryContext(ctx, query, encounterID)
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -120,15 +270,11 @@ func GetEncounterAdversaries(ctx context.Context, db *sql.DB, encounterID int64)
 		ea := &EncounterAdversary{
 			Adversary: &Adversary{},
 		}
-		err := rows.Scan(
-			&ea.ID, &ea.EncounterID, &ea.AdversaryID, &ea.Count,
-			&ea.Adversary.ID, &ea.Adversary.Name, &ea.Adversary.Type, &ea.Adversary.ChallengeRating, 
-			&ea.Adversary.Size, &ea.Adversary.ArmorClass, &ea.Adversary.HitPoints, &ea.Adversary.Speed, 
-			&ea.Adversary.Strength, &ea.Adversary.Dexterity, &ea.Adversary.Constitution, 
-			&ea.Adversary.Intelligence, &ea.Adversary.Wisdom, &ea.Adversary.Charisma, 
-			&ea.Adversary.Abilities, &ea.Adversary.Actions, &ea.Adversary.Reactions, 
-			&ea.Adversary.Description, &ea.Adversary.CreatedAt, &ea.Adversary.UpdatedAt,
+		dest := append(
+			[]interface{}{&ea.ID, &ea.EncounterID, &ea.AdversaryID, &ea.Count},
+			adversaryScanDest(ea.Adversary)...,
 		)
+		err := rows.Scan(dest...)
 		if err != nil {
 			return nil, err
 		}
@@ -142,6 +288,94 @@ func GetEncounterAdversaries(ctx context.Context, db *sql.DB, encounterID int64)
 	return adversaries, nil
 }
 
+// EncounterSummary is an encounter without its adversaries' statblocks, for
+// pickers and lists that only need totals
+type EncounterSummary struct {
+	ID             int64  `json:"id"`
+	Name           string `json:"name"`
+	PartySize      int    `json:"party_size"`
+	PartyTier      int    `json:"party_tier"`
+	Challenge      string `json:"challenge"`
+	DamageBoost    bool   `json:"damage_boost"`
+	AdversaryCount int    `json:"adversary_count"` // every copy counted
+
+	// Members are the encounter's adversaries with only their ID, name,
+	// role and tier loaded, enough to work out the battle point budget
+	Members []*EncounterAdversary `json:"-"`
+}
+
+// Encounter returns the summarized encounter, with its partly loaded
+// adversaries
+func (s *EncounterSummary) Encounter() *Encounter {
+	return &Encounter{
+		ID:          s.ID,
+		Name:        s.Name,
+		PartySize:   s.PartySize,
+		PartyTier:   s.PartyTier,
+		Challenge:   s.Challenge,
+		DamageBoost: s.DamageBoost,
+		Adversaries: s.Members,
+	}
+}
+
+// GetEncounterSummaries retrieves a summary of every encounter, ordered by
+// name, in two queries however many encounters there are
+func GetEncounterSummaries(ctx context.Context, db *sql.DB) ([]*EncounterSummary, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, name, party_size, party_tier, challenge, damage_boost
+		FROM encounters
+		ORDER BY name ASC, id ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries []*EncounterSummary
+	byID := make(map[int64]*EncounterSummary)
+	for rows.Next() {
+		s := &EncounterSummary{}
+		if err := rows.Scan(&s.ID, &s.Name, &s.PartySize, &s.PartyTier, &s.Challenge, &s.DamageBoost); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, s)
+		byID[s.ID] = s
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT ea.id, ea.encounter_id, ea.adversary_id, ea.count, a.name, a.role, a.tier
+		FROM encounter_adversaries ea
+		JOIN adversaries a ON ea.adversary_id = a.id
+		ORDER BY a.name ASC, ea.id ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		ea := &EncounterAdversary{Adversary: &Adversary{}}
+		err := rows.Scan(
+			&ea.ID, &ea.EncounterID, &ea.AdversaryID, &ea.Count,
+			&ea.Adversary.Name, &ea.Adversary.Role, &ea.Adversary.Tier,
+		)
+		if err != nil {
+			return nil, err
+		}
+		ea.Adversary.ID = ea.AdversaryID
+
+		if s, ok := byID[ea.EncounterID]; ok {
+			s.Members = append(s.Members, ea)
+			s.AdversaryCount += ea.Count
+		}
+	}
+
+	return summaries, rows.Err()
+}
+
 // CreateEncounter inserts a new encounter into the database
 func CreateEncounter(ctx context.Context, db *sql.DB, enc *Encounter) (int64, error) {
 	tx, err := db.BeginTx(ctx, nil)
@@ -150,13 +384,26 @@ func CreateEncounter(ctx context.Context, db *sql.DB, enc *Encounter) (int64, er
 	}
 	defer tx.Rollback()
 
+	// Encounters created without a party are built for the default party
+	partySize, partyTier, challenge := enc.PartySize, enc.PartyTier, enc.Challenge
+	if partySize == 0 {
+		partySize = DefaultPartySize
+	}
+	if partyTier == 0 {
+		partyTier = 1
+	}
+	if challenge == "" {
+		challenge = ChallengeStandard
+	}
+
 	// Insert encounter
 	query := `
-		INSERT INTO encounters (name, description)
-		VALUES (?, ?)
+		INSERT INTO encounters (
+			name, description, party_size, party_tier, challenge, damage_boost
+		) VALUES (?, ?, ?, ?, ?, ?)
 	`
 
-	result, err := tx.ExecContext(ctx, query, enc.Name, enc.Description)
+	result, err := tx.ExecContext(ctx, query, enc.Name, enc.Description, partySize, partyTier, challenge, enc.DamageBoost)
 	if err != nil {
 		return 0, err
 	}
@@ -214,6 +461,30 @@ func UpdateEncounter(ctx context.Context, db *sql.DB, enc *Encounter) error {
 	return nil
 }
 
+// UpdateEncounterParty sets the party an encounter is built for and the
+// GM's budget adjustments
+func UpdateEncounterParty(ctx context.Context, db *sql.DB, enc *Encounter) error {
+	query := `
+		UPDATE encounters
+		SET party_size = ?, party_tier = ?, challenge = ?, damage_boost = ?,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+
+	_, err := db.ExecContext(ctx, query, enc.PartySize, enc.PartyTier, enc.Challenge, enc.DamageBoost, enc.ID)
+	return err
+}
+
+// IsValidChallenge reports whether challenge is one of the challenge levels
+func IsValidChallenge(challenge string) bool {
+	for _, c := range Challenges {
+		if c == challenge {
+			return true
+		}
+	}
+	return false
+}
+
 // DeleteEncounter removes an encounter from the database
 func DeleteEncounter(ctx context.Context, db *sql.DB, id int64) error {
 	query := `DELETE FROM encounters WHERE id = ?`
@@ -232,7 +503,7 @@ func AddAdversaryToEncounter(ctx context.Context, tx *sql.Tx, ea *EncounterAdver
 	var existingID int64
 	var existingCount int
 	err := tx.QueryRowContext(ctx, query, ea.EncounterID, ea.AdversaryID).Scan(&existingID, &existingCount)
-	
+
 	if err == sql.ErrNoRows {
 		// Insert new adversary to encounter
 		query = `
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+)
+
+// benchEncounters is how many encounters the list benchmarks load
+const benchEncounters = 3000
+
+// newBenchDB creates a migrated database in a temporary directory with 30
+// adversaries and n encounters of three adversaries each
+func newBenchDB(b *testing.B, n int) *sql.DB {
+	b.Helper()
+	ctx := context.Background()
+	db := newTestDB(b)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	var adversaryIDs []int64
+	for i := 0; i < 30; i++ {
+		id, err := insertAdversary(ctx, tx, &Adversary{
+			Name:      fmt.Sprintf("Adversary %02d", i),
+			Tier:      1,
+			Role:      AdversaryRoles[i%len(AdversaryRoles)],
+			HitPoints: 5,
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		adversaryIDs = append(adversaryIDs, id)
+	}
+
+	for i := 0; i < n; i++ {
+		res, err := tx.ExecContext(ctx, `INSERT INTO encounters (name, description) VALUES (?, '')`, fmt.Sprintf("Encounter %05d", i))
+		if err != nil {
+			b.Fatal(err)
+		}
+		encounterID, err := res.LastInsertId()
+		if err != nil {
+			b.Fatal(err)
+		}
+		for j := 0; j < 3; j++ {
+			ea := &EncounterAdversary{
+				EncounterID: encounterID,
+				AdversaryID: adversaryIDs[(i+j*7)%len(adversaryIDs)],
+				Count:       j + 1,
+			}
+			if _, err := AddAdversaryToEncounter(ctx, tx, ea); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		b.Fatal(err)
+	}
+	return db
+}
+
+// BenchmarkGetAllEncounters loads every encounter with its adversaries,
+// batching the membership queries
+func BenchmarkGetAllEncounters(b *testing.B) {
+	db := newBenchDB(b, benchEncounters)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		encounters, _, err := GetAllEncounters(ctx, db, ListOptions{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(encounters) != benchEncounters || len(encounters[0].Adversaries) != 3 {
+			b.Fatalf("loaded %d encounters", len(encounters))
+		}
+	}
+}
+
+// BenchmarkGetAllEncountersPerEncounter loads the same encounters with one
+// membership query per encounter, as GetAllEncounters used to
+func BenchmarkGetAllEncountersPerEncounter(b *testing.B) {
+	db := newBenchDB(b, benchEncounters)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rows, err := db.QueryContext(ctx, `SELECT id FROM encounters ORDER BY name ASC`)
+		if err != nil {
+			b.Fatal(err)
+		}
+		var encounters []*Encounter
+		for rows.Next() {
+			enc := &Encounter{}
+			if err := rows.Scan(&enc.ID); err != nil {
+				b.Fatal(err)
+			}
+			encounters = append(encounters, enc)
+		}
+		rows.Close()
+
+		for _, enc := range encounters {
+			enc.Adversaries, err = GetEncounterAdversaries(ctx, db, enc.ID)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkGetEncounterSummaries loads the summaries a picker shows
+func BenchmarkGetEncounterSummaries(b *testing.B) {
+	db := newBenchDB(b, benchEncounters)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		summaries, err := GetEncounterSummaries(ctx, db)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(summaries) != benchEncounters || summaries[0].AdversaryCount != 6 {
+			b.Fatalf("loaded %d summaries", len(summaries))
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestDB creates a migrated database in a temporary directory, removed
+// when the test ends
+func newTestDB(tb testing.TB) *sql.DB {
+	tb.Helper()
+
+	db, err := sql.Open("sqlite3", filepath.Join(tb.TempDir(), "test.db")+"?_foreign_keys=on&_txlock=immediate")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+
+	if _, err := Migrate(context.Background(), db); err != nil {
+		tb.Fatal(err)
+	}
+	return db
+}
+
+// createTestAdversary stores a homebrew adversary with one feature
+func createTestAdversary(t *testing.T, db *sql.DB, name string) int64 {
+	t.Helper()
+	ctx := context.Background()
+
+	id, err := CreateAdversary(ctx, db, &Adversary{Name: name, Tier: 1, Role: "Standard", HitPoints: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateAdversaryFeature(ctx, db, &AdversaryFeature{AdversaryID: id, Kind: "Passive", Name: "Tough"}); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// addToEncounter adds an adversary to an encounter in its own transaction
+func addToEncounter(t *testing.T, db *sql.DB, encounterID, adversaryID int64, count int) (int64, error) {
+	t.Helper()
+	ctx := context.Background()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	id, err := AddAdversaryToEncounter(ctx, tx, &EncounterAdversary{EncounterID: encounterID, AdversaryID: adversaryID, Count: count})
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// countRows returns the number of rows a COUNT(*) query finds
+func countRows(t *testing.T, db *sql.DB, query string, args ...interface{}) int {
+	t.Helper()
+
+	var n int
+	if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestAddAdversaryToEncounter(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	bear := createTestAdversary(t, db, "Bear")
+	wolf := createTestAdversary(t, db, "Wolf")
+	encounterID, err := CreateEncounter(ctx, db, &Encounter{Name: "Forest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := addToEncounter(t, db, encounterID, bear, 2)
+	if err != nil {
+		t.Fatalf("adding bear: %v", err)
+	}
+	if _, err := addToEncounter(t, db, encounterID, wolf, 3); err != nil {
+		t.Fatalf("adding wolf: %v", err)
+	}
+
+	// Adding the bear again sets its count rather than adding a second row
+	again, err := addToEncounter(t, db, encounterID, bear, 5)
+	if err != nil {
+		t.Fatalf("adding bear again: %v", err)
+	}
+	if again != first {
+		t.Errorf("adding bear again returned membership %d, want %d", again, first)
+	}
+
+	members, err := GetEncounterAdversaries(ctx, db, encounterID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 2 {
+		t.Fatalf("encounter has %d adversaries, want 2", len(members))
+	}
+	if members[0].Adversary.Name != "Bear" || members[0].Count != 5 {
+		t.Errorf("first adversary is %d × %s, want 5 × Bear", members[0].Count, members[0].Adversary.Name)
+	}
+	if members[1].Adversary.Name != "Wolf" || members[1].Count != 3 {
+		t.Errorf("second adversary is %d × %s, want 3 × Wolf", members[1].Count, members[1].Adversary.Name)
+	}
+}
+
+func TestAddAdversaryToEncounterMissing(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	bear := createTestAdversary(t, db, "Bear")
+	encounterID, err := CreateEncounter(ctx, db, &Encounter{Name: "Forest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := addToEncounter(t, db, encounterID, bear+100, 1); err == nil {
+		t.Error("adding a missing adversary succeeded")
+	}
+	if _, err := addToEncounter(t, db, encounterID+100, bear, 1); err == nil {
+		t.Error("adding to a missing encounter succeeded")
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM encounter_adversaries`); n != 0 {
+		t.Errorf("%d memberships stored, want 0", n)
+	}
+}
+
+func TestDeleteAdversaryCascades(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	bear := createTestAdversary(t, db, "Bear")
+	wolf := createTestAdversary(t, db, "Wolf")
+	encounterID, err := CreateEncounter(ctx, db, &Encounter{
+		Name:        "Forest",
+		Adversaries: []*EncounterAdversary{{AdversaryID: bear, Count: 1}, {AdversaryID: wolf, Count: 2}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enc, err := GetEncounterByID(ctx, db, encounterID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionID, err := StartCombatSession(ctx, db, enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteAdversary(ctx, db, bear); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := countRows(t, db, `SELECT COUNT(*) FROM adversary_features WHERE adversary_id = ?`, bear); n != 0 {
+		t.Errorf("%d features of the deleted adversary left, want 0", n)
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM adversary_features WHERE adversary_id = ?`, wolf); n != 1 {
+		t.Errorf("%d features of the other adversary left, want 1", n)
+	}
+
+	members, err := GetEncounterAdversaries(ctx, db, encounterID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 || members[0].AdversaryID != wolf {
+		t.Errorf("encounter has %d adversaries after the delete, want only the wolf", len(members))
+	}
+
+	// Running fights keep their snapshot of the deleted adversary
+	if n := countRows(t, db, `SELECT COUNT(*) FROM combatants WHERE session_id = ? AND adversary_id IS NULL AND name = 'Bear'`, sessionID); n != 1 {
+		t.Errorf("%d detached bear combatants, want 1", n)
+	}
+}
+
+func TestDeleteEncounterCascades(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	bear := createTestAdversary(t, db, "Bear")
+	var encounterIDs []int64
+	for _, name := range []string{"Forest", "Cave"} {
+		id, err := CreateEncounter(ctx, db, &Encounter{
+			Name:        name,
+			Adversaries: []*EncounterAdversary{{AdversaryID: bear, Count: 2}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		encounterIDs = append(encounterIDs, id)
+	}
+
+	enc, err := GetEncounterByID(ctx, db, encounterIDs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionID, err := StartCombatSession(ctx, db, enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteEncounter(ctx, db, encounterIDs[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := countRows(t, db, `SELECT COUNT(*) FROM encounter_adversaries WHERE encounter_id = ?`, encounterIDs[0]); n != 0 {
+		t.Errorf("%d memberships of the deleted encounter left, want 0", n)
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM encounter_adversaries WHERE encounter_id = ?`, encounterIDs[1]); n != 1 {
+		t.Errorf("%d memberships of the other encounter left, want 1", n)
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM combat_sessions WHERE id = ?`, sessionID); n != 0 {
+		t.Errorf("%d combat sessions of the deleted encounter left, want 0", n)
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM combatants WHERE session_id = ?`, sessionID); n != 0 {
+		t.Errorf("%d combatants of the deleted encounter left, want 0", n)
+	}
+
+	// The adversary itself is untouched
+	adv, err := GetAdversaryByID(ctx, db, bear)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adv == nil || len(adv.Features) != 1 {
+		t.Error("deleting an encounter changed its adversary")
+	}
+}
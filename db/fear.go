@@ -0,0 +1,142 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// DefaultFearMax is the Fear a GM can hold unless a session is given a
+// different cap
+const DefaultFearMax = 12
+
+// ErrNotEnoughFear is returned when spending more Fear than the session holds
+var ErrNotEnoughFear = errors.New("not enough Fear")
+
+// FearEntry records a single gain or spend of GM Fear
+type FearEntry struct {
+	ID          int64     `json:"id"`
+	SessionID   int64     `json:"session_id"`
+	Delta       int       `json:"delta"` // positive for gains, negative for spends
+	Reason      string    `json:"reason"`
+	FeatureID   *int64    `json:"feature_id"`
+	FeatureName string    `json:"feature_name"` // name of the linked feature, empty if none
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Amount returns the Fear gained or spent, without its sign
+func (e *FearEntry) Amount() int {
+	if e.Delta < 0 {
+		return -e.Delta
+	}
+	return e.Delta
+}
+
+// ChangeFear gains (positive delta) or spends (negative delta) Fear in a
+// combat session and logs it, optionally against an adversary feature. Gains
+// beyond the session's cap are lost, so the logged delta can be smaller than
+// requested; the applied delta is returned. A change that leaves the pool as
+// it was, such as a gain at the cap, is not logged. Spending more than the
+// session holds fails with ErrNotEnoughFear.
+func ChangeFear(ctx context.Context, db Conn, sessionID int64, delta int, reason string, featureID *int64) (int, error) {
+	err := inTx(ctx, db, func(tx *sql.Tx) error {
+		var err error
+		delta, err = changeFear(ctx, tx, sessionID, delta, reason, featureID)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return delta, nil
+}
+
+// changeFear is ChangeFear within an existing transaction. The update keeps
+// the pool between 0 and the cap, and the delta applied is what the pool
+// holds after it less what it held before. A pool left as it was is not
+// touched at all, so the change leaves nothing for the combat log either.
+func changeFear(ctx context.Context, tx *sql.Tx, sessionID int64, delta int, reason string, featureID *int64) (int, error) {
+	var before int
+	err := tx.QueryRowContext(ctx, `SELECT fear FROM combat_sessions WHERE id = ?`, sessionID).Scan(&before)
+	if err != nil {
+		return 0, err
+	}
+	if before+delta < 0 {
+		return 0, ErrNotEnoughFear
+	}
+
+	var after int
+	err = tx.QueryRowContext(ctx, `
+		UPDATE combat_sessions
+		SET fear = MIN(MAX(fear + ?, 0), fear_max),
+		    updated_at = CASE WHEN MIN(MAX(fear + ?, 0), fear_max) = fear THEN updated_at ELSE CURRENT_TIMESTAMP END
+		WHERE id = ?
+		RETURNING fear
+	`, delta, delta, sessionID).Scan(&after)
+	if err != nil {
+		return 0, err
+	}
+
+	delta = after - before
+	if delta == 0 {
+		return 0, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO fear_log (session_id, delta, reason, feature_id)
+		VALUES (?, ?, ?, ?)
+	`, sessionID, delta, reason, featureID)
+	if err != nil {
+		return 0, err
+	}
+
+	return delta, nil
+}
+
+// SetFearMax changes the Fear cap of a combat session, dropping any Fear
+// held above the new cap
+func SetFearMax(ctx context.Context, db Conn, sessionID int64, fearMax int) error {
+	query := `
+		UPDATE combat_sessions
+		SET fear_max = ?, fear = MIN(fear, ?), updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+
+	_, err := db.ExecContext(ctx, query, fearMax, fearMax, sessionID)
+	return err
+}
+
+// GetFearLog retrieves the Fear log of a combat session, newest first
+func GetFearLog(ctx context.Context, db Conn, sessionID int64) ([]*FearEntry, error) {
+	query := `
+		SELECT l.id, l.session_id, l.delta, l.reason, l.feature_id,
+		       COALESCE(f.name, ''), l.created_at
+		FROM fear_log l
+		LEFT JOIN adversary_features f ON f.id = l.feature_id
+		WHERE l.session_id = ?
+		ORDER BY l.id DESC
+	`
+
+	rows, err := db.QueryContext(ctx, query, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*FearEntry
+	for rows.Next() {
+		e := &FearEntry{}
+		err := rows.Scan(&e.ID, &e.SessionID, &e.Delta, &e.Reason, &e.FeatureID, &e.FeatureName, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,218 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Adversary feature kinds as printed on Daggerheart statblocks
+const (
+	FeaturePassive  = "Passive"
+	FeatureAction   = "Action"
+	FeatureReaction = "Reaction"
+)
+
+// FeatureKinds lists every valid feature kind in display order
+var FeatureKinds = []string{FeaturePassive, FeatureAction, FeatureReaction}
+
+// AdversaryFeature represents a single Passive, Action or Reaction entry
+// on an adversary statblock
+type AdversaryFeature struct {
+	ID          int64     `json:"id"`
+	AdversaryID int64     `json:"adversary_id"`
+	Position    int       `json:"position"`
+	Kind        string    `json:"kind"`
+	Name        string    `json:"name"`
+	Text        string    `json:"text"`
+	FearCost    int       `json:"fear_cost"`   // Fear the GM spends to use the feature, 0 if free
+	StressCost  int       `json:"stress_cost"` // Stress the adversary marks to use the feature, 0 if free
+	Countdown   int       `json:"countdown"`   // Starting value of the feature's countdown, 0 if none
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// SessionFeature is a feature of an adversary taking part in a combat session
+type SessionFeature struct {
+	*AdversaryFeature
+	AdversaryName string
+}
+
+// IsValidFeatureKind reports whether kind is one of the feature kinds
+func IsValidFeatureKind(kind string) bool {
+	for _, k := range FeatureKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// GetAdversaryFeatures retrieves all features of an adversary in statblock order
+func GetAdversaryFeatures(ctx context.Context, db *sql.DB, adversaryID int64) ([]*AdversaryFeature, error) {
+	query := `
+		SELECT id, adversary_id, position, kind, name, text, fear_cost, stress_cost,
+		       countdown, created_at, updated_at
+		FROM adversary_features
+		WHERE adversary_id = ?
+		ORDER BY position ASC, id ASC
+	`
+
+	rows, err := db.QueryContext(ctx, query, adversaryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var features []*AdversaryFeature
+	for rows.Next() {
+		f := &AdversaryFeature{}
+		err := rows.Scan(
+			&f.ID, &f.AdversaryID, &f.Position, &f.Kind, &f.Name, &f.Text,
+			&f.FearCost, &f.StressCost, &f.Countdown, &f.CreatedAt, &f.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		features = append(features, f)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return features, nil
+}
+
+// GetAdversaryFeatureByID retrieves a single feature by ID
+func GetAdversaryFeatureByID(ctx context.Context, db *sql.DB, id int64) (*AdversaryFeature, error) {
+	query := `
+		SELECT id, adversary_id, position, kind, name, text, fear_cost, stress_cost,
+		       countdown, created_at, updated_at
+		FROM adversary_features
+		WHERE id = ?
+	`
+
+	f := &AdversaryFeature{}
+	err := db.QueryRowContext(ctx, query, id).Scan(
+		&f.ID, &f.AdversaryID, &f.Position, &f.Kind, &f.Name, &f.Text,
+		&f.FearCost, &f.StressCost, &f.Countdown, &f.CreatedAt, &f.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// CreateAdversaryFeature appends a new feature to the end of an adversary's statblock
+func CreateAdversaryFeature(ctx context.Context, db *sql.DB, f *AdversaryFeature) (int64, error) {
+	query := `
+		INSERT INTO adversary_features (
+			adversary_id, position, kind, name, text, fear_cost, stress_cost, countdown
+		) VALUES (
+			?, (SELECT COALESCE(MAX(position), -1) + 1 FROM adversary_features WHERE adversary_id = ?),
+			?, ?, ?, ?, ?, ?
+		)
+	`
+
+	result, err := db.ExecContext(
+		ctx, query,
+		f.AdversaryID, f.AdversaryID, f.Kind, f.Name, f.Text, f.FearCost, f.StressCost, f.Countdown,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+// UpdateAdversaryFeature updates an existing feature. The position is left
+// untouched; use ReorderAdversaryFeatures to move features.
+func UpdateAdversaryFeature(ctx context.Context, db *sql.DB, f *AdversaryFeature) error {
+	query := `
+		UPDATE adversary_features
+		SET kind = ?, name = ?, text = ?, fear_cost = ?, stress_cost = ?, countdown = ?,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+
+	_, err := db.ExecContext(ctx, query, f.Kind, f.Name, f.Text, f.FearCost, f.StressCost, f.Countdown, f.ID)
+	return err
+}
+
+// DeleteAdversaryFeature removes a feature from the database
+func DeleteAdversaryFeature(ctx context.Context, db *sql.DB, id int64) error {
+	query := `DELETE FROM adversary_features WHERE id = ?`
+	_, err := db.ExecContext(ctx, query, id)
+	return err
+}
+
+// ReorderAdversaryFeatures stores a new statblock order for an adversary's
+// features. featureIDs lists the feature IDs in their new order; IDs that do
+// not belong to the adversary are ignored.
+func ReorderAdversaryFeatures(ctx context.Context, db *sql.DB, adversaryID int64, featureIDs []int64) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE adversary_features
+		SET position = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND adversary_id = ?
+	`
+
+	for position, id := range featureIDs {
+		if _, err := tx.ExecContext(ctx, query, position, id, adversaryID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetSessionFeatures retrieves the features of every adversary taking part
+// in a combat session
+func GetSessionFeatures(ctx context.Context, db *sql.DB, sessionID int64) ([]*SessionFeature, error) {
+	query := `
+		SELECT f.id, f.adversary_id, f.position, f.kind, f.name, f.text,
+		       f.fear_cost, f.stress_cost, f.countdown, f.created_at, f.updated_at,
+		       a.name
+		FROM adversary_features f
+		JOIN adversaries a ON a.id = f.adversary_id
+		WHERE f.adversary_id IN (
+			SELECT adversary_id FROM combatants WHERE session_id = ?
+		)
+		ORDER BY a.name ASC, f.position ASC, f.id ASC
+	`
+
+	rows, err := db.QueryContext(ctx, query, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var features []*SessionFeature
+	for rows.Next() {
+		f := &SessionFeature{AdversaryFeature: &AdversaryFeature{}}
+		err := rows.Scan(
+			&f.ID, &f.AdversaryID, &f.Position, &f.Kind, &f.Name, &f.Text,
+			&f.FearCost, &f.StressCost, &f.Countdown, &f.CreatedAt, &f.UpdatedAt, &f.AdversaryName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		features = append(features, f)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return features, nil
+}
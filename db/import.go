@@ -0,0 +1,217 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Import conflict policies, for imported adversaries whose name is already
+// taken in the bestiary
+const (
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictRename    = "rename"
+)
+
+// ConflictPolicies lists the valid conflict policies
+var ConflictPolicies = []string{ConflictSkip, ConflictOverwrite, ConflictRename}
+
+// What an import does with each adversary
+const (
+	ImportCreate    = "create"
+	ImportSkip      = "skip"
+	ImportOverwrite = "overwrite"
+	ImportRename    = "rename"
+)
+
+// ImportItem is the planned or applied import of a single adversary
+type ImportItem struct {
+	Adversary  *Adversary // the imported statblock, with its features
+	Action     string
+	Name       string // name the adversary is stored under
+	ExistingID int64  // adversary whose name it matched, 0 if none
+	ID         int64  // adversary created or overwritten, set once applied
+}
+
+// IsValidConflictPolicy reports whether policy is one of the conflict policies
+func IsValidConflictPolicy(policy string) bool {
+	for _, p := range ConflictPolicies {
+		if p == policy {
+			return true
+		}
+	}
+	return false
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// PlanImport works out what importing adversaries would do under a conflict
+// policy, without changing anything. Names are matched case-insensitively,
+// against the bestiary and against earlier adversaries in the same import.
+func PlanImport(ctx context.Context, db *sql.DB, adversaries []*Adversary, policy string) ([]*ImportItem, error) {
+	return planImport(ctx, db, adversaries, policy)
+}
+
+// ImportAdversaries imports adversaries with their features in a single
+// transaction, resolving name conflicts with the given policy. Overwriting an
+// adversary replaces its statblock and all of its features.
+func ImportAdversaries(ctx context.Context, db *sql.DB, adversaries []*Adversary, policy string) ([]*ImportItem, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Plan inside the transaction so the names cannot change underneath it
+	items, err := planImport(ctx, tx, adversaries, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		// Imported adversaries always become homebrew, even copies of
+		// library adversaries
+		adv := *item.Adversary
+		adv.Name = item.Name
+		adv.Source = SourceHomebrew
+
+		switch item.Action {
+		case ImportCreate, ImportRename:
+			id, err := insertAdversary(ctx, tx, &adv)
+			if err != nil {
+				return nil, err
+			}
+			item.ID = id
+
+		case ImportOverwrite:
+			adv.ID = item.ExistingID
+			if err := updateAdversary(ctx, tx, &adv); err != nil {
+				return nil, err
+			}
+			item.ID = adv.ID
+
+		default:
+			continue
+		}
+
+		if err := replaceFeatures(ctx, tx, item.ID, adv.Features); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// planImport works out an import against the adversaries already in the
+// database
+func planImport(ctx context.Context, db queryer, adversaries []*Adversary, policy string) ([]*ImportItem, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id, name, source FROM adversaries`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var existing []*Adversary
+	for rows.Next() {
+		adv := &Adversary{}
+		if err := rows.Scan(&adv.ID, &adv.Name, &adv.Source); err != nil {
+			return nil, err
+		}
+		existing = append(existing, adv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return planImportItems(existing, adversaries, policy)
+}
+
+// planImportItems works out an import against existing, the bestiary's
+// adversaries with at least their ID, name and source
+func planImportItems(existing, adversaries []*Adversary, policy string) ([]*ImportItem, error) {
+	if !IsValidConflictPolicy(policy) {
+		return nil, fmt.Errorf("unknown conflict policy %q", policy)
+	}
+
+	// Lowercased name to adversary ID; 0 for names taken earlier in the
+	// import. Read-only adversaries are never overwritten.
+	taken := make(map[string]int64)
+	readOnly := make(map[int64]bool)
+	for _, adv := range existing {
+		taken[strings.ToLower(adv.Name)] = adv.ID
+		readOnly[adv.ID] = adv.ReadOnly()
+	}
+
+	items := make([]*ImportItem, len(adversaries))
+	for i, adv := range adversaries {
+		item := &ImportItem{Adversary: adv, Action: ImportCreate, Name: adv.Name}
+		items[i] = item
+
+		existingID, conflict := taken[strings.ToLower(adv.Name)]
+		if !conflict {
+			taken[strings.ToLower(adv.Name)] = 0
+			continue
+		}
+		item.ExistingID = existingID
+
+		switch {
+		case policy == ConflictRename:
+			item.Action = ImportRename
+			item.Name = uniqueName(adv.Name, taken)
+			taken[strings.ToLower(item.Name)] = 0
+
+		case policy == ConflictOverwrite && existingID != 0 && !readOnly[existingID]:
+			item.Action = ImportOverwrite
+
+		default:
+			// Skipped, a read-only adversary, or a duplicate within the
+			// import that cannot overwrite an adversary that does not exist
+			// yet
+			item.Action = ImportSkip
+		}
+	}
+
+	return items, nil
+}
+
+// uniqueName appends the lowest number that makes name unused, e.g.
+// "Goblin (2)"
+func uniqueName(name string, taken map[string]int64) string {
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)", name, n)
+		if _, ok := taken[strings.ToLower(candidate)]; !ok {
+			return candidate
+		}
+	}
+}
+
+// replaceFeatures replaces all features of an adversary, keeping the order
+// they are given in
+func replaceFeatures(ctx context.Context, tx *sql.Tx, adversaryID int64, features []*AdversaryFeature) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM adversary_features WHERE adversary_id = ?`, adversaryID); err != nil {
+		return err
+	}
+
+	for position, f := range features {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO adversary_features (
+				adversary_id, position, kind, name, text, fear_cost, stress_cost,
+				countdown
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, adversaryID, position, f.Kind, f.Name, f.Text, f.FearCost, f.StressCost, f.Countdown)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
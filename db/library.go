@@ -0,0 +1,54 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+// SeedLibrary stores the SRD library adversaries as read-only SRD
+// adversaries, in a single transaction. Library adversaries already seeded
+// are matched by name and brought up to date, so seeding again after an
+// upgrade refreshes them. Homebrew adversaries are never touched.
+func SeedLibrary(ctx context.Context, db *sql.DB, adversaries []*Adversary) (created, updated int, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	for _, a := range adversaries {
+		adv := *a
+		adv.Source = SourceSRD
+
+		var id int64
+		err := tx.QueryRowContext(ctx, `
+			SELECT id FROM adversaries WHERE source = ? AND name = ?
+		`, SourceSRD, adv.Name).Scan(&id)
+
+		if err == sql.ErrNoRows {
+			id, err = insertAdversary(ctx, tx, &adv)
+			if err != nil {
+				return 0, 0, err
+			}
+			created++
+		} else if err != nil {
+			return 0, 0, err
+		} else {
+			adv.ID = id
+			if err := updateAdversary(ctx, tx, &adv); err != nil {
+				return 0, 0, err
+			}
+			updated++
+		}
+
+		if err := replaceFeatures(ctx, tx, id, adv.Features); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+
+	return created, updated, nil
+}
@@ -0,0 +1,230 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Errors returned for list options a query cannot honour
+var (
+	ErrInvalidSort   = errors.New("invalid sort field")
+	ErrInvalidCursor = errors.New("invalid page cursor")
+)
+
+// ListOptions filters, sorts and pages the adversary and encounter lists.
+// The zero value lists everything by name.
+type ListOptions struct {
+	// Adversaries of this type (case-insensitive), tier, role and tag.
+	// Encounters match on their party tier, and on the type, role and tag of
+	// any adversary in them.
+	Type string
+	Tier int
+	Role string
+	Tag  string
+
+	Sort  string // a field of AdversarySortFields or EncounterSortFields; "name" if empty
+	Desc  bool
+	After string // cursor returned with the previous page
+	Limit int    // page size; 0 for no limit
+}
+
+// Filtered reports whether any filter is set
+func (o ListOptions) Filtered() bool {
+	return o.Type != "" || o.Tier != 0 || o.Role != "" || o.Tag != ""
+}
+
+// Matches reports whether an adversary passes the filters, for lists that
+// are not loaded through GetAllAdversaries
+func (o ListOptions) Matches(adv *Adversary) bool {
+	if o.Type != "" && !strings.EqualFold(adv.Type, o.Type) {
+		return false
+	}
+	if o.Tier != 0 && adv.Tier != o.Tier {
+		return false
+	}
+	if o.Role != "" && adv.Role != o.Role {
+		return false
+	}
+	if o.Tag != "" && !adv.HasTag(o.Tag) {
+		return false
+	}
+	return true
+}
+
+// sortField is a column a list can be sorted by
+type sortField struct {
+	column  string
+	numeric bool
+}
+
+// AdversarySortFields lists the fields adversaries can be sorted by
+var AdversarySortFields = []string{"name", "tier", "role", "type", "difficulty", "created"}
+
+// EncounterSortFields lists the fields encounters can be sorted by
+var EncounterSortFields = []string{"name", "tier", "created"}
+
+var adversarySorts = map[string]sortField{
+	"name":       {"a.name", false},
+	"tier":       {"a.tier", true},
+	"role":       {"a.role", false},
+	"type":       {"a.type", false},
+	"difficulty": {"a.difficulty", true},
+	"created":    {"a.created_at", false},
+}
+
+var encounterSorts = map[string]sortField{
+	"name":    {"e.name", false},
+	"tier":    {"e.party_tier", true},
+	"created": {"e.created_at", false},
+}
+
+// cursor is the position after the last row of a page: the sort it was
+// taken from, that row's sort key and its ID to break ties
+type cursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v"`
+	ID    int64  `json:"id"`
+}
+
+// encode returns the cursor as an opaque, URL-safe string
+func (c cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// listQuery is the ORDER BY, keyset condition and LIMIT that ListOptions add
+// to a list query
+type listQuery struct {
+	sort    string
+	field   sortField
+	desc    bool
+	limit   int
+	where   string // empty on the first page
+	args    []interface{}
+	orderBy string
+}
+
+// newListQuery resolves the sort and cursor of opts against the sortable
+// fields of a list; idColumn breaks ties
+func newListQuery(opts ListOptions, sorts map[string]sortField, idColumn string) (*listQuery, error) {
+	sort := sortName(opts)
+	field, ok := sorts[sort]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+
+	q := &listQuery{sort: sort, field: field, desc: opts.Desc, limit: opts.Limit}
+	dir, cmp := "ASC", ">"
+	if opts.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	q.orderBy = field.column + " " + dir + ", " + idColumn + " " + dir
+
+	c, err := parseCursor(opts)
+	if err != nil || c == nil {
+		return q, err
+	}
+
+	var value interface{} = c.Value
+	if field.numeric {
+		n, err := strconv.ParseInt(c.Value, 10, 64)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		value = n
+	}
+
+	q.where = "(" + field.column + " " + cmp + " ? OR (" + field.column + " = ? AND " + idColumn + " " + cmp + " ?))"
+	q.args = []interface{}{value, value, c.ID}
+	return q, nil
+}
+
+// sortName is the field opts sorts by
+func sortName(opts ListOptions) string {
+	if opts.Sort == "" {
+		return "name"
+	}
+	return opts.Sort
+}
+
+// parseCursor decodes the cursor of opts, checking it was taken from the
+// same sort. It returns nil for the first page.
+func parseCursor(opts ListOptions) (*cursor, error) {
+	if opts.After == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(opts.After)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Sort != sortName(opts) || c.Desc != opts.Desc {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// keyColumn selects the sort key as text, so it can go in a cursor
+func (q *listQuery) keyColumn() string {
+	return "CAST(" + q.field.column + " AS TEXT)"
+}
+
+// suffix is the ORDER BY and LIMIT clauses of the query. One row more than
+// the page size is fetched, to tell whether there is a next page.
+func (q *listQuery) suffix() string {
+	s := " ORDER BY " + q.orderBy
+	if q.limit > 0 {
+		s += " LIMIT " + strconv.Itoa(q.limit+1)
+	}
+	return s
+}
+
+// hasMore reports whether n fetched rows overflow the page, so there is a
+// next page
+func (q *listQuery) hasMore(n int) bool {
+	return q.limit > 0 && n > q.limit
+}
+
+// cursorAfter returns the cursor of the page after the row with the given
+// sort key and ID
+func (q *listQuery) cursorAfter(key string, id int64) string {
+	return cursor{Sort: q.sort, Desc: q.desc, Value: key, ID: id}.encode()
+}
+
+// adversaryFilters returns the conditions and arguments that filter the
+// adversaries table, aliased as "a", by opts
+func adversaryFilters(opts ListOptions) ([]string, []interface{}) {
+	var where []string
+	var args []interface{}
+	if opts.Type != "" {
+		where = append(where, "a.type = ? COLLATE NOCASE")
+		args = append(args, opts.Type)
+	}
+	if opts.Tier != 0 {
+		where = append(where, "a.tier = ?")
+		args = append(args, opts.Tier)
+	}
+	if opts.Role != "" {
+		where = append(where, "a.role = ?")
+		args = append(args, opts.Role)
+	}
+	if opts.Tag != "" {
+		where = append(where, "instr(',' || a.tags || ',', ',' || ? || ',') > 0")
+		args = append(args, strings.ToLower(strings.TrimSpace(opts.Tag)))
+	}
+	return where, args
+}
+
+// whereClause joins conditions into a WHERE clause, or returns "" if there
+// are none
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
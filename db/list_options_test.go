@@ -0,0 +1,185 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// createSortTestAdversaries stores adversaries whose names, tiers and
+// creation times repeat, so every sort has ties for the ID to break
+func createSortTestAdversaries(t *testing.T, db *sql.DB) {
+	t.Helper()
+	ctx := context.Background()
+
+	for i, adv := range []struct {
+		name string
+		tier int
+	}{
+		{"Bear", 2}, {"Wolf", 1}, {"Bear", 1}, {"Rat", 1},
+		{"Wolf", 3}, {"Bear", 1}, {"Ooze", 2},
+	} {
+		_, err := CreateAdversary(ctx, db, &Adversary{Name: adv.name, Tier: adv.tier, Role: RoleStandard, Difficulty: 10 + i%2})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// adversaryIDs returns the IDs of adversaries in list order
+func adversaryIDs(adversaries []*Adversary) []int64 {
+	ids := make([]int64, len(adversaries))
+	for i, adv := range adversaries {
+		ids[i] = adv.ID
+	}
+	return ids
+}
+
+// pageAdversaries lists adversaries a page at a time, following the cursors
+// to the last page, and returns them in order with the size of each page
+func pageAdversaries(t *testing.T, db *sql.DB, opts ListOptions) ([]*Adversary, []int) {
+	t.Helper()
+
+	var all []*Adversary
+	var sizes []int
+	for {
+		page, next, err := GetAllAdversaries(context.Background(), db, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, page...)
+		sizes = append(sizes, len(page))
+		if next == "" {
+			return all, sizes
+		}
+		if len(sizes) > 10 {
+			t.Fatal("paging does not end")
+		}
+		opts.After = next
+	}
+}
+
+func TestListCursor(t *testing.T) {
+	db := newTestDB(t)
+	createSortTestAdversaries(t, db)
+
+	for _, sort := range AdversarySortFields {
+		for _, desc := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s desc %v", sort, desc), func(t *testing.T) {
+				opts := ListOptions{Sort: sort, Desc: desc}
+				want, _, err := GetAllAdversaries(context.Background(), db, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// Pages hold every adversary once, in the order of the whole
+				// list, across ties in the sort key
+				opts.Limit = 2
+				got, sizes := pageAdversaries(t, db, opts)
+				if fmt.Sprint(adversaryIDs(got)) != fmt.Sprint(adversaryIDs(want)) {
+					t.Errorf("paged %v, want %v", adversaryIDs(got), adversaryIDs(want))
+				}
+				if fmt.Sprint(sizes) != "[2 2 2 1]" {
+					t.Errorf("page sizes %v, want [2 2 2 1]", sizes)
+				}
+			})
+		}
+	}
+}
+
+func TestListCursorOrder(t *testing.T) {
+	db := newTestDB(t)
+	createSortTestAdversaries(t, db)
+
+	// Ties on the sort key are broken by ID, in the same direction
+	adversaries, _, err := GetAllAdversaries(context.Background(), db, ListOptions{Sort: "tier"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(adversaryIDs(adversaries)); got != "[2 3 4 6 1 7 5]" {
+		t.Errorf("by tier: %s", got)
+	}
+
+	adversaries, _, err = GetAllAdversaries(context.Background(), db, ListOptions{Sort: "name", Desc: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(adversaryIDs(adversaries)); got != "[5 2 4 7 6 3 1]" {
+		t.Errorf("by name, descending: %s", got)
+	}
+}
+
+func TestListCursorLastPage(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	createSortTestAdversaries(t, db)
+
+	// A page that ends the list exactly has no next page
+	page, next, err := GetAllAdversaries(ctx, db, ListOptions{Limit: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 7 || next != "" {
+		t.Errorf("page of the whole list: %d adversaries, cursor %q", len(page), next)
+	}
+
+	// Following the cursor past the last adversary finds nothing
+	page, next, err = GetAllAdversaries(ctx, db, ListOptions{Limit: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 6 || next == "" {
+		t.Fatalf("first page: %d adversaries, cursor %q", len(page), next)
+	}
+	page, next, err = GetAllAdversaries(ctx, db, ListOptions{Limit: 6, After: next})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 1 || next != "" {
+		t.Errorf("last page: %d adversaries, cursor %q", len(page), next)
+	}
+	last := cursor{Sort: "name", Value: page[0].Name, ID: page[0].ID}.encode()
+	page, next, err = GetAllAdversaries(ctx, db, ListOptions{Limit: 6, After: last})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 0 || next != "" {
+		t.Errorf("past the last page: %d adversaries, cursor %q", len(page), next)
+	}
+}
+
+func TestListCursorInvalid(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	createSortTestAdversaries(t, db)
+
+	_, byTier, err := GetAllAdversaries(ctx, db, ListOptions{Sort: "tier", Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts ListOptions
+		want error
+	}{
+		{"not base64", ListOptions{Sort: "tier", After: "not a cursor!"}, ErrInvalidCursor},
+		{"not JSON", ListOptions{Sort: "tier", After: "bm90IGpzb24"}, ErrInvalidCursor},
+		{"another sort", ListOptions{Sort: "name", After: byTier}, ErrInvalidCursor},
+		{"another direction", ListOptions{Sort: "tier", Desc: true, After: byTier}, ErrInvalidCursor},
+		{"tampered key", ListOptions{Sort: "tier", After: cursor{Sort: "tier", Value: "1 OR 1=1", ID: 1}.encode()}, ErrInvalidCursor},
+		{"unknown sort", ListOptions{Sort: "hit_points"}, ErrInvalidSort},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := GetAllAdversaries(ctx, db, tt.opts); !errors.Is(err, tt.want) {
+				t.Errorf("adversaries: %v, want %v", err, tt.want)
+			}
+			if _, _, err := GetAllEncounters(ctx, db, tt.opts); !errors.Is(err, tt.want) {
+				t.Errorf("encounters: %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
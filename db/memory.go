@@ -0,0 +1,759 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an AdversaryStore and EncounterStore that keeps everything
+// in memory, for tests and throwaway sessions. It is safe for concurrent use,
+// and never shares its records with callers: it stores and returns copies.
+// Search always uses substring matching, like SQLite without FTS5.
+type MemoryStore struct {
+	mu sync.RWMutex
+
+	adversaries map[int64]*Adversary        // without features
+	features    map[int64]*AdversaryFeature // keyed by feature ID
+	encounters  map[int64]*Encounter        // without adversaries
+	members     map[int64]*EncounterAdversary
+
+	lastAdversaryID int64
+	lastFeatureID   int64
+	lastEncounterID int64
+	lastMemberID    int64
+}
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		adversaries: make(map[int64]*Adversary),
+		features:    make(map[int64]*AdversaryFeature),
+		encounters:  make(map[int64]*Encounter),
+		members:     make(map[int64]*EncounterAdversary),
+	}
+}
+
+// memoryNow is the timestamp given to records as they are written
+func memoryNow() time.Time {
+	return time.Now().UTC()
+}
+
+// memoryKey is the sort key of a record in a MemoryStore list
+type memoryKey struct {
+	text string
+	num  int64
+	id   int64
+}
+
+// less orders keys by their text or number, then by ID
+func (k memoryKey) less(o memoryKey, numeric bool) bool {
+	if numeric && k.num != o.num {
+		return k.num < o.num
+	}
+	if !numeric && k.text != o.text {
+		return k.text < o.text
+	}
+	return k.id < o.id
+}
+
+// value is the key as it is stored in a cursor
+func (k memoryKey) value(numeric bool) string {
+	if numeric {
+		return strconv.FormatInt(k.num, 10)
+	}
+	return k.text
+}
+
+// memoryTime formats a timestamp as a sort key that orders like the time
+func memoryTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000000000Z")
+}
+
+// memoryPage sorts and pages the records of a list the way the SQL list
+// queries do. keys holds each record's sort key for every sortable field; it
+// returns the indexes of the records on the page, in order, and the cursor
+// of the next page.
+func memoryPage(keys []map[string]memoryKey, sorts map[string]sortField, opts ListOptions) ([]int, string, error) {
+	name := sortName(opts)
+	field, ok := sorts[name]
+	if !ok {
+		return nil, "", ErrInvalidSort
+	}
+	c, err := parseCursor(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	before := func(a, b memoryKey) bool {
+		if opts.Desc {
+			return b.less(a, field.numeric)
+		}
+		return a.less(b, field.numeric)
+	}
+
+	var order []int
+	var after memoryKey
+	if c != nil {
+		after = memoryKey{text: c.Value, id: c.ID}
+		if field.numeric {
+			if after.num, err = strconv.ParseInt(c.Value, 10, 64); err != nil {
+				return nil, "", ErrInvalidCursor
+			}
+		}
+	}
+	for i := range keys {
+		if c == nil || before(after, keys[i][name]) {
+			order = append(order, i)
+		}
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return before(keys[order[i]][name], keys[order[j]][name])
+	})
+
+	if opts.Limit > 0 && len(order) > opts.Limit {
+		order = order[:opts.Limit]
+		last := keys[order[len(order)-1]][name]
+		next := cursor{Sort: name, Desc: opts.Desc, Value: last.value(field.numeric), ID: last.id}
+		return order, next.encode(), nil
+	}
+	return order, "", nil
+}
+
+// copyAdversary returns a copy of a stored adversary with its features
+func (m *MemoryStore) copyAdversary(adv *Adversary, withFeatures bool) *Adversary {
+	cp := *adv
+	cp.Features = nil
+	if withFeatures {
+		cp.Features = m.adversaryFeatures(adv.ID)
+	}
+	return &cp
+}
+
+// adversaryFeatures returns copies of an adversary's features in statblock
+// order
+func (m *MemoryStore) adversaryFeatures(adversaryID int64) []*AdversaryFeature {
+	var features []*AdversaryFeature
+	for _, f := range m.features {
+		if f.AdversaryID == adversaryID {
+			cp := *f
+			features = append(features, &cp)
+		}
+	}
+	sort.Slice(features, func(i, j int) bool {
+		if features[i].Position != features[j].Position {
+			return features[i].Position < features[j].Position
+		}
+		return features[i].ID < features[j].ID
+	})
+	return features
+}
+
+// ListAdversaries lists the adversaries matching opts
+func (m *MemoryStore) ListAdversaries(ctx context.Context, opts ListOptions) ([]*Adversary, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var matched []*Adversary
+	var keys []map[string]memoryKey
+	for _, adv := range m.adversaries {
+		if !opts.Matches(adv) {
+			continue
+		}
+		matched = append(matched, adv)
+		keys = append(keys, map[string]memoryKey{
+			"name":       {text: adv.Name, id: adv.ID},
+			"tier":       {num: int64(adv.Tier), id: adv.ID},
+			"role":       {text: adv.Role, id: adv.ID},
+			"type":       {text: adv.Type, id: adv.ID},
+			"difficulty": {num: int64(adv.Difficulty), id: adv.ID},
+			"created":    {text: memoryTime(adv.CreatedAt), id: adv.ID},
+		})
+	}
+
+	order, next, err := memoryPage(keys, adversarySorts, opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var adversaries []*Adversary
+	for _, i := range order {
+		adversaries = append(adversaries, m.copyAdversary(matched[i], false))
+	}
+	return adversaries, next, nil
+}
+
+// SearchAdversaries finds the adversaries containing every word of query,
+// name matches first
+func (m *MemoryStore) SearchAdversaries(ctx context.Context, query string, limit int) ([]*SearchResult, error) {
+	terms := searchTerms(query)
+	results := []*SearchResult{}
+	if len(terms) == 0 {
+		return results, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, adv := range m.adversaries {
+		var featureText []string
+		for _, f := range m.adversaryFeatures(adv.ID) {
+			featureText = append(featureText, f.Name+": "+f.Text)
+		}
+		features := strings.Join(featureText, " ")
+
+		text := strings.ToLower(strings.Join([]string{adv.Name, adv.Description, adv.MotivesTactics, features}, "\n"))
+		matched := true
+		for _, term := range terms {
+			if !strings.Contains(text, term) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			results = append(results, &SearchResult{
+				Adversary: m.copyAdversary(adv, false),
+				Snippet:   likeSnippet(terms, adv.Name, adv.Description, adv.MotivesTactics, features),
+			})
+		}
+	}
+
+	nameMatch := func(r *SearchResult) bool {
+		return strings.Contains(strings.ToLower(r.Adversary.Name), terms[0])
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if nameMatch(a) != nameMatch(b) {
+			return nameMatch(a)
+		}
+		if a.Adversary.Name != b.Adversary.Name {
+			return a.Adversary.Name < b.Adversary.Name
+		}
+		return a.Adversary.ID < b.Adversary.ID
+	})
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// GetAdversary returns an adversary with its features
+func (m *MemoryStore) GetAdversary(ctx context.Context, id int64) (*Adversary, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	adv, ok := m.adversaries[id]
+	if !ok {
+		return nil, nil
+	}
+	return m.copyAdversary(adv, true), nil
+}
+
+// CreateAdversary stores a new adversary's statblock, without its features
+func (m *MemoryStore) CreateAdversary(ctx context.Context, adv *Adversary) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.insertAdversary(adv), nil
+}
+
+// insertAdversary stores a copy of an adversary's statblock. Adversaries
+// without a source are homebrew.
+func (m *MemoryStore) insertAdversary(adv *Adversary) int64 {
+	m.lastAdversaryID++
+	cp := *adv
+	cp.ID = m.lastAdversaryID
+	cp.Features = nil
+	cp.Tags = NormalizeTags(cp.Tags)
+	if cp.Source == "" {
+		cp.Source = SourceHomebrew
+	}
+	cp.CreatedAt = memoryNow()
+	cp.UpdatedAt = cp.CreatedAt
+	m.adversaries[cp.ID] = &cp
+	return cp.ID
+}
+
+// UpdateAdversary replaces an adversary's statblock, keeping its source and
+// features
+func (m *MemoryStore) UpdateAdversary(ctx context.Context, adv *Adversary) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.updateAdversary(adv)
+	return nil
+}
+
+// updateAdversary replaces a stored adversary's statblock, if there is one
+func (m *MemoryStore) updateAdversary(adv *Adversary) {
+	existing, ok := m.adversaries[adv.ID]
+	if !ok {
+		return
+	}
+
+	cp := *adv
+	cp.Features = nil
+	cp.Tags = NormalizeTags(cp.Tags)
+	cp.Source = existing.Source
+	cp.CreatedAt = existing.CreatedAt
+	cp.UpdatedAt = memoryNow()
+	m.adversaries[cp.ID] = &cp
+}
+
+// DeleteAdversary removes an adversary, its features and its place in any
+// encounter
+func (m *MemoryStore) DeleteAdversary(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.adversaries, id)
+	for fid, f := range m.features {
+		if f.AdversaryID == id {
+			delete(m.features, fid)
+		}
+	}
+	for mid, ea := range m.members {
+		if ea.AdversaryID == id {
+			delete(m.members, mid)
+		}
+	}
+	return nil
+}
+
+// GetAdversaryFeatures returns an adversary's features in statblock order
+func (m *MemoryStore) GetAdversaryFeatures(ctx context.Context, adversaryID int64) ([]*AdversaryFeature, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.adversaryFeatures(adversaryID), nil
+}
+
+// GetAdversaryFeature returns a single feature
+func (m *MemoryStore) GetAdversaryFeature(ctx context.Context, id int64) (*AdversaryFeature, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	f, ok := m.features[id]
+	if !ok {
+		return nil, nil
+	}
+	cp := *f
+	return &cp, nil
+}
+
+// CreateAdversaryFeature appends a feature to the end of an adversary's
+// statblock
+func (m *MemoryStore) CreateAdversaryFeature(ctx context.Context, f *AdversaryFeature) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.adversaries[f.AdversaryID]; !ok {
+		return 0, fmt.Errorf("adversary %d does not exist", f.AdversaryID)
+	}
+
+	position := 0
+	for _, existing := range m.features {
+		if existing.AdversaryID == f.AdversaryID && existing.Position >= position {
+			position = existing.Position + 1
+		}
+	}
+	return m.insertFeature(f, position), nil
+}
+
+// insertFeature stores a copy of a feature at a position
+func (m *MemoryStore) insertFeature(f *AdversaryFeature, position int) int64 {
+	m.lastFeatureID++
+	cp := *f
+	cp.ID = m.lastFeatureID
+	cp.Position = position
+	cp.CreatedAt = memoryNow()
+	cp.UpdatedAt = cp.CreatedAt
+	m.features[cp.ID] = &cp
+	return cp.ID
+}
+
+// ReorderAdversaryFeatures stores a new statblock order for an adversary's
+// features, ignoring IDs of other adversaries' features
+func (m *MemoryStore) ReorderAdversaryFeatures(ctx context.Context, adversaryID int64, featureIDs []int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for position, id := range featureIDs {
+		if f, ok := m.features[id]; ok && f.AdversaryID == adversaryID {
+			f.Position = position
+			f.UpdatedAt = memoryNow()
+		}
+	}
+	return nil
+}
+
+// DeleteAdversaryFeature removes a feature
+func (m *MemoryStore) DeleteAdversaryFeature(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.features, id)
+	return nil
+}
+
+// replaceFeatures replaces all features of an adversary, keeping the order
+// they are given in
+func (m *MemoryStore) replaceFeatures(adversaryID int64, features []*AdversaryFeature) {
+	for id, f := range m.features {
+		if f.AdversaryID == adversaryID {
+			delete(m.features, id)
+		}
+	}
+	for position, f := range features {
+		cp := *f
+		cp.AdversaryID = adversaryID
+		m.insertFeature(&cp, position)
+	}
+}
+
+// PlanImport works out what importing adversaries would do under a conflict
+// policy, without changing anything
+func (m *MemoryStore) PlanImport(ctx context.Context, adversaries []*Adversary, policy string) ([]*ImportItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return planImportItems(m.adversaryList(), adversaries, policy)
+}
+
+// adversaryList returns the stored adversaries
+func (m *MemoryStore) adversaryList() []*Adversary {
+	adversaries := make([]*Adversary, 0, len(m.adversaries))
+	for _, adv := range m.adversaries {
+		adversaries = append(adversaries, adv)
+	}
+	return adversaries
+}
+
+// ImportAdversaries imports adversaries with their features as homebrew,
+// resolving name conflicts with the given policy
+func (m *MemoryStore) ImportAdversaries(ctx context.Context, adversaries []*Adversary, policy string) ([]*ImportItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	items, err := planImportItems(m.adversaryList(), adversaries, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		adv := *item.Adversary
+		adv.Name = item.Name
+		adv.Source = SourceHomebrew
+
+		switch item.Action {
+		case ImportCreate, ImportRename:
+			item.ID = m.insertAdversary(&adv)
+
+		case ImportOverwrite:
+			adv.ID = item.ExistingID
+			m.updateAdversary(&adv)
+			item.ID = adv.ID
+
+		default:
+			continue
+		}
+
+		m.replaceFeatures(item.ID, item.Adversary.Features)
+	}
+
+	return items, nil
+}
+
+// SeedLibrary stores the SRD library adversaries as read-only SRD
+// adversaries, refreshing those already seeded
+func (m *MemoryStore) SeedLibrary(ctx context.Context, adversaries []*Adversary) (created, updated int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	seeded := make(map[string]int64)
+	for _, adv := range m.adversaries {
+		if adv.Source == SourceSRD {
+			seeded[adv.Name] = adv.ID
+		}
+	}
+
+	for _, a := range adversaries {
+		adv := *a
+		adv.Source = SourceSRD
+
+		id, ok := seeded[adv.Name]
+		if ok {
+			adv.ID = id
+			m.updateAdversary(&adv)
+			updated++
+		} else {
+			id = m.insertAdversary(&adv)
+			seeded[adv.Name] = id
+			created++
+		}
+
+		m.replaceFeatures(id, a.Features)
+	}
+
+	return created, updated, nil
+}
+
+// encounterAdversaries returns copies of an encounter's adversaries with
+// their statblocks, ordered by adversary name
+func (m *MemoryStore) encounterAdversaries(encounterID int64) []*EncounterAdversary {
+	var members []*EncounterAdversary
+	for _, ea := range m.members {
+		if ea.EncounterID == encounterID {
+			cp := *ea
+			cp.Adversary = m.copyAdversary(m.adversaries[ea.AdversaryID], false)
+			members = append(members, &cp)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		a, b := members[i], members[j]
+		if a.Adversary.Name != b.Adversary.Name {
+			return a.Adversary.Name < b.Adversary.Name
+		}
+		return a.ID < b.ID
+	})
+	return members
+}
+
+// ListEncounters lists the encounters matching opts, with their adversaries
+func (m *MemoryStore) ListEncounters(ctx context.Context, opts ListOptions) ([]*Encounter, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// The adversary filters match encounters with any such adversary
+	adversaryOpts := ListOptions{Type: opts.Type, Role: opts.Role, Tag: opts.Tag}
+
+	var matched []*Encounter
+	var keys []map[string]memoryKey
+	for _, enc := range m.encounters {
+		if opts.Tier != 0 && enc.PartyTier != opts.Tier {
+			continue
+		}
+		if adversaryOpts.Filtered() {
+			found := false
+			for _, ea := range m.members {
+				if ea.EncounterID == enc.ID && adversaryOpts.Matches(m.adversaries[ea.AdversaryID]) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+
+		matched = append(matched, enc)
+		keys = append(keys, map[string]memoryKey{
+			"name":    {text: enc.Name, id: enc.ID},
+			"tier":    {num: int64(enc.PartyTier), id: enc.ID},
+			"created": {text: memoryTime(enc.CreatedAt), id: enc.ID},
+		})
+	}
+
+	order, next, err := memoryPage(keys, encounterSorts, opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var encounters []*Encounter
+	for _, i := range order {
+		cp := *matched[i]
+		cp.Adversaries = m.encounterAdversaries(cp.ID)
+		encounters = append(encounters, &cp)
+	}
+	return encounters, next, nil
+}
+
+// GetEncounterSummaries returns a summary of every encounter, ordered by
+// name
+func (m *MemoryStore) GetEncounterSummaries(ctx context.Context) ([]*EncounterSummary, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var summaries []*EncounterSummary
+	for _, enc := range m.encounters {
+		s := &EncounterSummary{
+			ID:          enc.ID,
+			Name:        enc.Name,
+			PartySize:   enc.PartySize,
+			PartyTier:   enc.PartyTier,
+			Challenge:   enc.Challenge,
+			DamageBoost: enc.DamageBoost,
+		}
+		for _, ea := range m.encounterAdversaries(enc.ID) {
+			ea.Adversary = &Adversary{
+				ID:   ea.Adversary.ID,
+				Name: ea.Adversary.Name,
+				Role: ea.Adversary.Role,
+				Tier: ea.Adversary.Tier,
+			}
+			s.Members = append(s.Members, ea)
+			s.AdversaryCount += ea.Count
+		}
+		summaries = append(summaries, s)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Name != summaries[j].Name {
+			return summaries[i].Name < summaries[j].Name
+		}
+		return summaries[i].ID < summaries[j].ID
+	})
+	return summaries, nil
+}
+
+// GetEncounter returns an encounter with its adversaries
+func (m *MemoryStore) GetEncounter(ctx context.Context, id int64) (*Encounter, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	enc, ok := m.encounters[id]
+	if !ok {
+		return nil, nil
+	}
+	cp := *enc
+	cp.Adversaries = m.encounterAdversaries(id)
+	return &cp, nil
+}
+
+// GetEncounterAdversaries returns an encounter's adversaries
+func (m *MemoryStore) GetEncounterAdversaries(ctx context.Context, encounterID int64) ([]*EncounterAdversary, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.encounterAdversaries(encounterID), nil
+}
+
+// CreateEncounter stores a new encounter with its adversaries. Encounters
+// created without a party are built for the default party.
+func (m *MemoryStore) CreateEncounter(ctx context.Context, enc *Encounter) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Check every adversary first, so a failed create stores nothing
+	for _, ea := range enc.Adversaries {
+		if _, ok := m.adversaries[ea.AdversaryID]; !ok {
+			return 0, fmt.Errorf("adversary %d does not exist", ea.AdversaryID)
+		}
+	}
+
+	m.lastEncounterID++
+	cp := *enc
+	cp.ID = m.lastEncounterID
+	cp.Adversaries = nil
+	if cp.PartySize == 0 {
+		cp.PartySize = DefaultPartySize
+	}
+	if cp.PartyTier == 0 {
+		cp.PartyTier = 1
+	}
+	if cp.Challenge == "" {
+		cp.Challenge = ChallengeStandard
+	}
+	cp.CreatedAt = memoryNow()
+	cp.UpdatedAt = cp.CreatedAt
+	m.encounters[cp.ID] = &cp
+
+	for _, ea := range enc.Adversaries {
+		ea.EncounterID = cp.ID
+		m.setEncounterAdversary(ea)
+	}
+
+	return cp.ID, nil
+}
+
+// UpdateEncounter replaces an encounter's name and description
+func (m *MemoryStore) UpdateEncounter(ctx context.Context, enc *Encounter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.encounters[enc.ID]; ok {
+		existing.Name = enc.Name
+		existing.Description = enc.Description
+		existing.UpdatedAt = memoryNow()
+	}
+	return nil
+}
+
+// UpdateEncounterParty sets the party an encounter is built for and the
+// GM's budget adjustments
+func (m *MemoryStore) UpdateEncounterParty(ctx context.Context, enc *Encounter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.encounters[enc.ID]; ok {
+		existing.PartySize = enc.PartySize
+		existing.PartyTier = enc.PartyTier
+		existing.Challenge = enc.Challenge
+		existing.DamageBoost = enc.DamageBoost
+		existing.UpdatedAt = memoryNow()
+	}
+	return nil
+}
+
+// DeleteEncounter removes an encounter and its adversaries
+func (m *MemoryStore) DeleteEncounter(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.encounters, id)
+	for mid, ea := range m.members {
+		if ea.EncounterID == id {
+			delete(m.members, mid)
+		}
+	}
+	return nil
+}
+
+// SetEncounterAdversary adds an adversary to an encounter, or sets its count
+// if it is already there
+func (m *MemoryStore) SetEncounterAdversary(ctx context.Context, ea *EncounterAdversary) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.encounters[ea.EncounterID]; !ok {
+		return 0, fmt.Errorf("encounter %d does not exist", ea.EncounterID)
+	}
+	if _, ok := m.adversaries[ea.AdversaryID]; !ok {
+		return 0, fmt.Errorf("adversary %d does not exist", ea.AdversaryID)
+	}
+	return m.setEncounterAdversary(ea), nil
+}
+
+// setEncounterAdversary stores an encounter adversary, replacing the count
+// of an existing one
+func (m *MemoryStore) setEncounterAdversary(ea *EncounterAdversary) int64 {
+	for _, existing := range m.members {
+		if existing.EncounterID == ea.EncounterID && existing.AdversaryID == ea.AdversaryID {
+			existing.Count = ea.Count
+			return existing.ID
+		}
+	}
+
+	m.lastMemberID++
+	m.members[m.lastMemberID] = &EncounterAdversary{
+		ID:          m.lastMemberID,
+		EncounterID: ea.EncounterID,
+		AdversaryID: ea.AdversaryID,
+		Count:       ea.Count,
+	}
+	return m.lastMemberID
+}
+
+// RemoveAdversaryFromEncounter takes an adversary out of an encounter
+func (m *MemoryStore) RemoveAdversaryFromEncounter(ctx context.Context, encounterAdversaryID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.members, encounterAdversaryID)
+	return nil
+}
@@ -0,0 +1,283 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrationFiles holds the ordered schema migrations, named
+// NNNN_description.sql. Migrations are forward-only: once released, a file
+// must never be edited; add a new one instead.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// ErrSchemaTooNew is returned when the database has migrations applied that
+// this binary does not know about, i.e. it was written by a newer release
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+
+// Migration is a single versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+	// Step optionally transforms data in Go after SQL has run, for changes
+	// that SQL alone cannot express
+	Step func(ctx context.Context, tx *sql.Tx) error
+}
+
+// Migrations returns every known migration in version order
+func Migrations() ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	for _, entry := range entries {
+		versionStr, name, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: name must be NNNN_description.sql", entry.Name())
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version: %w", entry.Name(), err)
+		}
+
+		contents, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, Migration{
+			Version: version,
+			Name:    name,
+			SQL:     string(contents),
+			Step:    migrationSteps[version],
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %04d_%s: versions must be sequential from 1", m.Version, m.Name)
+		}
+	}
+
+	return migrations, nil
+}
+
+// PendingMigrations returns the migrations that Migrate would apply, without
+// changing the database
+func PendingMigrations(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := schemaVersion(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	if current > len(migrations) {
+		return nil, fmt.Errorf("%w: database is at version %d, latest known is %d", ErrSchemaTooNew, current, len(migrations))
+	}
+
+	return migrations[current:], nil
+}
+
+// Migrate applies all pending migrations in order, each in its own
+// transaction, and returns the migrations that were applied. It refuses to
+// touch a database whose schema is newer than the binary.
+func Migrate(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	pending, err := PendingMigrations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	// Foreign keys must be disabled outside a transaction and only apply to
+	// a single connection, so the migrations run on a dedicated one. Table
+	// rebuilds would otherwise cascade deletes into child tables.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF`); err != nil {
+		return nil, err
+	}
+	defer conn.ExecContext(context.Background(), `PRAGMA foreign_keys = ON`)
+
+	if err := ensureMigrationsTable(ctx, conn); err != nil {
+		return nil, err
+	}
+
+	for _, m := range pending {
+		if err := applyMigration(ctx, conn, m); err != nil {
+			return nil, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+	}
+
+	return pending, nil
+}
+
+// applyMigration runs a single migration and records it in schema_migrations
+func applyMigration(ctx context.Context, conn *sql.Conn, m Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+		return err
+	}
+
+	if m.Step != nil {
+		if err := m.Step(ctx, tx); err != nil {
+			return err
+		}
+	}
+
+	// Make sure the migration left no dangling references behind
+	var violations int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM pragma_foreign_key_check`).Scan(&violations); err != nil {
+		return err
+	}
+	if violations > 0 {
+		return fmt.Errorf("%d foreign key violations", violations)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, m.Version, m.Name)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ensureMigrationsTable creates the schema_migrations bookkeeping table. A
+// database created before versioned migrations existed is baselined at the
+// version its tables already match, so those migrations are not re-run.
+func ensureMigrationsTable(ctx context.Context, conn *sql.Conn) error {
+	exists, err := tableExists(ctx, conn, "schema_migrations")
+	if err != nil || exists {
+		return err
+	}
+
+	baseline, err := unversionedSchemaVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		CREATE TABLE schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	if baseline > 0 {
+		migrations, err := Migrations()
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations[:baseline] {
+			_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, m.Version, m.Name+" (baseline)")
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// schemaVersion returns the highest applied migration version, inferring it
+// for databases that predate schema_migrations
+func schemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	exists, err := tableExists(ctx, conn, "schema_migrations")
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return unversionedSchemaVersion(ctx, conn)
+	}
+
+	var version int
+	err = conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+// unversionedSchemaVersion infers which migration a database created by
+// re-running schema.sql at startup corresponds to. Fresh databases are at 0.
+func unversionedSchemaVersion(ctx context.Context, conn *sql.Conn) (int, error) {
+	exists, err := tableExists(ctx, conn, "adversaries")
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	legacyStatblock, err := columnExists(ctx, conn, "adversaries", "challenge_rating")
+	if err != nil {
+		return 0, err
+	}
+	if legacyStatblock {
+		return 1, nil
+	}
+
+	legacyFeatures, err := columnExists(ctx, conn, "adversaries", "abilities")
+	if err != nil {
+		return 0, err
+	}
+	if legacyFeatures {
+		return 2, nil
+	}
+
+	return 3, nil
+}
+
+// tableExists reports whether a table with the given name exists
+func tableExists(ctx context.Context, conn *sql.Conn, table string) (bool, error) {
+	var count int
+	err := conn.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?
+	`, table).Scan(&count)
+	return count > 0, err
+}
+
+// columnExists reports whether table has a column with the given name
+func columnExists(ctx context.Context, conn *sql.Conn, table, column string) (bool, error) {
+	var count int
+	err := conn.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?
+	`, table, column).Scan(&count)
+	return count > 0, err
+}
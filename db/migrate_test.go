@@ -0,0 +1,247 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newRawTestDB creates an empty database in a temporary directory, without
+// running any migrations
+func newRawTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=on&_txlock=immediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// buildLegacySchema brings a database to the schema of the first n
+// migrations without recording them, as startup did before schema_migrations
+// existed
+func buildLegacySchema(t *testing.T, db *sql.DB, n int) {
+	t.Helper()
+	ctx := context.Background()
+
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations[:n] {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+			t.Fatalf("migration %04d_%s: %v", m.Version, m.Name, err)
+		}
+		if m.Step != nil {
+			if err := m.Step(ctx, tx); err != nil {
+				t.Fatalf("migration %04d_%s: %v", m.Version, m.Name, err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// hasColumn reports whether a table has a column
+func hasColumn(t *testing.T, db *sql.DB, table, column string) bool {
+	t.Helper()
+	return countRows(t, db, `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column) > 0
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	db := newRawTestDB(t)
+
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := Migrate(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(migrations) {
+		t.Errorf("applied %d migrations to a new database, want all %d", len(applied), len(migrations))
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM schema_migrations WHERE name NOT LIKE '%(baseline)'`); n != len(migrations) {
+		t.Errorf("%d migrations recorded, want %d", n, len(migrations))
+	}
+	if !hasColumn(t, db, "combatant_conditions", "public") {
+		t.Error("the latest migration was not applied")
+	}
+
+	// A second run has nothing left to do
+	applied, err = Migrate(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("second run applied %d migrations, want none", len(applied))
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM schema_migrations`); n != len(migrations) {
+		t.Errorf("%d migrations recorded after a second run, want %d", n, len(migrations))
+	}
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	ctx := context.Background()
+	db := newRawTestDB(t)
+
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A database from before the Daggerheart statblock, as schema.sql left it
+	buildLegacySchema(t, db, 1)
+	_, err = db.Exec(`
+		INSERT INTO adversaries (name, type, challenge_rating, size, armor_class, hit_points, speed,
+			strength, dexterity, constitution, intelligence, wisdom, charisma, abilities, actions, reactions, description)
+		VALUES ('Bear', 'Beast', '1/2', 'Large', 14, 7, '40 ft.', 16, 10, 14, 2, 12, 7,
+			'Keen Smell: Advantage on checks that rely on smell' || char(10) || char(10) || 'Hard to stop',
+			'Bite: 1d8 piercing damage', NULL, 'A big bear')
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO encounters (name) VALUES ('Forest')`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO encounter_adversaries (encounter_id, adversary_id, count) VALUES (1, 1, 2)`); err != nil {
+		t.Fatal(err)
+	}
+
+	// A dry run finds the migrations after the baseline and changes nothing
+	pending, err := PendingMigrations(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != len(migrations)-1 || pending[0].Version != 2 {
+		t.Fatalf("%d migrations pending, want %d from version 2", len(pending), len(migrations)-1)
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM sqlite_master WHERE name = 'schema_migrations'`); n != 0 {
+		t.Error("dry run created schema_migrations")
+	}
+
+	applied, err := Migrate(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(pending) {
+		t.Errorf("applied %d migrations, want %d", len(applied), len(pending))
+	}
+
+	// The legacy schema is baselined, not re-run
+	var name string
+	if err := db.QueryRow(`SELECT name FROM schema_migrations WHERE version = 1`).Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	if name != "initial_schema (baseline)" {
+		t.Errorf("version 1 recorded as %q, want the baseline", name)
+	}
+
+	// The statblock is converted and the legacy stats kept in the description
+	adv, err := GetAdversaryByID(ctx, db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adv.Tier != 1 || adv.Difficulty != 14 || adv.HitPoints != 7 || !strings.Contains(adv.Description, "AC 14, CR 1/2") {
+		t.Errorf("converted adversary is %+v", adv)
+	}
+	for _, column := range []string{"challenge_rating", "armor_class", "abilities", "actions", "reactions"} {
+		if hasColumn(t, db, "adversaries", column) {
+			t.Errorf("legacy column %s was not dropped", column)
+		}
+	}
+
+	// Each non-empty line of the legacy text becomes a feature, in order
+	features, err := GetAdversaryFeatures(ctx, db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ kind, name, text string }{
+		{FeaturePassive, "Keen Smell", "Advantage on checks that rely on smell"},
+		{FeaturePassive, "Feature 2", "Hard to stop"},
+		{FeatureAction, "Bite", "1d8 piercing damage"},
+	}
+	if len(features) != len(want) {
+		t.Fatalf("moved %d features, want %d: %+v", len(features), len(want), features)
+	}
+	for i, f := range features {
+		if f.Kind != want[i].kind || f.Name != want[i].name || f.Text != want[i].text {
+			t.Errorf("feature %d is %s %q: %q, want %s %q: %q", i, f.Kind, f.Name, f.Text, want[i].kind, want[i].name, want[i].text)
+		}
+	}
+
+	// Rows in other tables survive the table rebuilds
+	if n := countRows(t, db, `SELECT COUNT(*) FROM encounter_adversaries WHERE adversary_id = 1`); n != 1 {
+		t.Errorf("%d encounter rows for the bear, want 1", n)
+	}
+}
+
+func TestMigrateBaseline(t *testing.T) {
+	tests := []struct {
+		name     string
+		applied  int // migrations the legacy schema already matches
+		baseline int
+	}{
+		{"empty", 0, 0},
+		{"legacy statblock", 1, 1},
+		{"legacy features", 2, 2},
+		{"structured features", 3, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := newRawTestDB(t)
+			buildLegacySchema(t, db, tt.applied)
+
+			migrations, err := Migrations()
+			if err != nil {
+				t.Fatal(err)
+			}
+			applied, err := Migrate(ctx, db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(applied) != len(migrations)-tt.baseline {
+				t.Errorf("applied %d migrations, want %d", len(applied), len(migrations)-tt.baseline)
+			}
+			if n := countRows(t, db, `SELECT COUNT(*) FROM schema_migrations WHERE name LIKE '%(baseline)'`); n != tt.baseline {
+				t.Errorf("%d migrations baselined, want %d", n, tt.baseline)
+			}
+		})
+	}
+}
+
+func TestMigrateSchemaTooNew(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, 'from_the_future')`, len(migrations)+1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := PendingMigrations(ctx, db); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("dry run of a newer database: %v, want %v", err, ErrSchemaTooNew)
+	}
+	if _, err := Migrate(ctx, db); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("migrating a newer database: %v, want %v", err, ErrSchemaTooNew)
+	}
+}
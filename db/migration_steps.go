@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// migrationSteps holds the Go data transformations that run after the SQL
+// file of the same version
+var migrationSteps = map[int]func(ctx context.Context, tx *sql.Tx) error{
+	3: moveLegacyFeatures,
+}
+
+// legacyFeatureColumns maps the free-text feature columns to the feature
+// kind their lines become
+var legacyFeatureColumns = []struct {
+	column string
+	kind   string
+}{
+	{"abilities", FeaturePassive},
+	{"actions", FeatureAction},
+	{"reactions", FeatureReaction},
+}
+
+// moveLegacyFeatures moves the free-text Abilities, Actions and Reactions
+// columns into adversary_features rows, one feature per non-empty line, and
+// drops the old columns. Lines written as "Name: text" keep their name.
+func moveLegacyFeatures(ctx context.Context, tx *sql.Tx) error {
+	type legacyRow struct {
+		id    int64
+		texts []sql.NullString
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, abilities, actions, reactions FROM adversaries`)
+	if err != nil {
+		return err
+	}
+	var legacyRows []legacyRow
+	for rows.Next() {
+		row := legacyRow{texts: make([]sql.NullString, len(legacyFeatureColumns))}
+		if err := rows.Scan(&row.id, &row.texts[0], &row.texts[1], &row.texts[2]); err != nil {
+			rows.Close()
+			return err
+		}
+		legacyRows = append(legacyRows, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	insert := `
+		INSERT INTO adversary_features (adversary_id, position, kind, name, text)
+		VALUES (?, ?, ?, ?, ?)
+	`
+	for _, row := range legacyRows {
+		position := 0
+		for i, text := range row.texts {
+			for _, line := range strings.Split(text.String, "\n") {
+				line = strings.TrimSpace(line)
+				if line == "" {
+					continue
+				}
+				name, body := splitLegacyFeature(line, position+1)
+				_, err := tx.ExecContext(ctx, insert, row.id, position, legacyFeatureColumns[i].kind, name, body)
+				if err != nil {
+					return err
+				}
+				position++
+			}
+		}
+	}
+
+	for _, c := range legacyFeatureColumns {
+		if _, err := tx.ExecContext(ctx, `ALTER TABLE adversaries DROP COLUMN `+c.column); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// splitLegacyFeature splits a free-text feature line into a name and rules
+// text. Lines without a short "Name:" prefix are given a numbered name.
+func splitLegacyFeature(line string, n int) (string, string) {
+	if name, text, ok := strings.Cut(line, ":"); ok {
+		name = strings.TrimSpace(name)
+		if name != "" && len(name) <= 60 {
+			return name, strings.TrimSpace(text)
+		}
+	}
+	return fmt.Sprintf("Feature %d", n), line
+}
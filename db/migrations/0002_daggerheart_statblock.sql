@@ -0,0 +1,49 @@
+-- Replace the D&D-style statblock columns with the Daggerheart statblock.
+-- Existing rows are kept: Challenge Rating is mapped to a tier, Armor Class
+-- becomes Difficulty and the remaining legacy stats are appended to the
+-- description so nothing is lost.
+
+ALTER TABLE adversaries ADD COLUMN tier INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE adversaries ADD COLUMN role TEXT NOT NULL DEFAULT 'Standard';
+ALTER TABLE adversaries ADD COLUMN difficulty INTEGER NOT NULL DEFAULT 10;
+ALTER TABLE adversaries ADD COLUMN major_threshold INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE adversaries ADD COLUMN severe_threshold INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE adversaries ADD COLUMN stress INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE adversaries ADD COLUMN attack_modifier INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE adversaries ADD COLUMN attack_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE adversaries ADD COLUMN attack_range TEXT NOT NULL DEFAULT 'Melee';
+ALTER TABLE adversaries ADD COLUMN attack_damage TEXT NOT NULL DEFAULT '';
+ALTER TABLE adversaries ADD COLUMN damage_type TEXT NOT NULL DEFAULT 'Physical';
+ALTER TABLE adversaries ADD COLUMN experiences TEXT NOT NULL DEFAULT '';
+ALTER TABLE adversaries ADD COLUMN motives_tactics TEXT NOT NULL DEFAULT '';
+
+-- CAST parses the leading digits, so fractional ratings such as "1/8" land in tier 1
+UPDATE adversaries SET
+    tier = CASE
+        WHEN CAST(challenge_rating AS INTEGER) <= 4 THEN 1
+        WHEN CAST(challenge_rating AS INTEGER) <= 10 THEN 2
+        WHEN CAST(challenge_rating AS INTEGER) <= 16 THEN 3
+        ELSE 4
+    END,
+    difficulty = armor_class,
+    description = TRIM(COALESCE(description, '') || char(10) || char(10) || printf(
+        'Legacy statblock: %s, speed %s, AC %d, CR %s, STR %d, DEX %d, CON %d, INT %d, WIS %d, CHA %d',
+        size, speed, armor_class, challenge_rating, strength, dexterity,
+        constitution, intelligence, wisdom, charisma
+    ));
+
+DROP INDEX IF EXISTS idx_adversaries_cr;
+
+ALTER TABLE adversaries DROP COLUMN challenge_rating;
+ALTER TABLE adversaries DROP COLUMN size;
+ALTER TABLE adversaries DROP COLUMN armor_class;
+ALTER TABLE adversaries DROP COLUMN speed;
+ALTER TABLE adversaries DROP COLUMN strength;
+ALTER TABLE adversaries DROP COLUMN dexterity;
+ALTER TABLE adversaries DROP COLUMN constitution;
+ALTER TABLE adversaries DROP COLUMN intelligence;
+ALTER TABLE adversaries DROP COLUMN wisdom;
+ALTER TABLE adversaries DROP COLUMN charisma;
+
+CREATE INDEX idx_adversaries_tier ON adversaries(tier);
+CREATE INDEX idx_adversaries_role ON adversaries(role);
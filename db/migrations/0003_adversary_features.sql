@@ -0,0 +1,20 @@
+-- Structured Passive, Action and Reaction entries of a statblock.
+-- The free-text abilities, actions and reactions columns are moved into
+-- this table by the Go step registered for this version.
+
+CREATE TABLE adversary_features (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    adversary_id INTEGER NOT NULL,
+    position INTEGER NOT NULL DEFAULT 0,
+    kind TEXT NOT NULL,
+    name TEXT NOT NULL,
+    text TEXT NOT NULL DEFAULT '',
+    fear_cost INTEGER NOT NULL DEFAULT 0,
+    countdown INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (adversary_id) REFERENCES adversaries(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_adversary_features_adversary_id ON adversary_features(adversary_id, position);
+CREATE INDEX idx_adversary_features_name ON adversary_features(name);
@@ -0,0 +1,36 @@
+-- Server-side combat sessions. Each combatant is a snapshot of an adversary's
+-- statblock taken when the session starts, so editing the adversary mid-fight
+-- does not change the tracker.
+
+CREATE TABLE combat_sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    encounter_id INTEGER NOT NULL,
+    status TEXT NOT NULL DEFAULT 'active',
+    started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    ended_at TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (encounter_id) REFERENCES encounters(id) ON DELETE CASCADE
+);
+
+-- At most one running session per encounter
+CREATE UNIQUE INDEX idx_combat_sessions_active ON combat_sessions(encounter_id) WHERE status = 'active';
+CREATE INDEX idx_combat_sessions_encounter_id ON combat_sessions(encounter_id);
+
+CREATE TABLE combatants (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id INTEGER NOT NULL,
+    adversary_id INTEGER,
+    position INTEGER NOT NULL DEFAULT 0,
+    name TEXT NOT NULL,
+    role TEXT NOT NULL DEFAULT 'Standard',
+    difficulty INTEGER NOT NULL DEFAULT 10,
+    major_threshold INTEGER NOT NULL DEFAULT 0,
+    severe_threshold INTEGER NOT NULL DEFAULT 0,
+    hp_max INTEGER NOT NULL,
+    hp_marked INTEGER NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT 'Normal',
+    FOREIGN KEY (session_id) REFERENCES combat_sessions(id) ON DELETE CASCADE,
+    FOREIGN KEY (adversary_id) REFERENCES adversaries(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_combatants_session_id ON combatants(session_id, position);
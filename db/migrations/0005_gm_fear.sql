@@ -0,0 +1,17 @@
+-- GM Fear pool of a combat session, and a log of every gain and spend
+
+ALTER TABLE combat_sessions ADD COLUMN fear INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE combat_sessions ADD COLUMN fear_max INTEGER NOT NULL DEFAULT 12;
+
+CREATE TABLE fear_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id INTEGER NOT NULL,
+    delta INTEGER NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    feature_id INTEGER,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (session_id) REFERENCES combat_sessions(id) ON DELETE CASCADE,
+    FOREIGN KEY (feature_id) REFERENCES adversary_features(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_fear_log_session_id ON fear_log(session_id);
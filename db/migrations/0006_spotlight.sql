@@ -0,0 +1,11 @@
+-- Spotlight turn model. The spotlight passes between the players and the GM;
+-- on a GM turn the GM activates adversaries, tracked per combatant. Sessions
+-- using the optional action tracker pay for activations with action tokens
+-- instead of Fear.
+
+ALTER TABLE combat_sessions ADD COLUMN spotlight TEXT NOT NULL DEFAULT 'players';
+ALTER TABLE combat_sessions ADD COLUMN gm_turn INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE combat_sessions ADD COLUMN tracker_mode TEXT NOT NULL DEFAULT 'narrative';
+ALTER TABLE combat_sessions ADD COLUMN action_tokens INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE combatants ADD COLUMN acted BOOLEAN NOT NULL DEFAULT 0;
@@ -0,0 +1,19 @@
+-- Combatants can carry several conditions at once, each cleared manually or
+-- automatically when its expiry trigger fires. Existing single statuses are
+-- carried over as conditions that last until cleared.
+
+CREATE TABLE combatant_conditions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    combatant_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    expires TEXT NOT NULL DEFAULT 'until_cleared',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (combatant_id) REFERENCES combatants(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX idx_combatant_conditions_name ON combatant_conditions(combatant_id, name);
+
+INSERT INTO combatant_conditions (combatant_id, name)
+SELECT id, status FROM combatants WHERE status <> 'Normal';
+
+ALTER TABLE combatants DROP COLUMN status;
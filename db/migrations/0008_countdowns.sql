@@ -0,0 +1,26 @@
+-- Countdowns attached to a combat session or a single combatant, optionally
+-- started from an adversary feature. A countdown ticks down towards zero on
+-- action rolls or adversary actions; looping countdowns reset when they fire.
+
+CREATE TABLE countdowns (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id INTEGER NOT NULL,
+    combatant_id INTEGER,
+    feature_id INTEGER,
+    name TEXT NOT NULL,
+    kind TEXT NOT NULL DEFAULT 'standard',
+    purpose TEXT NOT NULL DEFAULT 'consequence',
+    tick_on TEXT NOT NULL DEFAULT 'roll',
+    looping BOOLEAN NOT NULL DEFAULT 0,
+    start_value INTEGER NOT NULL,
+    value INTEGER NOT NULL,
+    loops INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (session_id) REFERENCES combat_sessions(id) ON DELETE CASCADE,
+    FOREIGN KEY (combatant_id) REFERENCES combatants(id) ON DELETE CASCADE,
+    FOREIGN KEY (feature_id) REFERENCES adversary_features(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_countdowns_session_id ON countdowns(session_id);
+CREATE INDEX idx_countdowns_combatant_id ON countdowns(combatant_id);
@@ -0,0 +1,6 @@
+-- Where an adversary came from: created in this install ('homebrew') or
+-- seeded from the bundled SRD library ('srd'). SRD adversaries are read-only.
+
+ALTER TABLE adversaries ADD COLUMN source TEXT NOT NULL DEFAULT 'homebrew';
+
+CREATE INDEX idx_adversaries_source ON adversaries(source, name);
@@ -0,0 +1,7 @@
+-- Party an encounter is built for, and the GM's budget adjustments, used to
+-- work out its battle point budget
+
+ALTER TABLE encounters ADD COLUMN party_size INTEGER NOT NULL DEFAULT 4;
+ALTER TABLE encounters ADD COLUMN party_tier INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE encounters ADD COLUMN challenge TEXT NOT NULL DEFAULT 'standard';
+ALTER TABLE encounters ADD COLUMN damage_boost BOOLEAN NOT NULL DEFAULT 0;
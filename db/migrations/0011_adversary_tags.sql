@@ -0,0 +1,4 @@
+-- Free-form tags for grouping adversaries beyond their type, such as
+-- "undead" or "forest", stored lowercase and comma-separated
+
+ALTER TABLE adversaries ADD COLUMN tags TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+-- Player view: each combat session gets an unguessable token for its
+-- read-only player URL, and the GM chooses which countdowns players see
+
+ALTER TABLE combat_sessions ADD COLUMN player_token TEXT;
+UPDATE combat_sessions SET player_token = lower(hex(randomblob(16)));
+CREATE UNIQUE INDEX idx_combat_sessions_player_token ON combat_sessions(player_token);
+
+ALTER TABLE countdowns ADD COLUMN public BOOLEAN NOT NULL DEFAULT 0;
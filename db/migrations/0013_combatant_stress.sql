@@ -0,0 +1,12 @@
+-- Stress tracking: combatants get a Stress track copied from their adversary,
+-- and features declare the Stress an adversary marks to use them. Combatants
+-- of running sessions take the Stress of their adversary, if it still exists.
+
+ALTER TABLE combatants ADD COLUMN stress_max INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE combatants ADD COLUMN stress_marked INTEGER NOT NULL DEFAULT 0;
+
+UPDATE combatants
+SET stress_max = (SELECT stress FROM adversaries WHERE adversaries.id = combatants.adversary_id)
+WHERE adversary_id IS NOT NULL;
+
+ALTER TABLE adversary_features ADD COLUMN stress_cost INTEGER NOT NULL DEFAULT 0;
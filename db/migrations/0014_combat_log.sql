@@ -0,0 +1,22 @@
+-- Append-only log of every change to a combat session. Each entry keeps the
+-- fight as it stood before and after the change, as JSON, so that changes
+-- can be undone and redone. Undoing and redoing are logged as entries too,
+-- pointing at the entry they undo or redo.
+
+CREATE TABLE combat_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id INTEGER NOT NULL,
+    kind TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    target TEXT NOT NULL DEFAULT '',
+    summary TEXT NOT NULL DEFAULT '',
+    entry_id INTEGER,
+    undoable BOOLEAN NOT NULL DEFAULT 0,
+    before_state TEXT,
+    after_state TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (session_id) REFERENCES combat_sessions(id) ON DELETE CASCADE,
+    FOREIGN KEY (entry_id) REFERENCES combat_log(id)
+);
+
+CREATE INDEX idx_combat_log_session_id ON combat_log(session_id, id);
@@ -0,0 +1,15 @@
+-- Post-combat reports: a summary of each fight, written when it ends and
+-- kept with its encounter. The report itself is stored as JSON.
+
+CREATE TABLE combat_reports (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    encounter_id INTEGER NOT NULL,
+    session_id INTEGER NOT NULL,
+    report TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (encounter_id) REFERENCES encounters(id) ON DELETE CASCADE,
+    FOREIGN KEY (session_id) REFERENCES combat_sessions(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX idx_combat_reports_session_id ON combat_reports(session_id);
+CREATE INDEX idx_combat_reports_encounter_id ON combat_reports(encounter_id, id);
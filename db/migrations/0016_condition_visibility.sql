@@ -0,0 +1,4 @@
+-- Condition visibility: the GM chooses which conditions and effects players
+-- see. Conditions were all shown before, so existing ones stay shown.
+
+ALTER TABLE combatant_conditions ADD COLUMN public BOOLEAN NOT NULL DEFAULT 1;
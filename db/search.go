@@ -0,0 +1,323 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"unicode"
+)
+
+// Snippets mark the matched terms with these control characters, which never
+// appear in adversary text, so callers can highlight them after escaping
+const (
+	HighlightStart = "\x02"
+	HighlightEnd   = "\x03"
+)
+
+// snippetWords is roughly how many words a search snippet shows
+const snippetWords = 16
+
+// SearchResult is an adversary matching a search and an excerpt of the text
+// that matched
+type SearchResult struct {
+	Adversary *Adversary
+	Snippet   string // matched terms are wrapped in HighlightStart and HighlightEnd
+}
+
+// searchIndexSchema creates the adversaries_fts full-text index and the
+// triggers that keep it in sync. Each row shares its rowid with the adversary
+// it indexes; features are indexed as one column of their names and text.
+var searchIndexSchema = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS adversaries_fts USING fts5(
+		name, description, motives_tactics, features,
+		tokenize = 'porter unicode61'
+	)`,
+	`CREATE TRIGGER IF NOT EXISTS adversaries_fts_insert AFTER INSERT ON adversaries BEGIN
+		INSERT INTO adversaries_fts (rowid, name, description, motives_tactics, features)
+		VALUES (new.id, new.name, new.description, new.motives_tactics, '');
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS adversaries_fts_update AFTER UPDATE OF name, description, motives_tactics ON adversaries BEGIN
+		UPDATE adversaries_fts
+		SET name = new.name, description = new.description, motives_tactics = new.motives_tactics
+		WHERE rowid = new.id;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS adversaries_fts_delete AFTER DELETE ON adversaries BEGIN
+		DELETE FROM adversaries_fts WHERE rowid = old.id;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS adversaries_fts_feature_insert AFTER INSERT ON adversary_features BEGIN
+		UPDATE adversaries_fts SET features = (` + featureTextQuery("new") + `) WHERE rowid = new.adversary_id;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS adversaries_fts_feature_update AFTER UPDATE ON adversary_features BEGIN
+		UPDATE adversaries_fts SET features = (` + featureTextQuery("old") + `) WHERE rowid = old.adversary_id;
+		UPDATE adversaries_fts SET features = (` + featureTextQuery("new") + `) WHERE rowid = new.adversary_id;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS adversaries_fts_feature_delete AFTER DELETE ON adversary_features BEGIN
+		UPDATE adversaries_fts SET features = (` + featureTextQuery("old") + `) WHERE rowid = old.adversary_id;
+	END`,
+}
+
+// searchIndexTriggers lists the triggers created by searchIndexSchema
+var searchIndexTriggers = []string{
+	"adversaries_fts_insert", "adversaries_fts_update", "adversaries_fts_delete",
+	"adversaries_fts_feature_insert", "adversaries_fts_feature_update", "adversaries_fts_feature_delete",
+}
+
+// featureTextQuery selects the indexed feature text of the adversary that
+// the trigger row ("new" or "old") belongs to
+func featureTextQuery(row string) string {
+	return `SELECT COALESCE(group_concat(name || ': ' || text, ' '), '') FROM adversary_features WHERE adversary_id = ` + row + `.adversary_id`
+}
+
+// EnsureSearchIndex builds the full-text search index when SQLite was
+// compiled with FTS5, which for go-sqlite3 means building with the
+// sqlite_fts5 tag. Without FTS5 it drops the index's triggers, which would
+// otherwise break every write, and SearchAdversaries falls back to a plain
+// substring search. It is safe to run on every start.
+func EnsureSearchIndex(ctx context.Context, db *sql.DB) error {
+	available, err := fts5Available(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if !available {
+		for _, trigger := range searchIndexTriggers {
+			if _, err := tx.ExecContext(ctx, `DROP TRIGGER IF EXISTS `+trigger); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	}
+
+	// The index is rebuilt whenever a trigger is missing, since writes made
+	// without them never reached it
+	var triggers int
+	err = tx.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'adversaries_fts_%'
+	`).Scan(&triggers)
+	if err != nil {
+		return err
+	}
+	if triggers == len(searchIndexTriggers) {
+		return nil
+	}
+
+	for _, stmt := range searchIndexSchema {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM adversaries_fts`); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO adversaries_fts (rowid, name, description, motives_tactics, features)
+		SELECT a.id, a.name, a.description, a.motives_tactics, COALESCE((
+			SELECT group_concat(f.name || ': ' || f.text, ' ')
+			FROM adversary_features f WHERE f.adversary_id = a.id
+		), '')
+		FROM adversaries a
+	`)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// fts5Available reports whether SQLite was compiled with FTS5
+func fts5Available(ctx context.Context, db *sql.DB) (bool, error) {
+	var used bool
+	err := db.QueryRowContext(ctx, `SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&used)
+	return used, err
+}
+
+// searchIndexReady reports whether SearchAdversaries can use the full-text
+// index
+func searchIndexReady(ctx context.Context, db *sql.DB) (bool, error) {
+	available, err := fts5Available(ctx, db)
+	if err != nil || !available {
+		return false, err
+	}
+
+	var count int
+	err = db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'adversaries_fts'
+	`).Scan(&count)
+	return count > 0, err
+}
+
+// SearchAdversaries finds the adversaries whose name, description, motives
+// and tactics, or features contain every word of query, matching words by
+// prefix. Results are ranked best first, with matches in the name counting
+// most, and come with a snippet of the matching text.
+func SearchAdversaries(ctx context.Context, db *sql.DB, query string, limit int) ([]*SearchResult, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return []*SearchResult{}, nil
+	}
+
+	ready, err := searchIndexReady(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if !ready {
+		return searchAdversariesLike(ctx, db, terms, limit)
+	}
+
+	// Quote every term so punctuation can't be read as query syntax
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+adversaryColumns+`,
+			snippet(adversaries_fts, -1, ?, ?, '…', ?)
+		FROM adversaries_fts
+		JOIN adversaries a ON a.id = adversaries_fts.rowid
+		WHERE adversaries_fts MATCH ?
+		ORDER BY bm25(adversaries_fts, 10.0, 2.0, 2.0, 1.0), a.name
+		LIMIT ?
+	`, HighlightStart, HighlightEnd, snippetWords, strings.Join(quoted, " "), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []*SearchResult{}
+	for rows.Next() {
+		result := &SearchResult{Adversary: &Adversary{}}
+		if err := rows.Scan(append(adversaryScanDest(result.Adversary), &result.Snippet)...); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// searchAdversariesLike is SearchAdversaries without the full-text index. It
+// matches substrings rather than word prefixes and ranks name matches first.
+func searchAdversariesLike(ctx context.Context, db *sql.DB, terms []string, limit int) ([]*SearchResult, error) {
+	var where []string
+	var args []interface{}
+	for _, term := range terms {
+		pattern := "%" + escapeLike(term) + "%"
+		where = append(where, `(
+			a.name LIKE ? ESCAPE '\' OR a.description LIKE ? ESCAPE '\' OR a.motives_tactics LIKE ? ESCAPE '\'
+			OR EXISTS (
+				SELECT 1 FROM adversary_features f
+				WHERE f.adversary_id = a.id AND (f.name LIKE ? ESCAPE '\' OR f.text LIKE ? ESCAPE '\')
+			)
+		)`)
+		args = append(args, pattern, pattern, pattern, pattern, pattern)
+	}
+	args = append(args, "%"+escapeLike(terms[0])+"%", limit)
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+adversaryColumns+`, COALESCE((
+			SELECT group_concat(f.name || ': ' || f.text, ' ')
+			FROM adversary_features f WHERE f.adversary_id = a.id
+		), '')
+		FROM adversaries a
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY a.name LIKE ? ESCAPE '\' DESC, a.name
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []*SearchResult{}
+	for rows.Next() {
+		adv := &Adversary{}
+		var features string
+		if err := rows.Scan(append(adversaryScanDest(adv), &features)...); err != nil {
+			return nil, err
+		}
+		results = append(results, &SearchResult{
+			Adversary: adv,
+			Snippet:   likeSnippet(terms, adv.Name, adv.Description, adv.MotivesTactics, features),
+		})
+	}
+
+	return results, rows.Err()
+}
+
+// searchTerms splits a search query into lowercase words
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '\''
+	})
+}
+
+// escapeLike escapes the LIKE wildcards in s
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// likeSnippet builds a snippet like FTS5's snippet() from the first field
+// containing a term: a few words around the first match, with every matching
+// word highlighted
+func likeSnippet(terms []string, fields ...string) string {
+	for _, field := range fields {
+		words := strings.Fields(field)
+		first := -1
+		for i, word := range words {
+			if containsAny(strings.ToLower(word), terms) {
+				first = i
+				break
+			}
+		}
+		if first < 0 {
+			continue
+		}
+
+		start := first - snippetWords/4
+		if start < 0 {
+			start = 0
+		}
+		end := start + snippetWords
+		if end > len(words) {
+			end = len(words)
+		}
+
+		var b strings.Builder
+		if start > 0 {
+			b.WriteString("…")
+		}
+		for i, word := range words[start:end] {
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			if containsAny(strings.ToLower(word), terms) {
+				b.WriteString(HighlightStart + word + HighlightEnd)
+			} else {
+				b.WriteString(word)
+			}
+		}
+		if end < len(words) {
+			b.WriteString("…")
+		}
+		return b.String()
+	}
+	return ""
+}
+
+// containsAny reports whether s contains any of the terms
+func containsAny(s string, terms []string) bool {
+	for _, term := range terms {
+		if strings.Contains(s, term) {
+			return true
+		}
+	}
+	return false
+}
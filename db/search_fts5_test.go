@@ -0,0 +1,46 @@
+//go:build sqlite_fts5
+
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEnsureSearchIndex(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	// Adversaries stored before the index exists are indexed when it is built
+	createTestAdversary(t, db, "Bear")
+	if err := EnsureSearchIndex(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	if ready, err := searchIndexReady(ctx, db); err != nil || !ready {
+		t.Fatalf("index ready %v (%v) after building it with FTS5", ready, err)
+	}
+	if got := searchNames(t, db, "bear"); got != "Bear" {
+		t.Errorf("search after building the index found %q", got)
+	}
+
+	// A build without FTS5 drops the triggers, so writes it made meanwhile
+	// are caught up on the next start
+	for _, trigger := range searchIndexTriggers {
+		if _, err := db.Exec(`DROP TRIGGER ` + trigger); err != nil {
+			t.Fatal(err)
+		}
+	}
+	createTestAdversary(t, db, "Cave Bear")
+	if got := searchNames(t, db, "cave"); got != "" {
+		t.Fatalf("search without triggers found %q before the rebuild", got)
+	}
+	if err := EnsureSearchIndex(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	if got := searchNames(t, db, "bear"); got != "Bear, Cave Bear" {
+		t.Errorf("search after the rebuild found %q", got)
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM adversaries_fts`); n != 2 {
+		t.Errorf("index has %d rows after the rebuild, want 2", n)
+	}
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+// searchModes sets up a test database for each way SearchAdversaries can
+// search: substring matching, and the full-text index when SQLite has FTS5
+var searchModes = []struct {
+	name  string
+	setup func(t *testing.T) *sql.DB
+}{
+	{"substring", func(t *testing.T) *sql.DB {
+		return newTestDB(t)
+	}},
+	{"index", func(t *testing.T) *sql.DB {
+		db := newTestDB(t)
+		ctx := context.Background()
+		if available, err := fts5Available(ctx, db); err != nil || !available {
+			t.Skip("SQLite was built without FTS5; run with -tags sqlite_fts5")
+		}
+		if err := EnsureSearchIndex(ctx, db); err != nil {
+			t.Fatal(err)
+		}
+		return db
+	}},
+}
+
+// searchNames returns the names of the adversaries a search finds, best
+// first
+func searchNames(t *testing.T, db *sql.DB, query string) string {
+	t.Helper()
+
+	results, err := SearchAdversaries(context.Background(), db, query, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, r := range results {
+		names = append(names, r.Adversary.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func TestSearchAdversaries(t *testing.T) {
+	for _, mode := range searchModes {
+		t.Run(mode.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := mode.setup(t)
+
+			bear := createTestAdversary(t, db, "Bear")
+			if _, err := CreateAdversaryFeature(ctx, db, &AdversaryFeature{AdversaryID: bear, Kind: FeatureAction, Name: "Maul", Text: "Savages a wolf"}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := CreateAdversary(ctx, db, &Adversary{Name: "Dire Wolf", Tier: 1, Role: RoleSkulk, HitPoints: 4, Description: "A huge wolf that hunts in packs"}); err != nil {
+				t.Fatal(err)
+			}
+			createTestAdversary(t, db, "Giant Rat")
+
+			tests := []struct {
+				query string
+				want  string
+			}{
+				{"wolf", "Dire Wolf, Bear"},   // a name match ranks first
+				{"WOLF  pack", "Dire Wolf"},   // every word must match, by prefix
+				{"savages", "Bear"},           // feature text is searched
+				{`"giant" rat*`, "Giant Rat"}, // punctuation is not query syntax
+				{"owlbear", ""},
+				{" ", ""},
+			}
+			for _, tt := range tests {
+				if got := searchNames(t, db, tt.query); got != tt.want {
+					t.Errorf("search for %q found %q, want %q", tt.query, got, tt.want)
+				}
+			}
+
+			results, err := SearchAdversaries(ctx, db, "packs", 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 1 || !strings.Contains(results[0].Snippet, HighlightStart+"packs"+HighlightEnd) {
+				t.Errorf("snippet for packs: %+v", results)
+			}
+		})
+	}
+}
+
+func TestSearchAdversariesChanges(t *testing.T) {
+	for _, mode := range searchModes {
+		t.Run(mode.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := mode.setup(t)
+
+			id := createTestAdversary(t, db, "Giant Rat")
+
+			// Feature inserts, updates and deletes reach the search
+			featureID, err := CreateAdversaryFeature(ctx, db, &AdversaryFeature{AdversaryID: id, Kind: FeatureAction, Name: "Howl", Text: "Frightens the party"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := searchNames(t, db, "frightens"); got != "Giant Rat" {
+				t.Errorf("after adding a feature, search found %q", got)
+			}
+
+			err = UpdateAdversaryFeature(ctx, db, &AdversaryFeature{ID: featureID, AdversaryID: id, Kind: FeatureAction, Name: "Squeal", Text: "Deafens the party"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := searchNames(t, db, "frightens"); got != "" {
+				t.Errorf("after updating a feature, search for its old text found %q", got)
+			}
+			if got := searchNames(t, db, "squeal deafens"); got != "Giant Rat" {
+				t.Errorf("after updating a feature, search for its new text found %q", got)
+			}
+
+			if err := DeleteAdversaryFeature(ctx, db, featureID); err != nil {
+				t.Fatal(err)
+			}
+			if got := searchNames(t, db, "squeal"); got != "" {
+				t.Errorf("after deleting a feature, search found %q", got)
+			}
+			if got := searchNames(t, db, "tough"); got != "Giant Rat" {
+				t.Errorf("after deleting a feature, search for another found %q", got)
+			}
+
+			// So do changes to the adversary itself
+			adv, err := GetAdversaryByID(ctx, db, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			adv.Name = "Sewer Rat"
+			adv.MotivesTactics = "Scavenge, swarm"
+			if err := UpdateAdversary(ctx, db, adv); err != nil {
+				t.Fatal(err)
+			}
+			if got := searchNames(t, db, "giant"); got != "" {
+				t.Errorf("after renaming, search for the old name found %q", got)
+			}
+			if got := searchNames(t, db, "sewer swarm"); got != "Sewer Rat" {
+				t.Errorf("after renaming, search found %q", got)
+			}
+
+			if err := DeleteAdversary(ctx, db, id); err != nil {
+				t.Fatal(err)
+			}
+			if got := searchNames(t, db, "rat"); got != "" {
+				t.Errorf("after deleting, search found %q", got)
+			}
+		})
+	}
+}
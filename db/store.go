@@ -0,0 +1,172 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+// AdversaryStore stores the bestiary: adversaries, their features, and the
+// packs and SRD library imported into it. Lookups of a missing adversary or
+// feature return nil without an error.
+type AdversaryStore interface {
+	ListAdversaries(ctx context.Context, opts ListOptions) ([]*Adversary, string, error)
+	SearchAdversaries(ctx context.Context, query string, limit int) ([]*SearchResult, error)
+	GetAdversary(ctx context.Context, id int64) (*Adversary, error)
+	CreateAdversary(ctx context.Context, adv *Adversary) (int64, error)
+	UpdateAdversary(ctx context.Context, adv *Adversary) error
+	DeleteAdversary(ctx context.Context, id int64) error
+
+	GetAdversaryFeatures(ctx context.Context, adversaryID int64) ([]*AdversaryFeature, error)
+	GetAdversaryFeature(ctx context.Context, id int64) (*AdversaryFeature, error)
+	CreateAdversaryFeature(ctx context.Context, f *AdversaryFeature) (int64, error)
+	ReorderAdversaryFeatures(ctx context.Context, adversaryID int64, featureIDs []int64) error
+	DeleteAdversaryFeature(ctx context.Context, id int64) error
+
+	PlanImport(ctx context.Context, adversaries []*Adversary, policy string) ([]*ImportItem, error)
+	ImportAdversaries(ctx context.Context, adversaries []*Adversary, policy string) ([]*ImportItem, error)
+	SeedLibrary(ctx context.Context, adversaries []*Adversary) (created, updated int, err error)
+}
+
+// EncounterStore stores encounters and the adversaries in them. Lookups of a
+// missing encounter return nil without an error.
+type EncounterStore interface {
+	ListEncounters(ctx context.Context, opts ListOptions) ([]*Encounter, string, error)
+	GetEncounterSummaries(ctx context.Context) ([]*EncounterSummary, error)
+	GetEncounter(ctx context.Context, id int64) (*Encounter, error)
+	GetEncounterAdversaries(ctx context.Context, encounterID int64) ([]*EncounterAdversary, error)
+	CreateEncounter(ctx context.Context, enc *Encounter) (int64, error)
+	UpdateEncounter(ctx context.Context, enc *Encounter) error
+	UpdateEncounterParty(ctx context.Context, enc *Encounter) error
+	DeleteEncounter(ctx context.Context, id int64) error
+
+	// SetEncounterAdversary adds an adversary to an encounter, or sets its
+	// count if it is already there, and returns the membership ID
+	SetEncounterAdversary(ctx context.Context, ea *EncounterAdversary) (int64, error)
+	RemoveAdversaryFromEncounter(ctx context.Context, encounterAdversaryID int64) error
+}
+
+// SQLiteStore is the AdversaryStore and EncounterStore backed by the SQLite
+// database
+type SQLiteStore struct {
+	DB *sql.DB
+}
+
+// NewSQLiteStore returns a store backed by db
+func NewSQLiteStore(db *sql.DB) *SQLiteStore {
+	return &SQLiteStore{DB: db}
+}
+
+func (s *SQLiteStore) ListAdversaries(ctx context.Context, opts ListOptions) ([]*Adversary, string, error) {
+	return GetAllAdversaries(ctx, s.DB, opts)
+}
+
+func (s *SQLiteStore) SearchAdversaries(ctx context.Context, query string, limit int) ([]*SearchResult, error) {
+	return SearchAdversaries(ctx, s.DB, query, limit)
+}
+
+func (s *SQLiteStore) GetAdversary(ctx context.Context, id int64) (*Adversary, error) {
+	return GetAdversaryByID(ctx, s.DB, id)
+}
+
+func (s *SQLiteStore) CreateAdversary(ctx context.Context, adv *Adversary) (int64, error) {
+	return CreateAdversary(ctx, s.DB, adv)
+}
+
+func (s *SQLiteStore) UpdateAdversary(ctx context.Context, adv *Adversary) error {
+	return UpdateAdversary(ctx, s.DB, adv)
+}
+
+func (s *SQLiteStore) DeleteAdversary(ctx context.Context, id int64) error {
+	return DeleteAdversary(ctx, s.DB, id)
+}
+
+func (s *SQLiteStore) GetAdversaryFeatures(ctx context.Context, adversaryID int64) ([]*AdversaryFeature, error) {
+	return GetAdversaryFeatures(ctx, s.DB, adversaryID)
+}
+
+func (s *SQLiteStore) GetAdversaryFeature(ctx context.Context, id int64) (*AdversaryFeature, error) {
+	return GetAdversaryFeatureByID(ctx, s.DB, id)
+}
+
+func (s *SQLiteStore) CreateAdversaryFeature(ctx context.Context, f *AdversaryFeature) (int64, error) {
+	return CreateAdversaryFeature(ctx, s.DB, f)
+}
+
+func (s *SQLiteStore) ReorderAdversaryFeatures(ctx context.Context, adversaryID int64, featureIDs []int64) error {
+	return ReorderAdversaryFeatures(ctx, s.DB, adversaryID, featureIDs)
+}
+
+func (s *SQLiteStore) DeleteAdversaryFeature(ctx context.Context, id int64) error {
+	return DeleteAdversaryFeature(ctx, s.DB, id)
+}
+
+func (s *SQLiteStore) PlanImport(ctx context.Context, adversaries []*Adversary, policy string) ([]*ImportItem, error) {
+	return PlanImport(ctx, s.DB, adversaries, policy)
+}
+
+func (s *SQLiteStore) ImportAdversaries(ctx context.Context, adversaries []*Adversary, policy string) ([]*ImportItem, error) {
+	return ImportAdversaries(ctx, s.DB, adversaries, policy)
+}
+
+func (s *SQLiteStore) SeedLibrary(ctx context.Context, adversaries []*Adversary) (int, int, error) {
+	return SeedLibrary(ctx, s.DB, adversaries)
+}
+
+func (s *SQLiteStore) ListEncounters(ctx context.Context, opts ListOptions) ([]*Encounter, string, error) {
+	return GetAllEncounters(ctx, s.DB, opts)
+}
+
+func (s *SQLiteStore) GetEncounterSummaries(ctx context.Context) ([]*EncounterSummary, error) {
+	return GetEncounterSummaries(ctx, s.DB)
+}
+
+func (s *SQLiteStore) GetEncounter(ctx context.Context, id int64) (*Encounter, error) {
+	return GetEncounterByID(ctx, s.DB, id)
+}
+
+func (s *SQLiteStore) GetEncounterAdversaries(ctx context.Context, encounterID int64) ([]*EncounterAdversary, error) {
+	return GetEncounterAdversaries(ctx, s.DB, encounterID)
+}
+
+func (s *SQLiteStore) CreateEncounter(ctx context.Context, enc *Encounter) (int64, error) {
+	return CreateEncounter(ctx, s.DB, enc)
+}
+
+func (s *SQLiteStore) UpdateEncounter(ctx context.Context, enc *Encounter) error {
+	return UpdateEncounter(ctx, s.DB, enc)
+}
+
+func (s *SQLiteStore) UpdateEncounterParty(ctx context.Context, enc *Encounter) error {
+	return UpdateEncounterParty(ctx, s.DB, enc)
+}
+
+func (s *SQLiteStore) DeleteEncounter(ctx context.Context, id int64) error {
+	return DeleteEncounter(ctx, s.DB, id)
+}
+
+func (s *SQLiteStore) SetEncounterAdversary(ctx context.Context, ea *EncounterAdversary) (int64, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := AddAdversaryToEncounter(ctx, tx, ea)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+func (s *SQLiteStore) RemoveAdversaryFromEncounter(ctx context.Context, encounterAdversaryID int64) error {
+	return RemoveAdversaryFromEncounter(ctx, s.DB, encounterAdversaryID)
+}
+
+// SQLiteStore and MemoryStore are both adversary and encounter stores
+var (
+	_ AdversaryStore = (*SQLiteStore)(nil)
+	_ EncounterStore = (*SQLiteStore)(nil)
+	_ AdversaryStore = (*MemoryStore)(nil)
+	_ EncounterStore = (*MemoryStore)(nil)
+)
@@ -5,4 +5,5 @@ go 1.21
 require (
 	github.com/go-chi/chi/v5 v5.0.10
 	github.com/mattn/go-sqlite3 v1.14.17
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -1,8 +0,0 @@
-package app
-
-import (
-	"database/sql"
-)
-
-// DB is the shared database connection
-var DB *sql.DB
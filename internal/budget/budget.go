@@ -0,0 +1,166 @@
+// Package budget works out an encounter's battle point budget, following the
+// Daggerheart encounter building rules: the party gets (3 × PCs) + 2 battle
+// points, adjusted for how the fight is built, and each adversary costs
+// points by role.
+package budget
+
+import (
+	"fmt"
+
+	"github.com/juthrbog/adversarytracker/db"
+)
+
+// roleCosts is the battle point cost of one adversary of each role. Minions
+// are priced per group instead; see minionGroupCost.
+var roleCosts = map[string]int{
+	db.RoleSocial:   1,
+	db.RoleSupport:  1,
+	db.RoleHorde:    2,
+	db.RoleRanged:   2,
+	db.RoleSkulk:    2,
+	db.RoleStandard: 2,
+	db.RoleLeader:   3,
+	db.RoleBruiser:  4,
+	db.RoleSolo:     5,
+}
+
+// minionGroupCost is the cost of a group of Minions as large as the party
+const minionGroupCost = 1
+
+// Line is the cost of one adversary in the encounter
+type Line struct {
+	Name  string `json:"name"`
+	Role  string `json:"role"`
+	Count int    `json:"count"`
+	Cost  int    `json:"cost"`
+}
+
+// Adjustment is a change to the base budget, and why it applies
+type Adjustment struct {
+	Reason string `json:"reason"`
+	Points int    `json:"points"`
+}
+
+// Budget is an encounter's battle point budget and what it is spent on
+type Budget struct {
+	PartySize   int           `json:"party_size"`
+	PartyTier   int           `json:"party_tier"`
+	Base        int           `json:"base"`
+	Adjustments []*Adjustment `json:"adjustments"`
+	Available   int           `json:"available"`
+	Spent       int           `json:"spent"`
+	Lines       []*Line       `json:"lines"`
+	Warnings    []string      `json:"warnings"` // problems beyond the adjustments
+}
+
+// Remaining is the number of battle points left to spend; negative when the
+// encounter is over budget
+func (b *Budget) Remaining() int {
+	return b.Available - b.Spent
+}
+
+// Base is the unadjusted battle point budget for a party
+func Base(partySize int) int {
+	return 3*partySize + 2
+}
+
+// Cost is the battle point cost of count adversaries of a role, for a party
+// of partySize. Minions cost one point per group the size of the party, so a
+// partial group costs as much as a full one.
+func Cost(role string, count, partySize int) int {
+	if count <= 0 {
+		return 0
+	}
+	if role == db.RoleMinion {
+		groups := (count + partySize - 1) / partySize
+		return groups * minionGroupCost
+	}
+	return roleCosts[role] * count
+}
+
+// Calculate works out the budget of an encounter loaded with its adversaries
+func Calculate(enc *db.Encounter) *Budget {
+	partySize := enc.PartySize
+	if partySize < 1 {
+		partySize = 1
+	}
+
+	b := &Budget{
+		PartySize:   partySize,
+		PartyTier:   enc.PartyTier,
+		Base:        Base(partySize),
+		Adjustments: []*Adjustment{},
+		Lines:       []*Line{},
+		Warnings:    []string{},
+	}
+
+	solos := 0
+	bigThreats := 0
+	lowerTier := false
+	higherTier := false
+	for _, ea := range enc.Adversaries {
+		adv := ea.Adversary
+		line := &Line{
+			Name:  adv.Name,
+			Role:  adv.Role,
+			Count: ea.Count,
+			Cost:  Cost(adv.Role, ea.Count, partySize),
+		}
+		b.Lines = append(b.Lines, line)
+		b.Spent += line.Cost
+
+		switch adv.Role {
+		case db.RoleSolo:
+			solos += ea.Count
+			bigThreats += ea.Count
+		case db.RoleBruiser, db.RoleHorde, db.RoleLeader:
+			bigThreats += ea.Count
+		}
+		if adv.Tier < enc.PartyTier {
+			lowerTier = true
+		}
+		if adv.Tier > enc.PartyTier {
+			higherTier = true
+		}
+	}
+
+	// The standard adjustments. Those that depend on the adversaries are
+	// applied automatically; the rest are the GM's choice.
+	switch enc.Challenge {
+	case db.ChallengeEasier:
+		b.adjust("Easier or shorter fight", -1)
+	case db.ChallengeHarder:
+		b.adjust("Harder or longer fight", 2)
+	}
+	if solos >= 2 {
+		b.adjust("Two or more Solos", -2)
+	}
+	if enc.DamageBoost {
+		b.adjust("Adversaries deal extra damage", -2)
+	}
+	if lowerTier {
+		b.adjust("Adversaries from a lower tier", 1)
+	}
+	if len(enc.Adversaries) > 0 && bigThreats == 0 {
+		b.adjust("No Bruisers, Hordes, Leaders or Solos", 1)
+	}
+
+	b.Available = b.Base
+	for _, a := range b.Adjustments {
+		b.Available += a.Points
+	}
+
+	if remaining := b.Remaining(); remaining < 0 {
+		b.Warnings = append(b.Warnings, fmt.Sprintf("Over budget by %d battle points", -remaining))
+	}
+	if higherTier {
+		b.Warnings = append(b.Warnings, fmt.Sprintf("Adversaries above tier %d hit much harder than their cost suggests", enc.PartyTier))
+	}
+
+	return b
+}
+
+// adjust adds an adjustment to the budget
+func (b *Budget) adjust(reason string, points int) {
+	b.Adjustments = append(b.Adjustments, &Adjustment{Reason: reason, Points: points})
+}
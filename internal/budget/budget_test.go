@@ -0,0 +1,173 @@
+package budget
+
+import (
+	"testing"
+
+	"github.com/juthrbog/adversarytracker/db"
+)
+
+func TestCost(t *testing.T) {
+	tests := []struct {
+		name      string
+		role      string
+		count     int
+		partySize int
+		want      int
+	}{
+		{"one Standard", db.RoleStandard, 1, 4, 2},
+		{"three Bruisers", db.RoleBruiser, 3, 4, 12},
+		{"a Solo", db.RoleSolo, 1, 4, 5},
+		{"a full Minion group", db.RoleMinion, 4, 4, 1},
+		{"a partial Minion group", db.RoleMinion, 1, 4, 1},
+		{"one Minion past a group", db.RoleMinion, 5, 4, 2},
+		{"two full Minion groups", db.RoleMinion, 8, 4, 2},
+		{"Minions for a party of one", db.RoleMinion, 3, 1, 3},
+		{"none", db.RoleBruiser, 0, 4, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Cost(tt.role, tt.count, tt.partySize); got != tt.want {
+				t.Errorf("Cost(%s, %d, %d) = %d, want %d", tt.role, tt.count, tt.partySize, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	adversary := func(role string, tier int) *db.Adversary {
+		return &db.Adversary{Name: role, Role: role, Tier: tier}
+	}
+	solo := adversary(db.RoleSolo, 1)
+	bruiser := adversary(db.RoleBruiser, 1)
+	standard := adversary(db.RoleStandard, 1)
+	minion := adversary(db.RoleMinion, 1)
+
+	tests := []struct {
+		name        string
+		encounter   *db.Encounter
+		adversaries map[*db.Adversary]int
+		adjustments []string
+		available   int
+		spent       int
+		warnings    int
+	}{
+		{
+			name:        "no adversaries",
+			encounter:   &db.Encounter{PartySize: 4, PartyTier: 1},
+			adjustments: []string{},
+			available:   14,
+		},
+		{
+			name:        "a Bruiser needs no adjustment",
+			encounter:   &db.Encounter{PartySize: 4, PartyTier: 1},
+			adversaries: map[*db.Adversary]int{bruiser: 1, standard: 2},
+			adjustments: []string{},
+			available:   14,
+			spent:       8,
+		},
+		{
+			name:        "Minions cost one point per party-sized group",
+			encounter:   &db.Encounter{PartySize: 4, PartyTier: 1},
+			adversaries: map[*db.Adversary]int{bruiser: 1, minion: 6},
+			adjustments: []string{},
+			available:   14,
+			spent:       6,
+		},
+		{
+			name:        "one Solo",
+			encounter:   &db.Encounter{PartySize: 4, PartyTier: 1},
+			adversaries: map[*db.Adversary]int{solo: 1},
+			adjustments: []string{},
+			available:   14,
+			spent:       5,
+		},
+		{
+			name:        "two or more Solos",
+			encounter:   &db.Encounter{PartySize: 4, PartyTier: 1},
+			adversaries: map[*db.Adversary]int{solo: 2},
+			adjustments: []string{"Two or more Solos"},
+			available:   12,
+			spent:       10,
+		},
+		{
+			name:        "damage boost",
+			encounter:   &db.Encounter{PartySize: 4, PartyTier: 1, DamageBoost: true},
+			adversaries: map[*db.Adversary]int{bruiser: 1},
+			adjustments: []string{"Adversaries deal extra damage"},
+			available:   12,
+			spent:       4,
+		},
+		{
+			name:        "lower tier",
+			encounter:   &db.Encounter{PartySize: 4, PartyTier: 2},
+			adversaries: map[*db.Adversary]int{bruiser: 1},
+			adjustments: []string{"Adversaries from a lower tier"},
+			available:   15,
+			spent:       4,
+		},
+		{
+			name:        "no big threats",
+			encounter:   &db.Encounter{PartySize: 4, PartyTier: 1},
+			adversaries: map[*db.Adversary]int{standard: 2, minion: 4},
+			adjustments: []string{"No Bruisers, Hordes, Leaders or Solos"},
+			available:   15,
+			spent:       5,
+		},
+		{
+			name:        "everything at once",
+			encounter:   &db.Encounter{PartySize: 3, PartyTier: 2, Challenge: db.ChallengeHarder, DamageBoost: true},
+			adversaries: map[*db.Adversary]int{solo: 2},
+			adjustments: []string{"Harder or longer fight", "Two or more Solos", "Adversaries deal extra damage", "Adversaries from a lower tier"},
+			available:   10,
+			spent:       10,
+		},
+		{
+			name:        "easier fight over budget",
+			encounter:   &db.Encounter{PartySize: 2, PartyTier: 1, Challenge: db.ChallengeEasier},
+			adversaries: map[*db.Adversary]int{bruiser: 2},
+			adjustments: []string{"Easier or shorter fight"},
+			available:   7,
+			spent:       8,
+			warnings:    1,
+		},
+		{
+			name:        "higher tier",
+			encounter:   &db.Encounter{PartySize: 4, PartyTier: 1},
+			adversaries: map[*db.Adversary]int{adversary(db.RoleBruiser, 2): 1},
+			adjustments: []string{},
+			available:   14,
+			spent:       4,
+			warnings:    1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for adv, count := range tt.adversaries {
+				tt.encounter.Adversaries = append(tt.encounter.Adversaries, &db.EncounterAdversary{Adversary: adv, Count: count})
+			}
+
+			b := Calculate(tt.encounter)
+
+			var reasons []string
+			for _, a := range b.Adjustments {
+				reasons = append(reasons, a.Reason)
+			}
+			if len(reasons) != len(tt.adjustments) {
+				t.Fatalf("adjustments are %q, want %q", reasons, tt.adjustments)
+			}
+			for i := range reasons {
+				if reasons[i] != tt.adjustments[i] {
+					t.Fatalf("adjustments are %q, want %q", reasons, tt.adjustments)
+				}
+			}
+			if b.Available != tt.available || b.Spent != tt.spent {
+				t.Errorf("%d of %d battle points spent, want %d of %d", b.Spent, b.Available, tt.spent, tt.available)
+			}
+			if len(b.Warnings) != tt.warnings {
+				t.Errorf("warnings are %q, want %d", b.Warnings, tt.warnings)
+			}
+		})
+	}
+}
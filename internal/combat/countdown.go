@@ -0,0 +1,79 @@
+package combat
+
+import (
+	"github.com/juthrbog/adversarytracker/db"
+)
+
+// Action roll results, as reported by the players
+const (
+	RollCritical    = "critical"
+	RollSuccessHope = "success_hope"
+	RollSuccessFear = "success_fear"
+	RollFailureHope = "failure_hope"
+	RollFailureFear = "failure_fear"
+)
+
+// RollResults lists the action roll results in order from best to worst
+var RollResults = []string{RollCritical, RollSuccessHope, RollSuccessFear, RollFailureHope, RollFailureFear}
+
+// dynamicTicks is the dynamic countdown table: how far a roll result
+// advances progress and consequence countdowns
+var dynamicTicks = map[string]map[string]int{
+	db.CountdownProgress: {
+		RollCritical:    3,
+		RollSuccessHope: 2,
+		RollSuccessFear: 1,
+		RollFailureHope: 0,
+		RollFailureFear: 0,
+	},
+	db.CountdownConsequence: {
+		RollCritical:    0,
+		RollSuccessHope: 0,
+		RollSuccessFear: 1,
+		RollFailureHope: 2,
+		RollFailureFear: 3,
+	},
+}
+
+// IsValidRollResult reports whether result is one of the action roll results
+func IsValidRollResult(result string) bool {
+	for _, r := range RollResults {
+		if r == result {
+			return true
+		}
+	}
+	return false
+}
+
+// RollTicks returns how far an action roll advances each of the countdowns
+// that tick on rolls, keyed by countdown ID
+func RollTicks(countdowns []*db.Countdown, result string) map[int64]int {
+	ticks := make(map[int64]int)
+	for _, c := range countdowns {
+		if c.TickOn != db.TickOnRoll {
+			continue
+		}
+		if c.Kind == db.CountdownDynamic {
+			ticks[c.ID] = dynamicTicks[c.Purpose][result]
+		} else {
+			ticks[c.ID] = 1
+		}
+	}
+	return ticks
+}
+
+// ActionTicks returns the countdowns advanced when a combatant takes the
+// spotlight: every session countdown that ticks on actions, and those
+// attached to that combatant. Each ticks by one.
+func ActionTicks(countdowns []*db.Countdown, combatantID int64) map[int64]int {
+	ticks := make(map[int64]int)
+	for _, c := range countdowns {
+		if c.TickOn != db.TickOnAction {
+			continue
+		}
+		if c.CombatantID == nil || *c.CombatantID == combatantID {
+			ticks[c.ID] = 1
+		}
+	}
+	return ticks
+}
@@ -0,0 +1,149 @@
+// Package combat holds the Daggerheart combat rules used by the tracker
+package combat
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/juthrbog/adversarytracker/db"
+)
+
+// Damage severities, by the number of HP they mark
+const (
+	SeverityNone    = "None"
+	SeverityMinor   = "Minor"
+	SeverityMajor   = "Major"
+	SeveritySevere  = "Severe"
+	SeverityMassive = "Massive"
+)
+
+// Damage is a single hit against a combatant
+type Damage struct {
+	Amount int `json:"amount"`
+	// Direct damage cannot be reduced by armor. Adversaries have no Armor
+	// Slots, so it only shows up in the explanation.
+	Direct     bool `json:"direct"`
+	Resistance bool `json:"resistance"`
+	Immunity   bool `json:"immunity"`
+	// MassiveDamage enables the optional rule where damage of at least twice
+	// the Severe threshold marks 4 HP
+	MassiveDamage bool `json:"massive_damage"`
+}
+
+// Outcome is the result of resolving damage against a combatant
+type Outcome struct {
+	Severity    string `json:"severity"`
+	Marked      int    `json:"marked"`    // HP marked by this hit
+	HPMarked    int    `json:"hp_marked"` // total HP marked after the hit
+	Defeated    bool   `json:"defeated"`  // whether the hit left the combatant with no HP
+	Explanation string `json:"explanation"`
+}
+
+// ResolveDamage works out how much HP a hit marks on a combatant. The damage
+// is first reduced by immunity (to nothing) or resistance (halved, rounding
+// down), then compared to the combatant's thresholds: Severe or more marks
+// 3 HP, Major or more marks 2, and anything else marks 1. Minions are
+// defeated by any damage. The combatant itself is not changed.
+func ResolveDamage(c *db.Combatant, d Damage) Outcome {
+	var steps []string
+	amount := d.Amount
+	if amount < 0 {
+		amount = 0
+	}
+
+	if d.Direct {
+		steps = append(steps, fmt.Sprintf("%d direct damage", amount))
+	} else {
+		steps = append(steps, fmt.Sprintf("%d damage", amount))
+	}
+
+	switch {
+	case d.Immunity:
+		amount = 0
+		steps = append(steps, "ignored by immunity")
+	case d.Resistance:
+		amount /= 2
+		steps = append(steps, fmt.Sprintf("halved to %d by resistance", amount))
+	}
+
+	out := Outcome{Severity: SeverityNone}
+
+	switch {
+	case amount <= 0:
+		steps = append(steps, "no HP marked")
+	case c.Role == db.RoleMinion:
+		out.Severity = severityFor(c, amount, d.MassiveDamage)
+		out.Marked = c.HPMax - c.HPMarked
+		steps = append(steps, "a Minion is defeated by any damage")
+	default:
+		out.Severity = severityFor(c, amount, d.MassiveDamage)
+		out.Marked = hpForSeverity(out.Severity)
+		steps = append(steps, thresholdStep(c, out.Severity))
+	}
+
+	// A combatant cannot mark more HP than it has left
+	if remaining := c.HPMax - c.HPMarked; out.Marked > remaining {
+		out.Marked = remaining
+	}
+	if out.Marked < 0 {
+		out.Marked = 0
+	}
+
+	out.HPMarked = c.HPMarked + out.Marked
+	out.Defeated = c.HPMax > 0 && out.HPMarked >= c.HPMax
+
+	if out.Defeated {
+		steps = append(steps, fmt.Sprintf("%s is defeated", c.Name))
+	} else {
+		steps = append(steps, fmt.Sprintf("%s has %d/%d HP marked", c.Name, out.HPMarked, c.HPMax))
+	}
+
+	out.Explanation = strings.Join(steps, ", ") + "."
+	return out
+}
+
+// severityFor compares damage to a combatant's thresholds. A threshold of 0
+// means the combatant has none, so damage can never reach it.
+func severityFor(c *db.Combatant, amount int, massiveDamage bool) string {
+	switch {
+	case c.SevereThreshold > 0 && massiveDamage && amount >= 2*c.SevereThreshold:
+		return SeverityMassive
+	case c.SevereThreshold > 0 && amount >= c.SevereThreshold:
+		return SeveritySevere
+	case c.MajorThreshold > 0 && amount >= c.MajorThreshold:
+		return SeverityMajor
+	default:
+		return SeverityMinor
+	}
+}
+
+// hpForSeverity returns the number of HP a damage severity marks
+func hpForSeverity(severity string) int {
+	switch severity {
+	case SeverityMassive:
+		return 4
+	case SeveritySevere:
+		return 3
+	case SeverityMajor:
+		return 2
+	case SeverityMinor:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// thresholdStep explains which threshold the damage reached
+func thresholdStep(c *db.Combatant, severity string) string {
+	hp := hpForSeverity(severity)
+	switch severity {
+	case SeverityMassive:
+		return fmt.Sprintf("at least twice the Severe threshold of %d is massive damage, marking %d HP", c.SevereThreshold, hp)
+	case SeveritySevere:
+		return fmt.Sprintf("meets the Severe threshold of %d, marking %d HP", c.SevereThreshold, hp)
+	case SeverityMajor:
+		return fmt.Sprintf("meets the Major threshold of %d, marking %d HP", c.MajorThreshold, hp)
+	default:
+		return fmt.Sprintf("below the Major threshold, marking %d HP", hp)
+	}
+}
@@ -0,0 +1,80 @@
+package combat
+
+import (
+	"testing"
+
+	"github.com/juthrbog/adversarytracker/db"
+)
+
+func TestResolveDamage(t *testing.T) {
+	tests := []struct {
+		name     string
+		role     string
+		major    int
+		severe   int
+		hpMarked int
+		damage   Damage
+		severity string
+		marked   int
+		defeated bool
+	}{
+		{name: "below Major", damage: Damage{Amount: 4}, severity: SeverityMinor, marked: 1},
+		{name: "exactly Major", damage: Damage{Amount: 5}, severity: SeverityMajor, marked: 2},
+		{name: "just below Severe", damage: Damage{Amount: 9}, severity: SeverityMajor, marked: 2},
+		{name: "exactly Severe", damage: Damage{Amount: 10}, severity: SeveritySevere, marked: 3},
+		{name: "twice Severe without the optional rule", damage: Damage{Amount: 20}, severity: SeveritySevere, marked: 3},
+		{name: "just below massive", damage: Damage{Amount: 19, MassiveDamage: true}, severity: SeveritySevere, marked: 3},
+		{name: "exactly twice Severe is massive", damage: Damage{Amount: 20, MassiveDamage: true}, severity: SeverityMassive, marked: 4},
+		{name: "well past massive", damage: Damage{Amount: 45, MassiveDamage: true}, severity: SeverityMassive, marked: 4},
+		{name: "direct damage uses the same thresholds", damage: Damage{Amount: 10, Direct: true}, severity: SeveritySevere, marked: 3},
+		{name: "resistance halves, rounding down", damage: Damage{Amount: 11, Resistance: true}, severity: SeverityMajor, marked: 2},
+		{name: "resistance below Major", damage: Damage{Amount: 9, Resistance: true}, severity: SeverityMinor, marked: 1},
+		{name: "resistance to 1 damage", damage: Damage{Amount: 1, Resistance: true}, severity: SeverityNone},
+		{name: "immunity", damage: Damage{Amount: 30, Immunity: true}, severity: SeverityNone},
+		{name: "no damage", damage: Damage{Amount: 0}, severity: SeverityNone},
+		{name: "negative damage", damage: Damage{Amount: -3}, severity: SeverityNone},
+		{name: "no thresholds", major: -1, severe: -1, damage: Damage{Amount: 50, MassiveDamage: true}, severity: SeverityMinor, marked: 1},
+		{name: "capped by HP left", hpMarked: 8, damage: Damage{Amount: 10}, severity: SeveritySevere, marked: 2, defeated: true},
+		{name: "exactly the HP left", hpMarked: 7, damage: Damage{Amount: 10}, severity: SeveritySevere, marked: 3, defeated: true},
+		{name: "already defeated", hpMarked: 10, damage: Damage{Amount: 10}, severity: SeveritySevere, defeated: true},
+		{name: "Minion", role: db.RoleMinion, damage: Damage{Amount: 1}, severity: SeverityMinor, marked: 10, defeated: true},
+		{name: "Minion immune", role: db.RoleMinion, damage: Damage{Amount: 8, Immunity: true}, severity: SeverityNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A Major threshold of 5 and Severe of 10 unless the case says
+			// otherwise; -1 stands for no threshold at all
+			c := &db.Combatant{
+				Name:            "Bear",
+				Role:            db.RoleBruiser,
+				MajorThreshold:  5,
+				SevereThreshold: 10,
+				HPMax:           10,
+				HPMarked:        tt.hpMarked,
+			}
+			if tt.role != "" {
+				c.Role = tt.role
+			}
+			if tt.major != 0 {
+				c.MajorThreshold = max(tt.major, 0)
+			}
+			if tt.severe != 0 {
+				c.SevereThreshold = max(tt.severe, 0)
+			}
+
+			out := ResolveDamage(c, tt.damage)
+
+			if out.Severity != tt.severity || out.Marked != tt.marked || out.Defeated != tt.defeated {
+				t.Errorf("got %s, %d HP marked, defeated %v; want %s, %d, %v (%s)",
+					out.Severity, out.Marked, out.Defeated, tt.severity, tt.marked, tt.defeated, out.Explanation)
+			}
+			if out.HPMarked != tt.hpMarked+tt.marked {
+				t.Errorf("total HP marked is %d, want %d", out.HPMarked, tt.hpMarked+tt.marked)
+			}
+			if c.HPMarked != tt.hpMarked {
+				t.Error("ResolveDamage changed the combatant")
+			}
+		})
+	}
+}
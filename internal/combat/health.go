@@ -0,0 +1,30 @@
+package combat
+
+import "github.com/juthrbog/adversarytracker/db"
+
+// Health bands describe how hurt a combatant looks, without giving away its
+// HP, for the player view
+const (
+	HealthUnhurt    = "Unhurt"
+	HealthWounded   = "Wounded"
+	HealthBloodied  = "Bloodied"
+	HealthNearDeath = "Near death"
+	HealthDefeated  = "Defeated"
+)
+
+// HealthBand returns the health band of a combatant. It is bloodied once
+// half its HP is marked, and near death with one HP left.
+func HealthBand(c *db.Combatant) string {
+	switch {
+	case c.Defeated():
+		return HealthDefeated
+	case c.HPMarked == 0:
+		return HealthUnhurt
+	case c.HPMax-c.HPMarked == 1:
+		return HealthNearDeath
+	case c.HPMarked*2 >= c.HPMax:
+		return HealthBloodied
+	default:
+		return HealthWounded
+	}
+}
@@ -0,0 +1,178 @@
+package combat
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/juthrbog/adversarytracker/db"
+)
+
+// DescribeChange names what a change to a combat session was about and
+// summarizes it for the combat log, by comparing the fight before and after
+// it. before is nil for the start of combat. The target is the first
+// combatant or countdown changed, if any.
+func DescribeChange(before, after *db.CombatState) (target, summary string) {
+	if before == nil {
+		return "", fmt.Sprintf("Combat started with %s", plural(len(after.Session.Combatants), "combatant"))
+	}
+	if after.Session.Status == db.CombatEnded && before.Session.Status != db.CombatEnded {
+		return "", "Combat ended"
+	}
+
+	var changes []string
+	note := func(name, change string) {
+		if target == "" {
+			target = name
+		}
+		changes = append(changes, change)
+	}
+
+	was := make(map[int64]*db.Combatant, len(before.Session.Combatants))
+	for _, c := range before.Session.Combatants {
+		was[c.ID] = c
+	}
+	for _, c := range after.Session.Combatants {
+		old, ok := was[c.ID]
+		if !ok {
+			note(c.Name, c.Name+" joined the fight")
+			continue
+		}
+		delete(was, c.ID)
+
+		if d := c.HPMarked - old.HPMarked; d != 0 {
+			note(c.Name, fmt.Sprintf("%s %s %s (%d/%d)", c.Name, markedOrCleared(d), plural(abs(d), "HP"), c.HPMarked, c.HPMax))
+		}
+		if d := c.StressMarked - old.StressMarked; d != 0 {
+			note(c.Name, fmt.Sprintf("%s %s %s (%d/%d)", c.Name, markedOrCleared(d), plural(abs(d), "Stress"), c.StressMarked, c.StressMax))
+		}
+		if c.Acted && !old.Acted {
+			note(c.Name, c.Name+" acted")
+		}
+
+		had := make(map[string]*db.CombatantCondition, len(old.Conditions))
+		for _, cond := range old.Conditions {
+			had[cond.Name] = cond
+		}
+		for _, cond := range c.Conditions {
+			oldCond, ok := had[cond.Name]
+			switch {
+			case !ok:
+				note(c.Name, fmt.Sprintf("%s is %s", c.Name, cond.Name))
+			case cond.Public && !oldCond.Public:
+				note(c.Name, fmt.Sprintf("%s's %s shown to players", c.Name, cond.Name))
+			case !cond.Public && oldCond.Public:
+				note(c.Name, fmt.Sprintf("%s's %s hidden from players", c.Name, cond.Name))
+			}
+			delete(had, cond.Name)
+		}
+		for _, cond := range old.Conditions {
+			if _, ok := had[cond.Name]; ok {
+				note(c.Name, fmt.Sprintf("%s is no longer %s", c.Name, cond.Name))
+			}
+		}
+
+		describeCountdowns(old.Countdowns, c.Countdowns, note)
+	}
+	for _, c := range before.Session.Combatants {
+		if _, ok := was[c.ID]; ok {
+			note(c.Name, c.Name+" removed from the fight")
+		}
+	}
+
+	describeCountdowns(before.Session.Countdowns, after.Session.Countdowns, note)
+
+	s, old := after.Session, before.Session
+	if s.Fear != old.Fear {
+		change := "gained"
+		if s.Fear < old.Fear {
+			change = "spent"
+		}
+		reason := ""
+		if len(after.FearLog) > len(before.FearLog) && after.FearLog[0].Reason != "" {
+			reason = " on " + after.FearLog[0].Reason
+		}
+		changes = append(changes, fmt.Sprintf("GM %s %s%s (%d/%d)", change, plural(abs(s.Fear-old.Fear), "Fear"), reason, s.Fear, s.FearMax))
+	}
+	if s.FearMax != old.FearMax {
+		changes = append(changes, fmt.Sprintf("Fear cap set to %d", s.FearMax))
+	}
+	if s.Spotlight != old.Spotlight {
+		if s.Spotlight == db.SpotlightGM {
+			changes = append(changes, "Spotlight passed to the GM")
+		} else {
+			changes = append(changes, "Spotlight passed to the players")
+		}
+	}
+	if s.TrackerMode != old.TrackerMode {
+		if s.TrackerMode == db.TrackerActionTracker {
+			changes = append(changes, "Switched to the action tracker")
+		} else {
+			changes = append(changes, "Switched to the narrative spotlight")
+		}
+	}
+	if s.ActionTokens != old.ActionTokens {
+		changes = append(changes, fmt.Sprintf("Action tokens set to %d", s.ActionTokens))
+	}
+
+	if len(changes) == 0 {
+		return target, "Combat updated"
+	}
+	return target, strings.Join(changes, "; ")
+}
+
+// describeCountdowns notes the countdowns added, removed, ticked and shown or
+// hidden between two lists
+func describeCountdowns(before, after []*db.Countdown, note func(name, change string)) {
+	was := make(map[int64]*db.Countdown, len(before))
+	for _, cd := range before {
+		was[cd.ID] = cd
+	}
+	for _, cd := range after {
+		old, ok := was[cd.ID]
+		if !ok {
+			note(cd.Name, fmt.Sprintf("Countdown %s started at %d", cd.Name, cd.Value))
+			continue
+		}
+		delete(was, cd.ID)
+
+		switch {
+		case cd.Loops > old.Loops:
+			note(cd.Name, fmt.Sprintf("Countdown %s fired and looped to %d", cd.Name, cd.Value))
+		case cd.Value != old.Value:
+			note(cd.Name, fmt.Sprintf("Countdown %s at %d", cd.Name, cd.Value))
+		}
+		if cd.Public != old.Public {
+			if cd.Public {
+				note(cd.Name, fmt.Sprintf("Countdown %s shown to players", cd.Name))
+			} else {
+				note(cd.Name, fmt.Sprintf("Countdown %s hidden from players", cd.Name))
+			}
+		}
+	}
+	for _, cd := range before {
+		if _, ok := was[cd.ID]; ok {
+			note(cd.Name, fmt.Sprintf("Countdown %s removed", cd.Name))
+		}
+	}
+}
+
+func markedOrCleared(delta int) string {
+	if delta < 0 {
+		return "cleared"
+	}
+	return "marked"
+}
+
+func plural(n int, noun string) string {
+	if n == 1 || noun == "HP" || noun == "Stress" || noun == "Fear" {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,264 @@
+package combat
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/juthrbog/adversarytracker/db"
+)
+
+// BuildReport summarizes an ended fight from its final state and the changes
+// that stand in its combat log, oldest first (see db.GetCombatHistory).
+// Fights that were not logged from the start are summarized from what was
+// logged, and from the final state alone if nothing was.
+func BuildReport(final *db.CombatState, history []*db.CombatLogEntry) *db.CombatReport {
+	s := final.Session
+	report := &db.CombatReport{
+		EncounterID: s.EncounterID,
+		SessionID:   s.ID,
+		StartedAt:   s.StartedAt,
+		EndedAt:     time.Now().UTC(),
+		GMTurns:     s.GMTurn,
+		Combatants:  []*db.CombatantReport{},
+		Countdowns:  []*db.CountdownReport{},
+	}
+	if s.EndedAt != nil {
+		report.EndedAt = *s.EndedAt
+	}
+
+	combatants := make(map[int64]*db.CombatantReport)
+	countdowns := make(map[int64]*db.CountdownReport)
+
+	// see adds the combatants and countdowns of a state met for the first
+	// time, as they stood then, and keeps the latest values of the others
+	see := func(state *db.CombatState) {
+		for _, c := range state.Session.Combatants {
+			cr, ok := combatants[c.ID]
+			if !ok {
+				cr = &db.CombatantReport{Damage: c.HPMarked, StressMarked: c.StressMarked}
+				combatants[c.ID] = cr
+				report.Combatants = append(report.Combatants, cr)
+			}
+			cr.Name, cr.Role = c.Name, c.Role
+			cr.HPMax, cr.HPMarked, cr.StressMax = c.HPMax, c.HPMarked, c.StressMax
+			cr.Defeated = c.Defeated()
+		}
+		for _, cd := range stateCountdowns(state) {
+			cr, ok := countdowns[cd.ID]
+			if !ok {
+				cr = &db.CountdownReport{Resolved: countdownFired(cd)}
+				countdowns[cd.ID] = cr
+				report.Countdowns = append(report.Countdowns, cr)
+			}
+			cr.Name, cr.Kind = cd.Name, cd.Kind
+			cr.StartValue, cr.Value, cr.Loops = cd.StartValue, cd.Value, cd.Loops
+		}
+	}
+
+	for _, e := range history {
+		if e.Kind == db.CombatLogUndo || e.Kind == db.CombatLogRedo {
+			continue
+		}
+		if e.Undoable {
+			report.Changes++
+		}
+		see(e.After)
+		if e.Before == nil {
+			continue
+		}
+		at := e.CreatedAt
+
+		was := make(map[int64]*db.Combatant, len(e.Before.Session.Combatants))
+		for _, c := range e.Before.Session.Combatants {
+			was[c.ID] = c
+		}
+		for _, c := range e.After.Session.Combatants {
+			old, ok := was[c.ID]
+			if !ok {
+				continue
+			}
+			cr := combatants[c.ID]
+			if d := c.HPMarked - old.HPMarked; d > 0 {
+				cr.Damage += d
+			}
+			if d := c.StressMarked - old.StressMarked; d > 0 {
+				cr.StressMarked += d
+			}
+			if c.Defeated() && !old.Defeated() {
+				cr.DefeatedAt = &at
+			}
+		}
+
+		wasCountdown := make(map[int64]*db.Countdown)
+		for _, cd := range stateCountdowns(e.Before) {
+			wasCountdown[cd.ID] = cd
+		}
+		for _, cd := range stateCountdowns(e.After) {
+			old, ok := wasCountdown[cd.ID]
+			cr := countdowns[cd.ID]
+			if ok && cr.ResolvedAt == nil && (cd.Loops > old.Loops || (cd.Value == 0 && old.Value > 0)) {
+				cr.Resolved, cr.ResolvedAt = true, &at
+			}
+		}
+	}
+
+	// Whatever the log missed, the fight ended as it stands now
+	see(final)
+	present := make(map[int64]bool)
+	for _, c := range s.Combatants {
+		present[c.ID] = true
+	}
+	for id, cr := range combatants {
+		cr.Removed = !present[id]
+		if !cr.Defeated {
+			cr.DefeatedAt = nil
+		}
+	}
+	present = make(map[int64]bool)
+	for _, cd := range stateCountdowns(final) {
+		present[cd.ID] = true
+	}
+	for id, cr := range countdowns {
+		cr.Removed = !present[id]
+	}
+
+	// The Fear log is newest first
+	for i := len(final.FearLog) - 1; i >= 0; i-- {
+		e := final.FearLog[i]
+		if e.Delta > 0 {
+			report.FearGained += e.Delta
+		} else if e.Delta < 0 {
+			report.FearSpent -= e.Delta
+			report.FearSpends = append(report.FearSpends, e)
+		}
+	}
+	if report.FearSpends == nil {
+		report.FearSpends = []*db.FearEntry{}
+	}
+
+	return report
+}
+
+// stateCountdowns lists every countdown of a state, those of the encounter
+// first
+func stateCountdowns(state *db.CombatState) []*db.Countdown {
+	countdowns := append([]*db.Countdown(nil), state.Session.Countdowns...)
+	for _, c := range state.Session.Combatants {
+		countdowns = append(countdowns, c.Countdowns...)
+	}
+	return countdowns
+}
+
+// countdownFired reports whether a countdown has run down at least once
+func countdownFired(cd *db.Countdown) bool {
+	return cd.Done() || cd.Loops > 0
+}
+
+// WriteReportMarkdown writes the report of a fight in an encounter as a
+// Markdown document
+func WriteReportMarkdown(w io.Writer, encounterName string, r *db.CombatReport) error {
+	b := bufio.NewWriter(w)
+
+	fmt.Fprintf(b, "# %s: combat report\n\n", markdownText(encounterName))
+	fmt.Fprintf(b, "Fought on %s, from %s to %s.\n\n",
+		r.StartedAt.Format("January 2, 2006"), r.StartedAt.Format("15:04"), r.EndedAt.Format("15:04"))
+
+	b.WriteString("## Summary\n\n")
+	fmt.Fprintf(b, "- Duration: %s\n", r.DurationLabel())
+	fmt.Fprintf(b, "- GM turns: %d\n", r.GMTurns)
+	fmt.Fprintf(b, "- Adversaries defeated: %d of %d\n", r.DefeatedCount(), len(r.Combatants))
+	fmt.Fprintf(b, "- Fear gained: %d\n", r.FearGained)
+	fmt.Fprintf(b, "- Fear spent: %d\n", r.FearSpent)
+	fmt.Fprintf(b, "- Countdowns resolved: %d of %d\n", r.ResolvedCount(), len(r.Countdowns))
+
+	if len(r.Combatants) > 0 {
+		b.WriteString("\n## Adversaries\n\n")
+		b.WriteString("| Adversary | Role | HP marked | Stress marked | Outcome |\n")
+		b.WriteString("| --- | --- | --- | --- | --- |\n")
+		for _, c := range r.Combatants {
+			fmt.Fprintf(b, "| %s | %s | %d (%d/%d at the end) | %d | %s |\n",
+				markdownCell(c.Name), markdownCell(c.Role), c.Damage, c.HPMarked, c.HPMax, c.StressMarked, combatantOutcome(c))
+		}
+	}
+
+	if len(r.FearSpends) > 0 {
+		b.WriteString("\n## Fear spent\n\n")
+		for _, e := range r.FearSpends {
+			fmt.Fprintf(b, "- %s: %s", e.CreatedAt.Format("15:04"), plural(e.Amount(), "Fear"))
+			if e.FeatureName != "" {
+				fmt.Fprintf(b, " on %s", markdownText(e.FeatureName))
+			}
+			if e.Reason != "" {
+				fmt.Fprintf(b, " (%s)", markdownText(e.Reason))
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	if len(r.Countdowns) > 0 {
+		b.WriteString("\n## Countdowns\n\n")
+		b.WriteString("| Countdown | Result |\n")
+		b.WriteString("| --- | --- |\n")
+		for _, cd := range r.Countdowns {
+			fmt.Fprintf(b, "| %s | %s |\n", markdownCell(cd.Name), countdownOutcome(cd))
+		}
+	}
+
+	return b.Flush()
+}
+
+// combatantOutcome describes how a combatant's fight ended
+func combatantOutcome(c *db.CombatantReport) string {
+	var outcome string
+	switch {
+	case c.Defeated && c.DefeatedAt != nil:
+		outcome = "Defeated at " + c.DefeatedAt.Format("15:04")
+	case c.Defeated:
+		outcome = "Defeated"
+	default:
+		outcome = "Standing"
+	}
+	if c.Removed {
+		outcome += ", removed from the fight"
+	}
+	return outcome
+}
+
+// countdownOutcome describes what became of a countdown
+func countdownOutcome(cd *db.CountdownReport) string {
+	var outcome string
+	switch {
+	case cd.Loops == 1:
+		outcome = "Fired once"
+	case cd.Loops > 1:
+		outcome = fmt.Sprintf("Fired %d times", cd.Loops)
+	case cd.Resolved && cd.ResolvedAt != nil:
+		outcome = "Resolved at " + cd.ResolvedAt.Format("15:04")
+	case cd.Resolved:
+		outcome = "Resolved"
+	default:
+		outcome = fmt.Sprintf("At %d of %d", cd.Value, cd.StartValue)
+	}
+	if cd.Removed {
+		outcome += ", removed"
+	}
+	return outcome
+}
+
+// markdownText escapes the characters that Markdown would read as
+// formatting in free text
+func markdownText(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+// markdownCell escapes text for a Markdown table cell
+func markdownCell(s string) string {
+	return strings.ReplaceAll(markdownText(s), "|", `\|`)
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`, "\n", " ",
+)
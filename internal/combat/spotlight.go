@@ -0,0 +1,52 @@
+package combat
+
+import (
+	"fmt"
+
+	"github.com/juthrbog/adversarytracker/db"
+)
+
+// Cost is what activating an adversary on a GM turn costs
+type Cost struct {
+	Fear   int
+	Tokens int
+}
+
+// Free reports whether the activation costs nothing
+func (c Cost) Free() bool {
+	return c.Fear == 0 && c.Tokens == 0
+}
+
+// String describes the cost for the tracker UI
+func (c Cost) String() string {
+	switch {
+	case c.Tokens > 0:
+		return fmt.Sprintf("%d action token", c.Tokens)
+	case c.Fear > 0:
+		return fmt.Sprintf("%d Fear", c.Fear)
+	default:
+		return "free"
+	}
+}
+
+// ActivationCost returns the cost of activating one more adversary in the
+// session's current GM turn. In the narrative flow the GM spotlights one
+// adversary for free and pays 1 Fear for each additional one. With the
+// action tracker every activation spends an action token instead.
+func ActivationCost(s *db.CombatSession) Cost {
+	if s.TrackerMode == db.TrackerActionTracker {
+		return Cost{Tokens: 1}
+	}
+
+	if s.ActedCount() == 0 {
+		return Cost{}
+	}
+
+	return Cost{Fear: 1}
+}
+
+// PriceActivation is ActivationCost as db.ActivateCombatant takes it
+func PriceActivation(s *db.CombatSession) (fear, tokens int) {
+	cost := ActivationCost(s)
+	return cost.Fear, cost.Tokens
+}
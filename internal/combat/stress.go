@@ -0,0 +1,79 @@
+package combat
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/juthrbog/adversarytracker/db"
+)
+
+// StressOutcome is the result of marking Stress on a combatant
+type StressOutcome struct {
+	Marked       int    `json:"marked"`        // Stress marked by this change
+	Overflow     int    `json:"overflow"`      // HP marked because the Stress track was full
+	StressMarked int    `json:"stress_marked"` // total Stress marked after the change
+	HPMarked     int    `json:"hp_marked"`     // total HP marked after the change
+	Defeated     bool   `json:"defeated"`      // whether the overflow left the combatant with no HP
+	Explanation  string `json:"explanation"`
+}
+
+// MarkStress works out what marking Stress does to a combatant. Stress is
+// marked until the Stress track is full; each Stress it cannot mark marks an
+// HP instead, up to the HP it has left. The combatant itself is not changed.
+func MarkStress(c *db.Combatant, amount int) StressOutcome {
+	if amount < 0 {
+		amount = 0
+	}
+
+	out := StressOutcome{StressMarked: c.StressMarked, HPMarked: c.HPMarked}
+
+	out.Marked = c.StressMax - c.StressMarked
+	if out.Marked > amount {
+		out.Marked = amount
+	}
+	if out.Marked < 0 {
+		out.Marked = 0
+	}
+	out.StressMarked += out.Marked
+
+	out.Overflow = amount - out.Marked
+	if remaining := c.HPMax - c.HPMarked; out.Overflow > remaining {
+		out.Overflow = remaining
+	}
+	if out.Overflow < 0 {
+		out.Overflow = 0
+	}
+	out.HPMarked += out.Overflow
+	out.Defeated = out.Overflow > 0 && c.HPMax > 0 && out.HPMarked >= c.HPMax
+
+	var steps []string
+	switch {
+	case amount == out.Marked:
+		steps = append(steps, fmt.Sprintf("%s marks %d Stress", c.Name, out.Marked))
+	case out.Marked > 0:
+		steps = append(steps, fmt.Sprintf("%s marks %d Stress", c.Name, out.Marked),
+			fmt.Sprintf("the Stress track is then full, marking %d HP instead", out.Overflow))
+	default:
+		steps = append(steps, fmt.Sprintf("%s's Stress track is full, marking %d HP instead", c.Name, out.Overflow))
+	}
+	if out.Defeated {
+		steps = append(steps, fmt.Sprintf("%s is defeated", c.Name))
+	} else {
+		steps = append(steps, fmt.Sprintf("%s has %d/%d Stress and %d/%d HP marked", c.Name, out.StressMarked, c.StressMax, out.HPMarked, c.HPMax))
+	}
+
+	out.Explanation = strings.Join(steps, ", ") + "."
+	return out
+}
+
+// ClearStress returns the Stress a combatant has marked after clearing up to
+// amount of it
+func ClearStress(c *db.Combatant, amount int) int {
+	if amount >= c.StressMarked {
+		return 0
+	}
+	if amount < 0 {
+		return c.StressMarked
+	}
+	return c.StressMarked - amount
+}
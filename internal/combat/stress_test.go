@@ -0,0 +1,44 @@
+package combat
+
+import (
+	"testing"
+
+	"github.com/juthrbog/adversarytracker/db"
+)
+
+func TestMarkStress(t *testing.T) {
+	tests := []struct {
+		name         string
+		stressMarked int
+		hpMarked     int
+		amount       int
+		marked       int
+		overflow     int
+		defeated     bool
+	}{
+		{name: "fits on the track", amount: 1, marked: 1},
+		{name: "fills the track", stressMarked: 1, amount: 1, marked: 1},
+		{name: "spills into HP", stressMarked: 1, amount: 3, marked: 1, overflow: 2},
+		{name: "full track marks HP", stressMarked: 2, amount: 1, overflow: 1},
+		{name: "overflow defeats", stressMarked: 2, hpMarked: 6, amount: 3, overflow: 1, defeated: true},
+		{name: "nothing to mark", amount: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &db.Combatant{Name: "Bear", HPMax: 7, HPMarked: tt.hpMarked, StressMax: 2, StressMarked: tt.stressMarked}
+
+			out := MarkStress(c, tt.amount)
+
+			if out.Marked != tt.marked || out.Overflow != tt.overflow || out.Defeated != tt.defeated {
+				t.Errorf("marked %d, overflow %d, defeated %v; want %d, %d, %v (%s)",
+					out.Marked, out.Overflow, out.Defeated, tt.marked, tt.overflow, tt.defeated, out.Explanation)
+			}
+			if out.StressMarked != tt.stressMarked+tt.marked || out.HPMarked != tt.hpMarked+tt.overflow {
+				t.Errorf("totals are %d Stress and %d HP", out.StressMarked, out.HPMarked)
+			}
+			if c.StressMarked != tt.stressMarked || c.HPMarked != tt.hpMarked {
+				t.Error("MarkStress changed the combatant")
+			}
+		})
+	}
+}
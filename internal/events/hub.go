@@ -0,0 +1,195 @@
+// Package events is an in-process publish/subscribe hub for live updates.
+// Each topic keeps its most recent events, so a subscriber that drops its
+// connection can resume from the last event it saw.
+package events
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// subscriberBuffer is how many events a subscriber can fall behind by
+// before it is dropped
+const subscriberBuffer = 32
+
+// Event is a single published change. IDs are set by the hub; they are
+// unique within a hub and increase within a topic.
+type Event struct {
+	ID     string
+	Type   string
+	Data   []byte
+	Source string // the client that caused the change, if known
+}
+
+// Hub fans events out to the subscribers of each topic. It is safe for
+// concurrent use.
+type Hub struct {
+	mu      sync.Mutex
+	epoch   string // tells this hub's event IDs from those of an earlier run
+	history int
+	topics  map[string]*topic
+	closed  bool
+}
+
+// topic is the recent events and the subscribers of one topic
+type topic struct {
+	seq    uint64
+	recent []Event
+	subs   map[chan Event]struct{}
+}
+
+// NewHub returns a hub that keeps the last history events of each topic for
+// replay
+func NewHub(history int) *Hub {
+	return &Hub{
+		epoch:   strconv.FormatInt(time.Now().UnixNano(), 36),
+		history: history,
+		topics:  make(map[string]*topic),
+	}
+}
+
+// topic returns a topic, creating it on first use. h.mu must be held.
+func (h *Hub) topic(key string) *topic {
+	t, ok := h.topics[key]
+	if !ok {
+		t = &topic{subs: make(map[chan Event]struct{})}
+		h.topics[key] = t
+	}
+	return t
+}
+
+// Publish gives an event its ID, sends it to every subscriber of a topic
+// and keeps it for replay. Subscribers too far behind to take it are
+// dropped; their channel is closed, and they can resubscribe from the last
+// event they received.
+func (h *Hub) Publish(key string, ev Event) Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	t := h.topic(key)
+	t.seq++
+	ev.ID = h.eventID(t.seq)
+
+	t.recent = append(t.recent, ev)
+	if len(t.recent) > h.history {
+		t.recent = t.recent[len(t.recent)-h.history:]
+	}
+
+	for ch := range t.subs {
+		select {
+		case ch <- ev:
+		default:
+			delete(t.subs, ch)
+			close(ch)
+		}
+	}
+
+	return ev
+}
+
+// Subscription is a subscriber's view of a topic
+type Subscription struct {
+	// Replay is the events published since the last one the subscriber
+	// saw, to be sent before the live ones
+	Replay []Event
+	// Complete is false when the missed events cannot all be replayed,
+	// because the last one seen is too old or from an earlier run, and the
+	// subscriber should reload its state instead
+	Complete bool
+	// LastID is the ID of the latest event of the topic when subscribing,
+	// to resume from after reloading
+	LastID string
+	// Events receives the live events. It is closed when the subscription
+	// is cancelled or dropped.
+	Events <-chan Event
+
+	cancel func()
+}
+
+// Cancel ends the subscription. It must be called once the subscriber is
+// done.
+func (s *Subscription) Cancel() {
+	s.cancel()
+}
+
+// Subscribe starts receiving the events of a topic. lastID is the ID of the
+// last event the subscriber saw, or "" for a new subscriber.
+func (h *Hub) Subscribe(key, lastID string) *Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	t := h.topic(key)
+	replay, complete := h.since(t, lastID)
+	c := make(chan Event, subscriberBuffer)
+	sub := &Subscription{
+		Replay:   replay,
+		Complete: complete,
+		LastID:   h.eventID(t.seq),
+		Events:   c,
+		cancel:   func() {},
+	}
+
+	if h.closed {
+		close(c)
+		return sub
+	}
+
+	t.subs[c] = struct{}{}
+	sub.cancel = func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := t.subs[c]; ok {
+			delete(t.subs, c)
+			close(c)
+		}
+	}
+	return sub
+}
+
+// eventID formats the ID of the event with a sequence number
+func (h *Hub) eventID(seq uint64) string {
+	return h.epoch + "-" + strconv.FormatUint(seq, 10)
+}
+
+// since returns the kept events of a topic published after lastID, and
+// whether they are all the events published since. h.mu must be held.
+func (h *Hub) since(t *topic, lastID string) ([]Event, bool) {
+	if lastID == "" {
+		return nil, true
+	}
+
+	epoch, seqStr, ok := strings.Cut(lastID, "-")
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if !ok || err != nil || epoch != h.epoch || seq > t.seq {
+		return nil, false
+	}
+
+	var replay []Event
+	for _, ev := range t.recent {
+		_, evSeq, _ := strings.Cut(ev.ID, "-")
+		if n, _ := strconv.ParseUint(evSeq, 10, 64); n > seq {
+			replay = append(replay, ev)
+		}
+	}
+
+	// Events between lastID and the oldest one kept are lost
+	missed := t.seq - seq
+	return replay, uint64(len(replay)) == missed
+}
+
+// Close ends every subscription, and any made afterwards, so that streams
+// can finish when the server shuts down
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for _, t := range h.topics {
+		for ch := range t.subs {
+			delete(t.subs, ch)
+			close(ch)
+		}
+	}
+}
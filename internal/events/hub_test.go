@@ -0,0 +1,146 @@
+package events
+
+import (
+	"testing"
+)
+
+// publishN publishes n events of type "tick" to a topic and returns them
+func publishN(h *Hub, key string, n int) []Event {
+	var published []Event
+	for i := 0; i < n; i++ {
+		published = append(published, h.Publish(key, Event{Type: "tick", Data: []byte{byte(i)}}))
+	}
+	return published
+}
+
+func TestHubDelivers(t *testing.T) {
+	h := NewHub(10)
+
+	sub := h.Subscribe("forest", "")
+	defer sub.Cancel()
+	if len(sub.Replay) != 0 || !sub.Complete {
+		t.Fatalf("new subscriber got %d events to replay, complete %v; want none, complete", len(sub.Replay), sub.Complete)
+	}
+	ch := sub.Events
+
+	published := publishN(h, "forest", 3)
+	h.Publish("cave", Event{Type: "other"})
+
+	for i, want := range published {
+		got := <-ch
+		if got.ID != want.ID || got.Data[0] != byte(i) {
+			t.Errorf("event %d is %s, want %s", i, got.ID, want.ID)
+		}
+	}
+	select {
+	case ev := <-ch:
+		t.Errorf("got event %s of another topic", ev.ID)
+	default:
+	}
+
+	sub.Cancel()
+	if _, open := <-ch; open {
+		t.Error("channel still open after cancel")
+	}
+	sub.Cancel() // a second cancel is harmless
+}
+
+func TestHubReplay(t *testing.T) {
+	h := NewHub(5)
+	published := publishN(h, "forest", 8)
+
+	tests := []struct {
+		name     string
+		lastID   string
+		replay   int
+		complete bool
+	}{
+		{"up to date", published[7].ID, 0, true},
+		{"kept events", published[4].ID, 3, true},
+		{"oldest kept", published[2].ID, 5, true},
+		{"lost events", published[1].ID, 5, false},
+		{"earlier run", "0-3", 0, false},
+		{"from the future", published[0].ID[:len(published[0].ID)-1] + "99", 0, false},
+		{"garbled", "nonsense", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := h.Subscribe("forest", tt.lastID)
+			defer sub.Cancel()
+
+			if len(sub.Replay) != tt.replay || sub.Complete != tt.complete {
+				t.Fatalf("got %d events to replay, complete %v; want %d, complete %v", len(sub.Replay), sub.Complete, tt.replay, tt.complete)
+			}
+			if sub.LastID != published[7].ID {
+				t.Errorf("last ID is %s, want %s", sub.LastID, published[7].ID)
+			}
+			for i, ev := range sub.Replay {
+				if want := published[8-tt.replay+i]; ev.ID != want.ID {
+					t.Errorf("replayed event %d is %s, want %s", i, ev.ID, want.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestHubReplayFromEmptyTopic(t *testing.T) {
+	h := NewHub(5)
+
+	// A subscriber that saw nothing yet resumes from the ID it was given
+	first := h.Subscribe("forest", "")
+	first.Cancel()
+	published := publishN(h, "forest", 2)
+
+	sub := h.Subscribe("forest", first.LastID)
+	defer sub.Cancel()
+	if len(sub.Replay) != 2 || !sub.Complete || sub.Replay[0].ID != published[0].ID {
+		t.Errorf("got %d events to replay, complete %v; want both published, complete", len(sub.Replay), sub.Complete)
+	}
+}
+
+func TestHubDropsSlowSubscribers(t *testing.T) {
+	h := NewHub(100)
+
+	slowSub := h.Subscribe("forest", "")
+	defer slowSub.Cancel()
+	fastSub := h.Subscribe("forest", "")
+	defer fastSub.Cancel()
+	slow, fast := slowSub.Events, fastSub.Events
+
+	for i := 0; i < subscriberBuffer+1; i++ {
+		h.Publish("forest", Event{Type: "tick"})
+		<-fast
+	}
+
+	received := 0
+	for range slow {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("slow subscriber got %d events before being dropped, want %d", received, subscriberBuffer)
+	}
+
+	// The fast subscriber is still subscribed
+	h.Publish("forest", Event{Type: "tick"})
+	if _, open := <-fast; !open {
+		t.Error("fast subscriber was dropped")
+	}
+}
+
+func TestHubClose(t *testing.T) {
+	h := NewHub(10)
+
+	before := h.Subscribe("forest", "")
+	defer before.Cancel()
+	h.Close()
+	if _, open := <-before.Events; open {
+		t.Error("subscription still open after Close")
+	}
+
+	after := h.Subscribe("forest", "")
+	defer after.Cancel()
+	if _, open := <-after.Events; open {
+		t.Error("subscription made after Close is open")
+	}
+}
@@ -0,0 +1,220 @@
+// Package generator rolls random encounters from the bestiary. An encounter
+// is built around one centerpiece adversary (a Solo, Leader or Bruiser) and
+// filled out with the other roles until its battle points are spent. The
+// same bestiary, options and seed always roll the same encounter, so a GM can
+// share a roll by its seed.
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/juthrbog/adversarytracker/db"
+	"github.com/juthrbog/adversarytracker/internal/budget"
+)
+
+// ErrNoAdversaries is returned when no adversary in the bestiary matches the
+// options
+var ErrNoAdversaries = errors.New("no adversaries match the party tier and filters")
+
+// Options describes the encounter to roll
+type Options struct {
+	PartySize int
+	PartyTier int
+	Type      string // only adversaries of this type, if set
+	Tag       string // only adversaries with this tag, if set
+	Target    int    // battle points to spend; the party's base budget if 0
+	Seed      int64
+}
+
+// centerpieceRoles are the roles an encounter can be built around. An
+// encounter gets at most one of them.
+var centerpieceRoles = []string{db.RoleSolo, db.RoleLeader, db.RoleBruiser}
+
+// fillRoles are the roles that fill out an encounter around its centerpiece
+var fillRoles = []string{
+	db.RoleHorde, db.RoleMinion, db.RoleRanged, db.RoleSkulk,
+	db.RoleSocial, db.RoleStandard, db.RoleSupport,
+}
+
+// roleLimits caps how many adversaries of a fill role an encounter gets, so
+// the mix stays balanced. Roles without a limit can repeat freely.
+var roleLimits = map[string]int{
+	db.RoleSupport: 1,
+	db.RoleSocial:  1,
+	db.RoleMinion:  2, // groups, not adversaries
+}
+
+// Generate rolls an encounter from adversaries. The encounter is not saved;
+// its adversaries are in the order they were picked.
+func Generate(adversaries []*db.Adversary, opts Options) (*db.Encounter, error) {
+	if opts.PartySize < 1 {
+		return nil, errors.New("party size must be at least 1")
+	}
+
+	target := opts.Target
+	if target <= 0 {
+		target = budget.Base(opts.PartySize)
+	}
+
+	// Group matching adversaries by role, sorted by ID so the roll depends
+	// only on the bestiary and not on the order it was loaded in
+	var candidates []*db.Adversary
+	for _, adv := range adversaries {
+		if matches(adv, opts) {
+			candidates = append(candidates, adv)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, ErrNoAdversaries
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].ID < candidates[j].ID })
+
+	byRole := make(map[string][]*db.Adversary)
+	for _, adv := range candidates {
+		byRole[adv.Role] = append(byRole[adv.Role], adv)
+	}
+
+	g := &roll{
+		rng:       rand.New(rand.NewSource(opts.Seed)),
+		partySize: opts.PartySize,
+		remaining: target,
+		byRole:    byRole,
+		counts:    make(map[int64]*db.EncounterAdversary),
+		picked:    make(map[string]int),
+	}
+
+	// The centerpiece, leaving room for at least one more adversary
+	if role := g.pickRole(centerpieceRoles, 2); role != "" {
+		g.add(g.pickAdversary(role))
+
+		// A Leader commands a group of Minions
+		if role == db.RoleLeader && g.affordable(db.RoleMinion, 0) {
+			g.add(g.pickAdversary(db.RoleMinion))
+		}
+	}
+
+	// Fill out the rest of the budget
+	for {
+		role := g.pickRole(fillRoles, 0)
+		if role == "" {
+			break
+		}
+		g.add(g.pickAdversary(role))
+	}
+
+	if len(g.order) == 0 {
+		return nil, fmt.Errorf("no matching adversary fits in %d battle points", target)
+	}
+
+	enc := &db.Encounter{
+		Name:        fmt.Sprintf("Tier %d encounter #%d", opts.PartyTier, opts.Seed),
+		Description: description(opts, target-g.remaining),
+		PartySize:   opts.PartySize,
+		PartyTier:   opts.PartyTier,
+		Challenge:   db.ChallengeStandard,
+		Adversaries: g.order,
+	}
+	return enc, nil
+}
+
+// matches reports whether an adversary passes the options' filters
+func matches(adv *db.Adversary, opts Options) bool {
+	if adv.Tier != opts.PartyTier {
+		return false
+	}
+	if opts.Type != "" && !strings.EqualFold(adv.Type, opts.Type) {
+		return false
+	}
+	if opts.Tag != "" && !adv.HasTag(opts.Tag) {
+		return false
+	}
+	return true
+}
+
+// description summarizes how an encounter was rolled
+func description(opts Options, spent int) string {
+	desc := fmt.Sprintf("Generated for %d PCs at tier %d with %d battle points", opts.PartySize, opts.PartyTier, spent)
+	if opts.Type != "" {
+		desc += ", type " + opts.Type
+	}
+	if opts.Tag != "" {
+		desc += ", tag " + opts.Tag
+	}
+	return desc + fmt.Sprintf(", seed %d.", opts.Seed)
+}
+
+// roll is the state of an encounter being rolled
+type roll struct {
+	rng       *rand.Rand
+	partySize int
+	remaining int
+	byRole    map[string][]*db.Adversary
+	counts    map[int64]*db.EncounterAdversary
+	order     []*db.EncounterAdversary
+	picked    map[string]int // adversaries, or Minion groups, picked per role
+}
+
+// unitCost is the cost of adding one more adversary of a role, or one more
+// group for Minions
+func (g *roll) unitCost(role string) int {
+	if role == db.RoleMinion {
+		return budget.Cost(role, g.partySize, g.partySize)
+	}
+	return budget.Cost(role, 1, g.partySize)
+}
+
+// affordable reports whether one more adversary of a role is available,
+// within its limit, and fits in the budget with spare points left over
+func (g *roll) affordable(role string, spare int) bool {
+	if len(g.byRole[role]) == 0 {
+		return false
+	}
+	if limit, ok := roleLimits[role]; ok && g.picked[role] >= limit {
+		return false
+	}
+	return g.unitCost(role)+spare <= g.remaining
+}
+
+// pickRole picks one of the affordable roles at random, or returns "" if
+// none is
+func (g *roll) pickRole(roles []string, spare int) string {
+	var options []string
+	for _, role := range roles {
+		if g.affordable(role, spare) {
+			options = append(options, role)
+		}
+	}
+	if len(options) == 0 {
+		return ""
+	}
+	return options[g.rng.Intn(len(options))]
+}
+
+// pickAdversary picks one of the candidates of a role at random
+func (g *roll) pickAdversary(role string) *db.Adversary {
+	candidates := g.byRole[role]
+	return candidates[g.rng.Intn(len(candidates))]
+}
+
+// add puts one more adversary, or a group of Minions, in the encounter
+func (g *roll) add(adv *db.Adversary) {
+	g.remaining -= g.unitCost(adv.Role)
+	g.picked[adv.Role]++
+
+	n := 1
+	if adv.Role == db.RoleMinion {
+		n = g.partySize
+	}
+
+	ea, ok := g.counts[adv.ID]
+	if !ok {
+		ea = &db.EncounterAdversary{AdversaryID: adv.ID, Adversary: adv}
+		g.counts[adv.ID] = ea
+		g.order = append(g.order, ea)
+	}
+	ea.Count += n
+}
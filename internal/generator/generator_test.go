@@ -0,0 +1,185 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/juthrbog/adversarytracker/db"
+	"github.com/juthrbog/adversarytracker/internal/budget"
+)
+
+// bestiary has a few adversaries of every role at tier 1, two of them at
+// tier 2, and tags to filter on
+func bestiary() []*db.Adversary {
+	roles := append(append([]string{}, centerpieceRoles...), fillRoles...)
+
+	var adversaries []*db.Adversary
+	id := int64(1)
+	for _, role := range roles {
+		for i, tags := range []string{"forest", "undead", "forest,beast"} {
+			adversaries = append(adversaries, &db.Adversary{
+				ID:   id,
+				Name: fmt.Sprintf("%s %d", role, i+1),
+				Type: []string{"Beast", "Undead", "Beast"}[i],
+				Tier: 1,
+				Role: role,
+				Tags: tags,
+			})
+			id++
+		}
+	}
+	adversaries = append(adversaries,
+		&db.Adversary{ID: id, Name: "Tier 2 Bruiser", Tier: 2, Role: db.RoleBruiser, Tags: "forest"},
+		&db.Adversary{ID: id + 1, Name: "Tier 2 Standard", Tier: 2, Role: db.RoleStandard, Tags: "forest"},
+	)
+	return adversaries
+}
+
+// rolled describes an encounter's adversaries, e.g. "3x2 10x1"
+func rolled(enc *db.Encounter) string {
+	var parts []string
+	for _, ea := range enc.Adversaries {
+		parts = append(parts, fmt.Sprintf("%dx%d", ea.AdversaryID, ea.Count))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestGenerateIsReproducible(t *testing.T) {
+	adversaries := bestiary()
+	opts := Options{PartySize: 4, PartyTier: 1, Seed: 42}
+
+	first, err := Generate(adversaries, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := Generate(adversaries, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rolled(again) != rolled(first) || again.Name != first.Name || again.Description != first.Description {
+		t.Errorf("same seed rolled %q then %q", rolled(first), rolled(again))
+	}
+
+	// The order the bestiary was loaded in does not matter
+	reversed := make([]*db.Adversary, len(adversaries))
+	for i, adv := range adversaries {
+		reversed[len(adversaries)-1-i] = adv
+	}
+	shuffled, err := Generate(reversed, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rolled(shuffled) != rolled(first) {
+		t.Errorf("reversed bestiary rolled %q, want %q", rolled(shuffled), rolled(first))
+	}
+
+	// Other seeds roll other encounters
+	seen := map[string]bool{rolled(first): true}
+	for seed := int64(1); seed <= 20; seed++ {
+		enc, err := Generate(adversaries, Options{PartySize: 4, PartyTier: 1, Seed: seed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[rolled(enc)] = true
+	}
+	if len(seen) < 2 {
+		t.Error("every seed rolled the same encounter")
+	}
+}
+
+func TestGenerateStaysWithinBudget(t *testing.T) {
+	adversaries := bestiary()
+
+	for partySize := 1; partySize <= 6; partySize++ {
+		for _, target := range []int{0, 3, 9, 25} {
+			for seed := int64(0); seed < 25; seed++ {
+				opts := Options{PartySize: partySize, PartyTier: 1, Target: target, Seed: seed}
+				enc, err := Generate(adversaries, opts)
+				if err != nil {
+					t.Fatalf("%+v: %v", opts, err)
+				}
+
+				want := target
+				if want == 0 {
+					want = budget.Base(partySize)
+				}
+				b := budget.Calculate(enc)
+				if b.Spent > want || b.Spent == 0 {
+					t.Fatalf("%+v: spent %d of %d battle points on %q", opts, b.Spent, want, rolled(enc))
+				}
+
+				centerpieces := 0
+				for _, ea := range enc.Adversaries {
+					for _, role := range centerpieceRoles {
+						if ea.Adversary.Role == role {
+							centerpieces += ea.Count
+						}
+					}
+				}
+				if centerpieces > 1 {
+					t.Fatalf("%+v: %d centerpieces in %q", opts, centerpieces, rolled(enc))
+				}
+			}
+		}
+	}
+}
+
+func TestGenerateFilters(t *testing.T) {
+	adversaries := bestiary()
+
+	tests := []struct {
+		name string
+		opts Options
+		want func(adv *db.Adversary) bool
+	}{
+		{"tier", Options{PartyTier: 2}, func(adv *db.Adversary) bool { return adv.Tier == 2 }},
+		{"tag", Options{PartyTier: 1, Tag: "forest"}, func(adv *db.Adversary) bool { return adv.HasTag("forest") }},
+		{"tag in any case", Options{PartyTier: 1, Tag: " Beast "}, func(adv *db.Adversary) bool { return adv.HasTag("beast") }},
+		{"type", Options{PartyTier: 1, Type: "undead"}, func(adv *db.Adversary) bool { return adv.Type == "Undead" }},
+		{"tag and type", Options{PartyTier: 1, Tag: "forest", Type: "Beast"}, func(adv *db.Adversary) bool {
+			return adv.HasTag("forest") && adv.Type == "Beast"
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for seed := int64(0); seed < 25; seed++ {
+				opts := tt.opts
+				opts.PartySize, opts.Seed = 4, seed
+
+				enc, err := Generate(adversaries, opts)
+				if err != nil {
+					t.Fatalf("seed %d: %v", seed, err)
+				}
+				for _, ea := range enc.Adversaries {
+					if !tt.want(ea.Adversary) {
+						t.Fatalf("seed %d rolled %s, which does not match the filters", seed, ea.Adversary.Name)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	adversaries := bestiary()
+
+	if _, err := Generate(adversaries, Options{PartySize: 4, PartyTier: 1, Tag: "dragon"}); !errors.Is(err, ErrNoAdversaries) {
+		t.Errorf("unknown tag: got %v, want ErrNoAdversaries", err)
+	}
+	if _, err := Generate(adversaries, Options{PartySize: 4, PartyTier: 3}); !errors.Is(err, ErrNoAdversaries) {
+		t.Errorf("empty tier: got %v, want ErrNoAdversaries", err)
+	}
+	if _, err := Generate(adversaries, Options{PartySize: 0, PartyTier: 1}); err == nil {
+		t.Error("party of 0: no error")
+	}
+
+	// Only a Solo matches, and it costs more than the budget
+	solo := []*db.Adversary{{ID: 1, Name: "Dragon", Tier: 1, Role: db.RoleSolo}}
+	if _, err := Generate(solo, Options{PartySize: 1, PartyTier: 1, Target: 3}); err == nil {
+		t.Error("nothing affordable: no error")
+	}
+}
@@ -0,0 +1,89 @@
+// Package openapi builds OpenAPI 3 documents and validates request bodies
+// against their schemas
+package openapi
+
+// Version is the OpenAPI version documents are written in
+const Version = "3.0.3"
+
+// Document is an OpenAPI document
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Servers    []Server             `json:"servers,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Server is a base URL the paths are relative to
+type Server struct {
+	URL string `json:"url"`
+}
+
+// PathItem holds the operations on one path, keyed by lowercase HTTP method
+type PathItem map[string]*Operation
+
+// Operation is a single API operation
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+// Parameter is a path or query parameter
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody describes the body an operation accepts
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response describes one response of an operation
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType holds the schema of a request or response body
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components holds the named schemas referenced from the rest of the
+// document
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// JSONContent wraps a schema as application/json content
+func JSONContent(s *Schema) map[string]*MediaType {
+	return map[string]*MediaType{"application/json": {Schema: s}}
+}
+
+// Schema returns the request body schema of an operation, or nil if it
+// takes no JSON body
+func (op *Operation) Schema() *Schema {
+	if op.RequestBody == nil {
+		return nil
+	}
+	if mt := op.RequestBody.Content["application/json"]; mt != nil {
+		return mt.Schema
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package openapi
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema is the subset of the OpenAPI schema object used by the API
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+}
+
+// Object returns a closed object schema: properties other than the listed
+// ones are rejected
+func Object(properties map[string]*Schema, required ...string) *Schema {
+	closed := false
+	return &Schema{
+		Type:                 "object",
+		Properties:           properties,
+		Required:             required,
+		AdditionalProperties: &closed,
+	}
+}
+
+// String returns a string schema
+func String() *Schema {
+	return &Schema{Type: "string"}
+}
+
+// Integer returns an integer schema
+func Integer() *Schema {
+	return &Schema{Type: "integer"}
+}
+
+// Boolean returns a boolean schema
+func Boolean() *Schema {
+	return &Schema{Type: "boolean"}
+}
+
+// Array returns an array schema of items
+func Array(items *Schema) *Schema {
+	return &Schema{Type: "array", Items: items}
+}
+
+// Ref returns a schema referencing a named component schema
+func Ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// Min sets the minimum of a numeric schema
+func (s *Schema) Min(min float64) *Schema {
+	s.Minimum = &min
+	return s
+}
+
+// Max sets the maximum of a numeric schema
+func (s *Schema) Max(max float64) *Schema {
+	s.Maximum = &max
+	return s
+}
+
+// Length sets the length bounds of a string schema. A max of 0 leaves the
+// length unbounded.
+func (s *Schema) Length(min, max int) *Schema {
+	s.MinLength = &min
+	if max > 0 {
+		s.MaxLength = &max
+	}
+	return s
+}
+
+// OneOf restricts a string schema to the given values
+func (s *Schema) OneOf(values ...string) *Schema {
+	for _, v := range values {
+		s.Enum = append(s.Enum, v)
+	}
+	return s
+}
+
+// Describe sets the description of a schema
+func (s *Schema) Describe(description string) *Schema {
+	s.Description = description
+	return s
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// SchemaOf returns the schema of a Go value as encoding/json would encode
+// it. Named struct types are added to the components and referenced, so
+// the document stays in step with the types the API returns.
+func (c *Components) SchemaOf(v interface{}) *Schema {
+	return c.schemaOfType(reflect.TypeOf(v))
+}
+
+// Named adds the schema of a struct value to the components under the given
+// name, for types whose Go name is not fit for the document, and returns a
+// reference to it
+func (c *Components) Named(name string, v interface{}) *Schema {
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if c.Schemas == nil {
+		c.Schemas = make(map[string]*Schema)
+	}
+	c.Schemas[name] = c.structSchema(t)
+	return Ref(name)
+}
+
+func (c *Components) schemaOfType(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Ptr {
+		return c.schemaOfType(t.Elem())
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		// Unexported Go types still get a capitalized schema name
+		name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+		if c.Schemas == nil {
+			c.Schemas = make(map[string]*Schema)
+		}
+		if _, ok := c.Schemas[name]; !ok {
+			// Register before walking the fields, for recursive types
+			c.Schemas[name] = &Schema{}
+			*c.Schemas[name] = *c.structSchema(t)
+		}
+		return Ref(name)
+	case t.Kind() == reflect.Struct:
+		return c.structSchema(t)
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return String()
+	case reflect.Bool:
+		return Boolean()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Integer()
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return Array(c.schemaOfType(t.Elem()))
+	case reflect.Map:
+		return &Schema{Type: "object"}
+	}
+
+	return &Schema{}
+}
+
+// structSchema describes the JSON-encoded fields of a struct. Fields without
+// omitempty are always present, so they are listed as required.
+func (c *Components) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		// Embedded structs are flattened into the outer object
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded := c.structSchema(ft)
+				for k, v := range embedded.Properties {
+					s.Properties[k] = v
+				}
+				s.Required = append(s.Required, embedded.Required...)
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		// Pointers to plain values encode as null when unset
+		prop := c.schemaOfType(field.Type)
+		if field.Type.Kind() == reflect.Ptr && prop.Ref == "" {
+			prop.Nullable = true
+		}
+		s.Properties[name] = prop
+
+		if !strings.Contains(opts, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+
+	return s
+}
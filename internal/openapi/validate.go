@@ -0,0 +1,164 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Validate checks a decoded JSON value against the schema and returns what
+// is wrong with it, keyed by field path such as "adversaries[0].count". An
+// empty path is the value itself. Values should be decoded with UseNumber
+// so integers can be told apart from other numbers.
+func (c *Components) Validate(s *Schema, v interface{}) map[string]string {
+	errs := make(map[string]string)
+	c.validate(s, v, "", errs)
+	return errs
+}
+
+func (c *Components) validate(s *Schema, v interface{}, path string, errs map[string]string) {
+	if s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+		if ref, ok := c.Schemas[name]; ok {
+			c.validate(ref, v, path, errs)
+		}
+		return
+	}
+
+	if v == nil {
+		if !s.Nullable && s.Type != "" {
+			errs[path] = "must not be null"
+		}
+		return
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			errs[path] = "must be an object"
+			return
+		}
+		c.validateObject(s, obj, path, errs)
+
+	case "array":
+		arr, ok := v.([]interface{})
+		if !ok {
+			errs[path] = "must be an array"
+			return
+		}
+		if s.Items != nil {
+			for i, item := range arr {
+				c.validate(s.Items, item, path+"["+strconv.Itoa(i)+"]", errs)
+			}
+		}
+
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			errs[path] = "must be a string"
+			return
+		}
+		if s.MinLength != nil && len(strings.TrimSpace(str)) < *s.MinLength {
+			if *s.MinLength == 1 {
+				errs[path] = "is required"
+			} else {
+				errs[path] = fmt.Sprintf("must be at least %d characters", *s.MinLength)
+			}
+			return
+		}
+		if s.MaxLength != nil && len(str) > *s.MaxLength {
+			errs[path] = fmt.Sprintf("must be at most %d characters", *s.MaxLength)
+			return
+		}
+		if len(s.Enum) > 0 && !inEnum(s.Enum, str) {
+			errs[path] = "must be one of " + enumList(s.Enum)
+		}
+
+	case "integer", "number":
+		num, ok := v.(json.Number)
+		if !ok {
+			if s.Type == "integer" {
+				errs[path] = "must be an integer"
+			} else {
+				errs[path] = "must be a number"
+			}
+			return
+		}
+		f, err := num.Float64()
+		if err != nil {
+			errs[path] = "must be a number"
+			return
+		}
+		if s.Type == "integer" {
+			if _, err := num.Int64(); err != nil {
+				errs[path] = "must be an integer"
+				return
+			}
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			errs[path] = "must be at least " + formatNumber(*s.Minimum)
+		} else if s.Maximum != nil && f > *s.Maximum {
+			errs[path] = "must be at most " + formatNumber(*s.Maximum)
+		}
+
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			errs[path] = "must be true or false"
+		}
+	}
+}
+
+func (c *Components) validateObject(s *Schema, obj map[string]interface{}, path string, errs map[string]string) {
+	prefix := path
+	if prefix != "" {
+		prefix += "."
+	}
+
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			errs[prefix+name] = "is required"
+		}
+	}
+
+	// Check properties in a fixed order so nested errors are stable
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		prop, ok := s.Properties[name]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				errs[prefix+name] = "is not a known field"
+			}
+			continue
+		}
+		c.validate(prop, obj[name], prefix+name, errs)
+	}
+}
+
+func inEnum(enum []interface{}, v string) bool {
+	for _, e := range enum {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+func enumList(enum []interface{}) string {
+	values := make([]string, len(enum))
+	for i, e := range enum {
+		values[i] = fmt.Sprint(e)
+	}
+	return strings.Join(values, ", ")
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,211 @@
+// Package pack reads and writes homebrew adversary packs, the JSON or YAML
+// files used to move adversaries between installs. The format is documented
+// in docs/pack-format.md.
+package pack
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/juthrbog/adversarytracker/db"
+	"gopkg.in/yaml.v3"
+)
+
+// FormatVersion is the version of the pack format this release writes, and
+// the newest it reads
+const FormatVersion = 1
+
+// Encodings a pack can be written in
+const (
+	JSON = "json"
+	YAML = "yaml"
+)
+
+// Pack is a set of adversaries with metadata describing where they came from
+type Pack struct {
+	Format      int          `json:"format" yaml:"format"`
+	Name        string       `json:"name" yaml:"name"`
+	Author      string       `json:"author,omitempty" yaml:"author,omitempty"`
+	Version     string       `json:"version,omitempty" yaml:"version,omitempty"`
+	License     string       `json:"license,omitempty" yaml:"license,omitempty"`
+	Description string       `json:"description,omitempty" yaml:"description,omitempty"`
+	Adversaries []*Adversary `json:"adversaries" yaml:"adversaries"`
+}
+
+// Adversary is an adversary statblock as written in a pack. It carries no
+// database IDs, so a pack imports cleanly into any install.
+type Adversary struct {
+	Name            string     `json:"name" yaml:"name"`
+	Type            string     `json:"type,omitempty" yaml:"type,omitempty"`
+	Tier            int        `json:"tier" yaml:"tier"`
+	Role            string     `json:"role" yaml:"role"`
+	Difficulty      int        `json:"difficulty" yaml:"difficulty"`
+	MajorThreshold  int        `json:"major_threshold" yaml:"major_threshold"`
+	SevereThreshold int        `json:"severe_threshold" yaml:"severe_threshold"`
+	HitPoints       int        `json:"hit_points" yaml:"hit_points"`
+	Stress          int        `json:"stress" yaml:"stress"`
+	AttackModifier  int        `json:"attack_modifier" yaml:"attack_modifier"`
+	AttackName      string     `json:"attack_name,omitempty" yaml:"attack_name,omitempty"`
+	AttackRange     string     `json:"attack_range,omitempty" yaml:"attack_range,omitempty"`
+	AttackDamage    string     `json:"attack_damage,omitempty" yaml:"attack_damage,omitempty"`
+	DamageType      string     `json:"damage_type,omitempty" yaml:"damage_type,omitempty"`
+	Experiences     string     `json:"experiences,omitempty" yaml:"experiences,omitempty"`
+	MotivesTactics  string     `json:"motives_tactics,omitempty" yaml:"motives_tactics,omitempty"`
+	Description     string     `json:"description,omitempty" yaml:"description,omitempty"`
+	Tags            []string   `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Features        []*Feature `json:"features,omitempty" yaml:"features,omitempty"`
+}
+
+// Feature is a statblock feature as written in a pack
+type Feature struct {
+	Kind       string `json:"kind" yaml:"kind"`
+	Name       string `json:"name" yaml:"name"`
+	Text       string `json:"text,omitempty" yaml:"text,omitempty"`
+	FearCost   int    `json:"fear_cost,omitempty" yaml:"fear_cost,omitempty"`
+	StressCost int    `json:"stress_cost,omitempty" yaml:"stress_cost,omitempty"`
+	Countdown  int    `json:"countdown,omitempty" yaml:"countdown,omitempty"`
+}
+
+// New builds a pack from adversaries loaded with their features
+func New(name string, adversaries []*db.Adversary) *Pack {
+	p := &Pack{Format: FormatVersion, Name: name}
+
+	for _, adv := range adversaries {
+		a := &Adversary{
+			Name:            adv.Name,
+			Type:            adv.Type,
+			Tier:            adv.Tier,
+			Role:            adv.Role,
+			Difficulty:      adv.Difficulty,
+			MajorThreshold:  adv.MajorThreshold,
+			SevereThreshold: adv.SevereThreshold,
+			HitPoints:       adv.HitPoints,
+			Stress:          adv.Stress,
+			AttackModifier:  adv.AttackModifier,
+			AttackName:      adv.AttackName,
+			AttackRange:     adv.AttackRange,
+			AttackDamage:    adv.AttackDamage,
+			DamageType:      adv.DamageType,
+			Experiences:     adv.Experiences,
+			MotivesTactics:  adv.MotivesTactics,
+			Description:     adv.Description,
+			Tags:            adv.TagList(),
+		}
+		for _, f := range adv.Features {
+			a.Features = append(a.Features, &Feature{
+				Kind:       f.Kind,
+				Name:       f.Name,
+				Text:       f.Text,
+				FearCost:   f.FearCost,
+				StressCost: f.StressCost,
+				Countdown:  f.Countdown,
+			})
+		}
+		p.Adversaries = append(p.Adversaries, a)
+	}
+
+	return p
+}
+
+// DBAdversaries converts the pack's adversaries, with their features, to
+// database adversaries ready to be imported
+func (p *Pack) DBAdversaries() []*db.Adversary {
+	adversaries := make([]*db.Adversary, len(p.Adversaries))
+
+	for i, a := range p.Adversaries {
+		adv := &db.Adversary{
+			Name:            a.Name,
+			Type:            a.Type,
+			Tier:            a.Tier,
+			Role:            a.Role,
+			Difficulty:      a.Difficulty,
+			MajorThreshold:  a.MajorThreshold,
+			SevereThreshold: a.SevereThreshold,
+			HitPoints:       a.HitPoints,
+			Stress:          a.Stress,
+			AttackModifier:  a.AttackModifier,
+			AttackName:      a.AttackName,
+			AttackRange:     a.AttackRange,
+			AttackDamage:    a.AttackDamage,
+			DamageType:      a.DamageType,
+			Experiences:     a.Experiences,
+			MotivesTactics:  a.MotivesTactics,
+			Description:     a.Description,
+			Tags:            db.NormalizeTags(strings.Join(a.Tags, ",")),
+		}
+		for position, f := range a.Features {
+			adv.Features = append(adv.Features, &db.AdversaryFeature{
+				Position:   position,
+				Kind:       f.Kind,
+				Name:       f.Name,
+				Text:       f.Text,
+				FearCost:   f.FearCost,
+				StressCost: f.StressCost,
+				Countdown:  f.Countdown,
+			})
+		}
+		adversaries[i] = adv
+	}
+
+	return adversaries
+}
+
+// Parse reads a pack written as JSON or YAML. JSON is detected by a leading
+// brace; anything else is read as YAML.
+func Parse(data []byte) (*Pack, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, errors.New("pack is empty")
+	}
+
+	p := &Pack{}
+	if data[0] == '{' {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(p); err != nil {
+			return nil, fmt.Errorf("invalid JSON pack: %w", err)
+		}
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(p); err != nil {
+			return nil, fmt.Errorf("invalid YAML pack: %w", err)
+		}
+	}
+
+	if p.Format == 0 {
+		return nil, errors.New("pack has no format version")
+	}
+	if p.Format > FormatVersion {
+		return nil, fmt.Errorf("pack format %d is newer than this release supports (%d)", p.Format, FormatVersion)
+	}
+	if len(p.Adversaries) == 0 {
+		return nil, errors.New("pack has no adversaries")
+	}
+
+	return p, nil
+}
+
+// Encode writes a pack as JSON or YAML
+func Encode(p *Pack, encoding string) ([]byte, error) {
+	switch encoding {
+	case JSON:
+		return json.MarshalIndent(p, "", "  ")
+	case YAML:
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(p); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown pack encoding %q", encoding)
+	}
+}
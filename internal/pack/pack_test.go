@@ -0,0 +1,99 @@
+package pack
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/juthrbog/adversarytracker/db"
+)
+
+// testAdversaries returns adversaries as DBAdversaries builds them, with
+// every field a pack carries set
+func testAdversaries() []*db.Adversary {
+	return []*db.Adversary{
+		{
+			Name: "Goblin Sneak", Type: "Humanoid", Tier: 1, Role: db.RoleSkulk,
+			Difficulty: 12, MajorThreshold: 5, SevereThreshold: 9, HitPoints: 3, Stress: 2,
+			AttackModifier: 1, AttackName: "Shiv", AttackRange: "Melee", AttackDamage: "1d8+1", DamageType: "Physical",
+			Experiences: "Sneaky +2", MotivesTactics: "Ambush, flee", Description: "A goblin: small, quick\nand mean.",
+			Tags: "goblin,warband",
+			Features: []*db.AdversaryFeature{
+				{Position: 0, Kind: db.FeaturePassive, Name: "Slippery", Text: "Hard to pin down."},
+				{Position: 1, Kind: db.FeatureAction, Name: "Backstab", Text: "Deal extra damage.", FearCost: 1, StressCost: 1},
+				{Position: 2, Kind: db.FeatureReaction, Name: "Warband Horn", Countdown: 3},
+			},
+		},
+		{Name: "Goblin Minion", Tier: 1, Role: db.RoleMinion, HitPoints: 1, AttackModifier: -1},
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, encoding := range []string{JSON, YAML} {
+		t.Run(encoding, func(t *testing.T) {
+			p := New("Goblin Warband", testAdversaries())
+			p.Author = "Jane Doe"
+			p.License = "CC BY 4.0"
+
+			data, err := Encode(p, encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := Parse(data)
+			if err != nil {
+				t.Fatalf("parsing the encoded pack: %v\n%s", err, data)
+			}
+
+			if parsed.Format != FormatVersion || parsed.Name != "Goblin Warband" || parsed.Author != "Jane Doe" || parsed.License != "CC BY 4.0" {
+				t.Errorf("pack metadata is %+v", parsed)
+			}
+			if got := parsed.DBAdversaries(); !reflect.DeepEqual(got, testAdversaries()) {
+				t.Errorf("adversaries changed on the way through %s:\n%s", encoding, data)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string // empty if the pack is valid
+	}{
+		{"JSON", `  {"format": 1, "name": "Pack", "adversaries": [{"name": "Bear", "tier": 1, "role": "Bruiser"}]}`, ""},
+		{"YAML", "format: 1\nname: Pack\nadversaries:\n  - name: Bear\n    tier: 1\n", ""},
+		{"empty", " \n", "pack is empty"},
+		{"JSON syntax", `{"format": 1,`, "invalid JSON pack"},
+		{"YAML syntax", "format: [1\n", "invalid YAML pack"},
+		{"unknown JSON field", `{"format": 1, "adversaries": [{"name": "Bear", "armor_class": 14}]}`, "invalid JSON pack"},
+		{"unknown YAML field", "format: 1\nadversaries:\n  - name: Bear\n    armor_class: 14\n", "invalid YAML pack"},
+		{"no format", `{"name": "Pack", "adversaries": [{"name": "Bear"}]}`, "no format version"},
+		{"newer JSON format", `{"format": 2, "adversaries": [{"name": "Bear"}]}`, "pack format 2 is newer"},
+		{"newer YAML format", "format: 3\nadversaries:\n  - name: Bear\n", "pack format 3 is newer"},
+		{"no adversaries", "format: 1\nname: Pack\n", "no adversaries"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Parse([]byte(tt.data))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(p.Adversaries) != 1 || p.Adversaries[0].Name != "Bear" {
+					t.Errorf("parsed %+v", p)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEncodeUnknown(t *testing.T) {
+	if _, err := Encode(New("Pack", testAdversaries()), "toml"); err == nil {
+		t.Error("encoding as TOML did not fail")
+	}
+}
@@ -0,0 +1,98 @@
+// Package srd holds the read-only library of adversaries and environments
+// from the Daggerheart System Reference Document, embedded in the binary so
+// a new install can be seeded without any files on disk. The library is a
+// selection of tier 1 statblocks, not the whole SRD.
+package srd
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/juthrbog/adversarytracker/internal/pack"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed adversaries.yaml
+var adversariesYAML []byte
+
+//go:embed environments.yaml
+var environmentsYAML []byte
+
+// Environment is an SRD environment statblock. Environments are shown in the
+// library for reference and are not stored in the database.
+type Environment struct {
+	Name                 string          `yaml:"name"`
+	Tier                 int             `yaml:"tier"`
+	Type                 string          `yaml:"type"`       // Exploration, Social, Traversal or Event
+	Difficulty           string          `yaml:"difficulty"` // a number, or "Special"
+	Description          string          `yaml:"description"`
+	Impulses             string          `yaml:"impulses"`
+	PotentialAdversaries string          `yaml:"potential_adversaries"`
+	Features             []*pack.Feature `yaml:"features"`
+}
+
+var (
+	loadOnce     sync.Once
+	library      *pack.Pack
+	environments []*Environment
+	loadErr      error
+)
+
+// load parses the embedded library once. A parse error is a bug in the
+// embedded files, but it is returned rather than panicking so the server can
+// still run without the library.
+func load() {
+	library, loadErr = pack.Parse(adversariesYAML)
+	if loadErr != nil {
+		loadErr = fmt.Errorf("SRD adversaries: %w", loadErr)
+		return
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(environmentsYAML))
+	dec.KnownFields(true)
+	if err := dec.Decode(&environments); err != nil {
+		loadErr = fmt.Errorf("SRD environments: %w", err)
+	}
+}
+
+// Adversaries returns the library adversaries as a pack. The pack is shared,
+// so callers must not modify it.
+func Adversaries() (*pack.Pack, error) {
+	loadOnce.Do(load)
+	return library, loadErr
+}
+
+// Environments returns the library environments. The slice is shared, so
+// callers must not modify it.
+func Environments() ([]*Environment, error) {
+	loadOnce.Do(load)
+	return environments, loadErr
+}
+
+// FindAdversary returns the library adversary with the given slug, or nil if
+// there is none
+func FindAdversary(slug string) (*pack.Adversary, error) {
+	p, err := Adversaries()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, adv := range p.Adversaries {
+		if Slug(adv.Name) == slug {
+			return adv, nil
+		}
+	}
+	return nil, nil
+}
+
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Slug turns a library entry's name into its URL form, e.g. "Jagged Knife
+// Bandit" becomes "jagged-knife-bandit"
+func Slug(name string) string {
+	return strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
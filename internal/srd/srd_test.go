@@ -0,0 +1,80 @@
+package srd
+
+import "testing"
+
+// The library's size per tier, as the README gives it. Tiers 2 to 4 are not
+// bundled yet.
+var (
+	wantAdversaries  = map[int]int{1: 25}
+	wantEnvironments = map[int]int{1: 7}
+)
+
+func TestAdversaries(t *testing.T) {
+	p, err := Adversaries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tiers := map[int]int{}
+	slugs := map[string]bool{}
+	for _, adv := range p.Adversaries {
+		tiers[adv.Tier]++
+		if slugs[Slug(adv.Name)] {
+			t.Errorf("two adversaries are named %s", adv.Name)
+		}
+		slugs[Slug(adv.Name)] = true
+	}
+	for tier := 1; tier <= 4; tier++ {
+		if tiers[tier] != wantAdversaries[tier] {
+			t.Errorf("%d tier %d adversaries, want %d", tiers[tier], tier, wantAdversaries[tier])
+		}
+	}
+}
+
+func TestEnvironments(t *testing.T) {
+	environments, err := Environments()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tiers := map[int]int{}
+	for _, env := range environments {
+		tiers[env.Tier]++
+		if env.Name == "" || env.Type == "" || len(env.Features) == 0 {
+			t.Errorf("environment %+v is incomplete", env)
+		}
+	}
+	for tier := 1; tier <= 4; tier++ {
+		if tiers[tier] != wantEnvironments[tier] {
+			t.Errorf("%d tier %d environments, want %d", tiers[tier], tier, wantEnvironments[tier])
+		}
+	}
+}
+
+func TestFindAdversary(t *testing.T) {
+	adv, err := FindAdversary("jagged-knife-bandit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adv == nil || adv.Name != "Jagged Knife Bandit" {
+		t.Errorf("found %+v, want the Jagged Knife Bandit", adv)
+	}
+
+	if adv, err := FindAdversary("tarrasque"); err != nil || adv != nil {
+		t.Errorf("found %+v (%v) for a missing slug, want nothing", adv, err)
+	}
+}
+
+func TestSlug(t *testing.T) {
+	tests := map[string]string{
+		"Jagged Knife Bandit":  "jagged-knife-bandit",
+		"Minor Fire Elemental": "minor-fire-elemental",
+		"  Giant Mosquitoes!":  "giant-mosquitoes",
+		"Head Guard (Captain)": "head-guard-captain",
+	}
+	for name, want := range tests {
+		if got := Slug(name); got != want {
+			t.Errorf("Slug(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
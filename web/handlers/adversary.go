@@ -1,54 +1,109 @@
 package handlers
 
 import (
+	"errors"
 	"html/template"
 	"log/slog"
 	"net/http"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/juthrbog/adversarytracker/db"
-	"github.com/juthrbog/adversarytracker/internal/app"
 )
 
+// searchResultLimit caps the adversaries shown for a search
+const searchResultLimit = 50
+
 // AdversaryRoutes returns a router with all adversary routes
-func AdversaryRoutes() chi.Router {
+func (s *Server) AdversaryRoutes() chi.Router {
 	r := chi.NewRouter()
 
-	r.Get("/", ListAdversaries)
+	r.Get("/", s.ListAdversaries)
 	r.Get("/new", NewAdversaryForm)
-	r.Post("/", CreateAdversary)
-	
+	r.Post("/", s.CreateAdversary)
+
+	// Homebrew packs
+	r.Get("/export", s.ExportAdversaries)
+	r.Get("/import", ImportAdversariesForm)
+	r.Post("/import/preview", s.PreviewAdversaryImport)
+	r.Post("/import", s.ImportAdversaries)
+
 	r.Route("/{id}", func(r chi.Router) {
-		r.Get("/", ViewAdversary)
-		r.Get("/edit", EditAdversaryForm)
-		r.Post("/", UpdateAdversary)
-		r.Delete("/", DeleteAdversary)
+		r.Get("/", s.ViewAdversary)
+		r.Get("/edit", s.EditAdversaryForm)
+		r.Post("/", s.UpdateAdversary)
+		r.Delete("/", s.DeleteAdversary)
 		// HTMX specific route for deletion with POST
-		r.Post("/delete", DeleteAdversary)
+		r.Post("/delete", s.DeleteAdversary)
+		r.Post("/copy", s.CopyAdversary)
+
+		// Statblock feature management
+		r.Post("/features", s.CreateAdversaryFeature)
+		r.Post("/features/{featureId}/move", s.MoveAdversaryFeature)
+		r.Delete("/features/{featureId}", s.DeleteAdversaryFeature)
+		r.Post("/features/{featureId}/delete", s.DeleteAdversaryFeature) // For form submissions
 	})
 
 	return r
 }
 
-// ListAdversaries displays all adversaries
-func ListAdversaries(w http.ResponseWriter, r *http.Request) {
+// ListAdversaries displays a page of adversaries, filtered and sorted by the
+// query string, or those matching the q search. Requests from the live
+// search and filter form get just the list.
+func (s *Server) ListAdversaries(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
 
-	// Get all adversaries from the database
-	adversaries, err := db.GetAllAdversaries(ctx, app.DB)
-	if err != nil {
-		slog.Error("Failed to get adversaries", "error", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	opts, errs := parseListOptions(r.URL.Query(), db.AdversarySortFields, adversaryPageSize)
+	if len(errs) > 0 {
+		http.Error(w, errs.Error(), http.StatusBadRequest)
 		return
 	}
 
+	// Get a page of adversaries from the database, or those matching the
+	// search; search results are ranked, so they are filtered but not sorted
+	var adversaries []*db.Adversary
+	var next string
+	snippets := make(map[int64]template.HTML)
+	if query == "" {
+		var err error
+		adversaries, next, err = s.Adversaries.ListAdversaries(ctx, opts)
+		if errors.Is(err, db.ErrInvalidCursor) {
+			http.Error(w, "Invalid page cursor", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			slog.Error("Failed to get adversaries", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		results, err := s.Adversaries.SearchAdversaries(ctx, query, searchResultLimit)
+		if err != nil {
+			slog.Error("Failed to search adversaries", "error", err, "query", query)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		for _, result := range results {
+			if opts.Matches(result.Adversary) {
+				adversaries = append(adversaries, result.Adversary)
+				snippets[result.Adversary.ID] = highlightSnippet(result.Snippet)
+			}
+		}
+	}
+
+	// The live search box only swaps the list
+	files := []string{filepath.Join("templates", "adversaries", "list.html")}
+	name := "adversary-list"
+	if r.Header.Get("HX-Target") != "adversary-list" {
+		files = append([]string{filepath.Join("templates", "layout.html")}, files...)
+		name = "layout"
+	}
+
 	// Parse templates
-	tmpl, err := template.ParseFiles(
-		filepath.Join("templates", "layout.html"),
-		filepath.Join("templates", "adversaries", "list.html"),
-	)
+	tmpl, err := template.ParseFiles(files...)
 	if err != nil {
 		slog.Error("Failed to parse template", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -58,18 +113,37 @@ func ListAdversaries(w http.ResponseWriter, r *http.Request) {
 	// Render template
 	data := map[string]interface{}{
 		"Adversaries": adversaries,
+		"Query":       query,
+		"Snippets":    snippets,
+		"Options":     opts,
+		"Roles":       db.AdversaryRoles,
+		"SortFields":  db.AdversarySortFields,
+	}
+	if opts.After != "" {
+		data["FirstURL"] = pageURL("/adversaries", opts, adversaryPageSize, "")
+	}
+	if next != "" {
+		data["NextURL"] = pageURL("/adversaries", opts, adversaryPageSize, next)
 	}
 
-	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
+	if err := tmpl.ExecuteTemplate(w, name, data); err != nil {
 		slog.Error("Failed to execute template", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 	}
 }
 
+// highlightSnippet escapes a search snippet and marks its matched terms
+func highlightSnippet(snippet string) template.HTML {
+	escaped := template.HTMLEscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, db.HighlightStart, `<mark class="bg-dh-gold">`)
+	escaped = strings.ReplaceAll(escaped, db.HighlightEnd, `</mark>`)
+	return template.HTML(escaped)
+}
+
 // ViewAdversary displays a single adversary
-func ViewAdversary(w http.ResponseWriter, r *http.Request) {
+func (s *Server) ViewAdversary(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	
+
 	// Get adversary ID from URL
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
@@ -79,7 +153,7 @@ func ViewAdversary(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get adversary from database
-	adversary, err := db.GetAdversaryByID(ctx, app.DB, id)
+	adversary, err := s.Adversaries.GetAdversary(ctx, id)
 	if err != nil {
 		slog.Error("Failed to get adversary", "error", err, "id", id)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -95,6 +169,7 @@ func ViewAdversary(w http.ResponseWriter, r *http.Request) {
 	tmpl, err := template.ParseFiles(
 		filepath.Join("templates", "layout.html"),
 		filepath.Join("templates", "adversaries", "view.html"),
+		filepath.Join("templates", "adversaries", "features.html"),
 	)
 	if err != nil {
 		slog.Error("Failed to parse template", "error", err)
@@ -119,6 +194,7 @@ func NewAdversaryForm(w http.ResponseWriter, r *http.Request) {
 	tmpl, err := template.ParseFiles(
 		filepath.Join("templates", "layout.html"),
 		filepath.Join("templates", "adversaries", "form.html"),
+		filepath.Join("templates", "adversaries", "features.html"),
 	)
 	if err != nil {
 		slog.Error("Failed to parse template", "error", err)
@@ -139,9 +215,9 @@ func NewAdversaryForm(w http.ResponseWriter, r *http.Request) {
 }
 
 // CreateAdversary handles the form submission to create a new adversary
-func CreateAdversary(w http.ResponseWriter, r *http.Request) {
+func (s *Server) CreateAdversary(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	
+
 	// Parse form
 	if err := r.ParseForm(); err != nil {
 		http.Error(w, "Bad request", http.StatusBadRequest)
@@ -149,45 +225,14 @@ func CreateAdversary(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create adversary from form data
-	adv := &db.Adversary{
-		Name:            r.FormValue("name"),
-		Type:            r.FormValue("type"),
-		ChallengeRating: r.FormValue("challenge_rating"),
-		Size:            r.FormValue("size"),
-		Speed:           r.FormValue("speed"),
-		Abilities:       r.FormValue("abilities"),
-		Actions:         r.FormValue("actions"),
-		Reactions:       r.FormValue("reactions"),
-		Description:     r.FormValue("description"),
+	adv, err := parseAdversaryForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	// Parse numeric values
-	armorClass, _ := strconv.Atoi(r.FormValue("armor_class"))
-	adv.ArmorClass = armorClass
-
-	hitPoints, _ := strconv.Atoi(r.FormValue("hit_points"))
-	adv.HitPoints = hitPoints
-
-	strength, _ := strconv.Atoi(r.FormValue("strength"))
-	adv.Strength = strength
-
-	dexterity, _ := strconv.Atoi(r.FormValue("dexterity"))
-	adv.Dexterity = dexterity
-
-	constitution, _ := strconv.Atoi(r.FormValue("constitution"))
-	adv.Constitution = constitution
-
-	intelligence, _ := strconv.Atoi(r.FormValue("intelligence"))
-	adv.Intelligence = intelligence
-
-	wisdom, _ := strconv.Atoi(r.FormValue("wisdom"))
-	adv.Wisdom = wisdom
-
-	charisma, _ := strconv.Atoi(r.FormValue("charisma"))
-	adv.Charisma = charisma
-
 	// Save to database
-	id, err := db.CreateAdversary(ctx, app.DB, adv)
+	id, err := s.Adversaries.CreateAdversary(ctx, adv)
 	if err != nil {
 		slog.Error("Failed to create adversary", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -206,9 +251,9 @@ func CreateAdversary(w http.ResponseWriter, r *http.Request) {
 }
 
 // EditAdversaryForm displays the form to edit an existing adversary
-func EditAdversaryForm(w http.ResponseWriter, r *http.Request) {
+func (s *Server) EditAdversaryForm(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	
+
 	// Get adversary ID from URL
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
@@ -218,7 +263,7 @@ func EditAdversaryForm(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get adversary from database
-	adversary, err := db.GetAdversaryByID(ctx, app.DB, id)
+	adversary, err := s.Adversaries.GetAdversary(ctx, id)
 	if err != nil {
 		slog.Error("Failed to get adversary", "error", err, "id", id)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -230,10 +275,16 @@ func EditAdversaryForm(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if adversary.ReadOnly() {
+		http.Error(w, readOnlyAdversaryMessage, http.StatusForbidden)
+		return
+	}
+
 	// Parse templates
 	tmpl, err := template.ParseFiles(
 		filepath.Join("templates", "layout.html"),
 		filepath.Join("templates", "adversaries", "form.html"),
+		filepath.Join("templates", "adversaries", "features.html"),
 	)
 	if err != nil {
 		slog.Error("Failed to parse template", "error", err)
@@ -254,9 +305,9 @@ func EditAdversaryForm(w http.ResponseWriter, r *http.Request) {
 }
 
 // UpdateAdversary handles the form submission to update an existing adversary
-func UpdateAdversary(w http.ResponseWriter, r *http.Request) {
+func (s *Server) UpdateAdversary(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	
+
 	// Get adversary ID from URL
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
@@ -265,6 +316,10 @@ func UpdateAdversary(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.requireWritableAdversary(w, r, id) {
+		return
+	}
+
 	// Parse form
 	if err := r.ParseForm(); err != nil {
 		http.Error(w, "Bad request", http.StatusBadRequest)
@@ -272,46 +327,15 @@ func UpdateAdversary(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create adversary from form data
-	adv := &db.Adversary{
-		ID:              id,
-		Name:            r.FormValue("name"),
-		Type:            r.FormValue("type"),
-		ChallengeRating: r.FormValue("challenge_rating"),
-		Size:            r.FormValue("size"),
-		Speed:           r.FormValue("speed"),
-		Abilities:       r.FormValue("abilities"),
-		Actions:         r.FormValue("actions"),
-		Reactions:       r.FormValue("reactions"),
-		Description:     r.FormValue("description"),
+	adv, err := parseAdversaryForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-
-	// Parse numeric values
-	armorClass, _ := strconv.Atoi(r.FormValue("armor_class"))
-	adv.ArmorClass = armorClass
-
-	hitPoints, _ := strconv.Atoi(r.FormValue("hit_points"))
-	adv.HitPoints = hitPoints
-
-	strength, _ := strconv.Atoi(r.FormValue("strength"))
-	adv.Strength = strength
-
-	dexterity, _ := strconv.Atoi(r.FormValue("dexterity"))
-	adv.Dexterity = dexterity
-
-	constitution, _ := strconv.Atoi(r.FormValue("constitution"))
-	adv.Constitution = constitution
-
-	intelligence, _ := strconv.Atoi(r.FormValue("intelligence"))
-	adv.Intelligence = intelligence
-
-	wisdom, _ := strconv.Atoi(r.FormValue("wisdom"))
-	adv.Wisdom = wisdom
-
-	charisma, _ := strconv.Atoi(r.FormValue("charisma"))
-	adv.Charisma = charisma
+	adv.ID = id
 
 	// Update in database
-	err = db.UpdateAdversary(ctx, app.DB, adv)
+	err = s.Adversaries.UpdateAdversary(ctx, adv)
 	if err != nil {
 		slog.Error("Failed to update adversary", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -330,9 +354,9 @@ func UpdateAdversary(w http.ResponseWriter, r *http.Request) {
 }
 
 // DeleteAdversary handles the deletion of an adversary
-func DeleteAdversary(w http.ResponseWriter, r *http.Request) {
+func (s *Server) DeleteAdversary(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	
+
 	// Get adversary ID from URL
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
@@ -341,8 +365,12 @@ func DeleteAdversary(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.requireWritableAdversary(w, r, id) {
+		return
+	}
+
 	// Delete from database
-	err = db.DeleteAdversary(ctx, app.DB, id)
+	err = s.Adversaries.DeleteAdversary(ctx, id)
 	if err != nil {
 		slog.Error("Failed to delete adversary", "error", err, "id", id)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -359,3 +387,93 @@ func DeleteAdversary(w http.ResponseWriter, r *http.Request) {
 	// Regular form submission, redirect to the adversary list
 	http.Redirect(w, r, "/adversaries", http.StatusSeeOther)
 }
+
+// readOnlyAdversaryMessage is the response to changing an SRD adversary
+const readOnlyAdversaryMessage = "SRD adversaries are read-only; copy one to your bestiary to change it"
+
+// requireWritableAdversary checks that an adversary about to be changed
+// exists and is not read-only, writing a 404 or 403 response if it is not
+func (s *Server) requireWritableAdversary(w http.ResponseWriter, r *http.Request, id int64) bool {
+	adversary, err := s.Adversaries.GetAdversary(r.Context(), id)
+	if err != nil {
+		slog.Error("Failed to get adversary", "error", err, "id", id)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+
+	if adversary == nil {
+		http.Error(w, "Adversary not found", http.StatusNotFound)
+		return false
+	}
+
+	if adversary.ReadOnly() {
+		http.Error(w, readOnlyAdversaryMessage, http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// parseAdversaryForm builds an adversary from submitted statblock form values
+func parseAdversaryForm(r *http.Request) (*db.Adversary, error) {
+	adv := &db.Adversary{
+		Name:           r.FormValue("name"),
+		Type:           r.FormValue("type"),
+		Role:           r.FormValue("role"),
+		AttackName:     r.FormValue("attack_name"),
+		AttackRange:    r.FormValue("attack_range"),
+		AttackDamage:   r.FormValue("attack_damage"),
+		DamageType:     r.FormValue("damage_type"),
+		Experiences:    r.FormValue("experiences"),
+		MotivesTactics: r.FormValue("motives_tactics"),
+		Description:    r.FormValue("description"),
+		Tags:           db.NormalizeTags(r.FormValue("tags")),
+	}
+
+	// Parse numeric values
+	adv.Tier, _ = strconv.Atoi(r.FormValue("tier"))
+	adv.Difficulty, _ = strconv.Atoi(r.FormValue("difficulty"))
+	adv.MajorThreshold, _ = strconv.Atoi(r.FormValue("major_threshold"))
+	adv.SevereThreshold, _ = strconv.Atoi(r.FormValue("severe_threshold"))
+	adv.HitPoints, _ = strconv.Atoi(r.FormValue("hit_points"))
+	adv.Stress, _ = strconv.Atoi(r.FormValue("stress"))
+	adv.AttackModifier, _ = strconv.Atoi(r.FormValue("attack_modifier"))
+
+	if errs := validateAdversary(adv); len(errs) > 0 {
+		return nil, errs
+	}
+
+	return adv, nil
+}
+
+// validateAdversary checks an adversary submitted through the HTML forms or
+// the API
+func validateAdversary(adv *db.Adversary) validationErrors {
+	errs := validationErrors{}
+
+	if strings.TrimSpace(adv.Name) == "" {
+		errs["name"] = "is required"
+	}
+	if adv.Tier < 1 || adv.Tier > 4 {
+		errs["tier"] = "must be between 1 and 4"
+	}
+	if !db.IsValidRole(adv.Role) {
+		errs["role"] = "must be a valid adversary role"
+	}
+	if adv.Difficulty < 0 {
+		errs["difficulty"] = "cannot be negative"
+	}
+	if adv.MajorThreshold < 0 || adv.SevereThreshold < 0 {
+		errs["thresholds"] = "cannot be negative"
+	} else if adv.SevereThreshold > 0 && adv.SevereThreshold < adv.MajorThreshold {
+		errs["severe_threshold"] = "must not be below the major threshold"
+	}
+	if adv.HitPoints < 1 {
+		errs["hit_points"] = "must be at least 1"
+	}
+	if adv.Stress < 0 {
+		errs["stress"] = "cannot be negative"
+	}
+
+	return errs
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"bytes"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/juthrbog/adversarytracker/db"
+)
+
+// CreateAdversaryFeature handles adding a Passive, Action or Reaction to an adversary
+func (s *Server) CreateAdversaryFeature(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Get adversary ID from URL
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid adversary ID", http.StatusBadRequest)
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	feature := &db.AdversaryFeature{
+		AdversaryID: id,
+		Kind:        r.FormValue("kind"),
+		Name:        r.FormValue("name"),
+		Text:        r.FormValue("text"),
+	}
+
+	if feature.Name == "" {
+		http.Error(w, "Feature name is required", http.StatusBadRequest)
+		return
+	}
+	if !db.IsValidFeatureKind(feature.Kind) {
+		http.Error(w, "Invalid feature kind", http.StatusBadRequest)
+		return
+	}
+
+	// Make sure the adversary exists and can be changed
+	if !s.requireWritableAdversary(w, r, id) {
+		return
+	}
+
+	// Costs and countdowns left blank are zero; anything else must be a
+	// whole number, or the form is shown again with what was wrong
+	errs := validationErrors{}
+	feature.FearCost = parseFeatureNumber(r, "fear_cost", errs)
+	feature.StressCost = parseFeatureNumber(r, "stress_cost", errs)
+	feature.Countdown = parseFeatureNumber(r, "countdown", errs)
+	if len(errs) > 0 {
+		s.renderFeatureEditor(w, r, id, http.StatusUnprocessableEntity, map[string]interface{}{
+			"Errors": errs,
+			"Form":   r.PostForm,
+		})
+		return
+	}
+
+	// Save to database
+	if _, err := s.Adversaries.CreateAdversaryFeature(ctx, feature); err != nil {
+		slog.Error("Failed to create adversary feature", "error", err, "adversary_id", id)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.renderAdversaryFeatures(w, r, id)
+}
+
+// MoveAdversaryFeature moves a feature one place up or down the statblock
+func (s *Server) MoveAdversaryFeature(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, featureID, ok := parseFeatureParams(w, r)
+	if !ok {
+		return
+	}
+
+	if !s.requireWritableAdversary(w, r, id) {
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	offset := 0
+	switch r.FormValue("direction") {
+	case "up":
+		offset = -1
+	case "down":
+		offset = 1
+	default:
+		http.Error(w, "Direction must be up or down", http.StatusBadRequest)
+		return
+	}
+
+	// Get the current feature order
+	features, err := s.Adversaries.GetAdversaryFeatures(ctx, id)
+	if err != nil {
+		slog.Error("Failed to get adversary features", "error", err, "adversary_id", id)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	ids := make([]int64, len(features))
+	index := -1
+	for i, f := range features {
+		ids[i] = f.ID
+		if f.ID == featureID {
+			index = i
+		}
+	}
+
+	if index == -1 {
+		http.Error(w, "Feature not found", http.StatusNotFound)
+		return
+	}
+
+	// Swap with the neighbour; moving past either end is a no-op
+	target := index + offset
+	if target >= 0 && target < len(ids) {
+		ids[index], ids[target] = ids[target], ids[index]
+
+		if err := s.Adversaries.ReorderAdversaryFeatures(ctx, id, ids); err != nil {
+			slog.Error("Failed to reorder adversary features", "error", err, "adversary_id", id)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	s.renderAdversaryFeatures(w, r, id)
+}
+
+// DeleteAdversaryFeature handles removing a feature from an adversary
+func (s *Server) DeleteAdversaryFeature(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, featureID, ok := parseFeatureParams(w, r)
+	if !ok {
+		return
+	}
+
+	if !s.requireWritableAdversary(w, r, id) {
+		return
+	}
+
+	// Make sure the feature belongs to the adversary in the URL
+	feature, err := s.Adversaries.GetAdversaryFeature(ctx, featureID)
+	if err != nil {
+		slog.Error("Failed to get adversary feature", "error", err, "id", featureID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if feature == nil || feature.AdversaryID != id {
+		http.Error(w, "Feature not found", http.StatusNotFound)
+		return
+	}
+
+	// Delete from database
+	if err := s.Adversaries.DeleteAdversaryFeature(ctx, featureID); err != nil {
+		slog.Error("Failed to delete adversary feature", "error", err, "id", featureID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.renderAdversaryFeatures(w, r, id)
+}
+
+// parseFeatureParams extracts the adversary and feature IDs from the URL,
+// writing a 400 response if either is invalid
+func parseFeatureParams(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid adversary ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	featureID, err := strconv.ParseInt(chi.URLParam(r, "featureId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid feature ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	return id, featureID, true
+}
+
+// parseFeatureNumber reads a feature's Fear cost, Stress cost or countdown
+// from the form, adding to errs if it is not a whole number of at least zero
+func parseFeatureNumber(r *http.Request, field string, errs validationErrors) int {
+	value := strings.TrimSpace(r.FormValue(field))
+	if value == "" {
+		return 0
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		errs[field] = "must be a whole number"
+		return 0
+	}
+	if n < 0 {
+		errs[field] = "cannot be negative"
+		return 0
+	}
+	return n
+}
+
+// renderAdversaryFeatures responds to a feature change. HTMX requests get the
+// refreshed feature editor partial; regular form submissions are redirected
+// back to the edit page.
+func (s *Server) renderAdversaryFeatures(w http.ResponseWriter, r *http.Request, adversaryID int64) {
+	idStr := strconv.FormatInt(adversaryID, 10)
+
+	if r.Header.Get("HX-Request") != "true" {
+		http.Redirect(w, r, "/adversaries/"+idStr+"/edit", http.StatusSeeOther)
+		return
+	}
+
+	s.renderFeatureEditor(w, r, adversaryID, http.StatusOK, map[string]interface{}{})
+}
+
+// renderFeatureEditor writes the feature editor partial of an adversary with
+// the given status. data can hold the Errors of a rejected submission and the
+// Form values to fill the add form with again.
+func (s *Server) renderFeatureEditor(w http.ResponseWriter, r *http.Request, adversaryID int64, status int, data map[string]interface{}) {
+	adversary, err := s.Adversaries.GetAdversary(r.Context(), adversaryID)
+	if err != nil {
+		slog.Error("Failed to get adversary", "error", err, "id", adversaryID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if adversary == nil {
+		http.Error(w, "Adversary not found", http.StatusNotFound)
+		return
+	}
+
+	// Parse template
+	tmpl, err := template.ParseFiles(
+		filepath.Join("templates", "adversaries", "features.html"),
+	)
+	if err != nil {
+		slog.Error("Failed to parse template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Render template
+	data["Adversary"] = adversary
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, "feature-editor", data); err != nil {
+		slog.Error("Failed to execute template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/juthrbog/adversarytracker/db"
+	"github.com/juthrbog/adversarytracker/internal/pack"
+)
+
+// maxPackSize is the largest pack file that can be imported
+const maxPackSize = 5 << 20
+
+// ExportAdversaries downloads adversaries as a pack. Repeated id query
+// parameters select the adversaries to export; without any, the whole
+// bestiary is exported. The format parameter picks JSON or YAML, and name,
+// author, version and license fill in the pack metadata.
+func (s *Server) ExportAdversaries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	encoding := query.Get("format")
+	if encoding == "" {
+		encoding = pack.YAML
+	}
+	if encoding != pack.YAML && encoding != pack.JSON {
+		http.Error(w, "Format must be json or yaml", http.StatusBadRequest)
+		return
+	}
+
+	var adversaries []*db.Adversary
+	if ids := query["id"]; len(ids) > 0 {
+		for _, idStr := range ids {
+			id, err := strconv.ParseInt(idStr, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid adversary ID", http.StatusBadRequest)
+				return
+			}
+
+			adversary, err := s.Adversaries.GetAdversary(ctx, id)
+			if err != nil {
+				slog.Error("Failed to get adversary", "error", err, "id", id)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			if adversary == nil {
+				http.Error(w, "Adversary not found", http.StatusNotFound)
+				return
+			}
+			adversaries = append(adversaries, adversary)
+		}
+	} else {
+		all, _, err := s.Adversaries.ListAdversaries(ctx, db.ListOptions{})
+		if err != nil {
+			slog.Error("Failed to get adversaries", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		for _, adversary := range all {
+			adversary.Features, err = s.Adversaries.GetAdversaryFeatures(ctx, adversary.ID)
+			if err != nil {
+				slog.Error("Failed to get adversary features", "error", err, "adversary_id", adversary.ID)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+		adversaries = all
+	}
+
+	// Name a single-adversary pack after the adversary
+	name := query.Get("name")
+	if name == "" {
+		name = "Adversaries"
+		if len(adversaries) == 1 {
+			name = adversaries[0].Name
+		}
+	}
+
+	p := pack.New(name, adversaries)
+	p.Author = query.Get("author")
+	p.Version = query.Get("version")
+	p.License = query.Get("license")
+
+	body, err := pack.Encode(p, encoding)
+	if err != nil {
+		slog.Error("Failed to encode pack", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	contentType := "application/yaml"
+	if encoding == pack.JSON {
+		contentType = "application/json"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, packFileName(name), encoding))
+	w.Write(body)
+}
+
+// ImportAdversariesForm displays the pack import page
+func ImportAdversariesForm(w http.ResponseWriter, r *http.Request) {
+	renderImportPage(w, r, map[string]interface{}{
+		"Conflict": db.ConflictSkip,
+	})
+}
+
+// PreviewAdversaryImport parses an uploaded or pasted pack and shows what
+// importing it would do, without changing anything
+func (s *Server) PreviewAdversaryImport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	data, conflict, err := readPackUpload(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	preview := map[string]interface{}{
+		"PackText": string(data),
+		"Conflict": conflict,
+	}
+
+	p, err := pack.Parse(data)
+	if err != nil {
+		preview["Errors"] = []string{err.Error()}
+		renderImportPreview(w, r, preview)
+		return
+	}
+	preview["Pack"] = p
+
+	if errs := validatePack(p); len(errs) > 0 {
+		preview["Errors"] = errs
+		renderImportPreview(w, r, preview)
+		return
+	}
+
+	items, err := s.Adversaries.PlanImport(ctx, p.DBAdversaries(), conflict)
+	if err != nil {
+		slog.Error("Failed to plan import", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	preview["Items"] = items
+
+	renderImportPreview(w, r, preview)
+}
+
+// ImportAdversaries imports a pack into the bestiary in one transaction
+func (s *Server) ImportAdversaries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	data, conflict, err := readPackUpload(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p, err := pack.Parse(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if errs := validatePack(p); len(errs) > 0 {
+		http.Error(w, strings.Join(errs, "\n"), http.StatusBadRequest)
+		return
+	}
+
+	items, err := s.Adversaries.ImportAdversaries(ctx, p.DBAdversaries(), conflict)
+	if err != nil {
+		slog.Error("Failed to import adversaries", "error", err, "pack", p.Name)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	imported := 0
+	for _, item := range items {
+		if item.Action != db.ImportSkip {
+			imported++
+		}
+	}
+	slog.Info("Imported adversary pack", "pack", p.Name, "imported", imported, "skipped", len(items)-imported)
+
+	// Check if this is an HTMX request
+	if r.Header.Get("HX-Request") == "true" {
+		// For HTMX, redirect via response headers
+		w.Header().Set("HX-Redirect", "/adversaries")
+		return
+	}
+
+	// Regular form submission, redirect to the adversary list
+	http.Redirect(w, r, "/adversaries", http.StatusSeeOther)
+}
+
+// readPackUpload reads the pack from an uploaded file, or from the pasted
+// pack text when no file was chosen, along with the conflict policy
+func readPackUpload(r *http.Request) ([]byte, string, error) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(maxPackSize); err != nil {
+			return nil, "", fmt.Errorf("could not read upload: %w", err)
+		}
+	} else if err := r.ParseForm(); err != nil {
+		return nil, "", fmt.Errorf("bad request: %w", err)
+	}
+
+	conflict := formValueOr(r, "conflict", db.ConflictSkip)
+	if !db.IsValidConflictPolicy(conflict) {
+		return nil, "", fmt.Errorf("invalid conflict policy %q", conflict)
+	}
+
+	file, _, err := r.FormFile("file")
+	if err == nil {
+		defer file.Close()
+
+		data, err := io.ReadAll(io.LimitReader(file, maxPackSize+1))
+		if err != nil {
+			return nil, "", fmt.Errorf("could not read upload: %w", err)
+		}
+		if len(data) > maxPackSize {
+			return nil, "", fmt.Errorf("pack is larger than %d MB", maxPackSize>>20)
+		}
+		return data, conflict, nil
+	}
+
+	return []byte(r.FormValue("pack")), conflict, nil
+}
+
+// validatePack checks every adversary and feature in a pack, returning one
+// message per problem
+func validatePack(p *pack.Pack) []string {
+	var errs []string
+
+	for i, adv := range p.DBAdversaries() {
+		label := fmt.Sprintf("Adversary %d", i+1)
+		if adv.Name != "" {
+			label += " (" + adv.Name + ")"
+		}
+
+		if verrs := validateAdversary(adv); len(verrs) > 0 {
+			errs = append(errs, label+": "+verrs.Error())
+		}
+
+		for j, f := range adv.Features {
+			if strings.TrimSpace(f.Name) == "" {
+				errs = append(errs, fmt.Sprintf("%s: feature %d has no name", label, j+1))
+			}
+			if !db.IsValidFeatureKind(f.Kind) {
+				errs = append(errs, fmt.Sprintf("%s: feature %d has invalid kind %q", label, j+1, f.Kind))
+			}
+			if f.FearCost < 0 || f.StressCost < 0 || f.Countdown < 0 {
+				errs = append(errs, fmt.Sprintf("%s: feature %d has a negative Fear cost, Stress cost or countdown", label, j+1))
+			}
+		}
+	}
+
+	return errs
+}
+
+// renderImportPreview renders the import preview, as a partial for HTMX
+// requests or as the full import page otherwise
+func renderImportPreview(w http.ResponseWriter, r *http.Request, data map[string]interface{}) {
+	if r.Header.Get("HX-Request") != "true" {
+		renderImportPage(w, r, data)
+		return
+	}
+
+	tmpl, err := template.ParseFiles(filepath.Join("templates", "adversaries", "import.html"))
+	if err != nil {
+		slog.Error("Failed to parse template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	data["ConflictPolicies"] = db.ConflictPolicies
+	if err := tmpl.ExecuteTemplate(w, "import-preview", data); err != nil {
+		slog.Error("Failed to execute template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// renderImportPage renders the full import page
+func renderImportPage(w http.ResponseWriter, r *http.Request, data map[string]interface{}) {
+	tmpl, err := template.ParseFiles(
+		filepath.Join("templates", "layout.html"),
+		filepath.Join("templates", "adversaries", "import.html"),
+	)
+	if err != nil {
+		slog.Error("Failed to parse template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	data["ConflictPolicies"] = db.ConflictPolicies
+	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
+		slog.Error("Failed to execute template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+var nonFileNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// packFileName turns a pack name into a download file name, e.g.
+// "Goblin Warband" becomes "goblin-warband"
+func packFileName(name string) string {
+	slug := strings.Trim(nonFileNameChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if slug == "" {
+		slug = "adversaries"
+	}
+	return slug
+}
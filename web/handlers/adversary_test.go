@@ -0,0 +1,432 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/juthrbog/adversarytracker/db"
+)
+
+// testPack is a pack of one new adversary and one named like the bear
+const testPack = `format: 1
+name: Woodland
+adversaries:
+  - name: Dire Wolf
+    tier: 1
+    role: Skulk
+    hit_points: 4
+    features:
+      - kind: Action
+        name: Pack Tactics
+  - name: Bear
+    tier: 2
+    role: Bruiser
+    hit_points: 9
+`
+
+func adversaryRoutes(s *Server) http.Handler {
+	return s.AdversaryRoutes()
+}
+
+func TestListAdversaries(t *testing.T) {
+	runRouteTests(t, adversaryRoutes, []routeTest{
+		{
+			name: "page", method: "GET", target: "/",
+			status: http.StatusOK, contains: []string{pageMarker, "Bear", "Archer Guard"},
+		},
+		{
+			name: "filtered", method: "GET", target: "/?role=Bruiser",
+			status: http.StatusOK, contains: []string{"Bear"}, excludes: []string{"Archer Guard"},
+		},
+		{
+			name: "live search", method: "GET", target: "/?q=bear", htmx: true, hxTarget: "adversary-list",
+			status: http.StatusOK, contains: []string{`id="adversary-list"`, "Bear"}, excludes: []string{pageMarker, "Archer Guard"},
+		},
+		{
+			name: "search page", method: "GET", target: "/?q=volley",
+			status: http.StatusOK, contains: []string{pageMarker, "Archer Guard"},
+		},
+		{
+			name: "next page", method: "GET", target: "/?limit=1",
+			status: http.StatusOK, contains: []string{"Archer Guard", "after="}, excludes: []string{"Bear"},
+		},
+		{
+			name: "invalid filter", method: "GET", target: "/?tier=9",
+			status: http.StatusBadRequest,
+		},
+		{
+			name: "invalid cursor", method: "GET", target: "/?after=nonsense",
+			status: http.StatusBadRequest,
+		},
+		{
+			name: "store down", method: "GET", target: "/", setup: withBrokenStores,
+			status: http.StatusInternalServerError,
+		},
+		{
+			name: "search store down", method: "GET", target: "/?q=bear", setup: withBrokenStores,
+			status: http.StatusInternalServerError,
+		},
+	})
+}
+
+func TestViewAdversary(t *testing.T) {
+	runRouteTests(t, adversaryRoutes, []routeTest{
+		{
+			name: "adversary", method: "GET", target: "/1",
+			status: http.StatusOK, contains: []string{pageMarker, "Bear", "Claws", "Roar"},
+		},
+		{name: "invalid ID", method: "GET", target: "/bear", status: http.StatusBadRequest},
+		{name: "not found", method: "GET", target: "/99", status: http.StatusNotFound},
+		{name: "store down", method: "GET", target: "/1", setup: withBrokenStores, status: http.StatusInternalServerError},
+	})
+}
+
+func TestNewAdversaryForm(t *testing.T) {
+	runRouteTests(t, adversaryRoutes, []routeTest{
+		{name: "form", method: "GET", target: "/new", status: http.StatusOK, contains: []string{pageMarker, "<form"}},
+	})
+}
+
+func TestCreateAdversary(t *testing.T) {
+	created := func(t *testing.T, store *db.MemoryStore) {
+		adv := getAdversary(t, store, nextAdvID)
+		if adv == nil {
+			t.Fatal("adversary was not created")
+		}
+		if adv.Name != "Cave Bat" || adv.Tier != 2 || adv.Source != db.SourceHomebrew || adv.Tags != "cave,forest" {
+			t.Errorf("created %+v", adv)
+		}
+	}
+
+	runRouteTests(t, adversaryRoutes, []routeTest{
+		{
+			name: "form", method: "POST", target: "/", form: validAdversaryForm("Cave Bat"),
+			status: http.StatusSeeOther, redirect: "/adversaries/3", check: created,
+		},
+		{
+			name: "htmx", method: "POST", target: "/", form: validAdversaryForm("Cave Bat"), htmx: true,
+			status: http.StatusOK, redirect: "/adversaries/3", check: created,
+		},
+		{
+			name: "invalid", method: "POST", target: "/", form: validAdversaryForm(""),
+			status: http.StatusBadRequest, contains: []string{"name is required"},
+			check: func(t *testing.T, store *db.MemoryStore) {
+				if getAdversary(t, store, nextAdvID) != nil {
+					t.Error("invalid adversary was created")
+				}
+			},
+		},
+		{
+			name: "store down", method: "POST", target: "/", form: validAdversaryForm("Cave Bat"), setup: withBrokenStores,
+			status: http.StatusInternalServerError,
+		},
+	})
+}
+
+func TestEditAdversaryForm(t *testing.T) {
+	runRouteTests(t, adversaryRoutes, []routeTest{
+		{
+			name: "form", method: "GET", target: "/1/edit",
+			status: http.StatusOK, contains: []string{pageMarker, `value="Bear"`, "Claws"},
+		},
+		{name: "read-only", method: "GET", target: "/2/edit", status: http.StatusForbidden},
+		{name: "invalid ID", method: "GET", target: "/bear/edit", status: http.StatusBadRequest},
+		{name: "not found", method: "GET", target: "/99/edit", status: http.StatusNotFound},
+		{name: "store down", method: "GET", target: "/1/edit", setup: withBrokenStores, status: http.StatusInternalServerError},
+	})
+}
+
+func TestUpdateAdversary(t *testing.T) {
+	updated := func(t *testing.T, store *db.MemoryStore) {
+		adv := getAdversary(t, store, bearID)
+		if adv.Name != "Cave Bear" || adv.Role != "Skulk" || len(adv.Features) != 2 {
+			t.Errorf("updated to %+v", adv)
+		}
+	}
+	unchanged := func(t *testing.T, store *db.MemoryStore) {
+		if adv := getAdversary(t, store, bearID); adv.Name != "Bear" {
+			t.Errorf("bear renamed to %q", adv.Name)
+		}
+	}
+
+	runRouteTests(t, adversaryRoutes, []routeTest{
+		{
+			name: "form", method: "POST", target: "/1", form: validAdversaryForm("Cave Bear"),
+			status: http.StatusSeeOther, redirect: "/adversaries/1", check: updated,
+		},
+		{
+			name: "htmx", method: "POST", target: "/1", form: validAdversaryForm("Cave Bear"), htmx: true,
+			status: http.StatusOK, redirect: "/adversaries/1", check: updated,
+		},
+		{
+			name: "invalid", method: "POST", target: "/1", form: url.Values{"name": {"Cave Bear"}},
+			status: http.StatusBadRequest, check: unchanged,
+		},
+		{
+			name: "read-only", method: "POST", target: "/2", form: validAdversaryForm("Cave Bear"),
+			status: http.StatusForbidden,
+		},
+		{name: "invalid ID", method: "POST", target: "/bear", form: validAdversaryForm("Cave Bear"), status: http.StatusBadRequest},
+		{name: "not found", method: "POST", target: "/99", form: validAdversaryForm("Cave Bear"), status: http.StatusNotFound},
+		{
+			name: "store down", method: "POST", target: "/1", form: validAdversaryForm("Cave Bear"), setup: withBrokenStores,
+			status: http.StatusInternalServerError,
+		},
+	})
+}
+
+func TestDeleteAdversary(t *testing.T) {
+	deleted := func(t *testing.T, store *db.MemoryStore) {
+		if getAdversary(t, store, bearID) != nil {
+			t.Error("bear was not deleted")
+		}
+		if enc := getEncounter(t, store, forestID); len(enc.Adversaries) != 0 {
+			t.Error("bear is still in the forest")
+		}
+	}
+
+	runRouteTests(t, adversaryRoutes, []routeTest{
+		{
+			name: "htmx", method: "DELETE", target: "/1", htmx: true,
+			status: http.StatusOK, redirect: "/adversaries", check: deleted,
+		},
+		{
+			name: "form", method: "POST", target: "/1/delete",
+			status: http.StatusSeeOther, redirect: "/adversaries", check: deleted,
+		},
+		{
+			name: "read-only", method: "DELETE", target: "/2", htmx: true,
+			status: http.StatusForbidden,
+			check: func(t *testing.T, store *db.MemoryStore) {
+				if getAdversary(t, store, guardID) == nil {
+					t.Error("SRD adversary was deleted")
+				}
+			},
+		},
+		{name: "invalid ID", method: "DELETE", target: "/bear", status: http.StatusBadRequest},
+		{name: "not found", method: "POST", target: "/99/delete", status: http.StatusNotFound},
+		{name: "store down", method: "DELETE", target: "/1", setup: withBrokenStores, status: http.StatusInternalServerError},
+	})
+}
+
+func TestCopyAdversary(t *testing.T) {
+	copied := func(t *testing.T, store *db.MemoryStore) {
+		adv := getAdversary(t, store, nextAdvID)
+		if adv == nil {
+			t.Fatal("adversary was not copied")
+		}
+		if adv.Name != "Archer Guard (2)" || adv.ReadOnly() || len(adv.Features) != 1 {
+			t.Errorf("copied %+v", adv)
+		}
+	}
+
+	runRouteTests(t, adversaryRoutes, []routeTest{
+		{
+			name: "form", method: "POST", target: "/2/copy",
+			status: http.StatusSeeOther, redirect: "/adversaries/3/edit", check: copied,
+		},
+		{
+			name: "htmx", method: "POST", target: "/2/copy", htmx: true,
+			status: http.StatusOK, redirect: "/adversaries/3/edit", check: copied,
+		},
+		{name: "invalid ID", method: "POST", target: "/guard/copy", status: http.StatusBadRequest},
+		{name: "not found", method: "POST", target: "/99/copy", status: http.StatusNotFound},
+		{name: "store down", method: "POST", target: "/2/copy", setup: withBrokenStores, status: http.StatusInternalServerError},
+	})
+}
+
+func TestExportAdversaries(t *testing.T) {
+	runRouteTests(t, adversaryRoutes, []routeTest{
+		{
+			name: "bestiary", method: "GET", target: "/export",
+			status: http.StatusOK, contains: []string{"name: Adversaries", "name: Bear", "name: Claws", "name: Archer Guard"},
+		},
+		{
+			name: "one adversary as JSON", method: "GET", target: "/export?id=1&format=json",
+			status: http.StatusOK, contains: []string{`"name": "Bear"`, `"name": "Roar"`}, excludes: []string{"Archer Guard"},
+		},
+		{name: "invalid format", method: "GET", target: "/export?format=xml", status: http.StatusBadRequest},
+		{name: "invalid ID", method: "GET", target: "/export?id=bear", status: http.StatusBadRequest},
+		{name: "not found", method: "GET", target: "/export?id=99", status: http.StatusNotFound},
+		{name: "store down", method: "GET", target: "/export", setup: withBrokenStores, status: http.StatusInternalServerError},
+		{name: "one adversary store down", method: "GET", target: "/export?id=1", setup: withBrokenStores, status: http.StatusInternalServerError},
+	})
+}
+
+func TestImportAdversaries(t *testing.T) {
+	form := func(conflict string) url.Values {
+		return url.Values{"pack": {testPack}, "conflict": {conflict}}
+	}
+	imported := func(t *testing.T, store *db.MemoryStore) {
+		wolf := getAdversary(t, store, nextAdvID)
+		if wolf == nil || wolf.Name != "Dire Wolf" || len(wolf.Features) != 1 {
+			t.Errorf("imported %+v", wolf)
+		}
+		if bear := getAdversary(t, store, bearID); bear.Tier != 1 {
+			t.Error("skipped bear was overwritten")
+		}
+	}
+
+	runRouteTests(t, adversaryRoutes, []routeTest{
+		{name: "page", method: "GET", target: "/import", status: http.StatusOK, contains: []string{pageMarker, "<form"}},
+		{
+			name: "preview", method: "POST", target: "/import/preview", form: form(db.ConflictSkip),
+			status: http.StatusOK, contains: []string{pageMarker, "Dire Wolf", "Bear"},
+		},
+		{
+			name: "htmx preview", method: "POST", target: "/import/preview", form: form(db.ConflictRename), htmx: true,
+			status: http.StatusOK, contains: []string{`id="import-preview"`, "Bear (2)"}, excludes: []string{pageMarker},
+			check: func(t *testing.T, store *db.MemoryStore) {
+				if getAdversary(t, store, nextAdvID) != nil {
+					t.Error("preview imported adversaries")
+				}
+			},
+		},
+		{
+			name: "preview invalid pack", method: "POST", target: "/import/preview", form: url.Values{"pack": {"format: 1\nname: Empty\n"}}, htmx: true,
+			status: http.StatusOK, contains: []string{`id="import-preview"`},
+		},
+		{
+			name: "preview invalid conflict policy", method: "POST", target: "/import/preview", form: form("merge"),
+			status: http.StatusBadRequest,
+		},
+		{
+			name: "preview store down", method: "POST", target: "/import/preview", form: form(db.ConflictSkip), setup: withBrokenStores,
+			status: http.StatusInternalServerError,
+		},
+		{
+			name: "form", method: "POST", target: "/import", form: form(db.ConflictSkip),
+			status: http.StatusSeeOther, redirect: "/adversaries", check: imported,
+		},
+		{
+			name: "htmx", method: "POST", target: "/import", form: form(db.ConflictSkip), htmx: true,
+			status: http.StatusOK, redirect: "/adversaries", check: imported,
+		},
+		{
+			name: "overwrite", method: "POST", target: "/import", form: form(db.ConflictOverwrite),
+			status: http.StatusSeeOther, redirect: "/adversaries",
+			check: func(t *testing.T, store *db.MemoryStore) {
+				if bear := getAdversary(t, store, bearID); bear.Tier != 2 || len(bear.Features) != 0 {
+					t.Errorf("bear overwritten to %+v", bear)
+				}
+			},
+		},
+		{
+			name: "invalid pack", method: "POST", target: "/import", form: url.Values{"pack": {"adversaries: [{}]"}},
+			status: http.StatusBadRequest,
+		},
+		{
+			name: "store down", method: "POST", target: "/import", form: form(db.ConflictSkip), setup: withBrokenStores,
+			status: http.StatusInternalServerError,
+		},
+	})
+}
+
+func TestAdversaryFeatures(t *testing.T) {
+	featureNames := func(want ...string) func(t *testing.T, store *db.MemoryStore) {
+		return func(t *testing.T, store *db.MemoryStore) {
+			t.Helper()
+			var got []string
+			for _, f := range getAdversary(t, store, bearID).Features {
+				got = append(got, f.Name)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("bear has features %v, want %v", got, want)
+			}
+			for i := range got {
+				if got[i] != want[i] {
+					t.Fatalf("bear has features %v, want %v", got, want)
+				}
+			}
+		}
+	}
+	feature := url.Values{"kind": {"Passive"}, "name": {"Thick Hide"}, "text": {"Resistant to physical damage."}}
+
+	runRouteTests(t, adversaryRoutes, []routeTest{
+		{
+			name: "create", method: "POST", target: "/1/features", form: feature,
+			status: http.StatusSeeOther, redirect: "/adversaries/1/edit", check: featureNames("Claws", "Roar", "Thick Hide"),
+		},
+		{
+			name: "create htmx", method: "POST", target: "/1/features", form: feature, htmx: true,
+			status: http.StatusOK, contains: []string{`id="adversary-features"`, "Thick Hide"}, excludes: []string{pageMarker},
+		},
+		{
+			name: "create without name", method: "POST", target: "/1/features", form: url.Values{"kind": {"Passive"}},
+			status: http.StatusBadRequest, check: featureNames("Claws", "Roar"),
+		},
+		{
+			name: "create invalid kind", method: "POST", target: "/1/features", form: url.Values{"kind": {"Lair"}, "name": {"Den"}},
+			status: http.StatusBadRequest,
+		},
+		{
+			name: "create non-numeric cost", method: "POST", target: "/1/features", htmx: true,
+			form:     url.Values{"kind": {"Action"}, "name": {"Rend"}, "fear_cost": {"two"}, "stress_cost": {"1"}},
+			status:   http.StatusUnprocessableEntity,
+			contains: []string{`id="adversary-features"`, "fear_cost must be a whole number", `value="Rend"`, `value="two"`},
+			check:    featureNames("Claws", "Roar"),
+		},
+		{
+			name: "create negative countdown", method: "POST", target: "/1/features",
+			form:   url.Values{"kind": {"Passive"}, "name": {"Rot"}, "countdown": {"-3"}},
+			status: http.StatusUnprocessableEntity, contains: []string{"countdown cannot be negative"},
+			check: featureNames("Claws", "Roar"),
+		},
+		{
+			name: "create blank costs", method: "POST", target: "/1/features",
+			form:   url.Values{"kind": {"Passive"}, "name": {"Thick Hide"}, "fear_cost": {""}, "countdown": {" "}},
+			status: http.StatusSeeOther, check: featureNames("Claws", "Roar", "Thick Hide"),
+		},
+		{name: "create read-only", method: "POST", target: "/2/features", form: feature, status: http.StatusForbidden},
+		{name: "create invalid ID", method: "POST", target: "/bear/features", form: feature, status: http.StatusBadRequest},
+		{name: "create not found", method: "POST", target: "/99/features", form: feature, status: http.StatusNotFound},
+		{
+			name: "create store down", method: "POST", target: "/1/features", form: feature, setup: withBrokenStores,
+			status: http.StatusInternalServerError,
+		},
+
+		{
+			name: "move", method: "POST", target: "/1/features/2/move", form: url.Values{"direction": {"up"}},
+			status: http.StatusSeeOther, redirect: "/adversaries/1/edit", check: featureNames("Roar", "Claws"),
+		},
+		{
+			name: "move htmx", method: "POST", target: "/1/features/1/move", form: url.Values{"direction": {"down"}}, htmx: true,
+			status: http.StatusOK, contains: []string{`id="adversary-features"`}, check: featureNames("Roar", "Claws"),
+		},
+		{
+			name: "move past the end", method: "POST", target: "/1/features/2/move", form: url.Values{"direction": {"down"}}, htmx: true,
+			status: http.StatusOK, check: featureNames("Claws", "Roar"),
+		},
+		{
+			name: "move invalid direction", method: "POST", target: "/1/features/2/move", form: url.Values{"direction": {"left"}},
+			status: http.StatusBadRequest,
+		},
+		{
+			name: "move invalid feature ID", method: "POST", target: "/1/features/roar/move", form: url.Values{"direction": {"up"}},
+			status: http.StatusBadRequest,
+		},
+		{
+			name: "move another adversary's feature", method: "POST", target: "/1/features/3/move", form: url.Values{"direction": {"up"}},
+			status: http.StatusNotFound,
+		},
+		{
+			name: "move store down", method: "POST", target: "/1/features/2/move", form: url.Values{"direction": {"up"}}, setup: withBrokenStores,
+			status: http.StatusInternalServerError,
+		},
+
+		{
+			name: "delete htmx", method: "DELETE", target: "/1/features/1", htmx: true,
+			status: http.StatusOK, contains: []string{`id="adversary-features"`}, check: featureNames("Roar"),
+		},
+		{
+			name: "delete form", method: "POST", target: "/1/features/2/delete",
+			status: http.StatusSeeOther, redirect: "/adversaries/1/edit", check: featureNames("Claws"),
+		},
+		{name: "delete read-only", method: "DELETE", target: "/2/features/3", status: http.StatusForbidden},
+		{name: "delete invalid ID", method: "DELETE", target: "/1/features/claws", status: http.StatusBadRequest},
+		{name: "delete another adversary's feature", method: "DELETE", target: "/1/features/3", status: http.StatusNotFound},
+		{name: "delete missing feature", method: "DELETE", target: "/1/features/99", status: http.StatusNotFound},
+		{name: "delete store down", method: "DELETE", target: "/1/features/1", setup: withBrokenStores, status: http.StatusInternalServerError},
+	})
+}
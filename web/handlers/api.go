@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// APIRoutes returns the versioned JSON API router, mounted at /api/v1.
+// Request bodies are validated against the OpenAPI document generated from
+// the router; it fails if the routes and the documented operations disagree.
+func (s *Server) APIRoutes() (chi.Router, error) {
+	r := chi.NewRouter()
+	validator := &apiValidator{routes: r}
+	r.Use(negotiateJSON)
+	r.Use(validator.middleware)
+
+	r.Route("/adversaries", func(r chi.Router) {
+		r.Get("/", s.APIListAdversaries)
+		r.Post("/", s.APICreateAdversary)
+		r.Get("/{id}", s.APIGetAdversary)
+		r.Put("/{id}", s.APIUpdateAdversary)
+		r.Delete("/{id}", s.APIDeleteAdversary)
+	})
+
+	r.Route("/encounters", func(r chi.Router) {
+		r.Get("/", s.APIListEncounters)
+		r.Post("/", s.APICreateEncounter)
+
+		r.Route("/{id}", func(r chi.Router) {
+			r.Get("/", s.APIGetEncounter)
+			r.Put("/", s.APIUpdateEncounter)
+			r.Delete("/", s.APIDeleteEncounter)
+
+			// Encounter membership
+			r.Get("/adversaries", s.APIListEncounterAdversaries)
+			r.Put("/adversaries/{adversaryId}", s.APISetEncounterAdversary)
+			r.Delete("/adversaries/{adversaryId}", s.APIRemoveEncounterAdversary)
+
+			// Battle point budget
+			r.Get("/budget", s.APIGetEncounterBudget)
+			r.Put("/party", s.APISetEncounterParty)
+
+			// Combat session
+			r.Get("/combat", s.APIGetCombat)
+			r.Post("/combat", s.APIStartCombat)
+			r.Post("/combat/end", s.APIEndCombat)
+			r.Get("/combat/log", s.APIGetCombatLog)
+			r.Post("/combat/undo", s.APIUndoCombat)
+			r.Post("/combat/redo", s.APIRedoCombat)
+			r.Patch("/combat/combatants/{combatantId}", s.APIUpdateCombatant)
+			r.Post("/combat/combatants/{combatantId}/damage", s.APIDamageCombatant)
+			r.Post("/combat/combatants/{combatantId}/stress", s.APIStressCombatant)
+			r.Post("/combat/combatants/{combatantId}/features/{featureId}/use", s.APIUseFeature)
+
+			// Reports of past fights
+			r.Get("/reports", s.APIListCombatReports)
+			r.Get("/reports/{reportId}", s.APIGetCombatReport)
+		})
+	})
+
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, "not found")
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+	})
+
+	spec, err := buildAPISpec(r)
+	if err != nil {
+		return nil, err
+	}
+	validator.spec = spec
+
+	return r, nil
+}
+
+// apiError is the body of every API error response
+type apiError struct {
+	Error string `json:"error"`
+	// Fields maps request fields to what is wrong with them, for
+	// validation errors
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// validationErrors maps field names to validation messages
+type validationErrors map[string]string
+
+// Error joins the validation messages into a single sentence, sorted by field
+func (v validationErrors) Error() string {
+	fields := make([]string, 0, len(v))
+	for field := range v {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	msgs := make([]string, len(fields))
+	for i, field := range fields {
+		msgs[i] = field + " " + v[field]
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// negotiateJSON rejects requests that cannot accept a JSON response, or that
+// send a body that is not JSON
+func negotiateJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !acceptsJSON(r.Header.Get("Accept")) {
+			writeAPIError(w, http.StatusNotAcceptable, "this API only serves application/json")
+			return
+		}
+
+		if r.ContentLength != 0 && (r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch) {
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || mediaType != "application/json" {
+				writeAPIError(w, http.StatusUnsupportedMediaType, "request body must be application/json")
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// acceptsJSON reports whether an Accept header allows a JSON response. A
+// missing header accepts anything.
+func acceptsJSON(accept string) bool {
+	if accept == "" {
+		return true
+	}
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || params["q"] == "0" {
+			continue
+		}
+		switch mediaType {
+		case "application/json", "application/*", "*/*":
+			return true
+		}
+	}
+	return false
+}
+
+// decodeJSON decodes a request body into v, writing a 400 response and
+// returning false if it is not valid JSON for v
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil {
+		if errors.Is(err, io.EOF) {
+			writeAPIError(w, http.StatusBadRequest, "request body is required")
+		} else {
+			writeAPIError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		}
+		return false
+	}
+
+	return true
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to write JSON response", "error", err)
+	}
+}
+
+// writeAPIError writes a JSON error response
+func writeAPIError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, apiError{Error: msg})
+}
+
+// writeValidationError writes a 422 response listing the invalid fields
+func writeValidationError(w http.ResponseWriter, errs validationErrors) {
+	writeJSON(w, http.StatusUnprocessableEntity, apiError{Error: "validation failed", Fields: errs})
+}
+
+// writeAPIInternalError logs err and writes a 500 response
+func writeAPIInternalError(w http.ResponseWriter, msg string, err error, args ...interface{}) {
+	slog.Error(msg, append([]interface{}{"error", err}, args...)...)
+	writeAPIError(w, http.StatusInternalServerError, "internal server error")
+}
+
+// apiIDParam parses a numeric URL parameter, writing a 400 response and
+// returning false if it is invalid
+func apiIDParam(w http.ResponseWriter, r *http.Request, name, what string) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, name), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid "+what+" ID")
+		return 0, false
+	}
+	return id, true
+}
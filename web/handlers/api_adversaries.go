@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/juthrbog/adversarytracker/db"
+)
+
+// adversaryInput is the request body for creating or replacing an adversary
+type adversaryInput struct {
+	Name            string `json:"name"`
+	Type            string `json:"type"`
+	Tier            int    `json:"tier"`
+	Role            string `json:"role"`
+	Difficulty      int    `json:"difficulty"`
+	MajorThreshold  int    `json:"major_threshold"`
+	SevereThreshold int    `json:"severe_threshold"`
+	HitPoints       int    `json:"hit_points"`
+	Stress          int    `json:"stress"`
+	AttackModifier  int    `json:"attack_modifier"`
+	AttackName      string `json:"attack_name"`
+	AttackRange     string `json:"attack_range"`
+	AttackDamage    string `json:"attack_damage"`
+	DamageType      string `json:"damage_type"`
+	Experiences     string `json:"experiences"`
+	MotivesTactics  string `json:"motives_tactics"`
+	Description     string `json:"description"`
+	Tags            string `json:"tags"`
+}
+
+// adversary builds the adversary described by the input
+func (in *adversaryInput) adversary() *db.Adversary {
+	return &db.Adversary{
+		Name:            strings.TrimSpace(in.Name),
+		Type:            in.Type,
+		Tier:            in.Tier,
+		Role:            in.Role,
+		Difficulty:      in.Difficulty,
+		MajorThreshold:  in.MajorThreshold,
+		SevereThreshold: in.SevereThreshold,
+		HitPoints:       in.HitPoints,
+		Stress:          in.Stress,
+		AttackModifier:  in.AttackModifier,
+		AttackName:      in.AttackName,
+		AttackRange:     in.AttackRange,
+		AttackDamage:    in.AttackDamage,
+		DamageType:      in.DamageType,
+		Experiences:     in.Experiences,
+		MotivesTactics:  in.MotivesTactics,
+		Description:     in.Description,
+		Tags:            db.NormalizeTags(in.Tags),
+	}
+}
+
+// APIListAdversaries returns the adversaries matching the query's filters,
+// a page at a time if it has a limit
+func (s *Server) APIListAdversaries(w http.ResponseWriter, r *http.Request) {
+	opts, errs := parseListOptions(r.URL.Query(), db.AdversarySortFields, 0)
+	if len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	adversaries, next, err := s.Adversaries.ListAdversaries(r.Context(), opts)
+	if errors.Is(err, db.ErrInvalidCursor) {
+		writeAPIError(w, http.StatusBadRequest, "invalid page cursor")
+		return
+	}
+	if err != nil {
+		writeAPIInternalError(w, "Failed to get adversaries", err)
+		return
+	}
+
+	setNextLink(w, r, opts, next)
+
+	if adversaries == nil {
+		adversaries = []*db.Adversary{}
+	}
+	writeJSON(w, http.StatusOK, adversaries)
+}
+
+// APIGetAdversary returns a single adversary with its features
+func (s *Server) APIGetAdversary(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiIDParam(w, r, "id", "adversary")
+	if !ok {
+		return
+	}
+
+	adversary, ok := s.apiLoadAdversary(w, r, id)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, adversary)
+}
+
+// APICreateAdversary creates an adversary and returns it
+func (s *Server) APICreateAdversary(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var in adversaryInput
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+
+	adv := in.adversary()
+	if errs := validateAdversary(adv); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	id, err := s.Adversaries.CreateAdversary(ctx, adv)
+	if err != nil {
+		writeAPIInternalError(w, "Failed to create adversary", err)
+		return
+	}
+
+	adversary, ok := s.apiLoadAdversary(w, r, id)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/adversaries/"+strconv.FormatInt(id, 10))
+	writeJSON(w, http.StatusCreated, adversary)
+}
+
+// APIUpdateAdversary replaces an adversary's statblock and returns it.
+// Features are managed separately and are left untouched.
+func (s *Server) APIUpdateAdversary(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiIDParam(w, r, "id", "adversary")
+	if !ok {
+		return
+	}
+
+	existing, ok := s.apiLoadAdversary(w, r, id)
+	if !ok {
+		return
+	}
+	if existing.ReadOnly() {
+		writeAPIError(w, http.StatusForbidden, readOnlyAdversaryMessage)
+		return
+	}
+
+	var in adversaryInput
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+
+	adv := in.adversary()
+	if errs := validateAdversary(adv); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+	adv.ID = id
+
+	if err := s.Adversaries.UpdateAdversary(r.Context(), adv); err != nil {
+		writeAPIInternalError(w, "Failed to update adversary", err, "id", id)
+		return
+	}
+
+	adversary, ok := s.apiLoadAdversary(w, r, id)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, adversary)
+}
+
+// APIDeleteAdversary deletes an adversary
+func (s *Server) APIDeleteAdversary(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiIDParam(w, r, "id", "adversary")
+	if !ok {
+		return
+	}
+
+	existing, ok := s.apiLoadAdversary(w, r, id)
+	if !ok {
+		return
+	}
+	if existing.ReadOnly() {
+		writeAPIError(w, http.StatusForbidden, readOnlyAdversaryMessage)
+		return
+	}
+
+	if err := s.Adversaries.DeleteAdversary(r.Context(), id); err != nil {
+		writeAPIInternalError(w, "Failed to delete adversary", err, "id", id)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiLoadAdversary gets an adversary by ID, writing an error response and
+// returning false if it does not exist
+func (s *Server) apiLoadAdversary(w http.ResponseWriter, r *http.Request, id int64) (*db.Adversary, bool) {
+	adversary, err := s.Adversaries.GetAdversary(r.Context(), id)
+	if err != nil {
+		writeAPIInternalError(w, "Failed to get adversary", err, "id", id)
+		return nil, false
+	}
+
+	if adversary == nil {
+		writeAPIError(w, http.StatusNotFound, "adversary not found")
+		return nil, false
+	}
+
+	return adversary, true
+}
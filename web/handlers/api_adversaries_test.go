@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/juthrbog/adversarytracker/db"
+)
+
+func TestAPIAdversaries(t *testing.T) {
+	wolf := `{"name": "Wolf", "type": "Beast", "tier": 1, "role": "Skulk", "hit_points": 4, "stress": 1, "tags": "Forest, pack"}`
+
+	runRouteTests(t, apiRoutes, []routeTest{
+		{
+			name: "list", method: http.MethodGet, target: "/adversaries",
+			status: http.StatusOK, contains: []string{`"name":"Bear"`, `"name":"Archer Guard"`, `"source":"srd"`},
+		},
+		{
+			name: "list filtered", method: http.MethodGet, target: "/adversaries?role=Ranged",
+			status: http.StatusOK, contains: []string{`"name":"Archer Guard"`}, excludes: []string{`"name":"Bear"`},
+		},
+		{
+			name: "list nothing", method: http.MethodGet, target: "/adversaries?tier=4",
+			status: http.StatusOK, contains: []string{"[]"},
+		},
+		{
+			name: "list invalid filters", method: http.MethodGet, target: "/adversaries?tier=9&sort=hp&limit=0",
+			status:   http.StatusUnprocessableEntity,
+			contains: []string{`"error":"validation failed"`, `"tier":"must be between 1 and 4"`, `"sort":"must be one of `, `"limit":"must be between 1 and `},
+		},
+		{
+			name: "list invalid cursor", method: http.MethodGet, target: "/adversaries?limit=1&after=nonsense",
+			status: http.StatusBadRequest, contains: []string{`{"error":"invalid page cursor"}`},
+		},
+		{
+			name: "list store down", method: http.MethodGet, target: "/adversaries", setup: withBrokenStores,
+			status: http.StatusInternalServerError, contains: []string{`{"error":"internal server error"}`}, excludes: []string{errStoreDown.Error()},
+		},
+		{
+			name: "get", method: http.MethodGet, target: "/adversaries/1",
+			status: http.StatusOK, contains: []string{`"id":1`, `"name":"Bear"`, `"name":"Claws"`, `"name":"Roar"`},
+		},
+		{
+			name: "get invalid ID", method: http.MethodGet, target: "/adversaries/bear",
+			status: http.StatusBadRequest, contains: []string{`{"error":"invalid adversary ID"}`},
+		},
+		{
+			name: "get missing", method: http.MethodGet, target: "/adversaries/99",
+			status: http.StatusNotFound, contains: []string{`{"error":"adversary not found"}`},
+		},
+		{
+			name: "create", method: http.MethodPost, target: "/adversaries", json: wolf,
+			status: http.StatusCreated, contains: []string{`"id":3`, `"name":"Wolf"`, `"tags":"forest,pack"`},
+			check: func(t *testing.T, store *db.MemoryStore) {
+				if wolf := getAdversary(t, store, nextAdvID); wolf == nil || wolf.Role != db.RoleSkulk || wolf.HitPoints != 4 {
+					t.Errorf("created %+v", wolf)
+				}
+			},
+		},
+		{
+			name: "create inconsistent thresholds", method: http.MethodPost, target: "/adversaries",
+			json:   `{"name": "Wolf", "tier": 1, "role": "Skulk", "hit_points": 4, "major_threshold": 8, "severe_threshold": 5}`,
+			status: http.StatusUnprocessableEntity, contains: []string{`"severe_threshold":"must not be below the major threshold"`},
+			check: func(t *testing.T, store *db.MemoryStore) {
+				if getAdversary(t, store, nextAdvID) != nil {
+					t.Error("invalid adversary was created")
+				}
+			},
+		},
+		{
+			name: "create as a form", method: http.MethodPost, target: "/adversaries", form: validAdversaryForm("Wolf"),
+			status: http.StatusUnsupportedMediaType, contains: []string{`{"error":"request body must be application/json"}`},
+		},
+		{
+			name: "create store down", method: http.MethodPost, target: "/adversaries", json: wolf, setup: withBrokenStores,
+			status: http.StatusInternalServerError, contains: []string{`{"error":"internal server error"}`},
+		},
+		{
+			name: "update", method: http.MethodPut, target: "/adversaries/1",
+			json:   `{"name": "Cave Bear", "tier": 2, "role": "Bruiser", "hit_points": 8}`,
+			status: http.StatusOK, contains: []string{`"name":"Cave Bear"`, `"tier":2`},
+			check: func(t *testing.T, store *db.MemoryStore) {
+				if bear := getAdversary(t, store, bearID); bear.Name != "Cave Bear" || bear.HitPoints != 8 {
+					t.Errorf("updated to %+v", bear)
+				}
+			},
+		},
+		{
+			name: "update read-only", method: http.MethodPut, target: "/adversaries/2", json: wolf,
+			status: http.StatusForbidden, contains: []string{readOnlyAdversaryMessage},
+		},
+		{
+			name: "update missing", method: http.MethodPut, target: "/adversaries/99", json: wolf,
+			status: http.StatusNotFound, contains: []string{`{"error":"adversary not found"}`},
+		},
+		{
+			name: "delete", method: http.MethodDelete, target: "/adversaries/1",
+			status: http.StatusNoContent,
+			check: func(t *testing.T, store *db.MemoryStore) {
+				if getAdversary(t, store, bearID) != nil {
+					t.Error("adversary was not deleted")
+				}
+			},
+		},
+		{
+			name: "delete read-only", method: http.MethodDelete, target: "/adversaries/2",
+			status: http.StatusForbidden,
+			check: func(t *testing.T, store *db.MemoryStore) {
+				if getAdversary(t, store, guardID) == nil {
+					t.Error("read-only adversary was deleted")
+				}
+			},
+		},
+		{
+			name: "unknown route", method: http.MethodGet, target: "/dragons",
+			status: http.StatusNotFound, contains: []string{`{"error":"not found"}`},
+		},
+		{
+			name: "method not allowed", method: http.MethodPatch, target: "/adversaries/1", json: "{}",
+			status: http.StatusMethodNotAllowed, contains: []string{`{"error":"method not allowed"}`},
+		},
+	})
+}
+
+func TestAPIListPages(t *testing.T) {
+	runRouteTests(t, apiRoutes, []routeTest{
+		{
+			name: "first page", method: http.MethodGet, target: "/adversaries?sort=name&limit=1",
+			status: http.StatusOK, contains: []string{`"name":"Archer Guard"`}, excludes: []string{`"name":"Bear"`},
+		},
+		{
+			name: "descending", method: http.MethodGet, target: "/adversaries?" + url.Values{"sort": {"name"}, "order": {"desc"}, "limit": {"1"}}.Encode(),
+			status: http.StatusOK, contains: []string{`"name":"Bear"`}, excludes: []string{`"name":"Archer Guard"`},
+		},
+	})
+}
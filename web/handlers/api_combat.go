@@ -0,0 +1,494 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/juthrbog/adversarytracker/db"
+	"github.com/juthrbog/adversarytracker/internal/combat"
+)
+
+// damageResult is the response to damaging a combatant
+type damageResult struct {
+	Outcome   combat.Outcome `json:"outcome"`
+	Combatant *db.Combatant  `json:"combatant"`
+}
+
+// stressResult is the response to marking Stress on a combatant
+type stressResult struct {
+	Outcome   combat.StressOutcome `json:"outcome"`
+	Combatant *db.Combatant        `json:"combatant"`
+}
+
+// APIGetCombat returns the running combat session of an encounter
+func (s *Server) APIGetCombat(w http.ResponseWriter, r *http.Request) {
+	session, ok := s.apiLoadActiveSession(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, session)
+}
+
+// APIStartCombat starts a combat session for an encounter and returns it
+func (s *Server) APIStartCombat(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	encounter, ok := s.apiLoadEncounter(w, r)
+	if !ok {
+		return
+	}
+
+	active, err := db.GetActiveCombatSession(ctx, s.DB, encounter.ID)
+	if err != nil {
+		writeAPIInternalError(w, "Failed to get combat session", err, "encounter_id", encounter.ID)
+		return
+	}
+
+	if active != nil {
+		writeAPIError(w, http.StatusConflict, "encounter is already in combat")
+		return
+	}
+
+	if len(encounter.Adversaries) == 0 {
+		writeValidationError(w, validationErrors{"adversaries": "encounter has no adversaries"})
+		return
+	}
+
+	id, err := s.startCombat(r, encounter)
+	if err != nil {
+		writeAPIInternalError(w, "Failed to start combat session", err, "encounter_id", encounter.ID)
+		return
+	}
+
+	session, err := db.GetCombatSessionByID(ctx, s.DB, id)
+	if err != nil {
+		writeAPIInternalError(w, "Failed to get combat session", err, "id", id)
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/encounters/"+strconv.FormatInt(encounter.ID, 10)+"/combat")
+	writeJSON(w, http.StatusCreated, session)
+}
+
+// APIEndCombat ends the running combat session of an encounter and returns
+// the ended session
+func (s *Server) APIEndCombat(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	session, ok := s.apiLoadActiveSession(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.endCombat(r, session.EncounterID, session.ID); err != nil {
+		writeAPIInternalError(w, "Failed to end combat session", err, "id", session.ID)
+		return
+	}
+
+	ended, err := db.GetCombatSessionByID(ctx, s.DB, session.ID)
+	if err != nil {
+		writeAPIInternalError(w, "Failed to get combat session", err, "id", session.ID)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ended)
+}
+
+// APIUpdateCombatant sets the HP or Stress marked on a combatant and
+// returns it
+func (s *Server) APIUpdateCombatant(w http.ResponseWriter, r *http.Request) {
+	session, combatant, ok := s.apiLoadActiveCombatant(w, r)
+	if !ok {
+		return
+	}
+
+	var in struct {
+		HPMarked     *int `json:"hp_marked"`
+		StressMarked *int `json:"stress_marked"`
+	}
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+
+	errs := validationErrors{}
+	if in.HPMarked == nil && in.StressMarked == nil {
+		errs["hp_marked"] = "is required unless stress_marked is set"
+	}
+	if in.HPMarked != nil && (*in.HPMarked < 0 || *in.HPMarked > combatant.HPMax) {
+		errs["hp_marked"] = "must be between 0 and " + strconv.Itoa(combatant.HPMax)
+	}
+	if in.StressMarked != nil && (*in.StressMarked < 0 || *in.StressMarked > combatant.StressMax) {
+		errs["stress_marked"] = "must be between 0 and " + strconv.Itoa(combatant.StressMax)
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	// Only the fields sent are set, on the combatant as stored, so that a
+	// change to the other one made meanwhile is kept. Setting both is logged
+	// as an HP change and streamed as both.
+	eventType := CombatEventHP
+	if in.HPMarked == nil {
+		eventType = CombatEventStress
+	}
+	err := s.changeCombat(r, session.EncounterID, combatant.SessionID, eventType, func(tx *sql.Tx) error {
+		return db.ChangeCombatant(r.Context(), tx, combatant, func(c *db.Combatant) {
+			if in.HPMarked != nil {
+				c.HPMarked = *in.HPMarked
+			}
+			if in.StressMarked != nil {
+				c.StressMarked = *in.StressMarked
+			}
+		})
+	})
+	if err != nil {
+		writeAPIInternalError(w, "Failed to update combatant", err, "id", combatant.ID)
+		return
+	}
+	if in.HPMarked != nil && in.StressMarked != nil {
+		s.publishCombat(r, session.EncounterID, combatant.SessionID, CombatEventStress)
+	}
+
+	updated, ok := s.apiReloadCombatant(w, r, combatant)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// APIDamageCombatant resolves damage against a combatant's thresholds and
+// returns the outcome with the updated combatant
+func (s *Server) APIDamageCombatant(w http.ResponseWriter, r *http.Request) {
+	session, combatant, ok := s.apiLoadActiveCombatant(w, r)
+	if !ok {
+		return
+	}
+
+	var damage combat.Damage
+	if !decodeJSON(w, r, &damage) {
+		return
+	}
+
+	if damage.Amount < 0 {
+		writeValidationError(w, validationErrors{"amount": "cannot be negative"})
+		return
+	}
+
+	// Resolve against the HP marked when the hit lands
+	var outcome combat.Outcome
+	err := s.changeCombat(r, session.EncounterID, combatant.SessionID, CombatEventHP, func(tx *sql.Tx) error {
+		return db.ChangeCombatant(r.Context(), tx, combatant, func(c *db.Combatant) {
+			outcome = combat.ResolveDamage(c, damage)
+			c.HPMarked = outcome.HPMarked
+		})
+	})
+	if err != nil {
+		writeAPIInternalError(w, "Failed to update combatant", err, "id", combatant.ID)
+		return
+	}
+
+	updated, ok := s.apiReloadCombatant(w, r, combatant)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &damageResult{Outcome: outcome, Combatant: updated})
+}
+
+// APIStressCombatant marks Stress on a combatant, spilling into HP once its
+// Stress track is full, and returns the outcome with the updated combatant
+func (s *Server) APIStressCombatant(w http.ResponseWriter, r *http.Request) {
+	session, combatant, ok := s.apiLoadActiveCombatant(w, r)
+	if !ok {
+		return
+	}
+
+	var in struct {
+		Amount int `json:"amount"`
+	}
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+
+	if in.Amount < 1 {
+		writeValidationError(w, validationErrors{"amount": "must be at least 1"})
+		return
+	}
+
+	// Overflow depends on the Stress marked when it lands
+	var outcome combat.StressOutcome
+	err := s.changeCombat(r, session.EncounterID, combatant.SessionID, CombatEventStress, func(tx *sql.Tx) error {
+		return db.ChangeCombatant(r.Context(), tx, combatant, func(c *db.Combatant) {
+			outcome = combat.MarkStress(c, in.Amount)
+			c.StressMarked = outcome.StressMarked
+			c.HPMarked = outcome.HPMarked
+		})
+	})
+	if err != nil {
+		writeAPIInternalError(w, "Failed to update combatant", err, "id", combatant.ID)
+		return
+	}
+
+	updated, ok := s.apiReloadCombatant(w, r, combatant)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &stressResult{Outcome: outcome, Combatant: updated})
+}
+
+// APIUseFeature has a combatant use a feature of its adversary, paying the
+// Stress and Fear it costs, and returns the updated combatant
+func (s *Server) APIUseFeature(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	session, combatant, ok := s.apiLoadActiveCombatant(w, r)
+	if !ok {
+		return
+	}
+
+	featureID, ok := apiIDParam(w, r, "featureId", "feature")
+	if !ok {
+		return
+	}
+
+	feature, err := s.Adversaries.GetAdversaryFeature(ctx, featureID)
+	if err != nil {
+		writeAPIInternalError(w, "Failed to get adversary feature", err, "id", featureID)
+		return
+	}
+
+	if feature == nil || combatant.AdversaryID == nil || feature.AdversaryID != *combatant.AdversaryID {
+		writeAPIError(w, http.StatusNotFound, "feature not found")
+		return
+	}
+
+	if combatant.Defeated() {
+		writeAPIError(w, http.StatusConflict, "combatant is defeated")
+		return
+	}
+
+	err = s.changeCombat(r, session.EncounterID, combatant.SessionID, CombatEventStress, func(tx *sql.Tx) error {
+		return db.UseFeature(ctx, tx, combatant, feature)
+	})
+	switch {
+	case errors.Is(err, db.ErrNotEnoughStress), errors.Is(err, db.ErrNotEnoughFear):
+		writeAPIError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		writeAPIInternalError(w, "Failed to use feature", err, "combatant_id", combatant.ID, "feature_id", feature.ID)
+		return
+	}
+
+	updated, ok := s.apiReloadCombatant(w, r, combatant)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// apiLoadActiveSession gets the running combat session of the encounter in
+// the URL, writing an error response and returning false if there is none
+func (s *Server) apiLoadActiveSession(w http.ResponseWriter, r *http.Request) (*db.CombatSession, bool) {
+	encounter, ok := s.apiLoadEncounter(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	session, err := db.GetActiveCombatSession(r.Context(), s.DB, encounter.ID)
+	if err != nil {
+		writeAPIInternalError(w, "Failed to get combat session", err, "encounter_id", encounter.ID)
+		return nil, false
+	}
+
+	if session == nil {
+		writeAPIError(w, http.StatusNotFound, "encounter is not in combat")
+		return nil, false
+	}
+
+	return session, true
+}
+
+// apiLoadActiveCombatant gets the running combat session and the combatant
+// in the URL from it, writing an error response and returning false if the
+// combatant is not in it
+func (s *Server) apiLoadActiveCombatant(w http.ResponseWriter, r *http.Request) (*db.CombatSession, *db.Combatant, bool) {
+	session, ok := s.apiLoadActiveSession(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+
+	combatantID, ok := apiIDParam(w, r, "combatantId", "combatant")
+	if !ok {
+		return nil, nil, false
+	}
+
+	for _, c := range session.Combatants {
+		if c.ID == combatantID {
+			return session, c, true
+		}
+	}
+
+	writeAPIError(w, http.StatusNotFound, "combatant not found")
+	return nil, nil, false
+}
+
+// apiReloadCombatant reads a combatant back after a change, with its
+// conditions and countdowns
+func (s *Server) apiReloadCombatant(w http.ResponseWriter, r *http.Request, c *db.Combatant) (*db.Combatant, bool) {
+	session, err := db.GetCombatSessionByID(r.Context(), s.DB, c.SessionID)
+	if err != nil {
+		writeAPIInternalError(w, "Failed to get combat session", err, "id", c.SessionID)
+		return nil, false
+	}
+
+	if session != nil {
+		for _, updated := range session.Combatants {
+			if updated.ID == c.ID {
+				return updated, true
+			}
+		}
+	}
+
+	writeAPIError(w, http.StatusNotFound, "combatant not found")
+	return nil, false
+}
+
+// travelResult is the response to undoing or redoing combat changes
+type travelResult struct {
+	Steps   int               `json:"steps"` // changes undone or redone
+	Session *db.CombatSession `json:"session"`
+}
+
+// APIGetCombatLog returns the combat log of the running combat session of
+// an encounter, newest first
+func (s *Server) APIGetCombatLog(w http.ResponseWriter, r *http.Request) {
+	session, ok := s.apiLoadActiveSession(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := db.GetCombatLog(r.Context(), s.DB, session.ID)
+	if err != nil {
+		writeAPIInternalError(w, "Failed to get combat log", err, "session_id", session.ID)
+		return
+	}
+
+	if entries == nil {
+		entries = []*db.CombatLogEntry{}
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// APIUndoCombat undoes the latest changes to the running combat session of
+// an encounter and returns the session
+func (s *Server) APIUndoCombat(w http.ResponseWriter, r *http.Request) {
+	s.apiTravelCombat(w, r, db.CombatLogUndo)
+}
+
+// APIRedoCombat redoes the latest undone changes to the running combat
+// session of an encounter and returns the session
+func (s *Server) APIRedoCombat(w http.ResponseWriter, r *http.Request) {
+	s.apiTravelCombat(w, r, db.CombatLogRedo)
+}
+
+// apiTravelCombat undoes or redoes combat changes, depending on kind
+func (s *Server) apiTravelCombat(w http.ResponseWriter, r *http.Request, kind string) {
+	ctx := r.Context()
+
+	session, ok := s.apiLoadActiveSession(w, r)
+	if !ok {
+		return
+	}
+
+	var in struct {
+		Steps *int `json:"steps"`
+	}
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+
+	steps := 1
+	if in.Steps != nil {
+		if *in.Steps < 1 {
+			writeValidationError(w, validationErrors{"steps": "must be at least 1"})
+			return
+		}
+		steps = *in.Steps
+	}
+
+	travel := db.UndoCombat
+	if kind == db.CombatLogRedo {
+		travel = db.RedoCombat
+	}
+
+	done, err := travel(ctx, s.DB, session.ID, db.ActorAPI, steps)
+	if errors.Is(err, db.ErrNothingToUndo) || errors.Is(err, db.ErrNothingToRedo) {
+		writeAPIError(w, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		writeAPIInternalError(w, "Failed to "+kind+" combat changes", err, "session_id", session.ID)
+		return
+	}
+	s.publishCombat(r, session.EncounterID, session.ID, CombatEventUndo)
+
+	current, err := db.GetCombatSessionByID(ctx, s.DB, session.ID)
+	if err != nil {
+		writeAPIInternalError(w, "Failed to get combat session", err, "id", session.ID)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, travelResult{Steps: done, Session: current})
+}
+
+// APIListCombatReports returns the reports of an encounter's past fights,
+// newest first
+func (s *Server) APIListCombatReports(w http.ResponseWriter, r *http.Request) {
+	encounter, ok := s.apiLoadEncounter(w, r)
+	if !ok {
+		return
+	}
+
+	reports, err := db.GetCombatReports(r.Context(), s.DB, encounter.ID)
+	if err != nil {
+		writeAPIInternalError(w, "Failed to get combat reports", err, "encounter_id", encounter.ID)
+		return
+	}
+
+	if reports == nil {
+		reports = []*db.CombatReport{}
+	}
+	writeJSON(w, http.StatusOK, reports)
+}
+
+// APIGetCombatReport returns the report of one of an encounter's past fights
+func (s *Server) APIGetCombatReport(w http.ResponseWriter, r *http.Request) {
+	encounter, ok := s.apiLoadEncounter(w, r)
+	if !ok {
+		return
+	}
+
+	reportID, ok := apiIDParam(w, r, "reportId", "report")
+	if !ok {
+		return
+	}
+
+	report, err := db.GetCombatReport(r.Context(), s.DB, reportID)
+	if err != nil {
+		writeAPIInternalError(w, "Failed to get combat report", err, "id", reportID)
+		return
+	}
+
+	if report == nil || report.EncounterID != encounter.ID {
+		writeAPIError(w, http.StatusNotFound, "report not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/juthrbog/adversarytracker/db"
+)
+
+// apiCall is a request made to the API before the one under test
+type apiCall struct {
+	method, target, json string
+}
+
+// withAPICalls makes API requests in turn before the request, so that the
+// combat log has changes in it
+func withAPICalls(calls ...apiCall) func(s *Server, store *db.MemoryStore) {
+	return func(s *Server, store *db.MemoryStore) {
+		routes := apiRoutes(s)
+		for _, c := range calls {
+			r := httptest.NewRequest(c.method, c.target, strings.NewReader(c.json))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			routes.ServeHTTP(w, r)
+			if w.Code >= 300 {
+				panic(c.method + " " + c.target + ": " + w.Body.String())
+			}
+		}
+	}
+}
+
+// bearMarked checks the HP and Stress marked on Bear 1
+func bearMarked(hp, stress int) func(t *testing.T, session *db.CombatSession) {
+	return func(t *testing.T, session *db.CombatSession) {
+		t.Helper()
+		bear := session.Combatants[0]
+		if bear.HPMarked != hp || bear.StressMarked != stress {
+			t.Fatalf("Bear 1 has %d HP and %d Stress marked, want %d and %d", bear.HPMarked, bear.StressMarked, hp, stress)
+		}
+	}
+}
+
+// fightStatus checks the status of the fight
+func fightStatus(status string) func(t *testing.T, session *db.CombatSession) {
+	return func(t *testing.T, session *db.CombatSession) {
+		t.Helper()
+		if session.Status != status {
+			t.Fatalf("fight is %s, want %s", session.Status, status)
+		}
+	}
+}
+
+func TestAPICombat(t *testing.T) {
+	runRouteTests(t, apiRoutes, []routeTest{
+		{
+			name: "get", method: http.MethodGet, target: "/encounters/1/combat", fight: true,
+			status: http.StatusOK, contains: []string{`"status":"active"`, `"name":"Bear 1"`, `"name":"Bear 2"`, `"name":"Collapse"`},
+		},
+		{
+			name: "get after the fight", method: http.MethodGet, target: "/encounters/1/combat", fight: true, setup: endFight,
+			status: http.StatusNotFound, contains: []string{`{"error":"encounter is not in combat"}`},
+		},
+		{
+			name: "get missing encounter", method: http.MethodGet, target: "/encounters/99/combat", fight: true,
+			status: http.StatusNotFound, contains: []string{`{"error":"encounter not found"}`},
+		},
+		{
+			name: "get database down", method: http.MethodGet, target: "/encounters/1/combat", fight: true, setup: withDatabaseDown,
+			status: http.StatusInternalServerError, contains: []string{`{"error":"internal server error"}`},
+		},
+		{
+			name: "start", method: http.MethodPost, target: "/encounters/1/combat", fight: true, setup: endFight,
+			status: http.StatusCreated, contains: []string{`"id":2`, `"status":"active"`, `"name":"Bear 1"`},
+		},
+		{
+			name: "start during a fight", method: http.MethodPost, target: "/encounters/1/combat", fight: true,
+			status: http.StatusConflict, contains: []string{`{"error":"encounter is already in combat"}`},
+		},
+		{
+			name: "end", method: http.MethodPost, target: "/encounters/1/combat/end", fight: true,
+			status: http.StatusOK, contains: []string{`"status":"ended"`, `"ended_at"`},
+			checkFight: fightStatus(db.CombatEnded),
+		},
+		{
+			name: "end without a report", method: http.MethodPost, target: "/encounters/1/combat/end", fight: true, setup: withReportsDown,
+			status: http.StatusInternalServerError, contains: []string{`{"error":"internal server error"}`},
+			checkFight: fightStatus(db.CombatActive),
+		},
+		{
+			name: "end after the fight", method: http.MethodPost, target: "/encounters/1/combat/end", fight: true, setup: endFight,
+			status: http.StatusNotFound, contains: []string{`{"error":"encounter is not in combat"}`},
+		},
+		{
+			name: "mark HP", method: http.MethodPatch, target: "/encounters/1/combat/combatants/1", fight: true,
+			json:   `{"hp_marked": 3}`,
+			status: http.StatusOK, contains: []string{`"name":"Bear 1"`, `"hp_marked":3`}, checkFight: bearMarked(3, 0),
+		},
+		{
+			name: "mark Stress", method: http.MethodPatch, target: "/encounters/1/combat/combatants/1", fight: true,
+			json:   `{"stress_marked": 2}`,
+			status: http.StatusOK, contains: []string{`"stress_marked":2`}, checkFight: bearMarked(0, 2),
+		},
+		{
+			name: "mark HP keeps Stress", method: http.MethodPatch, target: "/encounters/1/combat/combatants/1", fight: true,
+			json:   `{"hp_marked": 3}`,
+			setup:  withAPICalls(apiCall{http.MethodPost, "/encounters/1/combat/combatants/1/stress", `{"amount": 1}`}),
+			status: http.StatusOK, contains: []string{`"hp_marked":3`, `"stress_marked":1`}, checkFight: bearMarked(3, 1),
+		},
+		{
+			name: "mark both", method: http.MethodPatch, target: "/encounters/1/combat/combatants/1", fight: true,
+			json:   `{"hp_marked": 2, "stress_marked": 1}`,
+			status: http.StatusOK, contains: []string{`"hp_marked":2`, `"stress_marked":1`}, checkFight: bearMarked(2, 1),
+		},
+		{
+			name: "mark too much HP", method: http.MethodPatch, target: "/encounters/1/combat/combatants/1", fight: true,
+			json:       `{"hp_marked": 8, "stress_marked": 3}`,
+			status:     http.StatusUnprocessableEntity,
+			contains:   []string{`"hp_marked":"must be between 0 and 7"`, `"stress_marked":"must be between 0 and 2"`},
+			checkFight: bearMarked(0, 0),
+		},
+		{
+			name: "mark nothing", method: http.MethodPatch, target: "/encounters/1/combat/combatants/1", fight: true,
+			json:   `{}`,
+			status: http.StatusUnprocessableEntity, contains: []string{`"hp_marked":"is required unless stress_marked is set"`},
+		},
+		{
+			name: "mark missing combatant", method: http.MethodPatch, target: "/encounters/1/combat/combatants/99", fight: true,
+			json:   `{"hp_marked": 1}`,
+			status: http.StatusNotFound, contains: []string{`{"error":"combatant not found"}`},
+		},
+		{
+			name: "mark invalid combatant ID", method: http.MethodPatch, target: "/encounters/1/combat/combatants/bear", fight: true,
+			json:   `{"hp_marked": 1}`,
+			status: http.StatusBadRequest, contains: []string{`{"error":"invalid combatant ID"}`},
+		},
+		{
+			name: "mark database down", method: http.MethodPatch, target: "/encounters/1/combat/combatants/1", fight: true,
+			json: `{"hp_marked": 1}`, setup: withDatabaseDown,
+			status: http.StatusInternalServerError, contains: []string{`{"error":"internal server error"}`},
+		},
+		{
+			name: "damage", method: http.MethodPost, target: "/encounters/1/combat/combatants/1/damage", fight: true,
+			json:   `{"amount": 20}`,
+			status: http.StatusOK, contains: []string{`"marked":1`, `"hp_marked":1`, `"name":"Bear 1"`}, checkFight: bearMarked(1, 0),
+		},
+		{
+			name: "damage immune", method: http.MethodPost, target: "/encounters/1/combat/combatants/1/damage", fight: true,
+			json:   `{"amount": 20, "immunity": true}`,
+			status: http.StatusOK, contains: []string{`"marked":0`}, checkFight: bearMarked(0, 0),
+		},
+		{
+			name: "damage after the fight", method: http.MethodPost, target: "/encounters/1/combat/combatants/1/damage", fight: true,
+			json: `{"amount": 20}`, setup: endFight,
+			status: http.StatusNotFound, contains: []string{`{"error":"encounter is not in combat"}`},
+		},
+		{
+			name: "stress", method: http.MethodPost, target: "/encounters/1/combat/combatants/1/stress", fight: true,
+			json:   `{"amount": 1}`,
+			status: http.StatusOK, contains: []string{`"marked":1`, `"overflow":0`, `"stress_marked":1`}, checkFight: bearMarked(0, 1),
+		},
+		{
+			name: "stress overflow", method: http.MethodPost, target: "/encounters/1/combat/combatants/1/stress", fight: true,
+			json:   `{"amount": 3}`,
+			status: http.StatusOK, contains: []string{`"marked":2`, `"overflow":1`}, checkFight: bearMarked(1, 2),
+		},
+		{
+			name: "use missing feature", method: http.MethodPost, target: "/encounters/1/combat/combatants/1/features/1/use", fight: true,
+			json:   `{}`,
+			status: http.StatusNotFound, contains: []string{`{"error":"feature not found"}`},
+		},
+		{
+			name: "use invalid feature ID", method: http.MethodPost, target: "/encounters/1/combat/combatants/1/features/roar/use", fight: true,
+			json:   `{}`,
+			status: http.StatusBadRequest, contains: []string{`{"error":"invalid feature ID"}`},
+		},
+	})
+}
+
+func TestAPICombatLog(t *testing.T) {
+	runRouteTests(t, apiRoutes, []routeTest{
+		{
+			name: "log", method: http.MethodGet, target: "/encounters/1/combat/log", fight: true,
+			setup: withAPICalls(
+				apiCall{http.MethodPatch, "/encounters/1/combat/combatants/1", `{"hp_marked": 1}`},
+				apiCall{http.MethodPost, "/encounters/1/combat/combatants/1/damage", `{"amount": 20}`},
+			),
+			status: http.StatusOK, contains: []string{`"summary":"Bear 1 marked 1 HP (2/7)"`, `"undo_steps":1`},
+		},
+		{
+			name: "undo", method: http.MethodPost, target: "/encounters/1/combat/undo", fight: true,
+			json: `{}`,
+			setup: withAPICalls(
+				apiCall{http.MethodPatch, "/encounters/1/combat/combatants/1", `{"hp_marked": 1}`},
+				apiCall{http.MethodPost, "/encounters/1/combat/combatants/1/damage", `{"amount": 20}`},
+			),
+			status: http.StatusOK, contains: []string{`"steps":1`, `"session"`}, checkFight: bearMarked(1, 0),
+		},
+		{
+			name: "redo", method: http.MethodPost, target: "/encounters/1/combat/redo", fight: true,
+			json: `{}`,
+			setup: withAPICalls(
+				apiCall{http.MethodPatch, "/encounters/1/combat/combatants/1", `{"hp_marked": 1}`},
+				apiCall{http.MethodPost, "/encounters/1/combat/combatants/1/damage", `{"amount": 20}`},
+				apiCall{http.MethodPost, "/encounters/1/combat/undo", `{}`},
+			),
+			status: http.StatusOK, contains: []string{`"steps":1`}, checkFight: bearMarked(2, 0),
+		},
+		{
+			name: "undo nothing", method: http.MethodPost, target: "/encounters/1/combat/undo", fight: true,
+			json:   `{}`,
+			status: http.StatusConflict, contains: []string{`{"error":"nothing to undo"}`},
+		},
+		{
+			name: "redo nothing", method: http.MethodPost, target: "/encounters/1/combat/redo", fight: true,
+			json:   `{}`,
+			status: http.StatusConflict, contains: []string{`{"error":"nothing to redo"}`},
+		},
+		{
+			name: "undo after the fight", method: http.MethodPost, target: "/encounters/1/combat/undo", fight: true,
+			json: `{}`, setup: endFight,
+			status: http.StatusNotFound, contains: []string{`{"error":"encounter is not in combat"}`},
+		},
+		{
+			name: "reports", method: http.MethodGet, target: "/encounters/1/reports", fight: true,
+			status: http.StatusOK, contains: []string{"[]"},
+		},
+		{
+			name: "reports after the fight", method: http.MethodGet, target: "/encounters/1/reports", fight: true,
+			setup:  withAPICalls(apiCall{http.MethodPost, "/encounters/1/combat/end", ""}),
+			status: http.StatusOK, contains: []string{`"encounter_id":1`, `"session_id":1`},
+		},
+		{
+			name: "report", method: http.MethodGet, target: "/encounters/1/reports/1", fight: true,
+			setup:  withAPICalls(apiCall{http.MethodPost, "/encounters/1/combat/end", ""}),
+			status: http.StatusOK, contains: []string{`"id":1`, `"combatants"`},
+		},
+		{
+			name: "missing report", method: http.MethodGet, target: "/encounters/1/reports/99", fight: true,
+			status: http.StatusNotFound, contains: []string{`{"error":"report not found"}`},
+		},
+		{
+			name: "invalid report ID", method: http.MethodGet, target: "/encounters/1/reports/latest", fight: true,
+			status: http.StatusBadRequest, contains: []string{`{"error":"invalid report ID"}`},
+		},
+	})
+}
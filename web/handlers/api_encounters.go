@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/juthrbog/adversarytracker/db"
+	"github.com/juthrbog/adversarytracker/internal/budget"
+)
+
+// encounterInput is the request body for creating or replacing an encounter
+type encounterInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Adversaries is only accepted when creating an encounter; membership of
+	// an existing encounter is managed through its adversaries endpoints
+	Adversaries []membershipInput `json:"adversaries"`
+}
+
+// membershipInput is an adversary and how many copies of it an encounter has
+type membershipInput struct {
+	AdversaryID int64 `json:"adversary_id"`
+	Count       int   `json:"count"`
+}
+
+// APIListEncounters returns the encounters matching the query's filters
+// with their adversaries, a page at a time if it has a limit
+func (s *Server) APIListEncounters(w http.ResponseWriter, r *http.Request) {
+	opts, errs := parseListOptions(r.URL.Query(), db.EncounterSortFields, 0)
+	if len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	encounters, next, err := s.Encounters.ListEncounters(r.Context(), opts)
+	if errors.Is(err, db.ErrInvalidCursor) {
+		writeAPIError(w, http.StatusBadRequest, "invalid page cursor")
+		return
+	}
+	if err != nil {
+		writeAPIInternalError(w, "Failed to get encounters", err)
+		return
+	}
+
+	setNextLink(w, r, opts, next)
+
+	if encounters == nil {
+		encounters = []*db.Encounter{}
+	}
+	writeJSON(w, http.StatusOK, encounters)
+}
+
+// APIGetEncounter returns a single encounter with its adversaries
+func (s *Server) APIGetEncounter(w http.ResponseWriter, r *http.Request) {
+	encounter, ok := s.apiLoadEncounter(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, encounter)
+}
+
+// APICreateEncounter creates an encounter, optionally with adversaries, and
+// returns it
+func (s *Server) APICreateEncounter(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var in encounterInput
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+
+	enc := &db.Encounter{
+		Name:        strings.TrimSpace(in.Name),
+		Description: in.Description,
+	}
+
+	errs := validationErrors{}
+	if enc.Name == "" {
+		errs["name"] = "is required"
+	}
+	for i, m := range in.Adversaries {
+		field := "adversaries[" + strconv.Itoa(i) + "]"
+		if m.Count < 1 {
+			errs[field+".count"] = "must be at least 1"
+		}
+
+		adversary, err := s.Adversaries.GetAdversary(ctx, m.AdversaryID)
+		if err != nil {
+			writeAPIInternalError(w, "Failed to get adversary", err, "id", m.AdversaryID)
+			return
+		}
+		if adversary == nil {
+			errs[field+".adversary_id"] = "does not exist"
+		}
+
+		enc.Adversaries = append(enc.Adversaries, &db.EncounterAdversary{
+			AdversaryID: m.AdversaryID,
+			Count:       m.Count,
+		})
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	id, err := s.Encounters.CreateEncounter(ctx, enc)
+	if err != nil {
+		writeAPIInternalError(w, "Failed to create encounter", err)
+		return
+	}
+
+	encounter, err := s.Encounters.GetEncounter(ctx, id)
+	if err != nil {
+		writeAPIInternalError(w, "Failed to get encounter", err, "id", id)
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/encounters/"+strconv.FormatInt(id, 10))
+	writeJSON(w, http.StatusCreated, encounter)
+}
+
+// APIUpdateEncounter replaces an encounter's name and description and
+// returns it
+func (s *Server) APIUpdateEncounter(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	encounter, ok := s.apiLoadEncounter(w, r)
+	if !ok {
+		return
+	}
+
+	var in encounterInput
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+
+	errs := validationErrors{}
+	if strings.TrimSpace(in.Name) == "" {
+		errs["name"] = "is required"
+	}
+	if in.Adversaries != nil {
+		errs["adversaries"] = "cannot be replaced here; use the encounter's adversaries endpoints"
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	encounter.Name = strings.TrimSpace(in.Name)
+	encounter.Description = in.Description
+
+	if err := s.Encounters.UpdateEncounter(ctx, encounter); err != nil {
+		writeAPIInternalError(w, "Failed to update encounter", err, "id", encounter.ID)
+		return
+	}
+
+	updated, err := s.Encounters.GetEncounter(ctx, encounter.ID)
+	if err != nil {
+		writeAPIInternalError(w, "Failed to get encounter", err, "id", encounter.ID)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// APIDeleteEncounter deletes an encounter
+func (s *Server) APIDeleteEncounter(w http.ResponseWriter, r *http.Request) {
+	encounter, ok := s.apiLoadEncounter(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.Encounters.DeleteEncounter(r.Context(), encounter.ID); err != nil {
+		writeAPIInternalError(w, "Failed to delete encounter", err, "id", encounter.ID)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIListEncounterAdversaries returns the adversaries in an encounter
+func (s *Server) APIListEncounterAdversaries(w http.ResponseWriter, r *http.Request) {
+	encounter, ok := s.apiLoadEncounter(w, r)
+	if !ok {
+		return
+	}
+
+	memberships := encounter.Adversaries
+	if memberships == nil {
+		memberships = []*db.EncounterAdversary{}
+	}
+	writeJSON(w, http.StatusOK, memberships)
+}
+
+// APISetEncounterAdversary puts an adversary in an encounter with the given
+// count, replacing the count if it is already there
+func (s *Server) APISetEncounterAdversary(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	encounter, ok := s.apiLoadEncounter(w, r)
+	if !ok {
+		return
+	}
+
+	adversaryID, ok := apiIDParam(w, r, "adversaryId", "adversary")
+	if !ok {
+		return
+	}
+
+	if _, ok := s.apiLoadAdversary(w, r, adversaryID); !ok {
+		return
+	}
+
+	var in struct {
+		Count int `json:"count"`
+	}
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+
+	if in.Count < 1 {
+		writeValidationError(w, validationErrors{"count": "must be at least 1"})
+		return
+	}
+
+	_, err := s.Encounters.SetEncounterAdversary(ctx, &db.EncounterAdversary{
+		EncounterID: encounter.ID,
+		AdversaryID: adversaryID,
+		Count:       in.Count,
+	})
+	if err != nil {
+		writeAPIInternalError(w, "Failed to add adversary to encounter", err, "encounter_id", encounter.ID)
+		return
+	}
+
+	membership, ok := s.apiLoadMembership(w, r, encounter.ID, adversaryID)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, membership)
+}
+
+// APIRemoveEncounterAdversary takes an adversary out of an encounter
+func (s *Server) APIRemoveEncounterAdversary(w http.ResponseWriter, r *http.Request) {
+	encounter, ok := s.apiLoadEncounter(w, r)
+	if !ok {
+		return
+	}
+
+	adversaryID, ok := apiIDParam(w, r, "adversaryId", "adversary")
+	if !ok {
+		return
+	}
+
+	membership, ok := s.apiLoadMembership(w, r, encounter.ID, adversaryID)
+	if !ok {
+		return
+	}
+
+	if err := s.Encounters.RemoveAdversaryFromEncounter(r.Context(), membership.ID); err != nil {
+		writeAPIInternalError(w, "Failed to remove adversary from encounter", err, "id", membership.ID)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIGetEncounterBudget returns an encounter's battle point budget
+func (s *Server) APIGetEncounterBudget(w http.ResponseWriter, r *http.Request) {
+	encounter, ok := s.apiLoadEncounter(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, budget.Calculate(encounter))
+}
+
+// APISetEncounterParty sets the party an encounter is built for and the GM's
+// budget adjustments, returning the recalculated budget
+func (s *Server) APISetEncounterParty(w http.ResponseWriter, r *http.Request) {
+	encounter, ok := s.apiLoadEncounter(w, r)
+	if !ok {
+		return
+	}
+
+	var in struct {
+		PartySize   int    `json:"party_size"`
+		PartyTier   int    `json:"party_tier"`
+		Challenge   string `json:"challenge"`
+		DamageBoost bool   `json:"damage_boost"`
+	}
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+
+	encounter.PartySize = in.PartySize
+	encounter.PartyTier = in.PartyTier
+	encounter.Challenge = in.Challenge
+	if encounter.Challenge == "" {
+		encounter.Challenge = db.ChallengeStandard
+	}
+	encounter.DamageBoost = in.DamageBoost
+
+	if errs := validateParty(encounter); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	if err := s.Encounters.UpdateEncounterParty(r.Context(), encounter); err != nil {
+		writeAPIInternalError(w, "Failed to update encounter party", err, "id", encounter.ID)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, budget.Calculate(encounter))
+}
+
+// apiLoadEncounter gets the encounter in the URL, writing an error response
+// and returning false if it does not exist
+func (s *Server) apiLoadEncounter(w http.ResponseWriter, r *http.Request) (*db.Encounter, bool) {
+	id, ok := apiIDParam(w, r, "id", "encounter")
+	if !ok {
+		return nil, false
+	}
+
+	encounter, err := s.Encounters.GetEncounter(r.Context(), id)
+	if err != nil {
+		writeAPIInternalError(w, "Failed to get encounter", err, "id", id)
+		return nil, false
+	}
+
+	if encounter == nil {
+		writeAPIError(w, http.StatusNotFound, "encounter not found")
+		return nil, false
+	}
+
+	return encounter, true
+}
+
+// apiLoadMembership finds an adversary's entry in an encounter, writing an
+// error response and returning false if the adversary is not in it
+func (s *Server) apiLoadMembership(w http.ResponseWriter, r *http.Request, encounterID, adversaryID int64) (*db.EncounterAdversary, bool) {
+	memberships, err := s.Encounters.GetEncounterAdversaries(r.Context(), encounterID)
+	if err != nil {
+		writeAPIInternalError(w, "Failed to get encounter adversaries", err, "encounter_id", encounterID)
+		return nil, false
+	}
+
+	for _, m := range memberships {
+		if m.AdversaryID == adversaryID {
+			return m, true
+		}
+	}
+
+	writeAPIError(w, http.StatusNotFound, "adversary is not in this encounter")
+	return nil, false
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/juthrbog/adversarytracker/db"
+)
+
+// forestBears checks how many bears the forest has
+func forestBears(n int) func(t *testing.T, store *db.MemoryStore) {
+	return func(t *testing.T, store *db.MemoryStore) {
+		t.Helper()
+
+		count := 0
+		for _, ea := range getEncounter(t, store, forestID).Adversaries {
+			if ea.AdversaryID == bearID {
+				count = ea.Count
+			}
+		}
+		if count != n {
+			t.Errorf("forest has %d bears, want %d", count, n)
+		}
+	}
+}
+
+func TestAPIEncounters(t *testing.T) {
+	runRouteTests(t, apiRoutes, []routeTest{
+		{
+			name: "list", method: http.MethodGet, target: "/encounters",
+			status: http.StatusOK, contains: []string{`"name":"Forest"`, `"count":2`},
+		},
+		{
+			name: "list invalid order", method: http.MethodGet, target: "/encounters?order=sideways",
+			status: http.StatusUnprocessableEntity, contains: []string{`"order":"must be asc or desc"`},
+		},
+		{
+			name: "list store down", method: http.MethodGet, target: "/encounters", setup: withBrokenEncounters,
+			status: http.StatusInternalServerError, contains: []string{`{"error":"internal server error"}`},
+		},
+		{
+			name: "get", method: http.MethodGet, target: "/encounters/1",
+			status: http.StatusOK, contains: []string{`"id":1`, `"name":"Forest"`, `"adversary_id":1`},
+		},
+		{
+			name: "get invalid ID", method: http.MethodGet, target: "/encounters/forest",
+			status: http.StatusBadRequest, contains: []string{`{"error":"invalid encounter ID"}`},
+		},
+		{
+			name: "get missing", method: http.MethodGet, target: "/encounters/99",
+			status: http.StatusNotFound, contains: []string{`{"error":"encounter not found"}`},
+		},
+		{
+			name: "create", method: http.MethodPost, target: "/encounters",
+			json:   `{"name": " Ambush ", "adversaries": [{"adversary_id": 1, "count": 1}, {"adversary_id": 2, "count": 3}]}`,
+			status: http.StatusCreated, contains: []string{`"id":2`, `"name":"Ambush"`},
+			check: func(t *testing.T, store *db.MemoryStore) {
+				if enc := getEncounter(t, store, nextEncID); enc == nil || len(enc.Adversaries) != 2 {
+					t.Errorf("created %+v", enc)
+				}
+			},
+		},
+		{
+			name: "create with a missing adversary", method: http.MethodPost, target: "/encounters",
+			json:   `{"name": "Ambush", "adversaries": [{"adversary_id": 99, "count": 1}]}`,
+			status: http.StatusUnprocessableEntity, contains: []string{`"adversaries[0].adversary_id":"does not exist"`},
+			check: func(t *testing.T, store *db.MemoryStore) {
+				if getEncounter(t, store, nextEncID) != nil {
+					t.Error("invalid encounter was created")
+				}
+			},
+		},
+		{
+			name: "create blank name", method: http.MethodPost, target: "/encounters", json: `{"name": "   "}`,
+			status: http.StatusUnprocessableEntity, contains: []string{`"name":"is required"`},
+		},
+		{
+			name: "create without a body", method: http.MethodPost, target: "/encounters", json: " ",
+			status: http.StatusBadRequest, contains: []string{`{"error":"request body is required"}`},
+		},
+		{
+			name: "update", method: http.MethodPut, target: "/encounters/1", json: `{"name": "Dark Forest", "description": "Bears."}`,
+			status: http.StatusOK, contains: []string{`"name":"Dark Forest"`, `"description":"Bears."`},
+			check: func(t *testing.T, store *db.MemoryStore) {
+				if enc := getEncounter(t, store, forestID); enc.Name != "Dark Forest" || len(enc.Adversaries) != 1 {
+					t.Errorf("updated to %+v", enc)
+				}
+			},
+		},
+		{
+			name: "update missing", method: http.MethodPut, target: "/encounters/99", json: `{"name": "Cave"}`,
+			status: http.StatusNotFound, contains: []string{`{"error":"encounter not found"}`},
+		},
+		{
+			name: "delete", method: http.MethodDelete, target: "/encounters/1",
+			status: http.StatusNoContent,
+			check: func(t *testing.T, store *db.MemoryStore) {
+				if getEncounter(t, store, forestID) != nil {
+					t.Error("encounter was not deleted")
+				}
+			},
+		},
+		{
+			name: "delete missing", method: http.MethodDelete, target: "/encounters/99",
+			status: http.StatusNotFound,
+		},
+		{
+			name: "list adversaries", method: http.MethodGet, target: "/encounters/1/adversaries",
+			status: http.StatusOK, contains: []string{`"adversary_id":1`, `"count":2`, `"name":"Bear"`},
+		},
+		{
+			name: "set adversary count", method: http.MethodPut, target: "/encounters/1/adversaries/1", json: `{"count": 5}`,
+			status: http.StatusOK, contains: []string{`"count":5`}, check: forestBears(5),
+		},
+		{
+			name: "add adversary", method: http.MethodPut, target: "/encounters/1/adversaries/2", json: `{"count": 1}`,
+			status: http.StatusOK, contains: []string{`"adversary_id":2`, `"count":1`}, check: forestBears(2),
+		},
+		{
+			name: "add missing adversary", method: http.MethodPut, target: "/encounters/1/adversaries/99", json: `{"count": 1}`,
+			status: http.StatusNotFound, contains: []string{`{"error":"adversary not found"}`},
+		},
+		{
+			name: "remove adversary", method: http.MethodDelete, target: "/encounters/1/adversaries/1",
+			status: http.StatusNoContent, check: forestBears(0),
+		},
+		{
+			name: "remove adversary not in the encounter", method: http.MethodDelete, target: "/encounters/1/adversaries/2",
+			status: http.StatusNotFound, contains: []string{`{"error":"adversary is not in this encounter"}`}, check: forestBears(2),
+		},
+		{
+			name: "budget", method: http.MethodGet, target: "/encounters/1/budget",
+			status: http.StatusOK, contains: []string{`"party_size":4`, `"spent":8`, `"name":"Bear"`},
+		},
+		{
+			name: "set party", method: http.MethodPut, target: "/encounters/1/party",
+			json:   `{"party_size": 5, "party_tier": 1, "challenge": "harder", "damage_boost": true}`,
+			status: http.StatusOK, contains: []string{`"party_size":5`, `"base":17`, `"available":17`},
+			check: func(t *testing.T, store *db.MemoryStore) {
+				if enc := getEncounter(t, store, forestID); enc.PartySize != 5 || !enc.DamageBoost {
+					t.Errorf("party set to %+v", enc)
+				}
+			},
+		},
+		{
+			name: "budget of a missing encounter", method: http.MethodGet, target: "/encounters/99/budget",
+			status: http.StatusNotFound, contains: []string{`{"error":"encounter not found"}`},
+		},
+	})
+}
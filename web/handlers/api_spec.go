@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/juthrbog/adversarytracker/db"
+	"github.com/juthrbog/adversarytracker/internal/budget"
+	"github.com/juthrbog/adversarytracker/internal/openapi"
+)
+
+// maxAPIBodySize is the largest request body the API accepts
+const maxAPIBodySize = 1 << 20
+
+// apiOperation documents one API route
+type apiOperation struct {
+	ID      string
+	Summary string
+	Tag     string
+	// Query documents the query parameters the route accepts
+	Query []*openapi.Parameter
+	// Request is the schema of the JSON body, or nil if the route takes none
+	Request *openapi.Schema
+	// Status is the success status code, and Response a value of the type
+	// returned with it, or nil for an empty response
+	Status   int
+	Response interface{}
+}
+
+// Request body schemas
+var (
+	adversarySchema = openapi.Object(map[string]*openapi.Schema{
+		"name":             openapi.String().Length(1, 0),
+		"type":             openapi.String(),
+		"tier":             openapi.Integer().Min(1).Max(4),
+		"role":             openapi.String().OneOf(db.AdversaryRoles...),
+		"difficulty":       openapi.Integer().Min(0),
+		"major_threshold":  openapi.Integer().Min(0),
+		"severe_threshold": openapi.Integer().Min(0),
+		"hit_points":       openapi.Integer().Min(1),
+		"stress":           openapi.Integer().Min(0),
+		"attack_modifier":  openapi.Integer(),
+		"attack_name":      openapi.String(),
+		"attack_range":     openapi.String(),
+		"attack_damage":    openapi.String(),
+		"damage_type":      openapi.String(),
+		"experiences":      openapi.String(),
+		"motives_tactics":  openapi.String(),
+		"description":      openapi.String(),
+		"tags":             openapi.String().Describe("Comma-separated tags"),
+	}, "name", "tier", "role", "hit_points")
+
+	membershipSchema = openapi.Object(map[string]*openapi.Schema{
+		"adversary_id": openapi.Integer().Min(1),
+		"count":        openapi.Integer().Min(1),
+	}, "adversary_id", "count")
+
+	newEncounterSchema = openapi.Object(map[string]*openapi.Schema{
+		"name":        openapi.String().Length(1, 0),
+		"description": openapi.String(),
+		"adversaries": openapi.Array(membershipSchema),
+	}, "name")
+
+	encounterSchema = openapi.Object(map[string]*openapi.Schema{
+		"name":        openapi.String().Length(1, 0),
+		"description": openapi.String(),
+	}, "name")
+
+	countSchema = openapi.Object(map[string]*openapi.Schema{
+		"count": openapi.Integer().Min(1),
+	}, "count")
+
+	partySchema = openapi.Object(map[string]*openapi.Schema{
+		"party_size":   openapi.Integer().Min(1).Max(maxPartySize),
+		"party_tier":   openapi.Integer().Min(1).Max(4),
+		"challenge":    openapi.String().OneOf(db.Challenges...),
+		"damage_boost": openapi.Boolean().Describe("Adversaries deal extra damage"),
+	}, "party_size", "party_tier")
+
+	combatantSchema = openapi.Object(map[string]*openapi.Schema{
+		"hp_marked":     openapi.Integer().Min(0).Describe("HP marked; at most the combatant's hp_max"),
+		"stress_marked": openapi.Integer().Min(0).Describe("Stress marked; at most the combatant's stress_max"),
+	})
+
+	stressSchema = openapi.Object(map[string]*openapi.Schema{
+		"amount": openapi.Integer().Min(1).Describe("Stress to mark; what the Stress track cannot hold marks HP"),
+	}, "amount")
+
+	travelSchema = openapi.Object(map[string]*openapi.Schema{
+		"steps": openapi.Integer().Min(1).Describe("Changes to undo or redo; defaults to 1"),
+	})
+
+	damageSchema = openapi.Object(map[string]*openapi.Schema{
+		"amount":         openapi.Integer().Min(0),
+		"direct":         openapi.Boolean(),
+		"resistance":     openapi.Boolean(),
+		"immunity":       openapi.Boolean(),
+		"massive_damage": openapi.Boolean().Describe("Use the optional massive damage rule"),
+	}, "amount")
+)
+
+// apiOperations documents every route of the API router, keyed by method
+// and route pattern. buildAPISpec fails if this and the router disagree.
+var apiOperations = map[string]apiOperation{
+	"GET /adversaries":         {ID: "listAdversaries", Summary: "List adversaries", Tag: "adversaries", Query: listParameters(db.AdversarySortFields, "Only adversaries", "Only adversaries of this tier"), Status: http.StatusOK, Response: []*db.Adversary{}},
+	"POST /adversaries":        {ID: "createAdversary", Summary: "Create an adversary", Tag: "adversaries", Request: adversarySchema, Status: http.StatusCreated, Response: &db.Adversary{}},
+	"GET /adversaries/{id}":    {ID: "getAdversary", Summary: "Get an adversary with its features", Tag: "adversaries", Status: http.StatusOK, Response: &db.Adversary{}},
+	"PUT /adversaries/{id}":    {ID: "updateAdversary", Summary: "Replace an adversary's statblock", Tag: "adversaries", Request: adversarySchema, Status: http.StatusOK, Response: &db.Adversary{}},
+	"DELETE /adversaries/{id}": {ID: "deleteAdversary", Summary: "Delete an adversary", Tag: "adversaries", Status: http.StatusNoContent},
+
+	"GET /encounters":         {ID: "listEncounters", Summary: "List encounters", Tag: "encounters", Query: listParameters(db.EncounterSortFields, "Only encounters with an adversary", "Only encounters for a party of this tier"), Status: http.StatusOK, Response: []*db.Encounter{}},
+	"POST /encounters":        {ID: "createEncounter", Summary: "Create an encounter", Tag: "encounters", Request: newEncounterSchema, Status: http.StatusCreated, Response: &db.Encounter{}},
+	"GET /encounters/{id}":    {ID: "getEncounter", Summary: "Get an encounter with its adversaries", Tag: "encounters", Status: http.StatusOK, Response: &db.Encounter{}},
+	"PUT /encounters/{id}":    {ID: "updateEncounter", Summary: "Replace an encounter's name and description", Tag: "encounters", Request: encounterSchema, Status: http.StatusOK, Response: &db.Encounter{}},
+	"DELETE /encounters/{id}": {ID: "deleteEncounter", Summary: "Delete an encounter", Tag: "encounters", Status: http.StatusNoContent},
+
+	"GET /encounters/{id}/adversaries":                  {ID: "listEncounterAdversaries", Summary: "List the adversaries in an encounter", Tag: "encounters", Status: http.StatusOK, Response: []*db.EncounterAdversary{}},
+	"PUT /encounters/{id}/adversaries/{adversaryId}":    {ID: "setEncounterAdversary", Summary: "Set how many of an adversary an encounter has", Tag: "encounters", Request: countSchema, Status: http.StatusOK, Response: &db.EncounterAdversary{}},
+	"DELETE /encounters/{id}/adversaries/{adversaryId}": {ID: "removeEncounterAdversary", Summary: "Remove an adversary from an encounter", Tag: "encounters", Status: http.StatusNoContent},
+
+	"GET /encounters/{id}/budget": {ID: "getEncounterBudget", Summary: "Get an encounter's battle point budget", Tag: "encounters", Status: http.StatusOK, Response: &budget.Budget{}},
+	"PUT /encounters/{id}/party":  {ID: "setEncounterParty", Summary: "Set the party an encounter is built for", Tag: "encounters", Request: partySchema, Status: http.StatusOK, Response: &budget.Budget{}},
+
+	"GET /encounters/{id}/combat":                                                    {ID: "getCombat", Summary: "Get the running combat session", Tag: "combat", Status: http.StatusOK, Response: &db.CombatSession{}},
+	"POST /encounters/{id}/combat":                                                   {ID: "startCombat", Summary: "Start a combat session", Tag: "combat", Status: http.StatusCreated, Response: &db.CombatSession{}},
+	"POST /encounters/{id}/combat/end":                                               {ID: "endCombat", Summary: "End the running combat session", Tag: "combat", Status: http.StatusOK, Response: &db.CombatSession{}},
+	"GET /encounters/{id}/combat/log":                                                {ID: "getCombatLog", Summary: "Get the combat log of the running combat session, newest first", Tag: "combat", Status: http.StatusOK, Response: []*db.CombatLogEntry{}},
+	"POST /encounters/{id}/combat/undo":                                              {ID: "undoCombat", Summary: "Undo the latest combat changes", Tag: "combat", Request: travelSchema, Status: http.StatusOK, Response: &travelResult{}},
+	"POST /encounters/{id}/combat/redo":                                              {ID: "redoCombat", Summary: "Redo the latest undone combat changes", Tag: "combat", Request: travelSchema, Status: http.StatusOK, Response: &travelResult{}},
+	"PATCH /encounters/{id}/combat/combatants/{combatantId}":                         {ID: "updateCombatant", Summary: "Set the HP or Stress marked on a combatant", Tag: "combat", Request: combatantSchema, Status: http.StatusOK, Response: &db.Combatant{}},
+	"POST /encounters/{id}/combat/combatants/{combatantId}/damage":                   {ID: "damageCombatant", Summary: "Resolve damage against a combatant", Tag: "combat", Request: damageSchema, Status: http.StatusOK, Response: &damageResult{}},
+	"POST /encounters/{id}/combat/combatants/{combatantId}/stress":                   {ID: "stressCombatant", Summary: "Mark Stress on a combatant", Tag: "combat", Request: stressSchema, Status: http.StatusOK, Response: &stressResult{}},
+	"POST /encounters/{id}/combat/combatants/{combatantId}/features/{featureId}/use": {ID: "useFeature", Summary: "Use a feature, paying its Stress and Fear cost", Tag: "combat", Status: http.StatusOK, Response: &db.Combatant{}},
+
+	"GET /encounters/{id}/reports":            {ID: "listCombatReports", Summary: "List the reports of an encounter's past fights, newest first", Tag: "combat", Status: http.StatusOK, Response: []*db.CombatReport{}},
+	"GET /encounters/{id}/reports/{reportId}": {ID: "getCombatReport", Summary: "Get the report of a past fight", Tag: "combat", Status: http.StatusOK, Response: &db.CombatReport{}},
+}
+
+// pathParamPattern matches the parameters of a chi route pattern
+var pathParamPattern = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+// buildAPISpec generates the OpenAPI document of the API router by walking
+// its routes. It fails if a route is not documented in apiOperations, or an
+// operation there has no route, so the document cannot drift from the
+// router.
+func buildAPISpec(routes chi.Routes) (*openapi.Document, error) {
+	doc := &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:       "Daggerheart Adversary Tracker API",
+			Description: "Adversaries, encounters and combat sessions.",
+			Version:     "1",
+		},
+		Servers: []openapi.Server{{URL: "/api/v1"}},
+		Paths:   make(map[string]*openapi.PathItem),
+	}
+	errorSchema := doc.Components.Named("Error", apiError{})
+
+	seen := make(map[string]bool)
+	var missing []string
+
+	err := chi.Walk(routes, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		pattern := normalizeRoutePattern(route)
+		key := method + " " + pattern
+
+		op, ok := apiOperations[key]
+		if !ok {
+			missing = append(missing, key)
+			return nil
+		}
+		seen[key] = true
+
+		operation := &openapi.Operation{
+			OperationID: op.ID,
+			Summary:     op.Summary,
+			Tags:        []string{op.Tag},
+			Responses: map[string]*openapi.Response{
+				"default": {Description: "Error", Content: openapi.JSONContent(errorSchema)},
+			},
+		}
+
+		for _, m := range pathParamPattern.FindAllStringSubmatch(pattern, -1) {
+			operation.Parameters = append(operation.Parameters, &openapi.Parameter{
+				Name:     m[1],
+				In:       "path",
+				Required: true,
+				Schema:   openapi.Integer(),
+			})
+		}
+		operation.Parameters = append(operation.Parameters, op.Query...)
+
+		if op.Request != nil {
+			operation.RequestBody = &openapi.RequestBody{
+				Required: true,
+				Content:  openapi.JSONContent(op.Request),
+			}
+		}
+
+		success := &openapi.Response{Description: http.StatusText(op.Status)}
+		if op.Response != nil {
+			success.Content = openapi.JSONContent(doc.Components.SchemaOf(op.Response))
+		}
+		operation.Responses[strconv.Itoa(op.Status)] = success
+
+		path := pathParamPattern.ReplaceAllString(pattern, "{$1}")
+		item := doc.Paths[path]
+		if item == nil {
+			item = &openapi.PathItem{}
+			doc.Paths[path] = item
+		}
+		(*item)[strings.ToLower(method)] = operation
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for key := range apiOperations {
+		if !seen[key] {
+			missing = append(missing, key+" (no route)")
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("API routes and OpenAPI operations disagree: %s", strings.Join(missing, ", "))
+	}
+
+	return doc, nil
+}
+
+// normalizeRoutePattern strips the trailing slash chi leaves on the root
+// route of a sub-router, so "/adversaries/" and "/adversaries" match
+func normalizeRoutePattern(pattern string) string {
+	if pattern != "/" {
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+	return pattern
+}
+
+// OpenAPIDocument serves the OpenAPI document of the API router
+func OpenAPIDocument(routes chi.Routes) http.HandlerFunc {
+	doc, err := buildAPISpec(routes)
+	var body []byte
+	if err == nil {
+		body, err = json.MarshalIndent(doc, "", "  ")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			slog.Error("Failed to build OpenAPI document", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}
+}
+
+// apiValidator rejects request bodies that do not match the request schema
+// of their route in the OpenAPI document
+type apiValidator struct {
+	routes chi.Routes
+	spec   *openapi.Document
+}
+
+// middleware validates the request body before the handler decodes it
+func (v *apiValidator) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op := v.operation(r)
+		if op == nil || op.Schema() == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAPIBodySize))
+		if err != nil {
+			writeAPIError(w, http.StatusRequestEntityTooLarge, "request body is too large")
+			return
+		}
+		// Hand the handler a fresh copy of the body
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if len(bytes.TrimSpace(body)) == 0 {
+			writeAPIError(w, http.StatusBadRequest, "request body is required")
+			return
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+
+		if errs := v.spec.Components.Validate(op.Schema(), value); len(errs) > 0 {
+			if msg, ok := errs[""]; ok {
+				delete(errs, "")
+				errs["body"] = msg
+			}
+			writeValidationError(w, errs)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// operation finds the documented operation a request is routed to
+func (v *apiValidator) operation(r *http.Request) *openapi.Operation {
+	if v.spec == nil {
+		return nil
+	}
+
+	path := r.URL.Path
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePath != "" {
+		path = rctx.RoutePath
+	}
+
+	rctx := chi.NewRouteContext()
+	if !v.routes.Match(rctx, r.Method, path) {
+		return nil
+	}
+
+	pattern := pathParamPattern.ReplaceAllString(normalizeRoutePattern(rctx.RoutePattern()), "{$1}")
+	item := v.spec.Paths[pattern]
+	if item == nil {
+		return nil
+	}
+	return (*item)[strings.ToLower(r.Method)]
+}
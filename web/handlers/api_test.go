@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/juthrbog/adversarytracker/internal/openapi"
+)
+
+// apiRoutes builds the API router of a test server. TestAPISpec reports why
+// if it cannot be built.
+func apiRoutes(s *Server) http.Handler {
+	r, err := s.APIRoutes()
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func TestAPISpec(t *testing.T) {
+	s, _ := newTestServer(t)
+	routes, err := s.APIRoutes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec, err := buildAPISpec(routes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every mounted route has a documented operation
+	mounted := 0
+	err = chi.Walk(routes, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		mounted++
+		path := pathParamPattern.ReplaceAllString(normalizeRoutePattern(route), "{$1}")
+
+		item := spec.Paths[path]
+		if item == nil {
+			t.Errorf("%s %s has no path in the document", method, route)
+			return nil
+		}
+		op := (*item)[strings.ToLower(method)]
+		if op == nil || op.OperationID == "" || op.Summary == "" {
+			t.Errorf("%s %s has no documented operation", method, route)
+			return nil
+		}
+		if len(op.Responses) < 2 || op.Responses["default"] == nil {
+			t.Errorf("%s %s does not document both its success and error responses", method, route)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ...and no operation is left without a route
+	documented := 0
+	for _, item := range spec.Paths {
+		documented += len(*item)
+	}
+	if mounted == 0 || documented != mounted {
+		t.Errorf("%d operations documented for %d routes", documented, mounted)
+	}
+
+	// The served document is the one the validator uses
+	w := httptest.NewRecorder()
+	OpenAPIDocument(routes).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("OpenAPI document status %d\n%s", w.Code, w.Body.String())
+	}
+	var served openapi.Document
+	if err := json.Unmarshal(w.Body.Bytes(), &served); err != nil {
+		t.Fatal(err)
+	}
+	if len(served.Paths) != len(spec.Paths) {
+		t.Errorf("served document has %d paths, want %d", len(served.Paths), len(spec.Paths))
+	}
+}
+
+func TestAPISpecDisagreement(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+
+	// A route missing from apiOperations, and every documented route
+	// missing from the router
+	r := chi.NewRouter()
+	r.Get("/adversaries", handler)
+	r.Get("/secrets", handler)
+
+	_, err := buildAPISpec(r)
+	if err == nil {
+		t.Fatal("undocumented route: no error")
+	}
+	for _, want := range []string{"GET /secrets", "POST /adversaries (no route)"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q: %v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "GET /adversaries,") {
+		t.Errorf("error mentions a documented route: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	OpenAPIDocument(r).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("OpenAPI document of a bad router: status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestAPIValidation(t *testing.T) {
+	adversary := `"name": "Wolf", "tier": 1, "role": "Skulk", "hit_points": 4`
+
+	runRouteTests(t, apiRoutes, []routeTest{
+		{
+			name: "unknown field", method: http.MethodPost, target: "/adversaries",
+			json:     `{` + adversary + `, "armor": 3}`,
+			status:   http.StatusUnprocessableEntity,
+			contains: []string{`"error":"validation failed"`, `"armor":"is not a known field"`},
+			excludes: []string{`"name"`},
+		},
+		{
+			name: "tier out of range", method: http.MethodPost, target: "/adversaries",
+			json:     `{"name": "Wolf", "tier": 5, "role": "Skulk", "hit_points": 0}`,
+			status:   http.StatusUnprocessableEntity,
+			contains: []string{`"tier":"must be at most 4"`, `"hit_points":"must be at least 1"`},
+		},
+		{
+			name: "unknown role", method: http.MethodPut, target: "/adversaries/1",
+			json:   `{"name": "Bear", "tier": 1, "role": "Tank", "hit_points": 7}`,
+			status: http.StatusUnprocessableEntity, contains: []string{`"role":"must be one of `},
+		},
+		{
+			name: "wrong type", method: http.MethodPost, target: "/adversaries",
+			json:     `{"name": "Wolf", "tier": "one", "role": "Skulk", "hit_points": 4.5}`,
+			status:   http.StatusUnprocessableEntity,
+			contains: []string{`"tier":"must be an integer"`, `"hit_points":"must be an integer"`},
+		},
+		{
+			name: "missing required fields", method: http.MethodPost, target: "/adversaries",
+			json:     `{"name": ""}`,
+			status:   http.StatusUnprocessableEntity,
+			contains: []string{`"name":"is required"`, `"tier":"is required"`, `"role":"is required"`},
+		},
+		{
+			name: "not an object", method: http.MethodPost, target: "/adversaries",
+			json:   `[1, 2]`,
+			status: http.StatusUnprocessableEntity, contains: []string{`"body":"must be an object"`},
+		},
+		{
+			name: "unknown nested field", method: http.MethodPost, target: "/encounters",
+			json:     `{"name": "Den", "adversaries": [{"adversary_id": 1, "count": 0, "elite": true}]}`,
+			status:   http.StatusUnprocessableEntity,
+			contains: []string{`"adversaries[0].count":"must be at least 1"`, `"adversaries[0].elite":"is not a known field"`},
+		},
+		{
+			name: "party out of range", method: http.MethodPut, target: "/encounters/1/party",
+			json:     `{"party_size": 0, "party_tier": 9, "challenge": "brutal"}`,
+			status:   http.StatusUnprocessableEntity,
+			contains: []string{`"party_size":"must be at least 1"`, `"party_tier":"must be at most 4"`, `"challenge":"must be one of `},
+		},
+		{
+			name: "count out of range", method: http.MethodPut, target: "/encounters/1/adversaries/1",
+			json:   `{"count": -2}`,
+			status: http.StatusUnprocessableEntity, contains: []string{`"count":"must be at least 1"`},
+		},
+		{
+			name: "negative damage", method: http.MethodPost, target: "/encounters/1/combat/combatants/1/damage", fight: true,
+			json:     `{"amount": -4, "critical": true}`,
+			status:   http.StatusUnprocessableEntity,
+			contains: []string{`"amount":"must be at least 0"`, `"critical":"is not a known field"`},
+		},
+		{
+			name: "no Stress to mark", method: http.MethodPost, target: "/encounters/1/combat/combatants/1/stress", fight: true,
+			json:   `{"amount": 0}`,
+			status: http.StatusUnprocessableEntity, contains: []string{`"amount":"must be at least 1"`},
+		},
+		{
+			name: "negative HP", method: http.MethodPatch, target: "/encounters/1/combat/combatants/1", fight: true,
+			json:     `{"hp_marked": -1, "hp": 3}`,
+			status:   http.StatusUnprocessableEntity,
+			contains: []string{`"hp_marked":"must be at least 0"`, `"hp":"is not a known field"`},
+		},
+		{
+			name: "undo no steps", method: http.MethodPost, target: "/encounters/1/combat/undo", fight: true,
+			json:   `{"steps": 0}`,
+			status: http.StatusUnprocessableEntity, contains: []string{`"steps":"must be at least 1"`},
+		},
+		{
+			name: "invalid JSON", method: http.MethodPost, target: "/adversaries",
+			json:   `{"name": `,
+			status: http.StatusBadRequest, contains: []string{`"error":"invalid JSON`},
+		},
+	})
+}
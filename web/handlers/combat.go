@@ -0,0 +1,444 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/juthrbog/adversarytracker/db"
+	"github.com/juthrbog/adversarytracker/internal/combat"
+)
+
+// CombatRoutes returns a router with the combat tracker routes of an
+// encounter. It is mounted below /encounters/{id}.
+func (s *Server) CombatRoutes() chi.Router {
+	r := chi.NewRouter()
+
+	r.Get("/", s.ViewCombat)
+	r.Post("/", s.StartCombat)
+	r.Post("/end", s.EndCombat)
+	r.Get("/events", s.CombatEvents)
+
+	// Combat log
+	r.Get("/log", s.ViewCombatLog)
+	r.Post("/undo", s.UndoCombat)
+	r.Post("/redo", s.RedoCombat)
+
+	// GM Fear
+	r.Get("/fear", s.ViewFear)
+	r.Post("/fear/gain", s.GainFear)
+	r.Post("/fear/spend", s.SpendFear)
+	r.Post("/fear/max", s.SetFearMax)
+
+	// Spotlight
+	r.Post("/spotlight", s.PassSpotlight)
+	r.Post("/mode", s.SetTrackerMode)
+	r.Post("/tokens", s.ChangeActionTokens)
+
+	// Countdowns
+	r.Post("/countdowns", s.CreateCountdown)
+	r.Post("/countdowns/roll", s.ReportRoll)
+	r.Route("/countdowns/{countdownId}", func(r chi.Router) {
+		r.Post("/tick", s.TickCountdown)
+		r.Post("/reset", s.ResetCountdown)
+		r.Post("/public", s.SetCountdownPublic)
+		r.Delete("/", s.DeleteCountdown)
+		r.Post("/delete", s.DeleteCountdown) // For form submissions
+	})
+
+	r.Route("/combatants/{combatantId}", func(r chi.Router) {
+		r.Post("/hp", s.UpdateCombatantHP)
+		r.Post("/damage", s.DamageCombatant)
+		r.Post("/stress", s.UpdateCombatantStress)
+		r.Post("/features/{featureId}/use", s.UseCombatantFeature)
+		r.Post("/conditions", s.AddCombatantCondition)
+		r.Delete("/conditions/{conditionId}", s.RemoveCombatantCondition)
+		r.Post("/conditions/{conditionId}/public", s.SetConditionPublic)
+		r.Post("/conditions/{conditionId}/delete", s.RemoveCombatantCondition) // For form submissions
+		r.Post("/activate", s.ActivateCombatant)
+		r.Delete("/", s.RemoveCombatant)
+		r.Post("/delete", s.RemoveCombatant) // For form submissions
+	})
+
+	return r
+}
+
+// ViewCombat returns the combat tracker of an encounter
+func (s *Server) ViewCombat(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid encounter ID", http.StatusBadRequest)
+		return
+	}
+
+	s.renderCombatTracker(w, r, id, "")
+}
+
+// StartCombat starts a combat session for an encounter. Starting an
+// encounter that is already in combat leaves the running session untouched.
+func (s *Server) StartCombat(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Get encounter ID from URL
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid encounter ID", http.StatusBadRequest)
+		return
+	}
+
+	// Get encounter from database
+	encounter, err := s.Encounters.GetEncounter(ctx, id)
+	if err != nil {
+		slog.Error("Failed to get encounter", "error", err, "id", id)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if encounter == nil {
+		http.Error(w, "Encounter not found", http.StatusNotFound)
+		return
+	}
+
+	session, err := db.GetActiveCombatSession(ctx, s.DB, id)
+	if err != nil {
+		slog.Error("Failed to get combat session", "error", err, "encounter_id", id)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if session == nil {
+		if len(encounter.Adversaries) == 0 {
+			http.Error(w, "Encounter has no adversaries", http.StatusBadRequest)
+			return
+		}
+
+		if _, err := s.startCombat(r, encounter); err != nil {
+			slog.Error("Failed to start combat session", "error", err, "encounter_id", id)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	s.renderCombatTracker(w, r, id, "")
+}
+
+// EndCombat ends the running combat session of an encounter
+func (s *Server) EndCombat(w http.ResponseWriter, r *http.Request) {
+	id, session, ok := s.loadActiveSession(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.endCombat(r, id, session.ID); err != nil {
+		slog.Error("Failed to end combat session", "error", err, "id", session.ID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.renderCombatTracker(w, r, id, "")
+}
+
+// UpdateCombatantHP marks or clears HP on a combatant. A positive delta
+// marks HP, a negative one clears it.
+func (s *Server) UpdateCombatantHP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	encounterID, _, combatant, ok := s.loadActiveCombatant(w, r)
+	if !ok {
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	delta, err := strconv.Atoi(r.FormValue("delta"))
+	if err != nil {
+		http.Error(w, "Invalid HP delta", http.StatusBadRequest)
+		return
+	}
+
+	// Clamp to the HP track
+	err = s.changeCombat(r, encounterID, combatant.SessionID, CombatEventHP, func(tx *sql.Tx) error {
+		return db.ChangeCombatant(ctx, tx, combatant, func(c *db.Combatant) {
+			c.HPMarked += delta
+			if c.HPMarked < 0 {
+				c.HPMarked = 0
+			}
+			if c.HPMarked > c.HPMax {
+				c.HPMarked = c.HPMax
+			}
+		})
+	})
+	if err != nil {
+		slog.Error("Failed to update combatant", "error", err, "id", combatant.ID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.renderCombatTracker(w, r, encounterID, "")
+}
+
+// DamageCombatant resolves a hit against a combatant's thresholds and marks
+// the resulting HP
+func (s *Server) DamageCombatant(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	encounterID, _, combatant, ok := s.loadActiveCombatant(w, r)
+	if !ok {
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	amount, err := strconv.Atoi(r.FormValue("damage"))
+	if err != nil || amount < 0 {
+		http.Error(w, "Damage must be a non-negative number", http.StatusBadRequest)
+		return
+	}
+
+	damage := combat.Damage{
+		Amount:        amount,
+		Direct:        r.FormValue("direct") != "",
+		Resistance:    r.FormValue("resistance") != "",
+		Immunity:      r.FormValue("immunity") != "",
+		MassiveDamage: r.FormValue("massive_damage") != "",
+	}
+
+	// Resolve against the HP marked when the hit lands
+	var outcome combat.Outcome
+	err = s.changeCombat(r, encounterID, combatant.SessionID, CombatEventHP, func(tx *sql.Tx) error {
+		return db.ChangeCombatant(ctx, tx, combatant, func(c *db.Combatant) {
+			outcome = combat.ResolveDamage(c, damage)
+			c.HPMarked = outcome.HPMarked
+		})
+	})
+	if err != nil {
+		slog.Error("Failed to update combatant", "error", err, "id", combatant.ID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.renderCombatTracker(w, r, encounterID, outcome.Explanation)
+}
+
+// RemoveCombatant takes a combatant out of the running combat session
+func (s *Server) RemoveCombatant(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	encounterID, _, combatant, ok := s.loadActiveCombatant(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.changeCombat(r, encounterID, combatant.SessionID, CombatEventCombatant, func(tx *sql.Tx) error {
+		return db.DeleteCombatant(ctx, tx, combatant)
+	})
+	if err != nil {
+		slog.Error("Failed to delete combatant", "error", err, "id", combatant.ID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.renderCombatTracker(w, r, encounterID, "")
+}
+
+// loadActiveSession resolves the running combat session of the encounter in
+// the URL. It writes an error response and returns false if there is none.
+func (s *Server) loadActiveSession(w http.ResponseWriter, r *http.Request) (int64, *db.CombatSession, bool) {
+	encounterID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid encounter ID", http.StatusBadRequest)
+		return 0, nil, false
+	}
+
+	session, err := db.GetActiveCombatSession(r.Context(), s.DB, encounterID)
+	if err != nil {
+		slog.Error("Failed to get combat session", "error", err, "encounter_id", encounterID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return 0, nil, false
+	}
+
+	if session == nil {
+		http.Error(w, "Encounter is not in combat", http.StatusNotFound)
+		return 0, nil, false
+	}
+
+	return encounterID, session, true
+}
+
+// loadActiveCombatant resolves the combatant in the URL, making sure it
+// belongs to the running combat session of the encounter in the URL. It
+// writes an error response and returns false if it does not.
+func (s *Server) loadActiveCombatant(w http.ResponseWriter, r *http.Request) (int64, *db.CombatSession, *db.Combatant, bool) {
+	encounterID, session, ok := s.loadActiveSession(w, r)
+	if !ok {
+		return 0, nil, nil, false
+	}
+
+	combatantID, err := strconv.ParseInt(chi.URLParam(r, "combatantId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid combatant ID", http.StatusBadRequest)
+		return 0, nil, nil, false
+	}
+
+	combatant, err := db.GetCombatantByID(r.Context(), s.DB, combatantID)
+	if err != nil {
+		slog.Error("Failed to get combatant", "error", err, "id", combatantID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return 0, nil, nil, false
+	}
+
+	if combatant == nil || combatant.SessionID != session.ID {
+		http.Error(w, "Combatant not found", http.StatusNotFound)
+		return 0, nil, nil, false
+	}
+
+	return encounterID, session, combatant, true
+}
+
+// renderCombatTracker responds to a combat change. HTMX requests get the
+// refreshed tracker partial, with an optional notice describing what just
+// happened; regular form submissions are redirected back to the encounter
+// page.
+func (s *Server) renderCombatTracker(w http.ResponseWriter, r *http.Request, encounterID int64, notice string) {
+	s.renderCombatPartial(w, r, encounterID, "combat-tracker", notice)
+}
+
+// renderCombatPartial renders one of the partials in
+// templates/encounters/combat.html for an HTMX request, or redirects to the
+// encounter page otherwise
+func (s *Server) renderCombatPartial(w http.ResponseWriter, r *http.Request, encounterID int64, name, notice string) {
+	ctx := r.Context()
+	idStr := strconv.FormatInt(encounterID, 10)
+
+	if r.Header.Get("HX-Request") != "true" {
+		http.Redirect(w, r, "/encounters/"+idStr, http.StatusSeeOther)
+		return
+	}
+
+	encounter, err := s.Encounters.GetEncounter(ctx, encounterID)
+	if err != nil {
+		slog.Error("Failed to get encounter", "error", err, "id", encounterID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if encounter == nil {
+		http.Error(w, "Encounter not found", http.StatusNotFound)
+		return
+	}
+
+	data, err := s.loadCombatData(ctx, encounter)
+	if err != nil {
+		slog.Error("Failed to load combat tracker", "error", err, "encounter_id", encounterID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	data["Notice"] = notice
+
+	// Partials without the combat log have it reload itself
+	if name != "combat-tracker" && name != "combat-log" {
+		w.Header().Set("HX-Trigger", combatLogEvent)
+	}
+
+	// Parse template
+	tmpl, err := template.ParseFiles(
+		filepath.Join("templates", "encounters", "combat.html"),
+	)
+	if err != nil {
+		slog.Error("Failed to parse template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tmpl.ExecuteTemplate(w, name, data); err != nil {
+		slog.Error("Failed to execute template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// loadCombatData gathers the template data of the combat tracker partials
+// for an encounter
+func (s *Server) loadCombatData(ctx context.Context, encounter *db.Encounter) (map[string]interface{}, error) {
+	data := map[string]interface{}{
+		"Encounter":          encounter,
+		"StandardConditions": db.StandardConditions,
+	}
+
+	session, err := db.GetActiveCombatSession(ctx, s.DB, encounter.ID)
+	if err != nil {
+		return nil, err
+	}
+	reports, err := db.GetCombatReports(ctx, s.DB, encounter.ID)
+	if err != nil {
+		return nil, err
+	}
+	data["Reports"] = reports
+
+	data["Session"] = session
+	if session == nil {
+		return data, nil
+	}
+
+	fearLog, err := db.GetFearLog(ctx, s.DB, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	data["FearLog"] = fearLog
+
+	combatLog, err := db.GetCombatLog(ctx, s.DB, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	data["CombatLog"] = combatLog
+	data["CanUndo"], data["CanRedo"] = false, false
+	for _, e := range combatLog {
+		if e.UndoSteps > 0 {
+			data["CanUndo"] = true
+		}
+		if e.RedoSteps > 0 {
+			data["CanRedo"] = true
+		}
+	}
+
+	features, err := db.GetSessionFeatures(ctx, s.DB, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	data["Features"] = features
+	data["CombatantFeatures"] = combatantFeatures(session, features)
+	data["ActivationCost"] = combat.ActivationCost(session)
+	data["TrackerModes"] = db.TrackerModes
+
+	return data, nil
+}
+
+// combatantFeatures lists, for each combatant by ID, the features of its
+// adversary that cost Stress, which the combatant uses from its own row of
+// the tracker
+func combatantFeatures(session *db.CombatSession, features []*db.SessionFeature) map[int64][]*db.SessionFeature {
+	byCombatant := make(map[int64][]*db.SessionFeature)
+	for _, c := range session.Combatants {
+		if c.AdversaryID == nil {
+			continue
+		}
+		for _, f := range features {
+			if f.AdversaryID == *c.AdversaryID && f.StressCost > 0 {
+				byCombatant[c.ID] = append(byCombatant[c.ID], f)
+			}
+		}
+	}
+	return byCombatant
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/juthrbog/adversarytracker/db"
+)
+
+// AddCombatantCondition puts a standard condition or a custom named effect on
+// a combatant
+func (s *Server) AddCombatantCondition(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	encounterID, _, combatant, ok := s.loadActiveCombatant(w, r)
+	if !ok {
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	cond := &db.CombatantCondition{
+		CombatantID: combatant.ID,
+		Name:        db.NormalizeConditionName(r.FormValue("name")),
+		Expires:     r.FormValue("expires"),
+		Public:      r.FormValue("public") != "",
+	}
+	if cond.Expires == "" {
+		cond.Expires = db.ExpiresUntilCleared
+	}
+
+	if cond.Name == "" {
+		http.Error(w, "Condition name is required", http.StatusBadRequest)
+		return
+	}
+	if len(cond.Name) > db.MaxConditionNameLength {
+		http.Error(w, "Condition name is too long", http.StatusBadRequest)
+		return
+	}
+	if !db.IsValidConditionExpiry(cond.Expires) {
+		http.Error(w, "Invalid condition expiry", http.StatusBadRequest)
+		return
+	}
+
+	err := s.changeCombat(r, encounterID, combatant.SessionID, CombatEventCondition, func(tx *sql.Tx) error {
+		return db.AddCombatantCondition(ctx, tx, cond)
+	})
+	if err != nil {
+		slog.Error("Failed to add combatant condition", "error", err, "combatant_id", combatant.ID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.renderCombatTracker(w, r, encounterID, "")
+}
+
+// RemoveCombatantCondition clears a condition from a combatant
+func (s *Server) RemoveCombatantCondition(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	encounterID, combatant, cond, ok := s.loadCombatantCondition(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.changeCombat(r, encounterID, combatant.SessionID, CombatEventCondition, func(tx *sql.Tx) error {
+		return db.DeleteCombatantCondition(ctx, tx, cond.ID)
+	})
+	if err != nil {
+		slog.Error("Failed to delete combatant condition", "error", err, "id", cond.ID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.renderCombatTracker(w, r, encounterID, "")
+}
+
+// SetConditionPublic shows a combatant's condition on the player view, or
+// hides it
+func (s *Server) SetConditionPublic(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	encounterID, combatant, cond, ok := s.loadCombatantCondition(w, r)
+	if !ok {
+		return
+	}
+
+	public, err := strconv.ParseBool(r.FormValue("public"))
+	if err != nil {
+		http.Error(w, "Invalid visibility", http.StatusBadRequest)
+		return
+	}
+
+	err = s.changeCombat(r, encounterID, combatant.SessionID, CombatEventCondition, func(tx *sql.Tx) error {
+		return db.SetCombatantConditionPublic(ctx, tx, cond.ID, public)
+	})
+	if err != nil {
+		slog.Error("Failed to set condition visibility", "error", err, "id", cond.ID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.renderCombatTracker(w, r, encounterID, "")
+}
+
+// loadCombatantCondition loads the condition in the URL, making sure it
+// belongs to the combatant in the URL. On failure it writes the error
+// response and returns ok false.
+func (s *Server) loadCombatantCondition(w http.ResponseWriter, r *http.Request) (encounterID int64, combatant *db.Combatant, cond *db.CombatantCondition, ok bool) {
+	encounterID, _, combatant, ok = s.loadActiveCombatant(w, r)
+	if !ok {
+		return 0, nil, nil, false
+	}
+
+	conditionID, err := strconv.ParseInt(chi.URLParam(r, "conditionId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid condition ID", http.StatusBadRequest)
+		return 0, nil, nil, false
+	}
+
+	cond, err = db.GetCombatantConditionByID(r.Context(), s.DB, conditionID)
+	if err != nil {
+		slog.Error("Failed to get combatant condition", "error", err, "id", conditionID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return 0, nil, nil, false
+	}
+
+	if cond == nil || cond.CombatantID != combatant.ID {
+		http.Error(w, "Condition not found", http.StatusNotFound)
+		return 0, nil, nil, false
+	}
+
+	return encounterID, combatant, cond, true
+}
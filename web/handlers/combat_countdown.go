@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/juthrbog/adversarytracker/db"
+	"github.com/juthrbog/adversarytracker/internal/combat"
+)
+
+// CountdownFiredEvent is the HTMX event triggered on the client when one or
+// more countdowns reach zero
+const CountdownFiredEvent = "countdownFired"
+
+// CreateCountdown starts a countdown in a running combat session, attached to
+// the whole session or to one combatant. A countdown started from an
+// adversary feature defaults to the feature's name and countdown value.
+func (s *Server) CreateCountdown(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	encounterID, session, ok := s.loadActiveSession(w, r)
+	if !ok {
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	countdown := &db.Countdown{
+		SessionID: session.ID,
+		Name:      strings.TrimSpace(r.FormValue("name")),
+		Kind:      formValueOr(r, "kind", db.CountdownStandard),
+		Purpose:   formValueOr(r, "purpose", db.CountdownConsequence),
+		TickOn:    formValueOr(r, "tick_on", db.TickOnRoll),
+		Looping:   r.FormValue("looping") != "",
+		Public:    r.FormValue("public") != "",
+	}
+	countdown.StartValue, _ = strconv.Atoi(r.FormValue("start"))
+
+	if combatantIDStr := r.FormValue("combatant_id"); combatantIDStr != "" {
+		combatantID, err := strconv.ParseInt(combatantIDStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid combatant ID", http.StatusBadRequest)
+			return
+		}
+
+		inSession := false
+		for _, c := range session.Combatants {
+			if c.ID == combatantID {
+				inSession = true
+				break
+			}
+		}
+		if !inSession {
+			http.Error(w, "Combatant not found", http.StatusNotFound)
+			return
+		}
+		countdown.CombatantID = &combatantID
+	}
+
+	if featureIDStr := r.FormValue("feature_id"); featureIDStr != "" {
+		featureID, err := strconv.ParseInt(featureIDStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid feature ID", http.StatusBadRequest)
+			return
+		}
+
+		features, err := db.GetSessionFeatures(ctx, s.DB, session.ID)
+		if err != nil {
+			slog.Error("Failed to get session features", "error", err, "session_id", session.ID)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		var feature *db.SessionFeature
+		for _, f := range features {
+			if f.ID == featureID {
+				feature = f
+				break
+			}
+		}
+		if feature == nil {
+			http.Error(w, "Feature not found", http.StatusNotFound)
+			return
+		}
+
+		countdown.FeatureID = &feature.ID
+		if countdown.Name == "" {
+			countdown.Name = feature.AdversaryName + ": " + feature.Name
+		}
+		if countdown.StartValue == 0 {
+			countdown.StartValue = feature.Countdown
+		}
+	}
+
+	if countdown.Name == "" {
+		http.Error(w, "Countdown name is required", http.StatusBadRequest)
+		return
+	}
+	if countdown.StartValue < 1 {
+		http.Error(w, "Countdown must start at 1 or more", http.StatusBadRequest)
+		return
+	}
+	if !db.IsValidCountdown(countdown) {
+		http.Error(w, "Invalid countdown kind, purpose or trigger", http.StatusBadRequest)
+		return
+	}
+
+	err := s.changeCombat(r, encounterID, session.ID, CombatEventCountdown, func(tx *sql.Tx) error {
+		_, err := db.CreateCountdown(ctx, tx, countdown)
+		return err
+	})
+	if err != nil {
+		slog.Error("Failed to create countdown", "error", err, "session_id", session.ID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.renderCombatTracker(w, r, encounterID, "")
+}
+
+// ReportRoll ticks every countdown that advances on action rolls. Dynamic
+// countdowns advance according to the roll result.
+func (s *Server) ReportRoll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	encounterID, session, ok := s.loadActiveSession(w, r)
+	if !ok {
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	result := r.FormValue("result")
+	if !combat.IsValidRollResult(result) {
+		http.Error(w, "Invalid roll result", http.StatusBadRequest)
+		return
+	}
+
+	var fired []*db.Countdown
+	err := s.changeCombat(r, encounterID, session.ID, CombatEventCountdown, func(tx *sql.Tx) error {
+		countdowns, err := db.GetCountdowns(ctx, tx, session.ID)
+		if err != nil {
+			return err
+		}
+
+		fired, err = db.TickCountdowns(ctx, tx, combat.RollTicks(countdowns, result))
+		return err
+	})
+	if err != nil {
+		slog.Error("Failed to tick countdowns", "error", err, "session_id", session.ID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.renderCombatTracker(w, r, encounterID, triggerCountdownsFired(w, fired))
+}
+
+// TickCountdown ticks a single countdown down by one
+func (s *Server) TickCountdown(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	encounterID, countdown, ok := s.loadSessionCountdown(w, r)
+	if !ok {
+		return
+	}
+
+	var fired []*db.Countdown
+	err := s.changeCombat(r, encounterID, countdown.SessionID, CombatEventCountdown, func(tx *sql.Tx) error {
+		var err error
+		fired, err = db.TickCountdowns(ctx, tx, map[int64]int{countdown.ID: 1})
+		return err
+	})
+	if err != nil {
+		slog.Error("Failed to tick countdown", "error", err, "id", countdown.ID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.renderCombatTracker(w, r, encounterID, triggerCountdownsFired(w, fired))
+}
+
+// ResetCountdown puts a countdown back to its start value
+func (s *Server) ResetCountdown(w http.ResponseWriter, r *http.Request) {
+	encounterID, countdown, ok := s.loadSessionCountdown(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.changeCombat(r, encounterID, countdown.SessionID, CombatEventCountdown, func(tx *sql.Tx) error {
+		return db.ResetCountdown(r.Context(), tx, countdown.ID)
+	})
+	if err != nil {
+		slog.Error("Failed to reset countdown", "error", err, "id", countdown.ID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.renderCombatTracker(w, r, encounterID, "")
+}
+
+// SetCountdownPublic shows a countdown on the player view, or hides it again
+func (s *Server) SetCountdownPublic(w http.ResponseWriter, r *http.Request) {
+	encounterID, countdown, ok := s.loadSessionCountdown(w, r)
+	if !ok {
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	public, err := strconv.ParseBool(r.FormValue("public"))
+	if err != nil {
+		http.Error(w, "Public must be true or false", http.StatusBadRequest)
+		return
+	}
+
+	err = s.changeCombat(r, encounterID, countdown.SessionID, CombatEventCountdown, func(tx *sql.Tx) error {
+		return db.SetCountdownPublic(r.Context(), tx, countdown.ID, public)
+	})
+	if err != nil {
+		slog.Error("Failed to set countdown visibility", "error", err, "id", countdown.ID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.renderCombatTracker(w, r, encounterID, "")
+}
+
+// DeleteCountdown removes a countdown from the combat session
+func (s *Server) DeleteCountdown(w http.ResponseWriter, r *http.Request) {
+	encounterID, countdown, ok := s.loadSessionCountdown(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.changeCombat(r, encounterID, countdown.SessionID, CombatEventCountdown, func(tx *sql.Tx) error {
+		return db.DeleteCountdown(r.Context(), tx, countdown.ID)
+	})
+	if err != nil {
+		slog.Error("Failed to delete countdown", "error", err, "id", countdown.ID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.renderCombatTracker(w, r, encounterID, "")
+}
+
+// tickActionCountdowns ticks the countdowns that advance when a combatant
+// takes the spotlight, and returns those that fired
+func tickActionCountdowns(ctx context.Context, tx *sql.Tx, combatant *db.Combatant) ([]*db.Countdown, error) {
+	countdowns, err := db.GetCountdowns(ctx, tx, combatant.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.TickCountdowns(ctx, tx, combat.ActionTicks(countdowns, combatant.ID))
+}
+
+// triggerCountdownsFired fires the countdownFired event on the client for
+// countdowns that reached zero, and returns a notice naming them
+func triggerCountdownsFired(w http.ResponseWriter, fired []*db.Countdown) string {
+	if len(fired) == 0 {
+		return ""
+	}
+
+	names := make([]string, len(fired))
+	for i, c := range fired {
+		names[i] = c.Name
+	}
+
+	event, err := json.Marshal(map[string]interface{}{
+		CountdownFiredEvent: map[string]interface{}{"names": names},
+	})
+	if err == nil {
+		w.Header().Set("HX-Trigger", string(event))
+	}
+
+	return "Countdown reached zero: " + strings.Join(names, ", ") + "."
+}
+
+// loadSessionCountdown resolves the countdown in the URL, making sure it
+// belongs to the running combat session of the encounter in the URL. It
+// writes an error response and returns false if it does not.
+func (s *Server) loadSessionCountdown(w http.ResponseWriter, r *http.Request) (int64, *db.Countdown, bool) {
+	encounterID, session, ok := s.loadActiveSession(w, r)
+	if !ok {
+		return 0, nil, false
+	}
+
+	countdownID, err := strconv.ParseInt(chi.URLParam(r, "countdownId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid countdown ID", http.StatusBadRequest)
+		return 0, nil, false
+	}
+
+	countdown, err := db.GetCountdownByID(r.Context(), s.DB, countdownID)
+	if err != nil {
+		slog.Error("Failed to get countdown", "error", err, "id", countdownID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return 0, nil, false
+	}
+
+	if countdown == nil || countdown.SessionID != session.ID {
+		http.Error(w, "Countdown not found", http.StatusNotFound)
+		return 0, nil, false
+	}
+
+	return encounterID, countdown, true
+}
+
+// formValueOr returns a form value, or def when it is empty
+func formValueOr(r *http.Request, key, def string) string {
+	if v := r.FormValue(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/juthrbog/adversarytracker/db"
+	"github.com/juthrbog/adversarytracker/internal/events"
+)
+
+// Combat event types, sent as the names of the events streamed by
+// CombatEvents. Every event carries the combat session as it stands after
+// the change, or null once there is none.
+const (
+	CombatEventSession   = "session"   // combat started or ended
+	CombatEventHP        = "hp"        // HP marked or cleared on a combatant
+	CombatEventStress    = "stress"    // Stress marked or cleared, or a feature used
+	CombatEventCombatant = "combatant" // a combatant left the fight
+	CombatEventCondition = "condition" // a condition added or cleared
+	CombatEventCountdown = "countdown" // a countdown created, ticked, reset or removed
+	CombatEventFear      = "fear"      // Fear gained or spent, or its cap changed
+	CombatEventSpotlight = "spotlight" // spotlight, tracker mode, action tokens or an activation
+	CombatEventUndo      = "undo"      // changes undone or redone from the combat log
+	CombatEventReset     = "reset"     // sent in place of missed events that cannot be replayed
+)
+
+// trackerEvents are the event types after which the encounter page reloads
+// its whole combat tracker; Fear events only reload the Fear tracker
+var trackerEvents = []string{
+	CombatEventSession,
+	CombatEventHP,
+	CombatEventStress,
+	CombatEventCombatant,
+	CombatEventCondition,
+	CombatEventCountdown,
+	CombatEventSpotlight,
+	CombatEventUndo,
+	CombatEventReset,
+}
+
+// TrackerClientHeader names the open combat tracker a change comes from.
+// The tracker's own event stream leaves out its changes, since it already
+// shows them.
+const TrackerClientHeader = "X-Tracker-Client"
+
+const (
+	// combatEventsHistory is how many events of each encounter are kept
+	// for clients that reconnect
+	combatEventsHistory = 100
+	// combatEventsRetry is how long clients wait before reconnecting
+	combatEventsRetry = 2 * time.Second
+	// combatEventsHeartbeat is how often an idle stream sends a comment, to
+	// keep proxies from closing it
+	combatEventsHeartbeat = 25 * time.Second
+)
+
+// NewCombatEvents returns the hub that streams combat changes, keeping
+// enough of each encounter's events for clients to catch up after a
+// dropped connection
+func NewCombatEvents() *events.Hub {
+	return events.NewHub(combatEventsHistory)
+}
+
+// newTrackerClient names a newly opened combat tracker, for
+// TrackerClientHeader
+func newTrackerClient() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// combatTopic is the hub topic of an encounter's combat. Streams follow the
+// encounter rather than a session, so they carry on as fights start and end.
+func combatTopic(encounterID int64) string {
+	return strconv.FormatInt(encounterID, 10)
+}
+
+// publishCombat streams a change to a combat session to every client
+// following the encounter. The change is already saved, so failing to
+// publish it is logged rather than failing the request.
+func (s *Server) publishCombat(r *http.Request, encounterID, sessionID int64, eventType string) {
+	// Publish even if the client that made the change has gone away
+	ctx := context.WithoutCancel(r.Context())
+
+	session, err := db.GetCombatSessionByID(ctx, s.DB, sessionID)
+	if err != nil {
+		slog.Error("Failed to get combat session", "error", err, "id", sessionID)
+		return
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		slog.Error("Failed to encode combat event", "error", err, "id", sessionID)
+		return
+	}
+
+	s.Events.Publish(combatTopic(encounterID), events.Event{
+		Type:   eventType,
+		Data:   data,
+		Source: r.Header.Get(TrackerClientHeader),
+	})
+}
+
+// CombatEvents streams the combat changes of an encounter as Server-Sent
+// Events. A client reconnecting with Last-Event-ID gets the events it
+// missed, or a reset event with the current session when they are no
+// longer kept. Events caused by the tracker named in the client query
+// parameter are left out.
+func (s *Server) CombatEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid encounter ID", http.StatusBadRequest)
+		return
+	}
+
+	encounter, err := s.Encounters.GetEncounter(ctx, id)
+	if err != nil {
+		slog.Error("Failed to get encounter", "error", err, "id", id)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if encounter == nil {
+		http.Error(w, "Encounter not found", http.StatusNotFound)
+		return
+	}
+
+	reset := func(ctx context.Context) ([]byte, error) {
+		session, err := db.GetActiveCombatSession(ctx, s.DB, id)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(session)
+	}
+
+	client := r.URL.Query().Get("client")
+	filter := func(ev events.Event) (events.Event, bool) {
+		return ev, client == "" || ev.Source != client
+	}
+
+	s.streamCombat(w, r, id, reset, filter)
+}
+
+// streamCombat streams the combat events of an encounter to one client.
+// reset loads the data of the reset event sent when missed events cannot be
+// replayed. filter turns each event into what the client is sent, or leaves
+// it out by returning false; events left out only move the client's last
+// event ID on.
+func (s *Server) streamCombat(w http.ResponseWriter, r *http.Request, encounterID int64, reset func(ctx context.Context) ([]byte, error), filter func(events.Event) (events.Event, bool)) {
+	ctx := r.Context()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		slog.Error("Response does not support streaming", "encounter_id", encounterID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Subscribe before loading the data for a reset, so that no change
+	// falls between the two
+	sub := s.Events.Subscribe(combatTopic(encounterID), r.Header.Get("Last-Event-ID"))
+	defer sub.Cancel()
+
+	var resetData []byte
+	if !sub.Complete {
+		var err error
+		if resetData, err = reset(ctx); err != nil {
+			slog.Error("Failed to load combat for a reset event", "error", err, "encounter_id", encounterID)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", combatEventsRetry.Milliseconds())
+
+	send := func(ev events.Event) {
+		if ev, ok := filter(ev); ok {
+			writeEvent(w, ev)
+		} else {
+			fmt.Fprintf(w, "id: %s\n\n", ev.ID)
+		}
+	}
+
+	// Catch up, and make sure the client resumes from the latest event if
+	// it reconnects before the next one
+	switch {
+	case !sub.Complete:
+		writeEvent(w, events.Event{ID: sub.LastID, Type: CombatEventReset, Data: resetData})
+	case len(sub.Replay) == 0:
+		fmt.Fprintf(w, "id: %s\n\n", sub.LastID)
+	default:
+		for _, ev := range sub.Replay {
+			send(ev)
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(combatEventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-sub.Events:
+			// The stream fell too far behind or the server is shutting
+			// down; the client reconnects and catches up
+			if !ok {
+				return
+			}
+			send(ev)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes an event in the text/event-stream format
+func writeEvent(w http.ResponseWriter, ev events.Event) {
+	fmt.Fprintf(w, "id: %s\nevent: %s\n", ev.ID, ev.Type)
+	for _, line := range strings.Split(string(ev.Data), "\n") {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	fmt.Fprint(w, "\n")
+}
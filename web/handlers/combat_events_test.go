@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/juthrbog/adversarytracker/db"
+	"github.com/juthrbog/adversarytracker/internal/combat"
+)
+
+// sseEvent is one event read from a combat event stream. Events that only
+// move the last event ID on have no type.
+type sseEvent struct {
+	ID   string
+	Type string
+	Data string
+}
+
+// session decodes the combat session an event carries
+func (ev sseEvent) session(t *testing.T) *db.CombatSession {
+	t.Helper()
+
+	var session *db.CombatSession
+	if err := json.Unmarshal([]byte(ev.Data), &session); err != nil {
+		t.Fatalf("decoding %s event: %v", ev.Type, err)
+	}
+	return session
+}
+
+// eventStream is an open combat event stream
+type eventStream struct {
+	events chan sseEvent
+}
+
+// startCombatTestServer serves the encounter and player routes of a combat
+// test server
+func startCombatTestServer(t *testing.T) (*httptest.Server, *Server) {
+	t.Helper()
+
+	s := newCombatServer(t)
+	r := chi.NewRouter()
+	r.Mount("/encounters", s.EncounterRoutes())
+	r.Mount("/play", s.PlayerRoutes())
+	ts := httptest.NewServer(r)
+	t.Cleanup(ts.Close)
+	return ts, s
+}
+
+// trackerEventsPath is the event stream path of the forest encounter for the
+// named tracker
+func trackerEventsPath(client string) string {
+	return fmt.Sprintf("/encounters/%d/combat/events?client=%s", forestID, client)
+}
+
+// openEventStream opens an event stream, resuming after lastID if it is
+// set. The stream is closed when the test ends.
+func openEventStream(t *testing.T, ts *httptest.Server, path, lastID string) *eventStream {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastID != "" {
+		r.Header.Set("Last-Event-ID", lastID)
+	}
+
+	resp, err := ts.Client().Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		resp.Body.Close()
+	})
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("event stream status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("event stream content type %q", ct)
+	}
+
+	stream := &eventStream{events: make(chan sseEvent, 100)}
+	go func() {
+		defer close(stream.events)
+
+		var ev sseEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			field, value, _ := strings.Cut(scanner.Text(), ": ")
+			switch field {
+			case "id":
+				ev.ID = value
+			case "event":
+				ev.Type = value
+			case "data":
+				ev.Data += value
+			case "":
+				// Skip the retry delay and heartbeats
+				if ev.ID != "" {
+					stream.events <- ev
+				}
+				ev = sseEvent{}
+			}
+		}
+	}()
+	return stream
+}
+
+// next returns the next event of a stream
+func (s *eventStream) next(t *testing.T) sseEvent {
+	t.Helper()
+
+	select {
+	case ev, ok := <-s.events:
+		if !ok {
+			t.Fatal("event stream closed")
+		}
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return sseEvent{}
+}
+
+// expect reads the next event of a stream and checks its type
+func (s *eventStream) expect(t *testing.T, eventType string) sseEvent {
+	t.Helper()
+
+	ev := s.next(t)
+	if ev.Type != eventType {
+		t.Fatalf("got %q event, want %q", ev.Type, eventType)
+	}
+	return ev
+}
+
+// postCombat sends an HTMX form submission to the forest's combat routes as
+// the named tracker, and fails the test unless it succeeds
+func postCombat(t *testing.T, ts *httptest.Server, client, path string, form url.Values) {
+	t.Helper()
+
+	if status, body := sendCombat(t, ts, client, path, form); status != http.StatusOK {
+		t.Fatalf("POST %s: status %d, want %d\n%s", path, status, http.StatusOK, body)
+	}
+}
+
+// sendCombat sends an HTMX form submission to the forest's combat routes as
+// the named tracker, and returns the response status and body
+func sendCombat(t *testing.T, ts *httptest.Server, client, path string, form url.Values) (int, string) {
+	t.Helper()
+
+	target := fmt.Sprintf("%s/encounters/%d/combat%s", ts.URL, forestID, path)
+	r, err := http.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("HX-Request", "true")
+	if client != "" {
+		r.Header.Set(TrackerClientHeader, client)
+	}
+
+	resp, err := ts.Client().Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+// postCombatAtOnce sends n HTMX form submissions to the forest's combat
+// routes at the same time, and waits for every one to succeed
+func postCombatAtOnce(t *testing.T, ts *httptest.Server, path string, form url.Values, n int) {
+	t.Helper()
+
+	paths := make([]string, n)
+	for i := range paths {
+		paths[i] = path
+	}
+	postCombatEachAtOnce(t, ts, paths, form)
+}
+
+// postCombatEachAtOnce sends an HTMX form submission to each of the given
+// combat routes of the forest at the same time, and waits for every one to
+// succeed
+func postCombatEachAtOnce(t *testing.T, ts *httptest.Server, paths []string, form url.Values) {
+	t.Helper()
+
+	errs := make(chan error, len(paths))
+	for _, path := range paths {
+		go func(path string) {
+			target := fmt.Sprintf("%s/encounters/%d/combat%s", ts.URL, forestID, path)
+			r, err := http.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+			if err != nil {
+				errs <- err
+				return
+			}
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.Header.Set("HX-Request", "true")
+
+			resp, err := ts.Client().Do(r)
+			if err != nil {
+				errs <- fmt.Errorf("POST %s: %w", path, err)
+				return
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				body, _ := io.ReadAll(resp.Body)
+				errs <- fmt.Errorf("POST %s: status %d\n%s", path, resp.StatusCode, body)
+				return
+			}
+			errs <- nil
+		}(path)
+	}
+
+	for range paths {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// fetch sends a GET request to a test server, as an HTMX request if htmx is
+// set, and returns the response status and body
+func fetch(t *testing.T, ts *httptest.Server, path string, htmx bool) (int, string) {
+	t.Helper()
+
+	r, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if htmx {
+		r.Header.Set("HX-Request", "true")
+	}
+
+	resp, err := ts.Client().Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestCombatEvents(t *testing.T) {
+	ts, _ := startCombatTestServer(t)
+
+	gm := openEventStream(t, ts, trackerEventsPath("gm"), "")
+	table := openEventStream(t, ts, trackerEventsPath("table"), "")
+	gm.expect(t, "")
+	table.expect(t, "")
+
+	// The tracker that made a change only has its last event ID moved on
+	postCombat(t, ts, "gm", "", nil)
+	started := table.expect(t, CombatEventSession)
+	if own := gm.expect(t, ""); own.ID != started.ID {
+		t.Errorf("own event has ID %s, want %s", own.ID, started.ID)
+	}
+	session := started.session(t)
+	if session == nil || session.Status != db.CombatActive || len(session.Combatants) != 2 {
+		t.Fatalf("session event does not carry the started fight: %s", started.Data)
+	}
+	bear := "/combatants/" + strconv.FormatInt(session.Combatants[0].ID, 10)
+	otherBear := "/combatants/" + strconv.FormatInt(session.Combatants[1].ID, 10)
+
+	postCombat(t, ts, "table", "/fear/gain", url.Values{"amount": {"2"}})
+	if fear := gm.expect(t, CombatEventFear).session(t); fear.Fear != 2 {
+		t.Errorf("fear event carries %d Fear, want 2", fear.Fear)
+	}
+	table.expect(t, "")
+
+	// Trackers reload the Fear tracker on Fear events
+	if status, body := fetch(t, ts, fmt.Sprintf("/encounters/%d/combat/fear", forestID), true); status != http.StatusOK || !strings.Contains(body, `id="fear-tracker"`) {
+		t.Errorf("Fear tracker: status %d\n%s", status, body)
+	}
+
+	changes := []struct {
+		path      string
+		form      url.Values
+		eventType string
+	}{
+		{bear + "/damage", url.Values{"damage": {"20"}}, CombatEventHP},
+		{bear + "/hp", url.Values{"delta": {"-1"}}, CombatEventHP},
+		{bear + "/stress", url.Values{"delta": {"1"}}, CombatEventStress},
+		{bear + "/conditions", url.Values{"name": {"Vulnerable"}}, CombatEventCondition},
+		{"/countdowns", url.Values{"name": {"Collapse"}, "start": {"3"}}, CombatEventCountdown},
+		{"/countdowns/roll", url.Values{"result": {combat.RollFailureFear}}, CombatEventCountdown},
+		{"/spotlight", url.Values{"to": {"gm"}}, CombatEventSpotlight},
+		{otherBear + "/activate", nil, CombatEventSpotlight},
+		{"/mode", url.Values{"mode": {db.TrackerModes[len(db.TrackerModes)-1]}}, CombatEventSpotlight},
+		{"/tokens", url.Values{"delta": {"1"}}, CombatEventSpotlight},
+		{"/fear/max", url.Values{"fear_max": {"6"}}, CombatEventFear},
+		{bear + "/delete", nil, CombatEventCombatant},
+		{"/end", nil, CombatEventSession},
+	}
+	for _, c := range changes {
+		postCombat(t, ts, "", c.path, c.form)
+		gm.expect(t, c.eventType)
+		table.expect(t, c.eventType)
+	}
+}
+
+func TestCombatEventsReplay(t *testing.T) {
+	ts, _ := startCombatTestServer(t)
+
+	// A tracker follows the fight, then loses its connection
+	first := openEventStream(t, ts, trackerEventsPath("table"), "")
+	postCombat(t, ts, "", "", nil)
+	first.expect(t, "")
+	seen := first.expect(t, CombatEventSession)
+
+	postCombat(t, ts, "gm", "/fear/gain", nil)
+	postCombat(t, ts, "gm", "/spotlight", url.Values{"to": {"gm"}})
+
+	resumed := openEventStream(t, ts, trackerEventsPath("table"), seen.ID)
+	resumed.expect(t, CombatEventFear)
+	last := resumed.expect(t, CombatEventSpotlight)
+
+	// A tracker that cannot catch up is sent the fight as it stands
+	stale := openEventStream(t, ts, trackerEventsPath("table"), "0-1")
+	reset := stale.expect(t, CombatEventReset)
+	if reset.ID != last.ID {
+		t.Errorf("reset event has ID %s, want the latest, %s", reset.ID, last.ID)
+	}
+	if session := reset.session(t); session == nil || session.Fear != 1 || session.Spotlight != db.SpotlightGM {
+		t.Errorf("reset event does not carry the running fight: %s", reset.Data)
+	}
+}
+
+func TestCombatEventsErrors(t *testing.T) {
+	runRouteTests(t, encounterRoutes, []routeTest{
+		{
+			name:   "invalid encounter",
+			method: http.MethodGet,
+			target: "/nope/combat/events",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "missing encounter",
+			method: http.MethodGet,
+			target: "/99/combat/events",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "store failure",
+			method: http.MethodGet,
+			target: "/1/combat/events",
+			setup:  withBrokenEncounters,
+			status: http.StatusInternalServerError,
+		},
+		{
+			name:   "fear tracker out of combat",
+			method: http.MethodGet,
+			target: "/1/combat/fear",
+			htmx:   true,
+			status: http.StatusNotFound,
+		},
+	})
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/juthrbog/adversarytracker/db"
+)
+
+// ViewFear returns the Fear tracker of a running combat session
+func (s *Server) ViewFear(w http.ResponseWriter, r *http.Request) {
+	encounterID, _, ok := s.loadActiveSession(w, r)
+	if !ok {
+		return
+	}
+
+	s.renderCombatPartial(w, r, encounterID, "fear-tracker", "")
+}
+
+// GainFear adds Fear to the GM's pool in a running combat session. Fear
+// gained beyond the cap is lost.
+func (s *Server) GainFear(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	encounterID, session, ok := s.loadActiveSession(w, r)
+	if !ok {
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	amount, ok := parseFearAmount(w, r.FormValue("amount"), 1)
+	if !ok {
+		return
+	}
+
+	err := s.changeCombat(r, encounterID, session.ID, CombatEventFear, func(tx *sql.Tx) error {
+		_, err := db.ChangeFear(ctx, tx, session.ID, amount, r.FormValue("reason"), nil)
+		return err
+	})
+	if err != nil {
+		slog.Error("Failed to gain Fear", "error", err, "session_id", session.ID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.renderCombatPartial(w, r, encounterID, "fear-tracker", "")
+}
+
+// SpendFear spends Fear from the GM's pool, optionally on a feature of one of
+// the adversaries in combat. Spending on a feature defaults to its Fear cost.
+func (s *Server) SpendFear(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	encounterID, session, ok := s.loadActiveSession(w, r)
+	if !ok {
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	defaultAmount := 1
+	var featureID *int64
+	if featureIDStr := r.FormValue("feature_id"); featureIDStr != "" {
+		id, err := strconv.ParseInt(featureIDStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid feature ID", http.StatusBadRequest)
+			return
+		}
+
+		feature, err := s.Adversaries.GetAdversaryFeature(ctx, id)
+		if err != nil {
+			slog.Error("Failed to get adversary feature", "error", err, "id", id)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		// Only features of adversaries in this fight can be paid for
+		inCombat := false
+		if feature != nil {
+			for _, c := range session.Combatants {
+				if c.AdversaryID != nil && *c.AdversaryID == feature.AdversaryID {
+					inCombat = true
+					break
+				}
+			}
+		}
+		if !inCombat {
+			http.Error(w, "Feature not found", http.StatusNotFound)
+			return
+		}
+
+		featureID = &feature.ID
+		if feature.FearCost > 0 {
+			defaultAmount = feature.FearCost
+		}
+	}
+
+	amount, ok := parseFearAmount(w, r.FormValue("amount"), defaultAmount)
+	if !ok {
+		return
+	}
+
+	err := s.changeCombat(r, encounterID, session.ID, CombatEventFear, func(tx *sql.Tx) error {
+		_, err := db.ChangeFear(ctx, tx, session.ID, -amount, r.FormValue("reason"), featureID)
+		return err
+	})
+	if errors.Is(err, db.ErrNotEnoughFear) {
+		http.Error(w, "Not enough Fear", http.StatusConflict)
+		return
+	} else if err != nil {
+		slog.Error("Failed to spend Fear", "error", err, "session_id", session.ID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.renderCombatPartial(w, r, encounterID, "fear-tracker", "")
+}
+
+// SetFearMax changes the cap of the GM's Fear pool in a running combat session
+func (s *Server) SetFearMax(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	encounterID, session, ok := s.loadActiveSession(w, r)
+	if !ok {
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	fearMax, err := strconv.Atoi(r.FormValue("fear_max"))
+	if err != nil || fearMax < 1 {
+		http.Error(w, "Fear cap must be at least 1", http.StatusBadRequest)
+		return
+	}
+
+	err = s.changeCombat(r, encounterID, session.ID, CombatEventFear, func(tx *sql.Tx) error {
+		return db.SetFearMax(ctx, tx, session.ID, fearMax)
+	})
+	if err != nil {
+		slog.Error("Failed to set Fear cap", "error", err, "session_id", session.ID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.renderCombatPartial(w, r, encounterID, "fear-tracker", "")
+}
+
+// parseFearAmount parses a positive Fear amount, using def when it is empty.
+// It writes a 400 response if the amount is invalid.
+func parseFearAmount(w http.ResponseWriter, value string, def int) (int, bool) {
+	if value == "" {
+		return def, true
+	}
+
+	amount, err := strconv.Atoi(value)
+	if err != nil || amount < 1 {
+		http.Error(w, "Fear amount must be at least 1", http.StatusBadRequest)
+		return 0, false
+	}
+
+	return amount, true
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/juthrbog/adversarytracker/db"
+	"github.com/juthrbog/adversarytracker/internal/combat"
+)
+
+// combatLogEvent is the HTMX event that tells the combat log to reload,
+// sent with the partials that do not include it
+const combatLogEvent = "combat-logged"
+
+// changeCombat makes a change to a combat session and logs it in the
+// session's combat log, in one transaction, then streams it to every client
+// following the encounter. It returns the error change fails with, if any.
+func (s *Server) changeCombat(r *http.Request, encounterID, sessionID int64, eventType string, change func(tx *sql.Tx) error) error {
+	_, err := db.ChangeCombat(r.Context(), s.DB, sessionID, eventType, combatActor(r), combat.DescribeChange, change)
+	if err != nil {
+		return err
+	}
+
+	s.publishCombat(r, encounterID, sessionID, eventType)
+	return nil
+}
+
+// startCombat starts a combat session for an encounter and logs the start,
+// in one transaction, then streams it. It returns the new session's ID.
+func (s *Server) startCombat(r *http.Request, encounter *db.Encounter) (int64, error) {
+	ctx := r.Context()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	sessionID, err := db.StartCombatSession(ctx, tx, encounter)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := db.RecordCombatChange(ctx, tx, sessionID, CombatEventSession, combatActor(r), combat.DescribeChange); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	s.publishCombat(r, encounter.ID, sessionID, CombatEventSession)
+	return sessionID, nil
+}
+
+// endCombat ends a combat session, logs the end and writes the fight's
+// report, in one transaction, then streams it. If any of it fails the
+// session is left running.
+func (s *Server) endCombat(r *http.Request, encounterID, sessionID int64) error {
+	ctx := r.Context()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := db.EndCombatSession(ctx, tx, sessionID); err != nil {
+		return err
+	}
+
+	if _, err := db.RecordCombatChange(ctx, tx, sessionID, CombatEventSession, combatActor(r), combat.DescribeChange); err != nil {
+		return err
+	}
+
+	if err := reportCombat(ctx, tx, sessionID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.publishCombat(r, encounterID, sessionID, CombatEventSession)
+	return nil
+}
+
+// combatActor is where a request changing a combat session came from
+func combatActor(r *http.Request) string {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		return db.ActorAPI
+	}
+	return db.ActorTracker
+}
+
+// ViewCombatLog returns the combat log of a running combat session
+func (s *Server) ViewCombatLog(w http.ResponseWriter, r *http.Request) {
+	encounterID, _, ok := s.loadActiveSession(w, r)
+	if !ok {
+		return
+	}
+
+	s.renderCombatPartial(w, r, encounterID, "combat-log", "")
+}
+
+// UndoCombat undoes the latest changes to a running combat session, one by
+// default or as many as the steps form value asks for
+func (s *Server) UndoCombat(w http.ResponseWriter, r *http.Request) {
+	s.travelCombat(w, r, db.CombatLogUndo)
+}
+
+// RedoCombat redoes the latest undone changes to a running combat session,
+// one by default or as many as the steps form value asks for
+func (s *Server) RedoCombat(w http.ResponseWriter, r *http.Request) {
+	s.travelCombat(w, r, db.CombatLogRedo)
+}
+
+// travelCombat undoes or redoes changes to a running combat session,
+// depending on kind, and reloads the tracker
+func (s *Server) travelCombat(w http.ResponseWriter, r *http.Request, kind string) {
+	encounterID, session, ok := s.loadActiveSession(w, r)
+	if !ok {
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	steps := 1
+	if stepsStr := r.FormValue("steps"); stepsStr != "" {
+		var err error
+		steps, err = strconv.Atoi(stepsStr)
+		if err != nil || steps < 1 {
+			http.Error(w, "Invalid number of steps", http.StatusBadRequest)
+			return
+		}
+	}
+
+	travel, verb := db.UndoCombat, "Undid"
+	if kind == db.CombatLogRedo {
+		travel, verb = db.RedoCombat, "Redid"
+	}
+
+	done, err := travel(r.Context(), s.DB, session.ID, db.ActorTracker, steps)
+	if errors.Is(err, db.ErrNothingToUndo) {
+		http.Error(w, "Nothing to undo", http.StatusConflict)
+		return
+	} else if errors.Is(err, db.ErrNothingToRedo) {
+		http.Error(w, "Nothing to redo", http.StatusConflict)
+		return
+	} else if err != nil {
+		slog.Error("Failed to "+kind+" combat changes", "error", err, "session_id", session.ID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	s.publishCombat(r, encounterID, session.ID, CombatEventUndo)
+
+	notice := verb + " 1 change."
+	if done != 1 {
+		notice = verb + " " + strconv.Itoa(done) + " changes."
+	}
+	s.renderCombatTracker(w, r, encounterID, notice)
+}
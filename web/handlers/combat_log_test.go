@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/juthrbog/adversarytracker/db"
+)
+
+// combatLog reads back the summaries of a session's combat log, newest
+// first, with undone entries wrapped in brackets
+func combatLog(t *testing.T, s *Server, sessionID int64) []string {
+	t.Helper()
+
+	entries, err := db.GetCombatLog(context.Background(), s.DB, sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var summaries []string
+	for _, e := range entries {
+		if e.Undone {
+			summaries = append(summaries, "["+e.Summary+"]")
+		} else {
+			summaries = append(summaries, e.Summary)
+		}
+	}
+	return summaries
+}
+
+func TestCombatLog(t *testing.T) {
+	ctx := context.Background()
+	ts, s, session := startPlayerFight(t)
+	bear := fmt.Sprintf("/combatants/%d", session.Combatants[0].ID)
+	otherBear := fmt.Sprintf("/combatants/%d", session.Combatants[1].ID)
+
+	postCombat(t, ts, "", bear+"/damage", url.Values{"damage": {"20"}})
+	postCombat(t, ts, "", bear+"/conditions", url.Values{"name": {"Vulnerable"}})
+	postCombat(t, ts, "", otherBear+"/delete", nil)
+	postCombat(t, ts, "", "/fear/gain", url.Values{"reason": {"a failed roll"}})
+
+	want := []string{
+		"GM gained 1 Fear on a failed roll (1/12)",
+		"Bear 2 removed from the fight",
+		"Bear 1 is Vulnerable",
+		"Bear 1 marked 1 HP (1/7)",
+		"Combat started with 2 combatants",
+	}
+	if got := combatLog(t, s, session.ID); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("log is\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	_, body := fetch(t, ts, fmt.Sprintf("/encounters/%d/combat", forestID), true)
+	if !strings.Contains(body, `id="combat-log"`) || !strings.Contains(body, "Bear 2 removed from the fight") {
+		t.Error("tracker does not show the combat log")
+	}
+
+	// Undoing brings back the removed bear, with its ID, and the Fear
+	if _, body := sendCombat(t, ts, "", "/undo", url.Values{"steps": {"2"}}); !strings.Contains(body, "Undid 2 changes.") {
+		t.Errorf("undo notice missing\n%s", body)
+	}
+	current, err := db.GetCombatSessionByID(ctx, s.DB, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(current.Combatants) != 2 || current.Combatants[1].ID != session.Combatants[1].ID || current.Fear != 0 {
+		t.Errorf("after undoing: %d combatants and %d Fear", len(current.Combatants), current.Fear)
+	}
+	if got := combatLog(t, s, session.ID); got[0] != "Undid: Bear 2 removed from the fight" || got[2] != "[GM gained 1 Fear on a failed roll (1/12)]" {
+		t.Errorf("log after undoing:\n%s", strings.Join(got, "\n"))
+	}
+
+	postCombat(t, ts, "", "/redo", nil)
+	current, err = db.GetCombatSessionByID(ctx, s.DB, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(current.Combatants) != 1 {
+		t.Errorf("after redoing: %d combatants, want 1", len(current.Combatants))
+	}
+
+	// A new change drops what is left to redo
+	postCombat(t, ts, "", bear+"/hp", url.Values{"delta": {"-1"}})
+	if status, body := sendCombat(t, ts, "", "/redo", nil); status != http.StatusConflict || !strings.Contains(body, "Nothing to redo") {
+		t.Errorf("redo after a new change: status %d\n%s", status, body)
+	}
+
+	// Undoing everything stops at the start of combat
+	if _, body := sendCombat(t, ts, "", "/undo", url.Values{"steps": {"99"}}); !strings.Contains(body, "Undid 4 changes.") {
+		t.Errorf("undoing everything\n%s", body)
+	}
+	current, err = db.GetCombatSessionByID(ctx, s.DB, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(current.Combatants) != 2 || current.Combatants[0].HPMarked != 0 || len(current.Combatants[0].Conditions) != 0 {
+		t.Errorf("after undoing everything: %+v", current.Combatants[0])
+	}
+	if status, _ := sendCombat(t, ts, "", "/undo", nil); status != http.StatusConflict {
+		t.Errorf("undo with nothing left: status %d, want %d", status, http.StatusConflict)
+	}
+
+	if status, _ := sendCombat(t, ts, "", "/undo", url.Values{"steps": {"0"}}); status != http.StatusBadRequest {
+		t.Errorf("zero steps: status %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestCombatLogAtOnce(t *testing.T) {
+	ts, s, session := startPlayerFight(t)
+	bear := fmt.Sprintf("/combatants/%d", session.Combatants[0].ID)
+
+	// Each change is logged against the one made before it
+	postCombatAtOnce(t, ts, bear+"/hp", url.Values{"delta": {"1"}}, 5)
+	want := []string{
+		"Bear 1 marked 1 HP (5/7)",
+		"Bear 1 marked 1 HP (4/7)",
+		"Bear 1 marked 1 HP (3/7)",
+		"Bear 1 marked 1 HP (2/7)",
+		"Bear 1 marked 1 HP (1/7)",
+		"Combat started with 2 combatants",
+	}
+	if got := combatLog(t, s, session.ID); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("log is\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// ...and undoing at once undoes one change each
+	postCombatAtOnce(t, ts, "/undo", nil, 2)
+	if _, hp := bearState(t, s, session.Combatants[0].ID); hp != 3 {
+		t.Errorf("after undoing twice at once: %d HP marked, want 3", hp)
+	}
+	got := combatLog(t, s, session.ID)
+	if got[0] != "Undid: Bear 1 marked 1 HP (4/7)" || got[1] != "Undid: Bear 1 marked 1 HP (5/7)" {
+		t.Errorf("log after undoing:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestCombatLogFearAtCap(t *testing.T) {
+	ts, s, session := startPlayerFight(t)
+
+	// Of gains made together at the cap, only the one that lands is logged
+	postCombat(t, ts, "", "/fear/gain", url.Values{"amount": {"11"}})
+	postCombatAtOnce(t, ts, "/fear/gain", nil, 3)
+	postCombat(t, ts, "", "/fear/gain", nil)
+
+	want := []string{
+		"GM gained 1 Fear (12/12)",
+		"GM gained 11 Fear (11/12)",
+		"Combat started with 2 combatants",
+	}
+	if got := combatLog(t, s, session.ID); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("log is\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	fearLog, err := db.GetFearLog(context.Background(), s.DB, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fearLog) != 2 || fearLog[0].Delta != 1 || fearLog[1].Delta != 11 {
+		t.Errorf("Fear log is %+v, want gains of 11 and 1", fearLog)
+	}
+}
+
+func TestCombatLogEvents(t *testing.T) {
+	ts, _, session := startPlayerFight(t)
+	table := openEventStream(t, ts, trackerEventsPath("table"), "")
+	table.expect(t, "")
+
+	postCombat(t, ts, "gm", fmt.Sprintf("/combatants/%d/hp", session.Combatants[0].ID), url.Values{"delta": {"3"}})
+	table.expect(t, CombatEventHP)
+
+	postCombat(t, ts, "gm", "/undo", nil)
+	if undone := table.expect(t, CombatEventUndo).session(t); undone.Combatants[0].HPMarked != 0 {
+		t.Errorf("undo event has %d HP marked, want 0", undone.Combatants[0].HPMarked)
+	}
+}
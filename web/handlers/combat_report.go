@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/juthrbog/adversarytracker/db"
+	"github.com/juthrbog/adversarytracker/internal/combat"
+)
+
+// reportCombat writes the report of a combat session that has just ended
+// in tx, from its final state and the changes that stand in its log
+func reportCombat(ctx context.Context, tx *sql.Tx, sessionID int64) error {
+	final, err := db.GetCombatState(ctx, tx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	history, err := db.GetCombatHistory(ctx, tx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.CreateCombatReport(ctx, tx, combat.BuildReport(final, history))
+	return err
+}
+
+// ViewCombatReport displays the report of one of an encounter's past fights
+func (s *Server) ViewCombatReport(w http.ResponseWriter, r *http.Request) {
+	encounter, report, ok := s.loadCombatReport(w, r)
+	if !ok {
+		return
+	}
+
+	data := map[string]interface{}{
+		"Encounter": encounter,
+		"Report":    report,
+	}
+
+	// Parse templates
+	tmpl, err := template.ParseFiles(
+		filepath.Join("templates", "layout.html"),
+		filepath.Join("templates", "encounters", "report.html"),
+	)
+	if err != nil {
+		slog.Error("Failed to parse template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Render template
+	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
+		slog.Error("Failed to execute template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// ExportCombatReport downloads the report of one of an encounter's past
+// fights as Markdown
+func (s *Server) ExportCombatReport(w http.ResponseWriter, r *http.Request) {
+	encounter, report, ok := s.loadCombatReport(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.md"`, reportFileName(encounter, report)))
+	if err := combat.WriteReportMarkdown(w, encounter.Name, report); err != nil {
+		slog.Error("Failed to write combat report", "error", err, "id", report.ID)
+	}
+}
+
+// loadCombatReport resolves the encounter and report in the URL, making sure
+// the report belongs to the encounter. It writes an error response and
+// returns false if it does not.
+func (s *Server) loadCombatReport(w http.ResponseWriter, r *http.Request) (*db.Encounter, *db.CombatReport, bool) {
+	ctx := r.Context()
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid encounter ID", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	reportID, err := strconv.ParseInt(chi.URLParam(r, "reportId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid report ID", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	encounter, err := s.Encounters.GetEncounter(ctx, id)
+	if err != nil {
+		slog.Error("Failed to get encounter", "error", err, "id", id)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	if encounter == nil {
+		http.Error(w, "Encounter not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+
+	report, err := db.GetCombatReport(ctx, s.DB, reportID)
+	if err != nil {
+		slog.Error("Failed to get combat report", "error", err, "id", reportID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	if report == nil || report.EncounterID != encounter.ID {
+		http.Error(w, "Report not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+
+	return encounter, report, true
+}
+
+// reportFileName names the Markdown download of a report after its
+// encounter and the day it was fought, e.g. "goblin-ambush-2024-05-04"
+func reportFileName(encounter *db.Encounter, report *db.CombatReport) string {
+	slug := strings.Trim(nonFileNameChars.ReplaceAllString(strings.ToLower(encounter.Name), "-"), "-")
+	if slug == "" {
+		slug = "combat"
+	}
+	return slug + "-" + report.StartedAt.Format("2006-01-02")
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/juthrbog/adversarytracker/db"
+	"github.com/juthrbog/adversarytracker/internal/combat"
+)
+
+func TestCombatReport(t *testing.T) {
+	ctx := context.Background()
+	ts, s, session := startPlayerFight(t)
+	bear := fmt.Sprintf("/combatants/%d", session.Combatants[0].ID)
+	otherBear := fmt.Sprintf("/combatants/%d", session.Combatants[1].ID)
+
+	// The first bear takes 8 HP in all, with one cleared in between
+	postCombat(t, ts, "", bear+"/hp", url.Values{"delta": {"3"}})
+	postCombat(t, ts, "", bear+"/hp", url.Values{"delta": {"-1"}})
+	postCombat(t, ts, "", bear+"/hp", url.Values{"delta": {"5"}})
+
+	// Undone damage does not count
+	postCombat(t, ts, "", otherBear+"/hp", url.Values{"delta": {"2"}})
+	postCombat(t, ts, "", "/undo", nil)
+
+	postCombat(t, ts, "", "/fear/gain", url.Values{"amount": {"3"}})
+	postCombat(t, ts, "", "/fear/spend", url.Values{"amount": {"2"}, "reason": {"a landslide"}})
+	postCombat(t, ts, "", "/countdowns", url.Values{"name": {"Collapse"}, "start": {"1"}})
+	postCombat(t, ts, "", "/countdowns/roll", url.Values{"result": {combat.RollFailureFear}})
+	postCombat(t, ts, "", "/end", nil)
+
+	reports, err := db.GetCombatReports(ctx, s.DB, forestID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("got %d reports, want 1", len(reports))
+	}
+	report := reports[0]
+
+	if report.SessionID != session.ID || report.FearGained != 3 || report.FearSpent != 2 || report.DefeatedCount() != 1 {
+		t.Errorf("report is %+v", report)
+	}
+	if len(report.Combatants) != 2 {
+		t.Fatalf("report has %d combatants, want 2", len(report.Combatants))
+	}
+	if c := report.Combatants[0]; c.Damage != 8 || c.HPMarked != 7 || !c.Defeated || c.DefeatedAt == nil {
+		t.Errorf("first bear: %+v", c)
+	}
+	if c := report.Combatants[1]; c.Damage != 0 || c.Defeated {
+		t.Errorf("second bear: %+v", c)
+	}
+	if len(report.Countdowns) != 1 || !report.Countdowns[0].Resolved || report.ResolvedCount() != 1 {
+		t.Errorf("countdowns: %+v", report.Countdowns)
+	}
+
+	// The encounter page lists the fight
+	_, body := fetch(t, ts, fmt.Sprintf("/encounters/%d/combat", forestID), true)
+	reportPath := fmt.Sprintf("/encounters/%d/reports/%d", forestID, report.ID)
+	if !strings.Contains(body, "Past Fights") || !strings.Contains(body, reportPath) {
+		t.Errorf("encounter page does not list the fight\n%s", body)
+	}
+
+	if status, body := fetch(t, ts, reportPath, false); status != http.StatusOK || !strings.Contains(body, "Forest: combat report") {
+		t.Errorf("report page: status %d\n%s", status, body)
+	}
+
+	resp, err := ts.Client().Get(ts.URL + reportPath + "/markdown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	markdown, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/markdown") {
+		t.Errorf("Content-Type is %q", ct)
+	}
+	if cd := resp.Header.Get("Content-Disposition"); !strings.Contains(cd, `filename="forest-`) {
+		t.Errorf("Content-Disposition is %q", cd)
+	}
+	for _, want := range []string{
+		"# Forest: combat report",
+		"- Adversaries defeated: 1 of 2",
+		"- Fear spent: 2",
+		"| Bear 1 | Bruiser | 8 (7/7 at the end) | 0 | Defeated at ",
+		"| Bear 2 | Bruiser | 0 (0/7 at the end) | 0 | Standing |",
+		": 2 Fear (a landslide)",
+		"| Collapse | Resolved at ",
+	} {
+		if !strings.Contains(string(markdown), want) {
+			t.Errorf("Markdown report is missing %q\n%s", want, markdown)
+		}
+	}
+
+	// Reports are only found under their own encounter
+	if status, _ := fetch(t, ts, fmt.Sprintf("/encounters/%d/reports/%d", forestID, report.ID+1), false); status != http.StatusNotFound {
+		t.Errorf("unknown report: status %d, want %d", status, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/juthrbog/adversarytracker/db"
+	"github.com/juthrbog/adversarytracker/internal/combat"
+)
+
+// PassSpotlight hands the spotlight to the GM, starting a GM turn, or back
+// to the players
+func (s *Server) PassSpotlight(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	encounterID, session, ok := s.loadActiveSession(w, r)
+	if !ok {
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	spotlight := r.FormValue("to")
+	if spotlight != db.SpotlightPlayers && spotlight != db.SpotlightGM {
+		http.Error(w, "Spotlight must go to players or gm", http.StatusBadRequest)
+		return
+	}
+
+	err := s.changeCombat(r, encounterID, session.ID, CombatEventSpotlight, func(tx *sql.Tx) error {
+		return db.PassSpotlight(ctx, tx, session.ID, spotlight)
+	})
+	if err != nil {
+		slog.Error("Failed to pass spotlight", "error", err, "session_id", session.ID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.renderCombatTracker(w, r, encounterID, "")
+}
+
+// SetTrackerMode switches between the narrative spotlight flow and the
+// action tracker
+func (s *Server) SetTrackerMode(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	encounterID, session, ok := s.loadActiveSession(w, r)
+	if !ok {
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	mode := r.FormValue("mode")
+	if !db.IsValidTrackerMode(mode) {
+		http.Error(w, "Invalid tracker mode", http.StatusBadRequest)
+		return
+	}
+
+	err := s.changeCombat(r, encounterID, session.ID, CombatEventSpotlight, func(tx *sql.Tx) error {
+		return db.SetTrackerMode(ctx, tx, session.ID, mode)
+	})
+	if err != nil {
+		slog.Error("Failed to set tracker mode", "error", err, "session_id", session.ID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.renderCombatTracker(w, r, encounterID, "")
+}
+
+// ChangeActionTokens adds or removes action tokens. Players add a token each
+// time they act while the action tracker is in use.
+func (s *Server) ChangeActionTokens(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	encounterID, session, ok := s.loadActiveSession(w, r)
+	if !ok {
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	delta, err := strconv.Atoi(r.FormValue("delta"))
+	if err != nil {
+		http.Error(w, "Invalid token delta", http.StatusBadRequest)
+		return
+	}
+
+	err = s.changeCombat(r, encounterID, session.ID, CombatEventSpotlight, func(tx *sql.Tx) error {
+		return db.ChangeActionTokens(ctx, tx, session.ID, delta)
+	})
+	if err != nil {
+		slog.Error("Failed to change action tokens", "error", err, "session_id", session.ID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.renderCombatTracker(w, r, encounterID, "")
+}
+
+// ActivateCombatant spotlights an adversary on the GM turn, paying Fear or an
+// action token when the activation is not free, and ticks the countdowns
+// that advance on adversary actions
+func (s *Server) ActivateCombatant(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	encounterID, session, combatant, ok := s.loadActiveCombatant(w, r)
+	if !ok {
+		return
+	}
+
+	// The cost is worked out from the fight as it stands when the
+	// activation is made
+	var cost combat.Cost
+	var fired []*db.Countdown
+	err := s.changeCombat(r, encounterID, session.ID, CombatEventSpotlight, func(tx *sql.Tx) error {
+		var err error
+		cost.Fear, cost.Tokens, err = db.ActivateCombatant(ctx, tx, combatant, combat.PriceActivation)
+		if err != nil {
+			return err
+		}
+
+		fired, err = tickActionCountdowns(ctx, tx, combatant)
+		return err
+	})
+	switch {
+	case errors.Is(err, db.ErrDefeated):
+		http.Error(w, "Combatant is defeated", http.StatusConflict)
+		return
+	case errors.Is(err, db.ErrNotGMTurn), errors.Is(err, db.ErrAlreadyActed):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, db.ErrNotEnoughFear), errors.Is(err, db.ErrNoActionTokens):
+		http.Error(w, "Spotlighting "+combatant.Name+" costs "+cost.String()+": "+err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		slog.Error("Failed to activate combatant", "error", err, "id", combatant.ID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	notice := combatant.Name + " takes the spotlight"
+	if !cost.Free() {
+		notice += " for " + cost.String()
+	}
+	notice += "."
+	if firedNotice := triggerCountdownsFired(w, fired); firedNotice != "" {
+		notice += " " + firedNotice
+	}
+	s.renderCombatTracker(w, r, encounterID, notice)
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/juthrbog/adversarytracker/db"
+	"github.com/juthrbog/adversarytracker/internal/combat"
+)
+
+// UpdateCombatantStress marks or clears Stress on a combatant. A positive
+// delta marks Stress, spilling into HP once the Stress track is full; a
+// negative one clears it.
+func (s *Server) UpdateCombatantStress(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	encounterID, _, combatant, ok := s.loadActiveCombatant(w, r)
+	if !ok {
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	delta, err := strconv.Atoi(r.FormValue("delta"))
+	if err != nil {
+		http.Error(w, "Invalid Stress delta", http.StatusBadRequest)
+		return
+	}
+
+	notice := ""
+	err = s.changeCombat(r, encounterID, combatant.SessionID, CombatEventStress, func(tx *sql.Tx) error {
+		return db.ChangeCombatant(ctx, tx, combatant, func(c *db.Combatant) {
+			if delta < 0 {
+				c.StressMarked = combat.ClearStress(c, -delta)
+				return
+			}
+
+			outcome := combat.MarkStress(c, delta)
+			c.StressMarked = outcome.StressMarked
+			c.HPMarked = outcome.HPMarked
+			if outcome.Overflow > 0 {
+				notice = outcome.Explanation
+			}
+		})
+	})
+	if err != nil {
+		slog.Error("Failed to update combatant", "error", err, "id", combatant.ID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.renderCombatTracker(w, r, encounterID, notice)
+}
+
+// UseCombatantFeature has a combatant use a feature of its adversary, paying
+// the Stress and Fear the feature costs
+func (s *Server) UseCombatantFeature(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	encounterID, _, combatant, ok := s.loadActiveCombatant(w, r)
+	if !ok {
+		return
+	}
+
+	featureID, err := strconv.ParseInt(chi.URLParam(r, "featureId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid feature ID", http.StatusBadRequest)
+		return
+	}
+
+	// Only the features of the combatant's own adversary can be used
+	feature, err := s.Adversaries.GetAdversaryFeature(ctx, featureID)
+	if err != nil {
+		slog.Error("Failed to get adversary feature", "error", err, "id", featureID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if feature == nil || combatant.AdversaryID == nil || feature.AdversaryID != *combatant.AdversaryID {
+		http.Error(w, "Feature not found", http.StatusNotFound)
+		return
+	}
+
+	if combatant.Defeated() {
+		http.Error(w, "Combatant is defeated", http.StatusConflict)
+		return
+	}
+
+	err = s.changeCombat(r, encounterID, combatant.SessionID, CombatEventStress, func(tx *sql.Tx) error {
+		return db.UseFeature(ctx, tx, combatant, feature)
+	})
+	switch {
+	case errors.Is(err, db.ErrNotEnoughStress):
+		http.Error(w, fmt.Sprintf("%s costs %d Stress: %s", feature.Name, feature.StressCost, err), http.StatusConflict)
+		return
+	case errors.Is(err, db.ErrNotEnoughFear):
+		http.Error(w, fmt.Sprintf("%s costs %d Fear: %s", feature.Name, feature.FearCost, err), http.StatusConflict)
+		return
+	case err != nil:
+		slog.Error("Failed to use feature", "error", err, "combatant_id", combatant.ID, "feature_id", feature.ID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.renderCombatTracker(w, r, encounterID, featureNotice(combatant, feature))
+}
+
+// featureNotice describes a combatant using a feature and what it paid
+func featureNotice(c *db.Combatant, f *db.AdversaryFeature) string {
+	var costs []string
+	if f.StressCost > 0 {
+		costs = append(costs, fmt.Sprintf("%d Stress", f.StressCost))
+	}
+	if f.FearCost > 0 {
+		costs = append(costs, fmt.Sprintf("%d Fear", f.FearCost))
+	}
+
+	switch len(costs) {
+	case 0:
+		return fmt.Sprintf("%s uses %s.", c.Name, f.Name)
+	case 1:
+		return fmt.Sprintf("%s uses %s for %s.", c.Name, f.Name, costs[0])
+	default:
+		return fmt.Sprintf("%s uses %s for %s and %s.", c.Name, f.Name, costs[0], costs[1])
+	}
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/juthrbog/adversarytracker/db"
+)
+
+// bearState reads back the Stress and HP marked on a combatant
+func bearState(t *testing.T, s *Server, id int64) (stress, hp int) {
+	t.Helper()
+
+	c, err := db.GetCombatantByID(context.Background(), s.DB, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.StressMarked, c.HPMarked
+}
+
+func TestCombatantStress(t *testing.T) {
+	ts, s, session := startPlayerFight(t)
+	bear := session.Combatants[0]
+	path := "/combatants/" + strconv.FormatInt(bear.ID, 10) + "/stress"
+
+	if bear.StressMax != 2 || bear.StressMarked != 0 {
+		t.Fatalf("bear starts with %d/%d Stress, want 0/2", bear.StressMarked, bear.StressMax)
+	}
+
+	postCombat(t, ts, "", path, url.Values{"delta": {"1"}})
+	if stress, hp := bearState(t, s, bear.ID); stress != 1 || hp != 0 {
+		t.Errorf("after marking 1 Stress: %d Stress, %d HP", stress, hp)
+	}
+
+	// Stress the track cannot hold marks HP instead
+	_, body := sendCombat(t, ts, "", path, url.Values{"delta": {"3"}})
+	if stress, hp := bearState(t, s, bear.ID); stress != 2 || hp != 2 {
+		t.Errorf("after overflowing: %d Stress, %d HP; want 2 and 2", stress, hp)
+	}
+	if !strings.Contains(body, "marking 2 HP instead") {
+		t.Error("overflow is not explained")
+	}
+
+	postCombat(t, ts, "", path, url.Values{"delta": {"-5"}})
+	if stress, hp := bearState(t, s, bear.ID); stress != 0 || hp != 2 {
+		t.Errorf("after clearing: %d Stress, %d HP; want 0 and 2", stress, hp)
+	}
+
+	if status, _ := sendCombat(t, ts, "", path, url.Values{"delta": {"lots"}}); status != http.StatusBadRequest {
+		t.Errorf("invalid delta: status %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestCombatantStressAtOnce(t *testing.T) {
+	ts, s, session := startPlayerFight(t)
+	bear := session.Combatants[0]
+	path := "/combatants/" + strconv.FormatInt(bear.ID, 10) + "/stress"
+
+	// The Stress that lands on a full track marks HP, whichever request it
+	// came in
+	postCombatAtOnce(t, ts, path, url.Values{"delta": {"1"}}, 6)
+	if stress, hp := bearState(t, s, bear.ID); stress != 2 || hp != 4 {
+		t.Errorf("after marking 1 Stress 6 times at once: %d Stress, %d HP; want 2 and 4", stress, hp)
+	}
+
+	postCombatAtOnce(t, ts, path, url.Values{"delta": {"-1"}}, 2)
+	if stress, hp := bearState(t, s, bear.ID); stress != 0 || hp != 4 {
+		t.Errorf("after clearing 1 Stress twice at once: %d Stress, %d HP; want 0 and 4", stress, hp)
+	}
+}
+
+func TestUseFeature(t *testing.T) {
+	ctx := context.Background()
+	ts, s, session := startPlayerFight(t)
+	bear := session.Combatants[0]
+
+	features := map[string]*db.AdversaryFeature{
+		"bite": {AdversaryID: bearID, Kind: db.FeatureAction, Name: "Bite", StressCost: 1},
+		"roar": {AdversaryID: bearID, Kind: db.FeatureAction, Name: "Roar", StressCost: 1, FearCost: 1},
+	}
+	for _, f := range features {
+		id, err := s.Adversaries.CreateAdversaryFeature(ctx, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.ID = id
+	}
+	use := func(f *db.AdversaryFeature) (int, string) {
+		return sendCombat(t, ts, "", fmt.Sprintf("/combatants/%d/features/%d/use", bear.ID, f.ID), nil)
+	}
+
+	// The tracker offers the features that cost Stress on the bear's row
+	_, body := fetch(t, ts, fmt.Sprintf("/encounters/%d/combat", forestID), true)
+	if !strings.Contains(body, "Bite (1 Stress)") || !strings.Contains(body, "Roar (1 Stress, 1 Fear)") {
+		t.Error("tracker does not offer the bear's Stress features")
+	}
+
+	if status, body := use(features["bite"]); status != http.StatusOK || !strings.Contains(body, "Bear 1 uses Bite for 1 Stress.") {
+		t.Errorf("using Bite: status %d\n%s", status, body)
+	}
+
+	// Roar also costs Fear, which the GM does not have yet
+	if status, _ := use(features["roar"]); status != http.StatusConflict {
+		t.Errorf("using Roar without Fear: status %d, want %d", status, http.StatusConflict)
+	}
+	if stress, _ := bearState(t, s, bear.ID); stress != 1 {
+		t.Errorf("failed use marked Stress: %d marked", stress)
+	}
+
+	postCombat(t, ts, "", "/fear/gain", nil)
+	if status, _ := use(features["roar"]); status != http.StatusOK {
+		t.Errorf("using Roar: status %d, want %d", status, http.StatusOK)
+	}
+	current, err := db.GetCombatSessionByID(ctx, s.DB, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.Fear != 0 || current.Combatants[0].StressMarked != 2 {
+		t.Errorf("after Roar: %d Fear and %d Stress, want 0 and 2", current.Fear, current.Combatants[0].StressMarked)
+	}
+
+	// A full Stress track cannot pay for a feature, and does not mark HP
+	if status, body := use(features["bite"]); status != http.StatusConflict || !strings.Contains(body, "Bite costs 1 Stress") {
+		t.Errorf("using Bite with no Stress left: status %d\n%s", status, body)
+	}
+	if _, hp := bearState(t, s, bear.ID); hp != 0 {
+		t.Errorf("paying Stress marked %d HP", hp)
+	}
+
+	if status, _ := sendCombat(t, ts, "", fmt.Sprintf("/combatants/%d/features/999/use", bear.ID), nil); status != http.StatusNotFound {
+		t.Errorf("unknown feature: status %d, want %d", status, http.StatusNotFound)
+	}
+}
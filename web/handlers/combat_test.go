@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/juthrbog/adversarytracker/db"
+)
+
+// tickFightCountdown ticks the fight's countdown before the request
+func tickFightCountdown(ticks int) func(s *Server, store *db.MemoryStore) {
+	return func(s *Server, store *db.MemoryStore) {
+		if _, err := db.TickCountdowns(context.Background(), s.DB, map[int64]int{fightCountdownID: ticks}); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// endFight ends the fight before the request
+func endFight(s *Server, store *db.MemoryStore) {
+	if err := db.EndCombatSession(context.Background(), s.DB, fightID); err != nil {
+		panic(err)
+	}
+}
+
+// countdownAt checks the value of the fight's countdown
+func countdownAt(value int) func(t *testing.T, session *db.CombatSession) {
+	return func(t *testing.T, session *db.CombatSession) {
+		t.Helper()
+		if len(session.Countdowns) != 1 || session.Countdowns[0].Value != value {
+			t.Fatalf("countdowns are %+v, want Collapse at %d", session.Countdowns, value)
+		}
+	}
+}
+
+// noCountdowns checks that the fight's countdown was deleted
+func noCountdowns(t *testing.T, session *db.CombatSession) {
+	t.Helper()
+	if len(session.Countdowns) != 0 {
+		t.Fatalf("countdowns are %+v, want none", session.Countdowns)
+	}
+}
+
+// bearConditions checks how many conditions Bear 1 has
+func bearConditions(n int) func(t *testing.T, session *db.CombatSession) {
+	return func(t *testing.T, session *db.CombatSession) {
+		t.Helper()
+		if got := session.Combatants[0].Conditions; len(got) != n {
+			t.Fatalf("Bear 1 has conditions %+v, want %d", got, n)
+		}
+	}
+}
+
+// bearConditionPublic checks whether Bear 1's condition is shown to players
+func bearConditionPublic(want bool) func(t *testing.T, session *db.CombatSession) {
+	return func(t *testing.T, session *db.CombatSession) {
+		t.Helper()
+		if got := session.Combatants[0].Conditions; len(got) != 1 || got[0].Public != want {
+			t.Fatalf("Bear 1 has conditions %+v, want one shown to players: %v", got, want)
+		}
+	}
+}
+
+func TestCountdownRoutes(t *testing.T) {
+	runRouteTests(t, encounterRoutes, []routeTest{
+		{
+			name: "tick", method: http.MethodPost, target: "/1/combat/countdowns/1/tick", htmx: true, fight: true,
+			status: http.StatusOK, contains: []string{`id="combat-tracker"`, "Collapse"}, excludes: []string{pageMarker},
+			checkFight: countdownAt(2),
+		},
+		{
+			name: "tick form", method: http.MethodPost, target: "/1/combat/countdowns/1/tick", fight: true,
+			status: http.StatusSeeOther, redirect: "/encounters/1", checkFight: countdownAt(2),
+		},
+		{
+			name: "tick to zero", method: http.MethodPost, target: "/1/combat/countdowns/1/tick", htmx: true, fight: true,
+			setup:  tickFightCountdown(2),
+			status: http.StatusOK, contains: []string{"Countdown reached zero: Collapse."}, checkFight: countdownAt(0),
+		},
+		{
+			name: "reset", method: http.MethodPost, target: "/1/combat/countdowns/1/reset", htmx: true, fight: true,
+			setup:  tickFightCountdown(2),
+			status: http.StatusOK, contains: []string{`id="combat-tracker"`}, checkFight: countdownAt(3),
+		},
+		{
+			name: "reset form", method: http.MethodPost, target: "/1/combat/countdowns/1/reset", fight: true,
+			setup:  tickFightCountdown(3),
+			status: http.StatusSeeOther, redirect: "/encounters/1", checkFight: countdownAt(3),
+		},
+		{
+			name: "delete", method: http.MethodDelete, target: "/1/combat/countdowns/1", htmx: true, fight: true,
+			status: http.StatusOK, contains: []string{`id="combat-tracker"`}, excludes: []string{"Collapse"},
+			checkFight: noCountdowns,
+		},
+		{
+			name: "delete form", method: http.MethodPost, target: "/1/combat/countdowns/1/delete", fight: true,
+			status: http.StatusSeeOther, redirect: "/encounters/1", checkFight: noCountdowns,
+		},
+		{
+			name: "tick invalid ID", method: http.MethodPost, target: "/1/combat/countdowns/collapse/tick", fight: true,
+			status: http.StatusBadRequest, checkFight: countdownAt(3),
+		},
+		{
+			name: "reset missing countdown", method: http.MethodPost, target: "/1/combat/countdowns/99/reset", fight: true,
+			status: http.StatusNotFound,
+		},
+		{
+			name: "delete missing countdown", method: http.MethodDelete, target: "/1/combat/countdowns/99", fight: true,
+			status: http.StatusNotFound, checkFight: countdownAt(3),
+		},
+		{
+			name: "tick after the fight", method: http.MethodPost, target: "/1/combat/countdowns/1/tick", fight: true,
+			setup: endFight, status: http.StatusNotFound, checkFight: countdownAt(3),
+		},
+		{
+			name: "tick out of combat", method: http.MethodPost, target: "/1/combat/countdowns/1/tick",
+			status: http.StatusNotFound,
+		},
+		{
+			name: "tick invalid encounter", method: http.MethodPost, target: "/forest/combat/countdowns/1/tick", fight: true,
+			status: http.StatusBadRequest,
+		},
+		{
+			name: "reset database down", method: http.MethodPost, target: "/1/combat/countdowns/1/reset", fight: true,
+			setup: withDatabaseDown, status: http.StatusInternalServerError,
+		},
+		{
+			name: "delete database down", method: http.MethodDelete, target: "/1/combat/countdowns/1", fight: true,
+			setup: withDatabaseDown, status: http.StatusInternalServerError,
+		},
+	})
+}
+
+func TestConditionRoutes(t *testing.T) {
+	runRouteTests(t, encounterRoutes, []routeTest{
+		{
+			name: "remove", method: http.MethodDelete, target: "/1/combat/combatants/1/conditions/1", htmx: true, fight: true,
+			status: http.StatusOK, contains: []string{`id="combat-tracker"`}, excludes: []string{"Clear Restrained"},
+			checkFight: bearConditions(0),
+		},
+		{
+			name: "remove form", method: http.MethodPost, target: "/1/combat/combatants/1/conditions/1/delete", fight: true,
+			status: http.StatusSeeOther, redirect: "/encounters/1", checkFight: bearConditions(0),
+		},
+		{
+			name: "remove from another combatant", method: http.MethodDelete, target: "/1/combat/combatants/2/conditions/1", fight: true,
+			status: http.StatusNotFound, checkFight: bearConditions(1),
+		},
+		{
+			name: "remove missing condition", method: http.MethodDelete, target: "/1/combat/combatants/1/conditions/99", fight: true,
+			status: http.StatusNotFound, checkFight: bearConditions(1),
+		},
+		{
+			name: "remove invalid condition ID", method: http.MethodDelete, target: "/1/combat/combatants/1/conditions/restrained", fight: true,
+			status: http.StatusBadRequest, checkFight: bearConditions(1),
+		},
+		{
+			name: "remove from missing combatant", method: http.MethodDelete, target: "/1/combat/combatants/99/conditions/1", fight: true,
+			status: http.StatusNotFound, checkFight: bearConditions(1),
+		},
+		{
+			name: "remove from invalid combatant ID", method: http.MethodDelete, target: "/1/combat/combatants/bear/conditions/1", fight: true,
+			status: http.StatusBadRequest,
+		},
+		{
+			name: "remove after the fight", method: http.MethodDelete, target: "/1/combat/combatants/1/conditions/1", fight: true,
+			setup: endFight, status: http.StatusNotFound,
+		},
+		{
+			name: "remove database down", method: http.MethodDelete, target: "/1/combat/combatants/1/conditions/1", fight: true,
+			setup: withDatabaseDown, status: http.StatusInternalServerError,
+		},
+		{
+			name: "hide", method: http.MethodPost, target: "/1/combat/combatants/1/conditions/1/public", htmx: true, fight: true,
+			form:   url.Values{"public": {"false"}},
+			status: http.StatusOK, contains: []string{`id="combat-tracker"`, "Show to players"}, checkFight: bearConditionPublic(false),
+		},
+		{
+			name: "hide on another combatant", method: http.MethodPost, target: "/1/combat/combatants/2/conditions/1/public", fight: true,
+			form:   url.Values{"public": {"false"}},
+			status: http.StatusNotFound, checkFight: bearConditionPublic(true),
+		},
+		{
+			name: "hide missing condition", method: http.MethodPost, target: "/1/combat/combatants/1/conditions/99/public", fight: true,
+			form:   url.Values{"public": {"false"}},
+			status: http.StatusNotFound, checkFight: bearConditionPublic(true),
+		},
+		{
+			name: "invalid visibility", method: http.MethodPost, target: "/1/combat/combatants/1/conditions/1/public", fight: true,
+			form:   url.Values{"public": {"sometimes"}},
+			status: http.StatusBadRequest, checkFight: bearConditionPublic(true),
+		},
+	})
+}
+
+func TestCombatantHPAtOnce(t *testing.T) {
+	ts, s, session := startPlayerFight(t)
+	bear := "/combatants/" + strconv.FormatInt(session.Combatants[0].ID, 10)
+
+	// Every change counts, however many land together
+	postCombatAtOnce(t, ts, bear+"/hp", url.Values{"delta": {"1"}}, 4)
+	if _, hp := bearState(t, s, session.Combatants[0].ID); hp != 4 {
+		t.Errorf("after marking 1 HP 4 times at once: %d HP marked, want 4", hp)
+	}
+
+	postCombatAtOnce(t, ts, bear+"/damage", url.Values{"damage": {"20"}}, 2)
+	if _, hp := bearState(t, s, session.Combatants[0].ID); hp != 6 {
+		t.Errorf("after 2 hits at once: %d HP marked, want 6", hp)
+	}
+
+	// ...and the HP track still holds
+	postCombatAtOnce(t, ts, bear+"/hp", url.Values{"delta": {"-4"}}, 3)
+	if _, hp := bearState(t, s, session.Combatants[0].ID); hp != 0 {
+		t.Errorf("after clearing 4 HP 3 times at once: %d HP marked, want 0", hp)
+	}
+}
+
+func TestFearAtOnce(t *testing.T) {
+	ctx := context.Background()
+	ts, s, session := startPlayerFight(t)
+
+	fear := func() int {
+		t.Helper()
+		current, err := db.GetCombatSessionByID(ctx, s.DB, session.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return current.Fear
+	}
+
+	postCombatAtOnce(t, ts, "/fear/gain", nil, 5)
+	if got := fear(); got != 5 {
+		t.Errorf("after gaining 1 Fear 5 times at once: %d Fear, want 5", got)
+	}
+
+	postCombatAtOnce(t, ts, "/fear/spend", nil, 3)
+	if got := fear(); got != 2 {
+		t.Errorf("after spending 1 Fear 3 times at once: %d Fear, want 2", got)
+	}
+}
+
+func TestActivateAtOnce(t *testing.T) {
+	ctx := context.Background()
+	ts, s, session := startPlayerFight(t)
+	bear := "/combatants/" + strconv.FormatInt(session.Combatants[0].ID, 10)
+	otherBear := "/combatants/" + strconv.FormatInt(session.Combatants[1].ID, 10)
+
+	postCombat(t, ts, "", "/fear/gain", url.Values{"amount": {"12"}})
+
+	// Only one of two adversaries spotlighted together goes free, turn
+	// after turn
+	const turns = 12
+	for i := 0; i < turns; i++ {
+		postCombat(t, ts, "", "/spotlight", url.Values{"to": {db.SpotlightGM}})
+		postCombatEachAtOnce(t, ts, []string{bear + "/activate", otherBear + "/activate"}, nil)
+	}
+	current, err := db.GetCombatSessionByID(ctx, s.DB, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.Fear != 12-turns || current.ActedCount() != 2 {
+		t.Errorf("after %d turns of 2 activations at once: %d Fear and %d acted, want %d and 2", turns, current.Fear, current.ActedCount(), 12-turns)
+	}
+
+	// A defeated adversary cannot take the spotlight
+	postCombat(t, ts, "", "/spotlight", url.Values{"to": {db.SpotlightGM}})
+	postCombat(t, ts, "", bear+"/hp", url.Values{"delta": {"7"}})
+	if status, body := sendCombat(t, ts, "", bear+"/activate", nil); status != http.StatusConflict || !strings.Contains(body, "Combatant is defeated") {
+		t.Errorf("activating a defeated bear: status %d\n%s", status, body)
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"html/template"
 	"log/slog"
 	"net/http"
@@ -9,42 +10,67 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/juthrbog/adversarytracker/db"
-	"github.com/juthrbog/adversarytracker/internal/app"
+	"github.com/juthrbog/adversarytracker/internal/budget"
 )
 
 // EncounterRoutes returns a router with all encounter routes
-func EncounterRoutes() chi.Router {
+func (s *Server) EncounterRoutes() chi.Router {
 	r := chi.NewRouter()
 
-	r.Get("/", ListEncounters)
-	r.Get("/new", NewEncounterForm)
-	r.Post("/", CreateEncounter)
-	
+	r.Get("/", s.ListEncounters)
+	r.Get("/new", s.NewEncounterForm)
+	r.Post("/", s.CreateEncounter)
+
+	// Random encounter generator
+	r.Get("/generate", s.GenerateEncounterForm)
+	r.Post("/generate", s.SaveGeneratedEncounter)
+
 	r.Route("/{id}", func(r chi.Router) {
-		r.Get("/", ViewEncounter)
-		r.Get("/edit", EditEncounterForm)
-		r.Post("/", UpdateEncounter)
-		r.Delete("/", DeleteEncounter)
-		r.Post("/delete", DeleteEncounter) // For form submissions
-		
+		r.Get("/", s.ViewEncounter)
+		r.Get("/edit", s.EditEncounterForm)
+		r.Post("/", s.UpdateEncounter)
+		r.Delete("/", s.DeleteEncounter)
+		r.Post("/delete", s.DeleteEncounter) // For form submissions
+
 		// Adversary management within encounter
-		r.Post("/adversaries", AddAdversaryToEncounter)
-		r.Delete("/adversaries/{adversaryId}", RemoveAdversaryFromEncounter)
-		r.Post("/adversaries/{adversaryId}/delete", RemoveAdversaryFromEncounter) // For form submissions
+		r.Post("/adversaries", s.AddAdversaryToEncounter)
+		r.Delete("/adversaries/{adversaryId}", s.RemoveAdversaryFromEncounter)
+		r.Post("/adversaries/{adversaryId}/delete", s.RemoveAdversaryFromEncounter) // For form submissions
+
+		// Battle point budget
+		r.Post("/budget", s.UpdateEncounterBudget)
+
+		// Combat tracker
+		r.Mount("/combat", s.CombatRoutes())
+
+		// Reports of past fights
+		r.Get("/reports/{reportId}", s.ViewCombatReport)
+		r.Get("/reports/{reportId}/markdown", s.ExportCombatReport)
 	})
 
 	// HTMX specific routes
-	r.Get("/add-adversary/{adversaryId}", AddAdversaryModal)
+	r.Get("/add-adversary/{adversaryId}", s.AddAdversaryModal)
 
 	return r
 }
 
-// ListEncounters displays all encounters
-func ListEncounters(w http.ResponseWriter, r *http.Request) {
+// ListEncounters displays a page of encounters, filtered and sorted by the
+// query string
+func (s *Server) ListEncounters(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	// Get all encounters from the database
-	encounters, err := db.GetAllEncounters(ctx, app.DB)
+	opts, errs := parseListOptions(r.URL.Query(), db.EncounterSortFields, encounterPageSize)
+	if len(errs) > 0 {
+		http.Error(w, errs.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get a page of encounters from the database
+	encounters, next, err := s.Encounters.ListEncounters(ctx, opts)
+	if errors.Is(err, db.ErrInvalidCursor) {
+		http.Error(w, "Invalid page cursor", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		slog.Error("Failed to get encounters", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -65,6 +91,15 @@ func ListEncounters(w http.ResponseWriter, r *http.Request) {
 	// Render template
 	data := map[string]interface{}{
 		"Encounters": encounters,
+		"Options":    opts,
+		"Roles":      db.AdversaryRoles,
+		"SortFields": db.EncounterSortFields,
+	}
+	if opts.After != "" {
+		data["FirstURL"] = pageURL("/encounters", opts, encounterPageSize, "")
+	}
+	if next != "" {
+		data["NextURL"] = pageURL("/encounters", opts, encounterPageSize, next)
 	}
 
 	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
@@ -74,9 +109,9 @@ func ListEncounters(w http.ResponseWriter, r *http.Request) {
 }
 
 // ViewEncounter displays a single encounter
-func ViewEncounter(w http.ResponseWriter, r *http.Request) {
+func (s *Server) ViewEncounter(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	
+
 	// Get encounter ID from URL
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
@@ -86,7 +121,7 @@ func ViewEncounter(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get encounter from database
-	encounter, err := db.GetEncounterByID(ctx, app.DB, id)
+	encounter, err := s.Encounters.GetEncounter(ctx, id)
 	if err != nil {
 		slog.Error("Failed to get encounter", "error", err, "id", id)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -98,10 +133,24 @@ func ViewEncounter(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Get the combat tracker; the encounter page renders it inline
+	data, err := s.loadCombatData(ctx, encounter)
+	if err != nil {
+		slog.Error("Failed to load combat tracker", "error", err, "encounter_id", id)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	data["Budget"] = budget.Calculate(encounter)
+	data["Challenges"] = db.Challenges
+	data["TrackerEvents"] = trackerEvents
+	data["TrackerClient"] = newTrackerClient()
+
 	// Parse templates
 	tmpl, err := template.ParseFiles(
 		filepath.Join("templates", "layout.html"),
 		filepath.Join("templates", "encounters", "view.html"),
+		filepath.Join("templates", "encounters", "budget.html"),
+		filepath.Join("templates", "encounters", "combat.html"),
 	)
 	if err != nil {
 		slog.Error("Failed to parse template", "error", err)
@@ -110,10 +159,6 @@ func ViewEncounter(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Render template
-	data := map[string]interface{}{
-		"Encounter": encounter,
-	}
-
 	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
 		slog.Error("Failed to execute template", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -121,11 +166,11 @@ func ViewEncounter(w http.ResponseWriter, r *http.Request) {
 }
 
 // NewEncounterForm displays the form to create a new encounter
-func NewEncounterForm(w http.ResponseWriter, r *http.Request) {
+func (s *Server) NewEncounterForm(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	// Get all adversaries for selection
-	adversaries, err := db.GetAllAdversaries(ctx, app.DB)
+	adversaries, _, err := s.Adversaries.ListAdversaries(ctx, db.ListOptions{})
 	if err != nil {
 		slog.Error("Failed to get adversaries", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -157,9 +202,9 @@ func NewEncounterForm(w http.ResponseWriter, r *http.Request) {
 }
 
 // CreateEncounter handles the form submission to create a new encounter
-func CreateEncounter(w http.ResponseWriter, r *http.Request) {
+func (s *Server) CreateEncounter(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	
+
 	// Parse form
 	if err := r.ParseForm(); err != nil {
 		http.Error(w, "Bad request", http.StatusBadRequest)
@@ -173,7 +218,7 @@ func CreateEncounter(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Save to database
-	id, err := db.CreateEncounter(ctx, app.DB, enc)
+	id, err := s.Encounters.CreateEncounter(ctx, enc)
 	if err != nil {
 		slog.Error("Failed to create encounter", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -192,9 +237,9 @@ func CreateEncounter(w http.ResponseWriter, r *http.Request) {
 }
 
 // EditEncounterForm displays the form to edit an existing encounter
-func EditEncounterForm(w http.ResponseWriter, r *http.Request) {
+func (s *Server) EditEncounterForm(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	
+
 	// Get encounter ID from URL
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
@@ -204,7 +249,7 @@ func EditEncounterForm(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get encounter from database
-	encounter, err := db.GetEncounterByID(ctx, app.DB, id)
+	encounter, err := s.Encounters.GetEncounter(ctx, id)
 	if err != nil {
 		slog.Error("Failed to get encounter", "error", err, "id", id)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -217,7 +262,7 @@ func EditEncounterForm(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get all adversaries for selection
-	adversaries, err := db.GetAllAdversaries(ctx, app.DB)
+	adversaries, _, err := s.Adversaries.ListAdversaries(ctx, db.ListOptions{})
 	if err != nil {
 		slog.Error("Failed to get adversaries", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -249,9 +294,9 @@ func EditEncounterForm(w http.ResponseWriter, r *http.Request) {
 }
 
 // UpdateEncounter handles the form submission to update an existing encounter
-func UpdateEncounter(w http.ResponseWriter, r *http.Request) {
+func (s *Server) UpdateEncounter(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	
+
 	// Get encounter ID from URL
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
@@ -274,7 +319,7 @@ func UpdateEncounter(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update in database
-	err = db.UpdateEncounter(ctx, app.DB, enc)
+	err = s.Encounters.UpdateEncounter(ctx, enc)
 	if err != nil {
 		slog.Error("Failed to update encounter", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -293,9 +338,9 @@ func UpdateEncounter(w http.ResponseWriter, r *http.Request) {
 }
 
 // DeleteEncounter handles the deletion of an encounter
-func DeleteEncounter(w http.ResponseWriter, r *http.Request) {
+func (s *Server) DeleteEncounter(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	
+
 	// Get encounter ID from URL
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
@@ -305,7 +350,7 @@ func DeleteEncounter(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Delete from database
-	err = db.DeleteEncounter(ctx, app.DB, id)
+	err = s.Encounters.DeleteEncounter(ctx, id)
 	if err != nil {
 		slog.Error("Failed to delete encounter", "error", err, "id", id)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -323,10 +368,16 @@ func DeleteEncounter(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/encounters", http.StatusSeeOther)
 }
 
+// encounterOption is an encounter offered in a picker, with its budget
+type encounterOption struct {
+	*db.EncounterSummary
+	Budget *budget.Budget
+}
+
 // AddAdversaryModal displays a modal for adding an adversary to an encounter
-func AddAdversaryModal(w http.ResponseWriter, r *http.Request) {
+func (s *Server) AddAdversaryModal(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	
+
 	// Get adversary ID from URL
 	adversaryIdStr := chi.URLParam(r, "adversaryId")
 	adversaryId, err := strconv.ParseInt(adversaryIdStr, 10, 64)
@@ -336,7 +387,7 @@ func AddAdversaryModal(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get adversary from database
-	adversary, err := db.GetAdversaryByID(ctx, app.DB, adversaryId)
+	adversary, err := s.Adversaries.GetAdversary(ctx, adversaryId)
 	if err != nil {
 		slog.Error("Failed to get adversary", "error", err, "id", adversaryId)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -348,14 +399,19 @@ func AddAdversaryModal(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get all encounters for selection
-	encounters, err := db.GetAllEncounters(ctx, app.DB)
+	// Get a summary of every encounter for selection
+	summaries, err := s.Encounters.GetEncounterSummaries(ctx)
 	if err != nil {
 		slog.Error("Failed to get encounters", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
+	encounters := make([]*encounterOption, len(summaries))
+	for i, summary := range summaries {
+		encounters[i] = &encounterOption{summary, budget.Calculate(summary.Encounter())}
+	}
+
 	// Parse template
 	tmpl, err := template.ParseFiles(
 		filepath.Join("templates", "encounters", "add_adversary_modal.html"),
@@ -379,9 +435,9 @@ func AddAdversaryModal(w http.ResponseWriter, r *http.Request) {
 }
 
 // AddAdversaryToEncounter handles adding an adversary to an encounter
-func AddAdversaryToEncounter(w http.ResponseWriter, r *http.Request) {
+func (s *Server) AddAdversaryToEncounter(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	
+
 	// Get encounter ID from URL
 	encounterIdStr := chi.URLParam(r, "id")
 	encounterId, err := strconv.ParseInt(encounterIdStr, 10, 64)
@@ -410,36 +466,19 @@ func AddAdversaryToEncounter(w http.ResponseWriter, r *http.Request) {
 		count = 1 // Default to 1 if invalid
 	}
 
-	// Begin transaction
-	tx, err := app.DB.BeginTx(ctx, nil)
-	if err != nil {
-		slog.Error("Failed to begin transaction", "error", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-	defer tx.Rollback()
-
-	// Add adversary to encounter
+	// Add adversary to encounter, or set its count if it is already there
 	ea := &db.EncounterAdversary{
 		EncounterID: encounterId,
 		AdversaryID: adversaryId,
 		Count:       count,
 	}
 
-	_, err = db.AddAdversaryToEncounter(ctx, tx, ea)
-	if err != nil {
+	if _, err := s.Encounters.SetEncounterAdversary(ctx, ea); err != nil {
 		slog.Error("Failed to add adversary to encounter", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	// Commit transaction
-	if err := tx.Commit(); err != nil {
-		slog.Error("Failed to commit transaction", "error", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-
 	// Check if this is an HTMX request
 	if r.Header.Get("HX-Request") == "true" {
 		// For HTMX, redirect via response headers
@@ -452,9 +491,9 @@ func AddAdversaryToEncounter(w http.ResponseWriter, r *http.Request) {
 }
 
 // RemoveAdversaryFromEncounter handles removing an adversary from an encounter
-func RemoveAdversaryFromEncounter(w http.ResponseWriter, r *http.Request) {
+func (s *Server) RemoveAdversaryFromEncounter(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	
+
 	// Get encounter ID from URL
 	encounterIdStr := chi.URLParam(r, "id")
 	_, err := strconv.ParseInt(encounterIdStr, 10, 64)
@@ -472,7 +511,7 @@ func RemoveAdversaryFromEncounter(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Remove adversary from encounter
-	err = db.RemoveAdversaryFromEncounter(ctx, app.DB, encounterAdversaryID)
+	err = s.Encounters.RemoveAdversaryFromEncounter(ctx, encounterAdversaryID)
 	if err != nil {
 		slog.Error("Failed to remove adversary from encounter", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
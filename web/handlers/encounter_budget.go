@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/juthrbog/adversarytracker/db"
+	"github.com/juthrbog/adversarytracker/internal/budget"
+)
+
+// maxPartySize is the largest party an encounter can be built for
+const maxPartySize = 10
+
+// UpdateEncounterBudget sets the party an encounter is built for and the
+// GM's budget adjustments, then shows the recalculated budget
+func (s *Server) UpdateEncounterBudget(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Get encounter ID from URL
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid encounter ID", http.StatusBadRequest)
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	enc := &db.Encounter{
+		ID:          id,
+		Challenge:   formValueOr(r, "challenge", db.ChallengeStandard),
+		DamageBoost: r.FormValue("damage_boost") != "",
+	}
+	enc.PartySize, _ = strconv.Atoi(r.FormValue("party_size"))
+	enc.PartyTier, _ = strconv.Atoi(r.FormValue("party_tier"))
+
+	if errs := validateParty(enc); len(errs) > 0 {
+		http.Error(w, errs.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Make sure the encounter exists
+	encounter, err := s.Encounters.GetEncounter(ctx, id)
+	if err != nil {
+		slog.Error("Failed to get encounter", "error", err, "id", id)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if encounter == nil {
+		http.Error(w, "Encounter not found", http.StatusNotFound)
+		return
+	}
+
+	if err := s.Encounters.UpdateEncounterParty(ctx, enc); err != nil {
+		slog.Error("Failed to update encounter party", "error", err, "id", id)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Regular form submission, redirect to the encounter
+	if r.Header.Get("HX-Request") != "true" {
+		http.Redirect(w, r, "/encounters/"+idStr, http.StatusSeeOther)
+		return
+	}
+
+	encounter.PartySize = enc.PartySize
+	encounter.PartyTier = enc.PartyTier
+	encounter.Challenge = enc.Challenge
+	encounter.DamageBoost = enc.DamageBoost
+
+	// Parse template
+	tmpl, err := template.ParseFiles(filepath.Join("templates", "encounters", "budget.html"))
+	if err != nil {
+		slog.Error("Failed to parse template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Encounter":  encounter,
+		"Budget":     budget.Calculate(encounter),
+		"Challenges": db.Challenges,
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "budget-panel", data); err != nil {
+		slog.Error("Failed to execute template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// validateParty checks the party settings of an encounter
+func validateParty(enc *db.Encounter) validationErrors {
+	errs := validationErrors{}
+
+	if enc.PartySize < 1 || enc.PartySize > maxPartySize {
+		errs["party_size"] = fmt.Sprintf("must be between 1 and %d", maxPartySize)
+	}
+	if enc.PartyTier < 1 || enc.PartyTier > 4 {
+		errs["party_tier"] = "must be between 1 and 4"
+	}
+	if !db.IsValidChallenge(enc.Challenge) {
+		errs["challenge"] = "must be one of " + strings.Join(db.Challenges, ", ")
+	}
+
+	return errs
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/juthrbog/adversarytracker/db"
+	"github.com/juthrbog/adversarytracker/internal/budget"
+	"github.com/juthrbog/adversarytracker/internal/generator"
+)
+
+// maxGeneratorSeed bounds the seeds picked for a new roll, keeping them short
+// enough to read out at the table
+const maxGeneratorSeed = 1000000
+
+// GenerateEncounterForm displays the encounter generator. Once the party is
+// filled in it rolls an encounter, picking a seed if none was given; HTMX
+// requests get just the rolled encounter.
+func (s *Server) GenerateEncounterForm(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	adversaries, _, err := s.Adversaries.ListAdversaries(ctx, db.ListOptions{})
+	if err != nil {
+		slog.Error("Failed to get adversaries", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Types": adversaryTypes(adversaries),
+		"Tags":  adversaryTags(adversaries),
+		"Seed":  query.Get("seed"),
+	}
+
+	// First visit: a blank form for the default party
+	if !query.Has("party_size") {
+		data["Options"] = generator.Options{PartySize: db.DefaultPartySize, PartyTier: 1}
+		renderGenerator(w, r, data)
+		return
+	}
+
+	// A roll without a seed gets a fresh one
+	if query.Get("seed") == "" {
+		query.Set("seed", strconv.Itoa(rand.Intn(maxGeneratorSeed)))
+	}
+
+	opts, err := parseGeneratorOptions(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data["Options"] = opts
+	data["Query"] = query.Encode()
+
+	encounter, err := generator.Generate(adversaries, opts)
+	if err != nil {
+		data["Error"] = err.Error()
+	} else {
+		data["Encounter"] = encounter
+		data["Budget"] = budget.Calculate(encounter)
+	}
+
+	renderGenerator(w, r, data)
+}
+
+// SaveGeneratedEncounter rolls the encounter described by the submitted
+// options and seed again and saves it
+func (s *Server) SaveGeneratedEncounter(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if r.PostForm.Get("seed") == "" {
+		http.Error(w, "Seed is required", http.StatusBadRequest)
+		return
+	}
+
+	opts, err := parseGeneratorOptions(r.PostForm)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	adversaries, _, err := s.Adversaries.ListAdversaries(ctx, db.ListOptions{})
+	if err != nil {
+		slog.Error("Failed to get adversaries", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	encounter, err := generator.Generate(adversaries, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	// Save to database
+	id, err := s.Encounters.CreateEncounter(ctx, encounter)
+	if err != nil {
+		slog.Error("Failed to create encounter", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Check if this is an HTMX request
+	if r.Header.Get("HX-Request") == "true" {
+		// For HTMX, redirect via response headers
+		w.Header().Set("HX-Redirect", "/encounters/"+strconv.FormatInt(id, 10))
+		return
+	}
+
+	// Regular form submission, redirect to the new encounter
+	http.Redirect(w, r, "/encounters/"+strconv.FormatInt(id, 10), http.StatusSeeOther)
+}
+
+// parseGeneratorOptions reads the generator options from query or form
+// values
+func parseGeneratorOptions(values url.Values) (generator.Options, error) {
+	opts := generator.Options{
+		Type: values.Get("type"),
+		Tag:  values.Get("tag"),
+	}
+
+	var err error
+	opts.PartySize, err = strconv.Atoi(values.Get("party_size"))
+	if err != nil || opts.PartySize < 1 || opts.PartySize > maxPartySize {
+		return opts, fmt.Errorf("party size must be between 1 and %d", maxPartySize)
+	}
+	opts.PartyTier, err = strconv.Atoi(values.Get("party_tier"))
+	if err != nil || opts.PartyTier < 1 || opts.PartyTier > 4 {
+		return opts, errors.New("party tier must be between 1 and 4")
+	}
+	if target := values.Get("target"); target != "" {
+		opts.Target, err = strconv.Atoi(target)
+		if err != nil || opts.Target < 1 {
+			return opts, errors.New("battle points must be a positive number")
+		}
+	}
+	opts.Seed, err = strconv.ParseInt(values.Get("seed"), 10, 64)
+	if err != nil {
+		return opts, errors.New("seed must be a whole number")
+	}
+
+	return opts, nil
+}
+
+// adversaryTypes lists the distinct adversary types in the bestiary
+func adversaryTypes(adversaries []*db.Adversary) []string {
+	seen := make(map[string]bool)
+	var types []string
+	for _, adv := range adversaries {
+		if adv.Type != "" && !seen[adv.Type] {
+			seen[adv.Type] = true
+			types = append(types, adv.Type)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// adversaryTags lists the distinct adversary tags in the bestiary
+func adversaryTags(adversaries []*db.Adversary) []string {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, adv := range adversaries {
+		for _, tag := range adv.TagList() {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// renderGenerator renders the generator page, or only the rolled encounter
+// for HTMX requests
+func renderGenerator(w http.ResponseWriter, r *http.Request, data map[string]interface{}) {
+	files := []string{filepath.Join("templates", "encounters", "generate.html")}
+	name := "generated-encounter"
+	if r.Header.Get("HX-Request") != "true" {
+		files = append([]string{filepath.Join("templates", "layout.html")}, files...)
+		name = "layout"
+	}
+
+	tmpl, err := template.ParseFiles(files...)
+	if err != nil {
+		slog.Error("Failed to parse template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tmpl.ExecuteTemplate(w, name, data); err != nil {
+		slog.Error("Failed to execute template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/juthrbog/adversarytracker/db"
+)
+
+func encounterRoutes(s *Server) http.Handler {
+	return s.EncounterRoutes()
+}
+
+// generatorForm is a roll of the encounter generator for a tier 1 party
+func generatorForm(seed string) url.Values {
+	return url.Values{"party_size": {"4"}, "party_tier": {"1"}, "seed": {seed}}
+}
+
+func TestListEncounters(t *testing.T) {
+	runRouteTests(t, encounterRoutes, []routeTest{
+		{
+			name: "page", method: "GET", target: "/",
+			status: http.StatusOK, contains: []string{pageMarker, "Forest"},
+		},
+		{
+			name: "filtered", method: "GET", target: "/?role=Ranged",
+			status: http.StatusOK, contains: []string{pageMarker}, excludes: []string{"Forest"},
+		},
+		{name: "invalid filter", method: "GET", target: "/?sort=difficulty", status: http.StatusBadRequest},
+		{name: "invalid cursor", method: "GET", target: "/?after=nonsense", status: http.StatusBadRequest},
+		{name: "store down", method: "GET", target: "/", setup: withBrokenStores, status: http.StatusInternalServerError},
+	})
+}
+
+func TestViewEncounter(t *testing.T) {
+	runRouteTests(t, encounterRoutes, []routeTest{
+		{
+			name: "encounter", method: "GET", target: "/1",
+			status: http.StatusOK, contains: []string{pageMarker, "Forest", "Bear", `id="budget-panel"`},
+		},
+		{name: "invalid ID", method: "GET", target: "/forest", status: http.StatusBadRequest},
+		{name: "not found", method: "GET", target: "/99", status: http.StatusNotFound},
+		{name: "store down", method: "GET", target: "/1", setup: withBrokenStores, status: http.StatusInternalServerError},
+	})
+}
+
+func TestNewEncounterForm(t *testing.T) {
+	runRouteTests(t, encounterRoutes, []routeTest{
+		{name: "form", method: "GET", target: "/new", status: http.StatusOK, contains: []string{pageMarker, "<form"}},
+		{name: "store down", method: "GET", target: "/new", setup: withBrokenStores, status: http.StatusInternalServerError},
+	})
+}
+
+func TestCreateEncounter(t *testing.T) {
+	form := url.Values{"name": {"Cave"}, "description": {"Dark and damp."}}
+	created := func(t *testing.T, store *db.MemoryStore) {
+		enc := getEncounter(t, store, nextEncID)
+		if enc == nil || enc.Name != "Cave" || enc.PartySize != db.DefaultPartySize {
+			t.Errorf("created %+v", enc)
+		}
+	}
+
+	runRouteTests(t, encounterRoutes, []routeTest{
+		{
+			name: "form", method: "POST", target: "/", form: form,
+			status: http.StatusSeeOther, redirect: "/encounters/2", check: created,
+		},
+		{
+			name: "htmx", method: "POST", target: "/", form: form, htmx: true,
+			status: http.StatusOK, redirect: "/encounters/2", check: created,
+		},
+		{name: "store down", method: "POST", target: "/", form: form, setup: withBrokenStores, status: http.StatusInternalServerError},
+	})
+}
+
+func TestGenerateEncounter(t *testing.T) {
+	saved := func(t *testing.T, store *db.MemoryStore) {
+		enc := getEncounter(t, store, nextEncID)
+		if enc == nil || len(enc.Adversaries) == 0 || enc.PartySize != 4 {
+			t.Errorf("saved %+v", enc)
+		}
+	}
+
+	runRouteTests(t, encounterRoutes, []routeTest{
+		{
+			name: "form", method: "GET", target: "/generate",
+			status: http.StatusOK, contains: []string{pageMarker, "<form"},
+		},
+		{
+			name: "roll", method: "GET", target: "/generate?" + generatorForm("7").Encode(),
+			status: http.StatusOK, contains: []string{pageMarker, `id="generated-encounter"`},
+		},
+		{
+			name: "roll htmx", method: "GET", target: "/generate?" + generatorForm("").Encode(), htmx: true,
+			status: http.StatusOK, contains: []string{`id="generated-encounter"`}, excludes: []string{pageMarker},
+		},
+		{
+			name: "roll invalid party", method: "GET", target: "/generate?party_size=0&party_tier=1",
+			status: http.StatusBadRequest,
+		},
+		{name: "roll store down", method: "GET", target: "/generate", setup: withBrokenStores, status: http.StatusInternalServerError},
+
+		{
+			name: "save", method: "POST", target: "/generate", form: generatorForm("7"),
+			status: http.StatusSeeOther, redirect: "/encounters/2", check: saved,
+		},
+		{
+			name: "save htmx", method: "POST", target: "/generate", form: generatorForm("7"), htmx: true,
+			status: http.StatusOK, redirect: "/encounters/2", check: saved,
+		},
+		{name: "save without seed", method: "POST", target: "/generate", form: generatorForm(""), status: http.StatusBadRequest},
+		{
+			name: "save with nothing to roll", method: "POST", target: "/generate",
+			form:   url.Values{"party_size": {"4"}, "party_tier": {"1"}, "seed": {"7"}, "tag": {"undead"}},
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "save store down", method: "POST", target: "/generate", form: generatorForm("7"), setup: withBrokenStores,
+			status: http.StatusInternalServerError,
+		},
+	})
+}
+
+func TestEditEncounterForm(t *testing.T) {
+	runRouteTests(t, encounterRoutes, []routeTest{
+		{
+			name: "form", method: "GET", target: "/1/edit",
+			status: http.StatusOK, contains: []string{pageMarker, `value="Forest"`},
+		},
+		{name: "invalid ID", method: "GET", target: "/forest/edit", status: http.StatusBadRequest},
+		{name: "not found", method: "GET", target: "/99/edit", status: http.StatusNotFound},
+		{name: "store down", method: "GET", target: "/1/edit", setup: withBrokenStores, status: http.StatusInternalServerError},
+	})
+}
+
+func TestUpdateEncounter(t *testing.T) {
+	form := url.Values{"name": {"Deep Forest"}, "description": {"Darker now."}}
+	updated := func(t *testing.T, store *db.MemoryStore) {
+		enc := getEncounter(t, store, forestID)
+		if enc.Name != "Deep Forest" || enc.Description != "Darker now." || len(enc.Adversaries) != 1 {
+			t.Errorf("updated to %+v", enc)
+		}
+	}
+
+	runRouteTests(t, encounterRoutes, []routeTest{
+		{
+			name: "form", method: "POST", target: "/1", form: form,
+			status: http.StatusSeeOther, redirect: "/encounters/1", check: updated,
+		},
+		{
+			name: "htmx", method: "POST", target: "/1", form: form, htmx: true,
+			status: http.StatusOK, redirect: "/encounters/1", check: updated,
+		},
+		{name: "invalid ID", method: "POST", target: "/forest", form: form, status: http.StatusBadRequest},
+		{name: "store down", method: "POST", target: "/1", form: form, setup: withBrokenStores, status: http.StatusInternalServerError},
+	})
+}
+
+func TestDeleteEncounter(t *testing.T) {
+	deleted := func(t *testing.T, store *db.MemoryStore) {
+		if getEncounter(t, store, forestID) != nil {
+			t.Error("forest was not deleted")
+		}
+		if getAdversary(t, store, bearID) == nil {
+			t.Error("deleting the forest deleted the bear")
+		}
+	}
+
+	runRouteTests(t, encounterRoutes, []routeTest{
+		{
+			name: "htmx", method: "DELETE", target: "/1", htmx: true,
+			status: http.StatusOK, redirect: "/encounters", check: deleted,
+		},
+		{
+			name: "form", method: "POST", target: "/1/delete",
+			status: http.StatusSeeOther, redirect: "/encounters", check: deleted,
+		},
+		{name: "invalid ID", method: "DELETE", target: "/forest", status: http.StatusBadRequest},
+		{name: "store down", method: "POST", target: "/1/delete", setup: withBrokenStores, status: http.StatusInternalServerError},
+	})
+}
+
+func TestAddAdversaryModal(t *testing.T) {
+	runRouteTests(t, encounterRoutes, []routeTest{
+		{
+			name: "modal", method: "GET", target: "/add-adversary/2", htmx: true,
+			status: http.StatusOK, contains: []string{`id="add-adversary-modal"`, "Archer Guard", "Forest (2 adversaries"},
+			excludes: []string{pageMarker},
+		},
+		{name: "invalid ID", method: "GET", target: "/add-adversary/guard", status: http.StatusBadRequest},
+		{name: "not found", method: "GET", target: "/add-adversary/99", status: http.StatusNotFound},
+		{name: "adversaries down", method: "GET", target: "/add-adversary/2", setup: withBrokenStores, status: http.StatusInternalServerError},
+		{
+			name: "encounters down", method: "GET", target: "/add-adversary/2", setup: withBrokenEncounters,
+			status: http.StatusInternalServerError,
+		},
+	})
+}
+
+func TestAddAdversaryToEncounter(t *testing.T) {
+	counts := func(want map[int64]int) func(t *testing.T, store *db.MemoryStore) {
+		return func(t *testing.T, store *db.MemoryStore) {
+			t.Helper()
+			enc := getEncounter(t, store, forestID)
+			if len(enc.Adversaries) != len(want) {
+				t.Fatalf("forest has %d adversaries, want %d", len(enc.Adversaries), len(want))
+			}
+			for _, ea := range enc.Adversaries {
+				if ea.Count != want[ea.AdversaryID] {
+					t.Errorf("forest has %d of adversary %d, want %d", ea.Count, ea.AdversaryID, want[ea.AdversaryID])
+				}
+			}
+		}
+	}
+
+	runRouteTests(t, encounterRoutes, []routeTest{
+		{
+			name: "form", method: "POST", target: "/1/adversaries", form: url.Values{"adversary_id": {"2"}, "count": {"3"}},
+			status: http.StatusSeeOther, redirect: "/encounters/1", check: counts(map[int64]int{bearID: 2, guardID: 3}),
+		},
+		{
+			name: "htmx", method: "POST", target: "/1/adversaries", form: url.Values{"adversary_id": {"2"}}, htmx: true,
+			status: http.StatusOK, redirect: "/encounters/1", check: counts(map[int64]int{bearID: 2, guardID: 1}),
+		},
+		{
+			name: "again sets the count", method: "POST", target: "/1/adversaries", form: url.Values{"adversary_id": {"1"}, "count": {"5"}},
+			status: http.StatusSeeOther, redirect: "/encounters/1", check: counts(map[int64]int{bearID: 5}),
+		},
+		{
+			name: "invalid encounter ID", method: "POST", target: "/forest/adversaries", form: url.Values{"adversary_id": {"2"}},
+			status: http.StatusBadRequest,
+		},
+		{
+			name: "invalid adversary ID", method: "POST", target: "/1/adversaries", form: url.Values{"adversary_id": {"guard"}},
+			status: http.StatusBadRequest,
+		},
+		{
+			name: "missing adversary", method: "POST", target: "/1/adversaries", form: url.Values{"adversary_id": {"99"}},
+			status: http.StatusInternalServerError, check: counts(map[int64]int{bearID: 2}),
+		},
+		{
+			name: "store down", method: "POST", target: "/1/adversaries", form: url.Values{"adversary_id": {"2"}}, setup: withBrokenStores,
+			status: http.StatusInternalServerError,
+		},
+	})
+}
+
+func TestRemoveAdversaryFromEncounter(t *testing.T) {
+	removed := func(t *testing.T, store *db.MemoryStore) {
+		if enc := getEncounter(t, store, forestID); len(enc.Adversaries) != 0 {
+			t.Error("bears are still in the forest")
+		}
+	}
+
+	runRouteTests(t, encounterRoutes, []routeTest{
+		{
+			name: "htmx", method: "DELETE", target: "/1/adversaries/1", htmx: true,
+			status: http.StatusOK, redirect: "/encounters/1", check: removed,
+		},
+		{
+			name: "form", method: "POST", target: "/1/adversaries/1/delete",
+			status: http.StatusSeeOther, redirect: "/encounters/1", check: removed,
+		},
+		{name: "invalid encounter ID", method: "DELETE", target: "/forest/adversaries/1", status: http.StatusBadRequest},
+		{name: "invalid adversary ID", method: "DELETE", target: "/1/adversaries/bears", status: http.StatusBadRequest},
+		{name: "store down", method: "DELETE", target: "/1/adversaries/1", setup: withBrokenStores, status: http.StatusInternalServerError},
+	})
+}
+
+func TestUpdateEncounterBudget(t *testing.T) {
+	form := url.Values{"party_size": {"5"}, "party_tier": {"2"}, "challenge": {db.ChallengeHarder}, "damage_boost": {"on"}}
+	updated := func(t *testing.T, store *db.MemoryStore) {
+		enc := getEncounter(t, store, forestID)
+		if enc.PartySize != 5 || enc.PartyTier != 2 || enc.Challenge != db.ChallengeHarder || !enc.DamageBoost {
+			t.Errorf("party set to %+v", enc)
+		}
+	}
+
+	runRouteTests(t, encounterRoutes, []routeTest{
+		{
+			name: "form", method: "POST", target: "/1/budget", form: form,
+			status: http.StatusSeeOther, redirect: "/encounters/1", check: updated,
+		},
+		{
+			name: "htmx", method: "POST", target: "/1/budget", form: form, htmx: true,
+			status: http.StatusOK, contains: []string{`id="budget-panel"`}, excludes: []string{pageMarker}, check: updated,
+		},
+		{
+			name: "invalid party", method: "POST", target: "/1/budget", form: url.Values{"party_size": {"0"}, "party_tier": {"2"}},
+			status: http.StatusBadRequest,
+		},
+		{name: "invalid ID", method: "POST", target: "/forest/budget", form: form, status: http.StatusBadRequest},
+		{name: "not found", method: "POST", target: "/99/budget", form: form, status: http.StatusNotFound},
+		{name: "store down", method: "POST", target: "/1/budget", form: form, setup: withBrokenStores, status: http.StatusInternalServerError},
+	})
+}
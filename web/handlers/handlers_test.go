@@ -0,0 +1,399 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/juthrbog/adversarytracker/db"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// TestMain runs the tests from the repository root, where the handlers find
+// their templates, and keeps the expected error logs out of the output
+func TestMain(m *testing.M) {
+	if err := os.Chdir(filepath.Join("..", "..")); err != nil {
+		panic(err)
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// The records every test server starts with, in a fresh memory store
+const (
+	bearID      = 1 // homebrew, with features bearClawsID and bearRoarID
+	guardID     = 2 // read-only SRD adversary
+	nextAdvID   = 3 // the next adversary created
+	bearClawsID = 1
+	bearRoarID  = 2
+	guardFeatID = 3
+
+	forestID      = 1 // encounter with two bears
+	forestBearsID = 1 // the bears' place in the forest
+	nextEncID     = 2 // the next encounter created
+)
+
+// The records of the fight under way in the forest for route tests with
+// fight set
+const (
+	fightID          = 1 // the combat session
+	fightBearID      = 1 // Bear 1, who is Restrained
+	fightOtherBearID = 2 // Bear 2
+	fightCountdownID = 1 // "Collapse", a standard countdown starting at 3
+	fightConditionID = 1 // Bear 1's Restrained condition
+)
+
+// newTestServer returns a server backed by a memory store holding the test
+// records, an empty SQLite database for combat sessions and a combat event
+// hub
+func newTestServer(t *testing.T) (*Server, *db.MemoryStore) {
+	t.Helper()
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+
+	bear := &db.Adversary{Name: "Bear", Type: "Beast", Tier: 1, Role: "Bruiser", Difficulty: 13, HitPoints: 7, Stress: 2, Tags: "forest"}
+	if _, err := store.CreateAdversary(ctx, bear); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []*db.AdversaryFeature{
+		{AdversaryID: bearID, Kind: "Action", Name: "Claws"},
+		{AdversaryID: bearID, Kind: "Reaction", Name: "Roar"},
+	} {
+		if _, err := store.CreateAdversaryFeature(ctx, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	guard := &db.Adversary{
+		Name: "Archer Guard", Type: "Humanoid", Tier: 1, Role: "Ranged", Difficulty: 10, HitPoints: 3,
+		Features: []*db.AdversaryFeature{{Kind: "Passive", Name: "Volley"}},
+	}
+	if _, _, err := store.SeedLibrary(ctx, []*db.Adversary{guard}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := store.CreateEncounter(ctx, &db.Encounter{
+		Name:        "Forest",
+		Adversaries: []*db.EncounterAdversary{{AdversaryID: bearID, Count: 2}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Server{Adversaries: store, Encounters: store, DB: newCombatDB(t), Events: NewCombatEvents()}, store
+}
+
+// newCombatDB creates a migrated SQLite database in a temporary directory,
+// for the combat sessions the encounter page looks up
+func newCombatDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=on&_txlock=immediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if _, err := db.Migrate(context.Background(), conn); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// newCombatServer returns a server whose stores and combat sessions share a
+// SQLite database holding the forest encounter, for the combat routes, which
+// need the encounter's adversaries in the same database as the fight
+func newCombatServer(t *testing.T) *Server {
+	t.Helper()
+	ctx := context.Background()
+	conn := newCombatDB(t)
+	store := db.NewSQLiteStore(conn)
+
+	bear := &db.Adversary{Name: "Bear", Type: "Beast", Tier: 1, Role: "Bruiser", Difficulty: 13, HitPoints: 7, Stress: 2}
+	if _, err := store.CreateAdversary(ctx, bear); err != nil {
+		t.Fatal(err)
+	}
+	_, err := store.CreateEncounter(ctx, &db.Encounter{
+		Name:        "Forest",
+		Adversaries: []*db.EncounterAdversary{{AdversaryID: bearID, Count: 2}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Server{Adversaries: store, Encounters: store, DB: conn, Events: NewCombatEvents()}
+}
+
+// startForestFight starts combat in the forest of a combat test server,
+// with a countdown and a condition in play
+func startForestFight(t *testing.T, s *Server) {
+	t.Helper()
+	ctx := context.Background()
+
+	enc, err := s.Encounters.GetEncounter(ctx, forestID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionID, err := db.StartCombatSession(ctx, s.DB, enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	countdown := &db.Countdown{
+		SessionID: sessionID, Name: "Collapse", Kind: db.CountdownStandard,
+		Purpose: db.CountdownConsequence, TickOn: db.TickOnRoll, StartValue: 3,
+	}
+	if _, err := db.CreateCountdown(ctx, s.DB, countdown); err != nil {
+		t.Fatal(err)
+	}
+	condition := &db.CombatantCondition{CombatantID: fightBearID, Name: db.ConditionRestrained, Expires: db.ExpiresUntilCleared, Public: true}
+	if err := db.AddCombatantCondition(ctx, s.DB, condition); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// withDatabaseDown closes the combat database of a test server
+func withDatabaseDown(s *Server, store *db.MemoryStore) {
+	s.DB.Close()
+}
+
+// withReportsDown drops the combat reports table of a test server, so that
+// ending a fight cannot report it
+func withReportsDown(s *Server, store *db.MemoryStore) {
+	if _, err := s.DB.Exec(`DROP TABLE combat_reports`); err != nil {
+		panic(err)
+	}
+}
+
+// errStoreDown is returned by every call to a brokenStore
+var errStoreDown = errors.New("store is down")
+
+// brokenStore is a store whose database has gone away. Its records can
+// still be seeded through the memory store it wraps, but every call a
+// handler makes first fails.
+type brokenStore struct {
+	*db.MemoryStore
+}
+
+func (brokenStore) ListAdversaries(context.Context, db.ListOptions) ([]*db.Adversary, string, error) {
+	return nil, "", errStoreDown
+}
+
+func (brokenStore) SearchAdversaries(context.Context, string, int) ([]*db.SearchResult, error) {
+	return nil, errStoreDown
+}
+
+func (brokenStore) GetAdversary(context.Context, int64) (*db.Adversary, error) {
+	return nil, errStoreDown
+}
+
+func (brokenStore) CreateAdversary(context.Context, *db.Adversary) (int64, error) {
+	return 0, errStoreDown
+}
+
+func (brokenStore) PlanImport(context.Context, []*db.Adversary, string) ([]*db.ImportItem, error) {
+	return nil, errStoreDown
+}
+
+func (brokenStore) ImportAdversaries(context.Context, []*db.Adversary, string) ([]*db.ImportItem, error) {
+	return nil, errStoreDown
+}
+
+func (brokenStore) ListEncounters(context.Context, db.ListOptions) ([]*db.Encounter, string, error) {
+	return nil, "", errStoreDown
+}
+
+func (brokenStore) GetEncounterSummaries(context.Context) ([]*db.EncounterSummary, error) {
+	return nil, errStoreDown
+}
+
+func (brokenStore) GetEncounter(context.Context, int64) (*db.Encounter, error) {
+	return nil, errStoreDown
+}
+
+func (brokenStore) CreateEncounter(context.Context, *db.Encounter) (int64, error) {
+	return 0, errStoreDown
+}
+
+func (brokenStore) UpdateEncounter(context.Context, *db.Encounter) error {
+	return errStoreDown
+}
+
+func (brokenStore) DeleteEncounter(context.Context, int64) error {
+	return errStoreDown
+}
+
+func (brokenStore) SetEncounterAdversary(context.Context, *db.EncounterAdversary) (int64, error) {
+	return 0, errStoreDown
+}
+
+func (brokenStore) RemoveAdversaryFromEncounter(context.Context, int64) error {
+	return errStoreDown
+}
+
+// withBrokenStores makes every store of a test server fail
+func withBrokenStores(s *Server, store *db.MemoryStore) {
+	s.Adversaries = brokenStore{store}
+	s.Encounters = brokenStore{store}
+}
+
+// withBrokenEncounters makes only the encounter store of a test server fail
+func withBrokenEncounters(s *Server, store *db.MemoryStore) {
+	s.Encounters = brokenStore{store}
+}
+
+// routeTest is a request to a router and the response it should get
+type routeTest struct {
+	name     string
+	method   string
+	target   string
+	form     url.Values // sent as an urlencoded body
+	json     string     // sent as a JSON body
+	htmx     bool       // sent as an HTMX request
+	hxTarget string     // HX-Target header
+
+	// fight sends the request to a combat test server with a fight under
+	// way in the forest (see startForestFight) instead of the memory store
+	// server. Its setup gets a nil store.
+	fight bool
+
+	setup func(s *Server, store *db.MemoryStore) // changes the test server before the request
+
+	status   int
+	redirect string   // Location header, or HX-Redirect for HTMX requests
+	contains []string // substrings of the response body
+	excludes []string // substrings the response body must not have
+
+	check      func(t *testing.T, store *db.MemoryStore)     // checks the store after the request
+	checkFight func(t *testing.T, session *db.CombatSession) // checks the fight after the request
+}
+
+// runRouteTests sends each request to the router that routes builds for a
+// fresh test server
+func runRouteTests(t *testing.T, routes func(s *Server) http.Handler, tests []routeTest) {
+	t.Helper()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s *Server
+			var store *db.MemoryStore
+			if tt.fight {
+				s = newCombatServer(t)
+				startForestFight(t, s)
+			} else {
+				s, store = newTestServer(t)
+			}
+			if tt.setup != nil {
+				tt.setup(s, store)
+			}
+
+			var body io.Reader
+			switch {
+			case tt.form != nil:
+				body = strings.NewReader(tt.form.Encode())
+			case tt.json != "":
+				body = strings.NewReader(tt.json)
+			}
+			r := httptest.NewRequest(tt.method, tt.target, body)
+			switch {
+			case tt.form != nil:
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			case tt.json != "":
+				r.Header.Set("Content-Type", "application/json")
+			}
+			if tt.htmx {
+				r.Header.Set("HX-Request", "true")
+			}
+			if tt.hxTarget != "" {
+				r.Header.Set("HX-Target", tt.hxTarget)
+			}
+
+			w := httptest.NewRecorder()
+			routes(s).ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("%s %s: status %d, want %d\n%s", tt.method, tt.target, w.Code, tt.status, w.Body.String())
+			}
+
+			if tt.redirect != "" {
+				header := "Location"
+				if tt.htmx {
+					header = "HX-Redirect"
+				}
+				if got := w.Header().Get(header); got != tt.redirect {
+					t.Errorf("%s header is %q, want %q", header, got, tt.redirect)
+				}
+			}
+
+			for _, s := range tt.contains {
+				if !strings.Contains(w.Body.String(), s) {
+					t.Errorf("response does not contain %q", s)
+				}
+			}
+			for _, s := range tt.excludes {
+				if strings.Contains(w.Body.String(), s) {
+					t.Errorf("response contains %q", s)
+				}
+			}
+
+			if tt.check != nil {
+				tt.check(t, store)
+			}
+			if tt.checkFight != nil {
+				session, err := db.GetCombatSessionByID(context.Background(), s.DB, fightID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				tt.checkFight(t, session)
+			}
+		})
+	}
+}
+
+// pageMarker is in every full page, and in no partial
+const pageMarker = "<!DOCTYPE html>"
+
+// validAdversaryForm is a complete statblock form submission
+func validAdversaryForm(name string) url.Values {
+	return url.Values{
+		"name":       {name},
+		"type":       {"Beast"},
+		"tier":       {"2"},
+		"role":       {"Skulk"},
+		"difficulty": {"14"},
+		"hit_points": {"5"},
+		"stress":     {"3"},
+		"tags":       {"Cave, Forest"},
+	}
+}
+
+// getAdversary loads an adversary from a test store
+func getAdversary(t *testing.T, store *db.MemoryStore, id int64) *db.Adversary {
+	t.Helper()
+
+	adv, err := store.GetAdversary(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return adv
+}
+
+// getEncounter loads an encounter from a test store
+func getEncounter(t *testing.T, store *db.MemoryStore, id int64) *db.Encounter {
+	t.Helper()
+
+	enc, err := store.GetEncounter(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enc
+}
@@ -8,7 +8,7 @@ import (
 )
 
 // Home handles the root path and renders the welcome page
-func Home(w http.ResponseWriter, r *http.Request) {
+func (s *Server) Home(w http.ResponseWriter, r *http.Request) {
 	// Parse templates
 	tmpl, err := template.ParseFiles(
 		filepath.Join("templates", "layout.html"),
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/juthrbog/adversarytracker/db"
+	"github.com/juthrbog/adversarytracker/internal/pack"
+	"github.com/juthrbog/adversarytracker/internal/srd"
+)
+
+// LibraryRoutes returns a router with the SRD library routes
+func (s *Server) LibraryRoutes() chi.Router {
+	r := chi.NewRouter()
+
+	r.Get("/", s.ViewLibrary)
+	r.Post("/seed", s.SeedLibrary)
+	r.Post("/adversaries/{slug}/copy", s.CopyLibraryAdversary)
+
+	return r
+}
+
+// libraryEntry is a library adversary with the slug its copy action uses
+type libraryEntry struct {
+	*pack.Adversary
+	Slug string
+}
+
+// ViewLibrary displays the SRD adversaries and environments
+func (s *Server) ViewLibrary(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	library, err := srd.Adversaries()
+	if err != nil {
+		slog.Error("Failed to load SRD adversaries", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	environments, err := srd.Environments()
+	if err != nil {
+		slog.Error("Failed to load SRD environments", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	entries := make([]libraryEntry, len(library.Adversaries))
+	for i, adv := range library.Adversaries {
+		entries[i] = libraryEntry{Adversary: adv, Slug: srd.Slug(adv.Name)}
+	}
+
+	// Count the library adversaries already seeded into the bestiary
+	adversaries, _, err := s.Adversaries.ListAdversaries(ctx, db.ListOptions{})
+	if err != nil {
+		slog.Error("Failed to get adversaries", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	seeded := 0
+	for _, adv := range adversaries {
+		if adv.ReadOnly() {
+			seeded++
+		}
+	}
+
+	// Parse templates
+	tmpl, err := template.ParseFiles(
+		filepath.Join("templates", "layout.html"),
+		filepath.Join("templates", "library", "list.html"),
+	)
+	if err != nil {
+		slog.Error("Failed to parse template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Render template
+	data := map[string]interface{}{
+		"Library":      library,
+		"Adversaries":  entries,
+		"Environments": environments,
+		"Seeded":       seeded,
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
+		slog.Error("Failed to execute template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// SeedLibrary adds the SRD adversaries to the bestiary as read-only
+// adversaries, refreshing any seeded before
+func (s *Server) SeedLibrary(w http.ResponseWriter, r *http.Request) {
+	library, err := srd.Adversaries()
+	if err != nil {
+		slog.Error("Failed to load SRD adversaries", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	created, updated, err := s.Adversaries.SeedLibrary(r.Context(), library.DBAdversaries())
+	if err != nil {
+		slog.Error("Failed to seed SRD library", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	slog.Info("Seeded SRD library", "created", created, "updated", updated)
+
+	// Check if this is an HTMX request
+	if r.Header.Get("HX-Request") == "true" {
+		// For HTMX, redirect via response headers
+		w.Header().Set("HX-Redirect", "/adversaries")
+		return
+	}
+
+	// Regular form submission, redirect to the adversary list
+	http.Redirect(w, r, "/adversaries", http.StatusSeeOther)
+}
+
+// CopyLibraryAdversary copies an SRD adversary into the bestiary as an
+// editable homebrew adversary
+func (s *Server) CopyLibraryAdversary(w http.ResponseWriter, r *http.Request) {
+	adv, err := srd.FindAdversary(chi.URLParam(r, "slug"))
+	if err != nil {
+		slog.Error("Failed to load SRD adversaries", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if adv == nil {
+		http.Error(w, "Adversary not found", http.StatusNotFound)
+		return
+	}
+
+	p := &pack.Pack{Adversaries: []*pack.Adversary{adv}}
+	s.copyToBestiary(w, r, p.DBAdversaries()[0])
+}
+
+// CopyAdversary copies an adversary, typically a read-only SRD adversary,
+// into the bestiary as an editable homebrew adversary
+func (s *Server) CopyAdversary(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Get adversary ID from URL
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid adversary ID", http.StatusBadRequest)
+		return
+	}
+
+	// Get adversary, with its features, from database
+	adversary, err := s.Adversaries.GetAdversary(ctx, id)
+	if err != nil {
+		slog.Error("Failed to get adversary", "error", err, "id", id)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if adversary == nil {
+		http.Error(w, "Adversary not found", http.StatusNotFound)
+		return
+	}
+
+	s.copyToBestiary(w, r, adversary)
+}
+
+// copyToBestiary stores a homebrew copy of an adversary, under a new name if
+// its own is taken, and sends the user to edit it
+func (s *Server) copyToBestiary(w http.ResponseWriter, r *http.Request, adv *db.Adversary) {
+	items, err := s.Adversaries.ImportAdversaries(r.Context(), []*db.Adversary{adv}, db.ConflictRename)
+	if err != nil {
+		slog.Error("Failed to copy adversary", "error", err, "name", adv.Name)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	editURL := "/adversaries/" + strconv.FormatInt(items[0].ID, 10) + "/edit"
+
+	// Check if this is an HTMX request
+	if r.Header.Get("HX-Request") == "true" {
+		// For HTMX, redirect via response headers
+		w.Header().Set("HX-Redirect", editURL)
+		return
+	}
+
+	// Regular form submission, redirect to the copy's edit page
+	http.Redirect(w, r, editURL, http.StatusSeeOther)
+}
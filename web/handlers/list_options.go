@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/juthrbog/adversarytracker/db"
+	"github.com/juthrbog/adversarytracker/internal/openapi"
+)
+
+// Page sizes of the adversary and encounter list pages
+const (
+	adversaryPageSize = 24
+	encounterPageSize = 18
+)
+
+// maxPageSize is the largest page a list can be asked for
+const maxPageSize = 100
+
+// Sort orders accepted in the order query parameter
+const (
+	orderAsc  = "asc"
+	orderDesc = "desc"
+)
+
+// parseListOptions reads list options from a query string: the type, tier,
+// role and tag filters, the sort field and order, the page cursor and the
+// page size. sortFields are the fields the list can be sorted by, and
+// pageSize the page size when none is given.
+func parseListOptions(values url.Values, sortFields []string, pageSize int) (db.ListOptions, validationErrors) {
+	errs := validationErrors{}
+	opts := db.ListOptions{
+		Type:  strings.TrimSpace(values.Get("type")),
+		Role:  values.Get("role"),
+		Tag:   strings.ToLower(strings.TrimSpace(values.Get("tag"))),
+		Sort:  values.Get("sort"),
+		After: values.Get("after"),
+		Limit: pageSize,
+	}
+
+	if tier := values.Get("tier"); tier != "" {
+		var err error
+		opts.Tier, err = strconv.Atoi(tier)
+		if err != nil || opts.Tier < 1 || opts.Tier > 4 {
+			errs["tier"] = "must be between 1 and 4"
+		}
+	}
+	if opts.Role != "" && !db.IsValidRole(opts.Role) {
+		errs["role"] = "must be one of " + strings.Join(db.AdversaryRoles, ", ")
+	}
+	if opts.Sort != "" && !contains(sortFields, opts.Sort) {
+		errs["sort"] = "must be one of " + strings.Join(sortFields, ", ")
+	}
+
+	switch values.Get("order") {
+	case "", orderAsc:
+	case orderDesc:
+		opts.Desc = true
+	default:
+		errs["order"] = "must be " + orderAsc + " or " + orderDesc
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		var err error
+		opts.Limit, err = strconv.Atoi(limit)
+		if err != nil || opts.Limit < 1 || opts.Limit > maxPageSize {
+			errs["limit"] = fmt.Sprintf("must be between 1 and %d", maxPageSize)
+		}
+	}
+
+	return opts, errs
+}
+
+// listValues encodes list options as a query string, leaving out defaults so
+// the same view always has the same URL
+func listValues(opts db.ListOptions, pageSize int) url.Values {
+	values := url.Values{}
+	if opts.Type != "" {
+		values.Set("type", opts.Type)
+	}
+	if opts.Tier != 0 {
+		values.Set("tier", strconv.Itoa(opts.Tier))
+	}
+	if opts.Role != "" {
+		values.Set("role", opts.Role)
+	}
+	if opts.Tag != "" {
+		values.Set("tag", opts.Tag)
+	}
+	if opts.Sort != "" && opts.Sort != "name" {
+		values.Set("sort", opts.Sort)
+	}
+	if opts.Desc {
+		values.Set("order", orderDesc)
+	}
+	if opts.Limit != pageSize {
+		values.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.After != "" {
+		values.Set("after", opts.After)
+	}
+	return values
+}
+
+// pageURL is the URL of a list page: path with the list options, and the
+// cursor of the page if after is set
+func pageURL(path string, opts db.ListOptions, pageSize int, after string) string {
+	opts.After = after
+	query := listValues(opts, pageSize).Encode()
+	if query == "" {
+		return path
+	}
+	return path + "?" + query
+}
+
+// setNextLink points the rel="next" Link header at the page after the one
+// being returned, if there is one
+func setNextLink(w http.ResponseWriter, r *http.Request, opts db.ListOptions, next string) {
+	if next != "" {
+		w.Header().Set("Link", "<"+pageURL(r.URL.Path, opts, 0, next)+`>; rel="next"`)
+	}
+}
+
+// listParameters documents the query parameters of a list endpoint. match
+// describes what the adversary filters match and tier what the tier filter
+// matches.
+func listParameters(sortFields []string, match, tier string) []*openapi.Parameter {
+	query := func(name, description string, schema *openapi.Schema) *openapi.Parameter {
+		return &openapi.Parameter{Name: name, In: "query", Description: description, Schema: schema}
+	}
+	return []*openapi.Parameter{
+		query("type", match+" of this type, case-insensitive", openapi.String()),
+		query("tier", tier, openapi.Integer().Min(1).Max(4)),
+		query("role", match+" of this role", openapi.String().OneOf(db.AdversaryRoles...)),
+		query("tag", match+" tagged with this tag", openapi.String()),
+		query("sort", "Field to sort by; name if not set", openapi.String().OneOf(sortFields...)),
+		query("order", "Sort order", openapi.String().OneOf(orderAsc, orderDesc)),
+		query("limit", "Page size; every match if not set", openapi.Integer().Min(1).Max(maxPageSize)),
+		query("after", `Page cursor, from the rel="next" Link header of the previous page`, openapi.String()),
+	}
+}
+
+// contains reports whether values contains s
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
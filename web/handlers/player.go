@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/juthrbog/adversarytracker/db"
+	"github.com/juthrbog/adversarytracker/internal/combat"
+	"github.com/juthrbog/adversarytracker/internal/events"
+)
+
+// playerSession is what the players see of a combat session: who holds the
+// spotlight, how hurt each adversary looks and what conditions it has, but
+// none of the stats, thresholds, Fear or countdowns the GM keeps hidden
+type playerSession struct {
+	Active       bool               `json:"active"`
+	Spotlight    string             `json:"spotlight"`
+	GMTurn       int                `json:"gm_turn"`
+	TrackerMode  string             `json:"tracker_mode"`
+	ActionTokens int                `json:"action_tokens"`
+	Combatants   []*playerCombatant `json:"combatants"`
+	Countdowns   []*playerCountdown `json:"countdowns"`
+}
+
+// playerCombatant is what the players see of a combatant
+type playerCombatant struct {
+	Name       string             `json:"name"`
+	Health     string             `json:"health"` // one of the combat.Health bands
+	Acted      bool               `json:"acted"`
+	Conditions []string           `json:"conditions"`
+	Countdowns []*playerCountdown `json:"countdowns"`
+}
+
+// playerCountdown is a countdown the GM has shown to the players
+type playerCountdown struct {
+	Name       string `json:"name"`
+	Purpose    string `json:"purpose"`
+	Value      int    `json:"value"`
+	StartValue int    `json:"start_value"`
+	Looping    bool   `json:"looping"`
+}
+
+// IsGMTurn reports whether the GM holds the spotlight
+func (s *playerSession) IsGMTurn() bool {
+	return s.Spotlight == db.SpotlightGM
+}
+
+// newPlayerSession redacts a combat session for the player view. Countdowns
+// and conditions are shown only if the GM made them public, and conditions by
+// name only.
+func newPlayerSession(session *db.CombatSession) *playerSession {
+	ps := &playerSession{
+		Active:       session.Status == db.CombatActive,
+		Spotlight:    session.Spotlight,
+		GMTurn:       session.GMTurn,
+		TrackerMode:  session.TrackerMode,
+		ActionTokens: session.ActionTokens,
+		Combatants:   []*playerCombatant{},
+		Countdowns:   publicCountdowns(session.Countdowns),
+	}
+
+	for _, c := range session.Combatants {
+		pc := &playerCombatant{
+			Name:       c.Name,
+			Health:     combat.HealthBand(c),
+			Acted:      c.Acted,
+			Conditions: []string{},
+			Countdowns: publicCountdowns(c.Countdowns),
+		}
+		for _, cond := range c.Conditions {
+			if cond.Public {
+				pc.Conditions = append(pc.Conditions, cond.Name)
+			}
+		}
+		ps.Combatants = append(ps.Combatants, pc)
+	}
+
+	return ps
+}
+
+// publicCountdowns returns the countdowns the GM has shown to the players
+func publicCountdowns(countdowns []*db.Countdown) []*playerCountdown {
+	public := []*playerCountdown{}
+	for _, c := range countdowns {
+		if c.Public {
+			public = append(public, &playerCountdown{
+				Name:       c.Name,
+				Purpose:    c.Purpose,
+				Value:      c.Value,
+				StartValue: c.StartValue,
+				Looping:    c.Looping,
+			})
+		}
+	}
+	return public
+}
+
+// PlayerRoutes returns a router with the read-only player view of combat
+// sessions, reached through each session's unguessable player token
+func (s *Server) PlayerRoutes() chi.Router {
+	r := chi.NewRouter()
+
+	r.Get("/{token}", s.PlayerView)
+	r.Get("/{token}/tracker", s.PlayerTracker)
+	r.Get("/{token}/events", s.PlayerEvents)
+
+	return r
+}
+
+// PlayerView displays the player view of a combat session
+func (s *Server) PlayerView(w http.ResponseWriter, r *http.Request) {
+	session, ok := s.loadPlayerSession(w, r)
+	if !ok {
+		return
+	}
+
+	data := map[string]interface{}{
+		"Token":         session.PlayerToken,
+		"Player":        newPlayerSession(session),
+		"TrackerEvents": trackerEvents,
+	}
+
+	// Parse templates
+	tmpl, err := template.ParseFiles(
+		filepath.Join("templates", "layout.html"),
+		filepath.Join("templates", "play", "view.html"),
+	)
+	if err != nil {
+		slog.Error("Failed to parse template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Render template
+	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
+		slog.Error("Failed to execute template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// PlayerTracker returns the player tracker partial of a combat session, for
+// the player view to reload when the fight changes
+func (s *Server) PlayerTracker(w http.ResponseWriter, r *http.Request) {
+	session, ok := s.loadPlayerSession(w, r)
+	if !ok {
+		return
+	}
+
+	data := map[string]interface{}{
+		"Token":  session.PlayerToken,
+		"Player": newPlayerSession(session),
+	}
+
+	// Parse template
+	tmpl, err := template.ParseFiles(
+		filepath.Join("templates", "play", "view.html"),
+	)
+	if err != nil {
+		slog.Error("Failed to parse template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "player-tracker", data); err != nil {
+		slog.Error("Failed to execute template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// PlayerEvents streams the changes to a combat session as Server-Sent
+// Events, like CombatEvents, with each session redacted for the players.
+// Fear changes and later fights of the same encounter are left out.
+func (s *Server) PlayerEvents(w http.ResponseWriter, r *http.Request) {
+	session, ok := s.loadPlayerSession(w, r)
+	if !ok {
+		return
+	}
+
+	reset := func(ctx context.Context) ([]byte, error) {
+		current, err := db.GetCombatSessionByID(ctx, s.DB, session.ID)
+		if err != nil {
+			return nil, err
+		}
+		if current == nil {
+			return []byte("null"), nil
+		}
+		return json.Marshal(newPlayerSession(current))
+	}
+
+	filter := func(ev events.Event) (events.Event, bool) {
+		if ev.Type == CombatEventFear {
+			return ev, false
+		}
+
+		var changed *db.CombatSession
+		if err := json.Unmarshal(ev.Data, &changed); err != nil {
+			slog.Error("Failed to decode combat event", "error", err, "id", ev.ID)
+			return ev, false
+		}
+		if changed == nil || changed.ID != session.ID {
+			return ev, false
+		}
+
+		data, err := json.Marshal(newPlayerSession(changed))
+		if err != nil {
+			slog.Error("Failed to encode player event", "error", err, "id", ev.ID)
+			return ev, false
+		}
+		return events.Event{ID: ev.ID, Type: ev.Type, Data: data}, true
+	}
+
+	s.streamCombat(w, r, session.EncounterID, reset, filter)
+}
+
+// loadPlayerSession resolves the combat session named by the player token
+// in the URL. It writes an error response and returns false if there is
+// none.
+func (s *Server) loadPlayerSession(w http.ResponseWriter, r *http.Request) (*db.CombatSession, bool) {
+	token := chi.URLParam(r, "token")
+
+	session, err := db.GetCombatSessionByPlayerToken(r.Context(), s.DB, token)
+	if err != nil {
+		slog.Error("Failed to get combat session by player token", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if session == nil {
+		http.Error(w, "Combat not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return session, true
+}
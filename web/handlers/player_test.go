@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/juthrbog/adversarytracker/db"
+	"github.com/juthrbog/adversarytracker/internal/combat"
+)
+
+func TestNewPlayerSession(t *testing.T) {
+	session := &db.CombatSession{
+		Status:    db.CombatActive,
+		Spotlight: db.SpotlightGM,
+		GMTurn:    2,
+		Combatants: []*db.Combatant{
+			{Name: "Fresh", HPMax: 6},
+			{Name: "Scratched", HPMax: 6, HPMarked: 2, Conditions: []*db.CombatantCondition{
+				{ID: 7, Name: "Vulnerable", Expires: db.ExpiresUntilCleared, Public: true},
+				{ID: 8, Name: "Hidden", Expires: db.ExpiresNextSpotlight, Public: true},
+				{ID: 9, Name: "Cursed by the hag", Expires: db.ExpiresEndOfScene, Public: true},
+				{ID: 10, Name: "Marked by the hag", Expires: db.ExpiresUntilCleared},
+			}},
+			{Name: "Bloodied", HPMax: 6, HPMarked: 3, Acted: true},
+			{Name: "Dying", HPMax: 6, HPMarked: 5},
+			{Name: "Down", HPMax: 6, HPMarked: 6},
+			{Name: "Minion", HPMax: 1, Countdowns: []*db.Countdown{
+				{Name: "Reinforcements", Value: 2, StartValue: 3, Public: true},
+				{Name: "Ambush", Value: 1, StartValue: 1},
+			}},
+		},
+		Countdowns: []*db.Countdown{
+			{Name: "Collapse", Purpose: db.CountdownConsequence, Value: 4, StartValue: 6, Public: true},
+			{Name: "Secret ritual", Value: 2, StartValue: 4},
+		},
+	}
+
+	ps := newPlayerSession(session)
+
+	if !ps.Active || !ps.IsGMTurn() || ps.GMTurn != 2 {
+		t.Errorf("player session is active %v, GM turn %v (%d); want active on GM turn 2", ps.Active, ps.IsGMTurn(), ps.GMTurn)
+	}
+
+	bands := []string{
+		combat.HealthUnhurt,
+		combat.HealthWounded,
+		combat.HealthBloodied,
+		combat.HealthNearDeath,
+		combat.HealthDefeated,
+		combat.HealthUnhurt,
+	}
+	for i, c := range ps.Combatants {
+		if c.Health != bands[i] {
+			t.Errorf("%s looks %s, want %s", c.Name, c.Health, bands[i])
+		}
+	}
+	// Only the conditions and custom effects the GM made public are shown,
+	// whatever their expiry
+	if got := ps.Combatants[1].Conditions; strings.Join(got, ",") != "Vulnerable,Hidden,Cursed by the hag" {
+		t.Errorf("conditions are %v, want [Vulnerable Hidden Cursed by the hag]", got)
+	}
+	if got := ps.Combatants[0].Conditions; got == nil || len(got) != 0 {
+		t.Errorf("conditions of a combatant without any are %#v, want an empty list", got)
+	}
+	if !ps.Combatants[2].Acted {
+		t.Error("the combatant that acted is not shown as having acted")
+	}
+
+	// Only the countdowns the GM made public are shown
+	if len(ps.Countdowns) != 1 || ps.Countdowns[0].Name != "Collapse" {
+		t.Errorf("session countdowns are %v, want only Collapse", ps.Countdowns)
+	}
+	if got := ps.Combatants[5].Countdowns; len(got) != 1 || got[0].Name != "Reinforcements" {
+		t.Errorf("combatant countdowns are %v, want only Reinforcements", got)
+	}
+
+	// Nothing the GM keeps hidden reaches the players
+	data, err := json.Marshal(ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hidden := range []string{"hp_marked", "hp_max", "difficulty", "threshold", "fear", "role", "Secret ritual", "Ambush", "Marked by the hag", "expires", "next_spotlight", `"id"`} {
+		if strings.Contains(string(data), hidden) {
+			t.Errorf("player session contains %q: %s", hidden, data)
+		}
+	}
+}
+
+// startPlayerFight starts combat in the forest on a combat test server and
+// returns its session
+func startPlayerFight(t *testing.T) (*httptest.Server, *Server, *db.CombatSession) {
+	t.Helper()
+
+	ts, s := startCombatTestServer(t)
+	postCombat(t, ts, "", "", nil)
+
+	session, err := db.GetActiveCombatSession(context.Background(), s.DB, forestID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session == nil || len(session.PlayerToken) != 32 {
+		t.Fatalf("started session has no player token: %+v", session)
+	}
+	return ts, s, session
+}
+
+func TestPlayerView(t *testing.T) {
+	ts, s, session := startPlayerFight(t)
+	bear := "/combatants/" + strconv.FormatInt(session.Combatants[0].ID, 10)
+
+	postCombat(t, ts, "", bear+"/damage", url.Values{"damage": {"20"}})
+	postCombat(t, ts, "", bear+"/conditions", url.Values{"name": {"Restrained"}, "public": {"1"}})
+	postCombat(t, ts, "", bear+"/conditions", url.Values{"name": {"Cursed by the hag"}})
+	postCombat(t, ts, "", "/countdowns", url.Values{"name": {"Collapse"}, "start": {"3"}, "public": {"1"}})
+	postCombat(t, ts, "", "/countdowns", url.Values{"name": {"Secret ritual"}, "start": {"4"}})
+
+	status, body := fetch(t, ts, "/play/"+session.PlayerToken+"/tracker", true)
+	if status != http.StatusOK {
+		t.Fatalf("player tracker status %d\n%s", status, body)
+	}
+	for _, want := range []string{`id="player-tracker"`, "Bear 1", "Bear 2", "Restrained", "Collapse: 3/3", "The players are up"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("player tracker does not contain %q", want)
+		}
+	}
+	for _, hidden := range []string{"Bruiser", "Secret ritual", "Cursed by the hag", "Fear", "hx-post"} {
+		if strings.Contains(body, hidden) {
+			t.Errorf("player tracker contains %q", hidden)
+		}
+	}
+
+	// The full page has no links into the GM's tracker
+	status, body = fetch(t, ts, "/play/"+session.PlayerToken, false)
+	if status != http.StatusOK || !strings.Contains(body, pageMarker) || !strings.Contains(body, `sse-connect="/play/`+session.PlayerToken+`/events"`) {
+		t.Errorf("player page: status %d\n%s", status, body)
+	}
+	if strings.Contains(body, `href="/encounters"`) {
+		t.Error("player page links to the encounters")
+	}
+
+	// Countdowns can be shown and hidden later
+	countdowns, err := db.GetCountdowns(context.Background(), s.DB, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range countdowns {
+		postCombat(t, ts, "", fmt.Sprintf("/countdowns/%d/public", c.ID), url.Values{"public": {strconv.FormatBool(!c.Public)}})
+	}
+	_, body = fetch(t, ts, "/play/"+session.PlayerToken+"/tracker", true)
+	if !strings.Contains(body, "Secret ritual") || strings.Contains(body, "Collapse") {
+		t.Error("toggling countdown visibility did not swap the countdowns shown")
+	}
+
+	// So can conditions
+	current, err := db.GetCombatSessionByID(context.Background(), s.DB, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range current.Combatants[0].Conditions {
+		postCombat(t, ts, "", fmt.Sprintf("%s/conditions/%d/public", bear, c.ID), url.Values{"public": {strconv.FormatBool(!c.Public)}})
+	}
+	_, body = fetch(t, ts, "/play/"+session.PlayerToken+"/tracker", true)
+	if !strings.Contains(body, "Cursed by the hag") || strings.Contains(body, "Restrained") {
+		t.Error("toggling condition visibility did not swap the conditions shown")
+	}
+
+	// After the fight, the link shows that it is over
+	postCombat(t, ts, "", "/end", nil)
+	if _, body := fetch(t, ts, "/play/"+session.PlayerToken+"/tracker", true); !strings.Contains(body, "The fight is over") {
+		t.Error("player view of an ended fight does not say it is over")
+	}
+}
+
+func TestPlayerEvents(t *testing.T) {
+	ts, _, session := startPlayerFight(t)
+	bear := "/combatants/" + strconv.FormatInt(session.Combatants[0].ID, 10)
+
+	players := openEventStream(t, ts, "/play/"+session.PlayerToken+"/events", "")
+	players.expect(t, "")
+
+	// Fear is the GM's business
+	postCombat(t, ts, "", "/fear/gain", nil)
+	players.expect(t, "")
+
+	postCombat(t, ts, "", bear+"/damage", url.Values{"damage": {"20"}})
+	ev := players.expect(t, CombatEventHP)
+	var ps playerSession
+	if err := json.Unmarshal([]byte(ev.Data), &ps); err != nil {
+		t.Fatal(err)
+	}
+	// Severe damage marks 3 of the bear's 7 HP
+	if ps.Combatants[0].Health != combat.HealthWounded {
+		t.Errorf("damaged bear looks %s, want %s", ps.Combatants[0].Health, combat.HealthWounded)
+	}
+	if strings.Contains(ev.Data, "hp_marked") || strings.Contains(ev.Data, "player_token") {
+		t.Errorf("player event carries GM data: %s", ev.Data)
+	}
+
+	// A later fight of the same encounter has its own player link
+	postCombat(t, ts, "", "/end", nil)
+	players.expect(t, CombatEventSession)
+	postCombat(t, ts, "", "", nil)
+	players.expect(t, "")
+
+	// A player reconnecting too late gets the fight as it stands
+	stale := openEventStream(t, ts, "/play/"+session.PlayerToken+"/events", "0-1")
+	reset := stale.expect(t, CombatEventReset)
+	if err := json.Unmarshal([]byte(reset.Data), &ps); err != nil {
+		t.Fatal(err)
+	}
+	if ps.Active {
+		t.Error("reset event shows the ended fight as active")
+	}
+}
+
+func TestPlayerViewErrors(t *testing.T) {
+	runRouteTests(t, func(s *Server) http.Handler { return s.PlayerRoutes() }, []routeTest{
+		{
+			name:   "unknown token",
+			method: http.MethodGet,
+			target: "/0123456789abcdef0123456789abcdef",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "unknown token tracker",
+			method: http.MethodGet,
+			target: "/nope/tracker",
+			htmx:   true,
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "unknown token events",
+			method: http.MethodGet,
+			target: "/nope/events",
+			status: http.StatusNotFound,
+		},
+	})
+}
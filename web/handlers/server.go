@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"database/sql"
+
+	"github.com/juthrbog/adversarytracker/db"
+	"github.com/juthrbog/adversarytracker/internal/events"
+)
+
+// Server holds what the handlers need to serve requests: the adversary and
+// encounter stores, the database that combat sessions are kept in, and the
+// hub that streams combat changes to every open tracker
+type Server struct {
+	Adversaries db.AdversaryStore
+	Encounters  db.EncounterStore
+
+	// DB is used directly by the combat, combat log, report and player view
+	// handlers, which have no store of their own
+	DB *sql.DB
+
+	Events *events.Hub
+}